@@ -0,0 +1,543 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"noema/internal/bundle"
+	"noema/internal/config"
+	"noema/internal/crypto"
+	"noema/internal/evaluate"
+	"noema/internal/zk"
+	"noema/internal/zk/aggregate"
+)
+
+const usage = `usage: noema <command> [flags]
+
+commands:
+  keygen                 generate the first key version for each policy gate circuit size
+  keys list              list key versions and their status
+  keys add               generate a new key version; new proofs use it after restart
+  keys retire <key_id>   make a key version verify-only
+  ceremony init          start a Groth16 phase-2 ceremony in -ceremony
+  ceremony contribute    add randomness: -in <newest phase2 file> -out <file>
+  ceremony verify [file] accept a contribution, or re-check the whole ceremony
+  ceremony finalize      seal the ceremony with -beacon and add its keys to -dir
+  open <run_id>          print the commitment opening of a stored run for an auditor
+  inclusion <run_id> <item_id>...
+                         print Merkle inclusion proofs for items of a stored run
+  reindex                rebuild the runs index from the stored runs
+  migrate-runs           copy the runs in -runs into the SQLite run store in -db
+  sample <opening.json> <dataset.json>
+                         print the items of a dataset a run's evaluator was sent,
+                         from the run's opening (noema open)
+  export-solidity        write the Solidity verifier contract for a key
+  calldata <file.noema>  print the verifyProof calldata for a bundle's proof
+  issuer keygen          generate the Ed25519 key attestations are signed with
+  issuer show            print the issuer document served at
+                         /.well-known/noema-issuer.json
+  aggregate setup        set up the keys POST /api/aggregate proves with, for
+                         -n proofs of -key (default: every size up to
+                         NOEMA_AGGREGATE_MAX)
+
+keygen and keys add set up keys for -system (groth16 or plonk, default
+NOEMA_PROOF_SYSTEM); plonk keys use the KZG SRS in -srs (default NOEMA_KZG_SRS)
+or a locally generated one.
+
+open, inclusion and reindex read the run store NOEMA_RUN_STORE names, or
+-store: fs keeps runs in -runs (default NOEMA_RUNS_DIR), sqlite in -db
+(default NOEMA_RUNS_DB).
+`
+
+func main() {
+	if err := config.Load(); err != nil {
+		log.Println("no .env loaded:", err)
+	}
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "keygen":
+		err = runKeygen(os.Args[2:])
+	case "keys":
+		err = runKeys(os.Args[2:])
+	case "ceremony":
+		err = runCeremony(os.Args[2:])
+	case "open":
+		err = runOpen(os.Args[2:])
+	case "inclusion":
+		err = runInclusion(os.Args[2:])
+	case "reindex":
+		err = runReindex(os.Args[2:])
+	case "migrate-runs":
+		err = runMigrateRuns(os.Args[2:])
+	case "sample":
+		err = runSample(os.Args[2:])
+	case "export-solidity":
+		err = runExportSolidity(os.Args[2:])
+	case "calldata":
+		err = runCalldata(os.Args[2:])
+	case "issuer":
+		err = runIssuer(os.Args[2:])
+	case "aggregate":
+		err = runAggregate(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", os.Args[1], err)
+	}
+}
+
+// backendFlags registers the flags that pick the proof system for new keys.
+func backendFlags(fs *flag.FlagSet) func() error {
+	system := fs.String("system", config.ProofSystem(), "proof system for new keys (groth16 or plonk)")
+	srs := fs.String("srs", config.KZGSRSFile(), "KZG SRS file for plonk keys (default: generate one locally)")
+	return func() error {
+		return zk.SetBackend(zk.Backend{System: *system, SRSFile: *srs})
+	}
+}
+
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	dir := fs.String("dir", config.KeysDir(), "key directory")
+	setBackend := backendFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := setBackend(); err != nil {
+		return err
+	}
+	infos, err := zk.GenerateKeys(*dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		fmt.Printf("wrote %s keys %s to %s\n", info.System, info.KeyID, *dir)
+		fmt.Printf("vk fingerprint: %s\n", info.VKFingerprint)
+	}
+	return nil
+}
+
+func runKeys(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing subcommand (list, add, retire)")
+	}
+	fs := flag.NewFlagSet("keys "+args[0], flag.ExitOnError)
+	dir := fs.String("dir", config.KeysDir(), "key directory")
+	var setBackend func() error
+	if args[0] == "add" {
+		setBackend = backendFlags(fs)
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if setBackend != nil {
+		if err := setBackend(); err != nil {
+			return err
+		}
+	}
+	switch args[0] {
+	case "list":
+		keys, err := zk.ListKeys(*dir)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			fmt.Printf("no keys in %s\n", *dir)
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY ID\tSYSTEM\tSTATUS\tCREATED\tVK FINGERPRINT")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", k.KeyID, k.System, k.Status, k.CreatedAt, k.VKFingerprint)
+		}
+		return w.Flush()
+	case "add":
+		infos, err := zk.AddKeyVersion(*dir)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			fmt.Printf("added %s %s (vk fingerprint %s)\n", info.System, info.KeyID, info.VKFingerprint)
+		}
+		fmt.Println("restart the server to start proving with it")
+		return nil
+	case "retire":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: noema keys retire [-dir dir] <key_id>")
+		}
+		info, err := zk.RetireKey(*dir, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("retired %s; proofs made with it still verify\n", info.KeyID)
+		return nil
+	default:
+		return fmt.Errorf("unknown subcommand %q", args[0])
+	}
+}
+
+func runCeremony(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing subcommand (init, contribute, verify, finalize)")
+	}
+	fs := flag.NewFlagSet("ceremony "+args[0], flag.ExitOnError)
+	dir := fs.String("ceremony", "ceremony", "ceremony directory")
+	switch args[0] {
+	case "init":
+		circuitID := fs.String("circuit", "", "circuit ID (default: the smallest policy gate circuit)")
+		phase1 := fs.String("phase1", "", "phase-1 parameters from a powers-of-tau ceremony (default: generate locally, development only)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		t, err := zk.InitCeremony(*dir, *circuitID, *phase1)
+		if err != nil {
+			return err
+		}
+		if t.Phase1Local {
+			fmt.Println("warning: phase 1 was generated locally; use -phase1 for production keys")
+		}
+		fmt.Printf("started ceremony for %s in %s\n", t.CircuitID, *dir)
+		fmt.Printf("first contributor builds on %s\n", filepath.Join(*dir, t.Last().File))
+		return nil
+	case "contribute":
+		in := fs.String("in", "", "newest phase-2 parameters from the coordinator")
+		out := fs.String("out", "contribution.bin", "where to write the contribution")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *in == "" {
+			return fmt.Errorf("usage: noema ceremony contribute -in <phase2 file> [-out file]")
+		}
+		sum, err := zk.ContributeCeremony(*in, *out)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s (sha256 %s); send it to the coordinator\n", *out, sum)
+		return nil
+	case "verify":
+		name := fs.String("name", "", "contributor name recorded in the transcript")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		switch fs.NArg() {
+		case 0:
+			t, err := zk.VerifyCeremony(*dir)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("ceremony for %s is valid: %d contributions\n", t.CircuitID, len(t.Contributions)-1)
+			if t.Final != nil {
+				fmt.Printf("sealed with beacon %s into %s (vk fingerprint %s)\n", t.Final.Beacon, t.Final.KeyID, t.Final.VKFingerprint)
+			}
+			return nil
+		case 1:
+			c, err := zk.AcceptContribution(*dir, fs.Arg(0), *name)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("accepted contribution %d (sha256 %s)\n", c.Index, c.SHA256)
+			fmt.Printf("next contributor builds on %s\n", filepath.Join(*dir, c.File))
+			return nil
+		default:
+			return fmt.Errorf("usage: noema ceremony verify [-ceremony dir] [-name name] [contribution file]")
+		}
+	case "finalize":
+		keysDir := fs.String("dir", config.KeysDir(), "key directory")
+		beacon := fs.String("beacon", "", "public random beacon in hex, published after the last contribution")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		b, err := hex.DecodeString(*beacon)
+		if err != nil || len(b) == 0 {
+			return fmt.Errorf("-beacon must be non-empty hex")
+		}
+		info, err := zk.FinalizeCeremony(*dir, *keysDir, b)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("added %s %s to %s (vk fingerprint %s)\n", info.System, info.KeyID, *keysDir, info.VKFingerprint)
+		fmt.Println("restart the server to start proving with it")
+		return nil
+	default:
+		return fmt.Errorf("unknown subcommand %q", args[0])
+	}
+}
+
+func runIssuer(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing subcommand (keygen, show)")
+	}
+	fs := flag.NewFlagSet("issuer "+args[0], flag.ExitOnError)
+	keyFile := fs.String("key", config.IssuerKeyFile(), "issuer key file")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	var issuer *crypto.Issuer
+	var err error
+	switch args[0] {
+	case "keygen":
+		issuer, err = crypto.GenerateIssuer(*keyFile)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "wrote issuer key %s to %s\n", issuer.KeyID(), *keyFile)
+	case "show":
+		issuer, err = crypto.LoadIssuer(*keyFile)
+		if err != nil {
+			return fmt.Errorf("%s: %w", *keyFile, err)
+		}
+	default:
+		return fmt.Errorf("unknown subcommand %q", args[0])
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(issuer.Document())
+}
+
+func runAggregate(args []string) error {
+	if len(args) == 0 || args[0] != "setup" {
+		return fmt.Errorf("missing subcommand (setup)")
+	}
+	fs := flag.NewFlagSet("aggregate setup", flag.ExitOnError)
+	dir := fs.String("dir", config.KeysDir(), "key directory")
+	keyID := fs.String("key", "", "key ID of the proofs to aggregate (default: the active key for the smallest circuit)")
+	n := fs.Int("n", 0, "number of proofs per aggregate (default: every size up to NOEMA_AGGREGATE_MAX)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if err := loadKeys(*dir); err != nil {
+		return err
+	}
+	child, err := zk.RecursionKey(*keyID)
+	if err != nil {
+		return err
+	}
+	agg := aggregate.New(filepath.Join(*dir, "aggregate"), config.AggregateMax())
+	sizes := []int{*n}
+	if *n == 0 {
+		sizes = nil
+		for size := aggregate.MinChildren; size <= agg.MaxChildren(); size++ {
+			sizes = append(sizes, size)
+		}
+	}
+	for _, size := range sizes {
+		m, created, err := agg.Setup(child, size)
+		if err != nil {
+			return err
+		}
+		if created {
+			fmt.Fprintf(os.Stderr, "set up %s for %s (%d constraints, vk %s)\n", m.CircuitID, m.ChildKeyID, m.Constraints, m.VKFingerprint)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s for %s is already set up\n", m.CircuitID, m.ChildKeyID)
+		}
+	}
+	return nil
+}
+
+// runStoreFlags adds the flags choosing a run store to fs and returns a
+// function opening the store they name once fs is parsed.
+func runStoreFlags(fs *flag.FlagSet) func() (evaluate.RunStore, error) {
+	kind := fs.String("store", config.RunStore(), "run store: fs or sqlite")
+	runsDir := fs.String("runs", config.RunsDir(), "runs directory of the fs store")
+	db := fs.String("db", config.RunsDB(), "database of the sqlite store")
+	return func() (evaluate.RunStore, error) {
+		return evaluate.OpenRunStore(*kind, *runsDir, *db)
+	}
+}
+
+func runOpen(args []string) error {
+	fs := flag.NewFlagSet("open", flag.ExitOnError)
+	openStore := runStoreFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: noema open [-store fs|sqlite] [-runs dir] [-db file] <run_id>")
+	}
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	resp, err := evaluate.LoadOpeningResponse(store, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(resp)
+}
+
+func runInclusion(args []string) error {
+	fs := flag.NewFlagSet("inclusion", flag.ExitOnError)
+	openStore := runStoreFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return fmt.Errorf("usage: noema inclusion [-store fs|sqlite] [-runs dir] [-db file] <run_id> <item_id>...")
+	}
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	resp, err := evaluate.InclusionProofs(store, fs.Arg(0), fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(resp)
+}
+
+func runReindex(args []string) error {
+	fs := flag.NewFlagSet("reindex", flag.ExitOnError)
+	openStore := runStoreFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if err := store.Reindex(); err != nil {
+		return err
+	}
+	list, err := evaluate.ListRuns(store, evaluate.RunFilter{}, 1, 0)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("indexed %d runs\n", list.Total)
+	return nil
+}
+
+func runMigrateRuns(args []string) error {
+	fs := flag.NewFlagSet("migrate-runs", flag.ExitOnError)
+	runsDir := fs.String("runs", config.RunsDir(), "runs directory to migrate from")
+	db := fs.String("db", config.RunsDB(), "SQLite database to migrate to")
+	deleteSource := fs.Bool("delete", false, "remove each run from -runs once it is copied")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	dst, err := evaluate.OpenSQLiteRunStore(*db)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	stats, err := evaluate.MigrateRuns(evaluate.NewFSRunStore(*runsDir), dst, *deleteSource)
+	fmt.Fprintf(os.Stderr, "copied %d runs from %s to %s (%d already there, %d deleted)\n", stats.Copied, *runsDir, *db, stats.Skipped, stats.Deleted)
+	return err
+}
+
+func runSample(args []string) error {
+	fs := flag.NewFlagSet("sample", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: noema sample <opening.json> <dataset.json>")
+	}
+	var resp evaluate.OpeningResponse
+	raw, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return fmt.Errorf("parse opening: %w", err)
+	}
+	dataset, err := os.ReadFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	items, err := evaluate.SampledItems(dataset, resp.DatasetDigestAlg, resp.DatasetSalt, resp.Opening)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(os.Stdout, "%s\n", items)
+	return err
+}
+
+// loadKeys makes the keys in dir available without creating any, so the
+// export commands never invent a key nobody proves with.
+func loadKeys(dir string) error {
+	keys, err := zk.ListKeys(dir)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no keys in %s; run noema keygen first", dir)
+	}
+	return zk.Init(dir)
+}
+
+func runExportSolidity(args []string) error {
+	fs := flag.NewFlagSet("export-solidity", flag.ExitOnError)
+	dir := fs.String("dir", config.KeysDir(), "key directory")
+	keyID := fs.String("key", "", "key ID (default: the active key for the smallest circuit)")
+	out := fs.String("o", "", "output file (default: stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := loadKeys(*dir); err != nil {
+		return err
+	}
+	v, err := zk.ExportSolidity(*keyID)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err := os.Stdout.Write(v.Source)
+		return err
+	}
+	if err := os.WriteFile(*out, v.Source, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote verifier for %s (vk fingerprint %s) to %s\n", v.KeyID, v.Fingerprint, *out)
+	return nil
+}
+
+func runCalldata(args []string) error {
+	fs := flag.NewFlagSet("calldata", flag.ExitOnError)
+	dir := fs.String("dir", config.KeysDir(), "key directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: noema calldata [-dir dir] <file.noema>")
+	}
+	raw, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := bundle.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if err := loadKeys(*dir); err != nil {
+		return err
+	}
+	cd, err := zk.EncodeCalldata(b.Proof.ProofB64, b.Proof.PublicInputsB64)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("key: %s\n", cd.KeyID)
+	fmt.Printf("function: %s\n", cd.Signature())
+	fmt.Printf("calldata: %s\n", cd.ABIHex())
+	return nil
+}
@@ -3,17 +3,22 @@ package main
 import (
 	"context"
 	"crypto/subtle"
+	"errors"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"noema/internal/auth"
 	"noema/internal/config"
+	"noema/internal/crypto"
 	"noema/internal/evaluate"
 	"noema/internal/gemini"
 	"noema/internal/session"
 	"noema/internal/verify"
 	"noema/internal/web"
+	"noema/internal/zk"
+	"noema/internal/zk/aggregate"
 
 	"github.com/gin-gonic/gin"
 )
@@ -51,6 +56,38 @@ func main() {
 	}
 	ensureDir(config.UploadsDir())
 	ensureDir(config.RunsDir())
+	if err := zk.SetBackend(zk.Backend{System: config.ProofSystem(), SRSFile: config.KZGSRSFile()}); err != nil {
+		log.Fatalf("invalid proof system: %v", err)
+	}
+	if err := zk.Init(config.KeysDir()); err != nil {
+		log.Fatalf("failed to load zk keys from %s: %v", config.KeysDir(), err)
+	}
+
+	issuer, err := crypto.LoadIssuer(config.IssuerKeyFile())
+	if errors.Is(err, crypto.ErrNoIssuerKey) {
+		log.Printf("warning: no issuer key at %s; attestations will be unsigned (run noema issuer keygen)", config.IssuerKeyFile())
+	} else if err != nil {
+		log.Fatalf("failed to load issuer key: %v", err)
+	}
+
+	store, err := evaluate.OpenRunStore(config.RunStore(), config.RunsDir(), config.RunsDB())
+	if err != nil {
+		log.Fatalf("failed to open run store: %v", err)
+	}
+	defer store.Close()
+	// Runs written by an older version, or copied in by hand, are listed
+	// once the index is rebuilt from their manifests.
+	if err := store.Reindex(); err != nil {
+		log.Printf("warning: failed to rebuild runs index: %v", err)
+	}
+	// Gemini outputs are cached on disk whichever store keeps the runs.
+	cacheDir := filepath.Join(config.RunsDir(), "cache")
+	// Aggregation keys are set up ahead of time by noema aggregate setup.
+	aggregator := aggregate.New(filepath.Join(config.KeysDir(), "aggregate"), config.AggregateMax())
+	jobs := evaluate.NewJobs(store, cacheDir, config.RunsMax(), issuer, aggregator, config.JobWorkers(), config.JobQueueSize())
+	if err := jobs.Start(context.Background()); err != nil {
+		log.Fatalf("failed to resume jobs: %v", err)
+	}
 
 	// Paths relative to working directory — run from backend/
 	r := gin.Default()
@@ -58,7 +95,7 @@ func main() {
 	r.LoadHTMLGlob("web/templates/*")
 	r.Static("/static", "web/static")
 
-	// ----- Public JSON API (unchanged) -----
+	// ----- Health checks -----
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
@@ -112,13 +149,30 @@ func main() {
 	apiCookie := r.Group("/api")
 	apiCookie.Use(auth.CookieAuth())
 	{
-		apiCookie.POST("/evaluate", evaluate.Handler(config.RunsDir(), config.RunsMax()))
+		apiCookie.POST("/evaluate", evaluate.Handler(store, cacheDir, config.RunsMax(), issuer, jobs))
+		apiCookie.GET("/jobs/:id", evaluate.JobHandler(store))
+		apiCookie.GET("/jobs/:id/events", evaluate.JobEventsHandler(jobs))
+		apiCookie.GET("/runs", evaluate.RunsHandler(store))
+		apiCookie.GET("/runs/:id", evaluate.RunHandler(store))
+		apiCookie.PATCH("/runs/:id", evaluate.RunPatchHandler(store))
+		apiCookie.GET("/runs/:id/opening", evaluate.OpeningHandler(store))
+		apiCookie.GET("/runs/:id/bundle", evaluate.BundleHandler(store))
+		apiCookie.GET("/runs/:id/inclusion", evaluate.InclusionHandler(store))
+		apiCookie.POST("/aggregate", evaluate.AggregateHandler(store, aggregator, jobs))
 	}
 
 	// ----- Public verify API -----
 	r.POST("/api/verify", verify.Handler())
+	r.POST("/api/verify/bundle", verify.BundleHandler(issuer))
+	r.POST("/api/verify/batch", verify.BatchHandler(issuer))
+	r.GET("/api/vk", verify.VKHandler())
+	r.GET("/api/vk/solidity", verify.SolidityHandler())
+	r.POST("/api/commitment/open", verify.OpenHandler())
+	r.POST("/api/dataset/inclusion/verify", verify.InclusionHandler())
+	r.GET("/api/public/runs/:id", evaluate.PublicRunHandler(store))
+	r.GET("/.well-known/noema-issuer.json", verify.IssuerHandler(issuer))
 
-	// ----- API gated by JudgeKey (X-Judge-Key or judge_key query) — unchanged -----
+	// ----- API gated by JudgeKey (X-Judge-Key or judge_key query) -----
 	apiGated := r.Group("/")
 	apiGated.Use(auth.JudgeKey())
 	{
@@ -0,0 +1,218 @@
+// Package bundle reads and writes .noema proof bundles: a single JSON file
+// carrying a proof, its public inputs, the key it verifies against and the
+// run it came from, so a proof can travel without the server that made it.
+package bundle
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"noema/internal/crypto"
+	"noema/internal/zk"
+)
+
+const (
+	// Format identifies bundle files.
+	Format = "noema_bundle"
+	// Version is the bundle layout this package writes. Bump it when a
+	// field changes meaning; adding optional fields doesn't need a bump.
+	Version = 1
+	// FileExtension is the extension bundles are downloaded with.
+	FileExtension = ".noema"
+	// MediaType is the Content-Type bundles are served with.
+	MediaType = "application/vnd.noema.bundle+json"
+)
+
+// Bundle is a portable proof. Everything in it is public.
+type Bundle struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Proof   Proof  `json:"proof"`
+	Run     Run    `json:"run"`
+	// Signature is the issuer's signature over the bundle, if the issuing
+	// server has an issuer key.
+	Signature *Signature `json:"signature,omitempty"`
+}
+
+// Proof is a proof with the key metadata needed to verify it.
+type Proof struct {
+	System          string `json:"system"`
+	Curve           string `json:"curve"`
+	CircuitID       string `json:"circuit_id"`
+	KeyID           string `json:"key_id"`
+	VKFingerprint   string `json:"vk_fingerprint"`
+	ProofB64        string `json:"proof_b64"`
+	PublicInputsB64 string `json:"public_inputs_b64"`
+}
+
+// Run describes the evaluation run a proof was made for.
+type Run struct {
+	RunID          string `json:"run_id"`
+	CreatedAt      string `json:"created_at"`
+	EvaluationName string `json:"evaluation_name,omitempty"`
+	PolicyVersion  string `json:"policy_version"`
+	Status         string `json:"status"`
+	// DatasetDigestAlg is how the dataset digest the commitment binds was
+	// computed, such as "jcs_sha256" or the legacy raw "sha256". Bundles
+	// issued before it was recorded leave it out.
+	DatasetDigestAlg string `json:"dataset_digest_alg,omitempty"`
+	// PublicOutput repeats what the public inputs disclose, for readers that
+	// don't decode them. Verify checks that the two agree.
+	PublicOutput zk.DisclosedOutputs `json:"public_output"`
+}
+
+// Signature is a detached issuer signature over the bundle's Attestation.
+type Signature = crypto.Signature
+
+// Attestation returns the statement a bundle's signature covers.
+func Attestation(b Bundle) crypto.Attestation {
+	return crypto.Attestation{
+		Format:           crypto.AttestationFormat,
+		Version:          crypto.AttestationVersion,
+		RunID:            b.Run.RunID,
+		Commitment:       b.Run.PublicOutput.Commitment,
+		PublicInputsB64:  b.Proof.PublicInputsB64,
+		VKFingerprint:    b.Proof.VKFingerprint,
+		DatasetDigestAlg: b.Run.DatasetDigestAlg,
+		IssuedAt:         b.Run.CreatedAt,
+	}
+}
+
+// Sign signs b's attestation with issuer and attaches the signature.
+func Sign(b *Bundle, issuer *crypto.Issuer) error {
+	sig, err := issuer.Sign(Attestation(*b))
+	if err != nil {
+		return err
+	}
+	b.Signature = &sig
+	return nil
+}
+
+// VerifySignature checks that b carries pub's signature over its
+// attestation. It does not verify the proof.
+func VerifySignature(b Bundle, pub ed25519.PublicKey) error {
+	if b.Signature == nil {
+		return fmt.Errorf("bundle is not signed")
+	}
+	return crypto.Verify(pub, Attestation(b), *b.Signature)
+}
+
+// FromProof builds a bundle for proof.
+func FromProof(proof zk.Proof, run Run) Bundle {
+	return Bundle{
+		Format:  Format,
+		Version: Version,
+		Proof: Proof{
+			System:          proof.System,
+			Curve:           proof.Curve,
+			CircuitID:       proof.CircuitID,
+			KeyID:           proof.KeyID,
+			VKFingerprint:   proof.VKFingerprint,
+			ProofB64:        proof.ProofB64,
+			PublicInputsB64: proof.PublicInputsB64,
+		},
+		Run: run,
+	}
+}
+
+// Marshal encodes b as an indented bundle file.
+func Marshal(b Bundle) ([]byte, error) {
+	out, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// Parse decodes a bundle file and checks that it is one this version can
+// read. It does not verify the proof.
+func Parse(raw []byte) (Bundle, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	var b Bundle
+	if err := dec.Decode(&b); err != nil {
+		return Bundle{}, fmt.Errorf("invalid bundle JSON")
+	}
+	if dec.More() {
+		return Bundle{}, fmt.Errorf("invalid bundle JSON")
+	}
+	if b.Format != Format {
+		return Bundle{}, fmt.Errorf("not a noema bundle")
+	}
+	if b.Version < 1 || b.Version > Version {
+		return Bundle{}, fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	if b.Proof.ProofB64 == "" || b.Proof.PublicInputsB64 == "" {
+		return Bundle{}, fmt.Errorf("bundle is missing its proof or public inputs")
+	}
+	return b, nil
+}
+
+// Result is the outcome of verifying a bundle.
+type Result struct {
+	Verified bool
+	Message  string
+	// Outputs is what the bundle's public inputs disclose.
+	Outputs zk.DisclosedOutputs
+}
+
+// UnauthenticatedRunFields are the Run fields neither the proof nor the
+// issuer's signature covers: Verify can't tell whether they were edited.
+var UnauthenticatedRunFields = []string{"evaluation_name", "policy_version"}
+
+// SignedRunFields are the Run fields only the issuer's signature covers.
+var SignedRunFields = []string{"run_id", "created_at", "dataset_digest_alg"}
+
+// Verify checks the bundle's proof and that its metadata describes the
+// proof it carries. A bundle whose status or public_output was edited after
+// issuing fails even if the proof itself is valid. The other Run fields
+// aren't bound to the proof; see UnauthenticatedRunFields and
+// SignedRunFields.
+func Verify(b Bundle) (Result, error) {
+	pi, err := zk.DecodePublicInputsB64(b.Proof.PublicInputsB64)
+	if err != nil {
+		return Result{Message: "invalid public inputs"}, nil
+	}
+	res := Result{Outputs: pi.Outputs()}
+	if msg := checkMetadata(b, pi, res.Outputs); msg != "" {
+		res.Message = msg
+		return res, nil
+	}
+	verified, msg, err := zk.VerifyProof(b.Proof.ProofB64, b.Proof.PublicInputsB64)
+	if err != nil {
+		return Result{Message: msg}, err
+	}
+	res.Verified = verified
+	res.Message = msg
+	return res, nil
+}
+
+func checkMetadata(b Bundle, pi zk.PublicInputs, outputs zk.DisclosedOutputs) string {
+	if pi.KeyID != "" && pi.KeyID != b.Proof.KeyID {
+		return "bundle key_id does not match public inputs"
+	}
+	if pi.VKFingerprint != "" && pi.VKFingerprint != b.Proof.VKFingerprint {
+		return "bundle vk_fingerprint does not match public inputs"
+	}
+	if key, err := zk.KeyForPublicInputs(b.Proof.PublicInputsB64); err == nil && key.CircuitID != b.Proof.CircuitID {
+		return "bundle circuit_id does not match its key"
+	} else if err == nil && key.System != b.Proof.System {
+		return "bundle system does not match its key"
+	}
+	if !reflect.DeepEqual(b.Run.PublicOutput, outputs) {
+		return "bundle public_output does not match public inputs"
+	}
+	if want := statusFor(pi.OverallPass); b.Run.Status != want {
+		return "bundle status does not match public inputs"
+	}
+	return ""
+}
+
+func statusFor(pass bool) string {
+	if pass {
+		return "PASS"
+	}
+	return "FAIL"
+}
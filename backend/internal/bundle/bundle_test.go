@@ -0,0 +1,119 @@
+package bundle
+
+import (
+	"strings"
+	"testing"
+
+	"noema/internal/zk"
+)
+
+func testBundle(t *testing.T) Bundle {
+	t.Helper()
+	salt, err := zk.NewCommitmentSalt()
+	if err != nil {
+		t.Fatalf("NewCommitmentSalt error: %v", err)
+	}
+	witness := &zk.WitnessInputs{
+		Salt:             salt,
+		DatasetDigestHex: "00112233445566778899aabbccddeeffffeeddccbbaa99887766554433221100",
+		ConstraintIDs:    []string{"pii_exposure_risk"},
+		Enabled:          []uint64{1},
+		MaxAllowed:       []uint64{1},
+		Severity:         []uint64{2},
+		Provenance:       &zk.Provenance{Kind: zk.EvaluatorGemini, Model: "gemini-2.5-flash", PromptVersion: "noema-eval-v2", ResponseHash: zk.ResponseHash([]byte("{}"))},
+	}
+	commitment, err := zk.CommitmentPoseidon(witness)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	policyHash, err := zk.PolicyHashPoseidon(witness)
+	if err != nil {
+		t.Fatalf("PolicyHashPoseidon error: %v", err)
+	}
+	proof, err := zk.GenerateProof(zk.PublicInputs{
+		PolicyThreshold: 1,
+		MaxSeverity:     2,
+		OverallPass:     false,
+		Commitment:      commitment,
+		PolicyHash:      policyHash,
+		HideMaxSeverity: true,
+		Witness:         witness,
+	})
+	if err != nil {
+		t.Fatalf("GenerateProof error: %v", err)
+	}
+	pi, err := zk.DecodePublicInputsB64(proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("DecodePublicInputsB64 error: %v", err)
+	}
+	return FromProof(proof, Run{
+		RunID:         "run_1_1",
+		CreatedAt:     "2026-01-02T03:04:05Z",
+		PolicyVersion: "noema_policy_v1",
+		Status:        "FAIL",
+		PublicOutput:  pi.Outputs(),
+	})
+}
+
+func TestBundleRoundTripVerifies(t *testing.T) {
+	raw, err := Marshal(testBundle(t))
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	b, err := Parse(raw)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	res, err := Verify(b)
+	if err != nil {
+		t.Fatalf("Verify error: %v", err)
+	}
+	if !res.Verified {
+		t.Fatalf("expected bundle to verify: %s", res.Message)
+	}
+	if res.Outputs.MaxSeverity != nil {
+		t.Fatalf("expected max severity to stay hidden")
+	}
+}
+
+func TestVerifyRejectsEditedMetadata(t *testing.T) {
+	valid := testBundle(t)
+	cases := []struct {
+		name string
+		edit func(*Bundle)
+		want string
+	}{
+		{"status", func(b *Bundle) { b.Run.Status = "PASS" }, "status"},
+		{"public output", func(b *Bundle) { b.Run.PublicOutput.OverallPass = true }, "public_output"},
+		{"key id", func(b *Bundle) { b.Proof.KeyID = "noema_policy_gate_v6_n8.k9" }, "key_id"},
+		{"vk fingerprint", func(b *Bundle) { b.Proof.VKFingerprint = strings.Repeat("0", 64) }, "vk_fingerprint"},
+		{"circuit id", func(b *Bundle) { b.Proof.CircuitID = "noema_policy_gate_v1" }, "circuit_id"},
+	}
+	for _, tc := range cases {
+		b := valid
+		b.Run.PublicOutput.Disclosed = append([]string(nil), valid.Run.PublicOutput.Disclosed...)
+		tc.edit(&b)
+		res, err := Verify(b)
+		if err != nil {
+			t.Fatalf("%s: Verify error: %v", tc.name, err)
+		}
+		if res.Verified || !strings.Contains(res.Message, tc.want) {
+			t.Fatalf("%s: expected rejection mentioning %q, got %+v", tc.name, tc.want, res)
+		}
+	}
+}
+
+func TestParseRejectsInvalidBundles(t *testing.T) {
+	cases := map[string]string{
+		"not json":        `proof`,
+		"wrong format":    `{"format":"other","version":1,"proof":{"proof_b64":"a","public_inputs_b64":"b"}}`,
+		"future version":  `{"format":"noema_bundle","version":2,"proof":{"proof_b64":"a","public_inputs_b64":"b"}}`,
+		"missing proof":   `{"format":"noema_bundle","version":1,"proof":{"public_inputs_b64":"b"}}`,
+		"trailing values": `{"format":"noema_bundle","version":1,"proof":{"proof_b64":"a","public_inputs_b64":"b"}} {}`,
+	}
+	for name, raw := range cases {
+		if _, err := Parse([]byte(raw)); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
 
 	"github.com/joho/godotenv"
@@ -56,6 +57,57 @@ func RunsDir() string {
 	return "data/runs"
 }
 
+// RunStore returns where evaluation runs are kept (NOEMA_RUN_STORE): "fs"
+// (default) for a directory per run in RunsDir, or "sqlite" for the RunsDB
+// database.
+func RunStore() string {
+	if v := os.Getenv("NOEMA_RUN_STORE"); v != "" {
+		return v
+	}
+	return "fs"
+}
+
+// RunsDB returns the SQLite database the sqlite run store uses
+// (NOEMA_RUNS_DB).
+func RunsDB() string {
+	if v := os.Getenv("NOEMA_RUNS_DB"); v != "" {
+		return v
+	}
+	return "data/runs.db"
+}
+
+// KeysDir returns the directory holding the persisted proving and verifying keys.
+func KeysDir() string {
+	if v := os.Getenv("NOEMA_KEYS_DIR"); v != "" {
+		return v
+	}
+	return "data/keys"
+}
+
+// IssuerKeyFile returns the Ed25519 key attestations are signed with
+// (NOEMA_ISSUER_KEY), by default issuer.pem in the keys directory.
+func IssuerKeyFile() string {
+	if v := os.Getenv("NOEMA_ISSUER_KEY"); v != "" {
+		return v
+	}
+	return filepath.Join(KeysDir(), "issuer.pem")
+}
+
+// ProofSystem returns the proof system new keys are set up for
+// (NOEMA_PROOF_SYSTEM): "groth16" (default) or "plonk".
+func ProofSystem() string {
+	if v := os.Getenv("NOEMA_PROOF_SYSTEM"); v != "" {
+		return v
+	}
+	return "groth16"
+}
+
+// KZGSRSFile returns the KZG SRS file PLONK keys are set up with
+// (NOEMA_KZG_SRS). Empty means a locally generated SRS.
+func KZGSRSFile() string {
+	return os.Getenv("NOEMA_KZG_SRS")
+}
+
 // SampleItemsLimit returns the max number of dataset items sent to Gemini.
 func SampleItemsLimit() int {
 	if v := os.Getenv("NOEMA_SAMPLE_ITEMS"); v != "" {
@@ -66,16 +118,6 @@ func SampleItemsLimit() int {
 	return 100
 }
 
-// RunsIndexLimit returns the max number of runs kept in index.json.
-func RunsIndexLimit() int {
-	if v := os.Getenv("NOEMA_RUNS_INDEX_LIMIT"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			return n
-		}
-	}
-	return 50
-}
-
 // RunsMax returns the maximum number of run artifacts to retain.
 // If unset or invalid, defaults to 50. Set to 0 to disable pruning.
 func RunsMax() int {
@@ -86,3 +128,37 @@ func RunsMax() int {
 	}
 	return 50
 }
+
+// JobWorkers returns how many asynchronous evaluation jobs run at once
+// (NOEMA_JOB_WORKERS, default 2).
+func JobWorkers() int {
+	if v := os.Getenv("NOEMA_JOB_WORKERS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 2
+}
+
+// JobQueueSize returns how many asynchronous evaluation jobs may wait for
+// a worker (NOEMA_JOB_QUEUE, default 32). Submissions beyond it are refused.
+func JobQueueSize() int {
+	if v := os.Getenv("NOEMA_JOB_QUEUE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 32
+}
+
+// AggregateMax returns the most runs one aggregate proof may cover
+// (NOEMA_AGGREGATE_MAX). Each run adds about a million constraints to the
+// aggregation circuit, so the default is 4.
+func AggregateMax() int {
+	if v := os.Getenv("NOEMA_AGGREGATE_MAX"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 2 {
+			return n
+		}
+	}
+	return 4
+}
@@ -29,28 +29,6 @@ func TestSampleItemsLimit(t *testing.T) {
 	}
 }
 
-func TestRunsIndexLimit(t *testing.T) {
-	t.Setenv("NOEMA_RUNS_INDEX_LIMIT", "")
-	if got := RunsIndexLimit(); got != 50 {
-		t.Fatalf("expected default 50, got %d", got)
-	}
-
-	t.Setenv("NOEMA_RUNS_INDEX_LIMIT", "12")
-	if got := RunsIndexLimit(); got != 12 {
-		t.Fatalf("expected 12, got %d", got)
-	}
-
-	t.Setenv("NOEMA_RUNS_INDEX_LIMIT", "0")
-	if got := RunsIndexLimit(); got != 50 {
-		t.Fatalf("expected default 50 for 0, got %d", got)
-	}
-
-	t.Setenv("NOEMA_RUNS_INDEX_LIMIT", "-1")
-	if got := RunsIndexLimit(); got != 50 {
-		t.Fatalf("expected default 50 for negative, got %d", got)
-	}
-}
-
 func TestRunsMax(t *testing.T) {
 	t.Setenv("NOEMA_RUNS_MAX", "")
 	if got := RunsMax(); got != 50 {
@@ -77,3 +55,171 @@ func TestRunsMax(t *testing.T) {
 		t.Fatalf("expected default 50 for invalid, got %d", got)
 	}
 }
+
+func TestKeysDir(t *testing.T) {
+	cases := []struct {
+		env  string
+		want string
+	}{
+		{"", "data/keys"},
+		{"/srv/noema/keys", "/srv/noema/keys"},
+		{"keys", "keys"},
+	}
+	for _, tc := range cases {
+		t.Setenv("NOEMA_KEYS_DIR", tc.env)
+		if got := KeysDir(); got != tc.want {
+			t.Fatalf("NOEMA_KEYS_DIR=%q: expected %q, got %q", tc.env, tc.want, got)
+		}
+	}
+}
+
+func TestProofSystem(t *testing.T) {
+	cases := []struct {
+		env  string
+		want string
+	}{
+		{"", "groth16"},
+		{"groth16", "groth16"},
+		{"plonk", "plonk"},
+		// Unknown systems are passed on for zk.SetBackend to reject, rather
+		// than quietly replaced by the default.
+		{"stark", "stark"},
+	}
+	for _, tc := range cases {
+		t.Setenv("NOEMA_PROOF_SYSTEM", tc.env)
+		if got := ProofSystem(); got != tc.want {
+			t.Fatalf("NOEMA_PROOF_SYSTEM=%q: expected %q, got %q", tc.env, tc.want, got)
+		}
+	}
+}
+
+func TestKZGSRSFile(t *testing.T) {
+	cases := []struct {
+		env  string
+		want string
+	}{
+		{"", ""},
+		{"/srv/noema/bn254.srs", "/srv/noema/bn254.srs"},
+	}
+	for _, tc := range cases {
+		t.Setenv("NOEMA_KZG_SRS", tc.env)
+		if got := KZGSRSFile(); got != tc.want {
+			t.Fatalf("NOEMA_KZG_SRS=%q: expected %q, got %q", tc.env, tc.want, got)
+		}
+	}
+}
+
+func TestIssuerKeyFile(t *testing.T) {
+	cases := []struct {
+		keysDir string
+		env     string
+		want    string
+	}{
+		{"", "", "data/keys/issuer.pem"},
+		{"/srv/noema/keys", "", "/srv/noema/keys/issuer.pem"},
+		{"/srv/noema/keys", "/etc/noema/issuer.pem", "/etc/noema/issuer.pem"},
+	}
+	for _, tc := range cases {
+		t.Setenv("NOEMA_KEYS_DIR", tc.keysDir)
+		t.Setenv("NOEMA_ISSUER_KEY", tc.env)
+		if got := IssuerKeyFile(); got != tc.want {
+			t.Fatalf("NOEMA_KEYS_DIR=%q NOEMA_ISSUER_KEY=%q: expected %q, got %q", tc.keysDir, tc.env, tc.want, got)
+		}
+	}
+}
+
+func TestJobWorkers(t *testing.T) {
+	cases := []struct {
+		env  string
+		want int
+	}{
+		{"", 2},
+		{"1", 1},
+		{"8", 8},
+		{"0", 2},
+		{"-3", 2},
+		{"nope", 2},
+	}
+	for _, tc := range cases {
+		t.Setenv("NOEMA_JOB_WORKERS", tc.env)
+		if got := JobWorkers(); got != tc.want {
+			t.Fatalf("NOEMA_JOB_WORKERS=%q: expected %d, got %d", tc.env, tc.want, got)
+		}
+	}
+}
+
+func TestJobQueueSize(t *testing.T) {
+	cases := []struct {
+		env  string
+		want int
+	}{
+		{"", 32},
+		{"1", 1},
+		{"100", 100},
+		{"0", 32},
+		{"-1", 32},
+		{"nope", 32},
+	}
+	for _, tc := range cases {
+		t.Setenv("NOEMA_JOB_QUEUE", tc.env)
+		if got := JobQueueSize(); got != tc.want {
+			t.Fatalf("NOEMA_JOB_QUEUE=%q: expected %d, got %d", tc.env, tc.want, got)
+		}
+	}
+}
+
+func TestRunStore(t *testing.T) {
+	cases := []struct {
+		env  string
+		want string
+	}{
+		{"", "fs"},
+		{"fs", "fs"},
+		{"sqlite", "sqlite"},
+		// Unknown stores are passed on for evaluate.OpenRunStore to reject,
+		// rather than quietly replaced by the default.
+		{"postgres", "postgres"},
+	}
+	for _, tc := range cases {
+		t.Setenv("NOEMA_RUN_STORE", tc.env)
+		if got := RunStore(); got != tc.want {
+			t.Fatalf("NOEMA_RUN_STORE=%q: expected %q, got %q", tc.env, tc.want, got)
+		}
+	}
+}
+
+func TestRunsDB(t *testing.T) {
+	cases := []struct {
+		env  string
+		want string
+	}{
+		{"", "data/runs.db"},
+		{"/srv/noema/runs.db", "/srv/noema/runs.db"},
+	}
+	for _, tc := range cases {
+		t.Setenv("NOEMA_RUNS_DB", tc.env)
+		if got := RunsDB(); got != tc.want {
+			t.Fatalf("NOEMA_RUNS_DB=%q: expected %q, got %q", tc.env, tc.want, got)
+		}
+	}
+}
+
+func TestAggregateMax(t *testing.T) {
+	cases := []struct {
+		env  string
+		want int
+	}{
+		{"", 4},
+		{"2", 2},
+		{"8", 8},
+		{"1", 4},
+		{"0", 4},
+		{"nope", 4},
+	}
+	for _, tc := range cases {
+		t.Setenv("NOEMA_AGGREGATE_MAX", tc.env)
+		if got := AggregateMax(); got != tc.want {
+			t.Fatalf("NOEMA_AGGREGATE_MAX=%q: expected %d, got %d", tc.env, tc.want, got)
+		}
+	}
+}
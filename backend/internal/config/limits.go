@@ -8,3 +8,16 @@ const (
 	MaxVerifyBytes     = 5 * 1024 * 1024  // 5MB
 	MaxMultipartMemory = 100 << 20        // 100MB for evaluate (dataset + images)
 )
+
+// A batch verify request holds up to MaxBatchVerifyItems items of at most
+// MaxVerifyBytes each.
+const (
+	MaxBatchVerifyBytes = 50 * 1024 * 1024 // 50MB
+	MaxBatchVerifyItems = 500
+)
+
+// MaxAggregateBytes bounds a POST /api/aggregate body, which only lists run IDs.
+const MaxAggregateBytes = 64 * 1024 // 64KB
+
+// MaxRunPatchBytes bounds a PATCH /api/runs/:id body, which only lists tags.
+const MaxRunPatchBytes = 64 * 1024 // 64KB
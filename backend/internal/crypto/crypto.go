@@ -1,4 +1,238 @@
+// Package crypto holds the issuer key a Noema deployment signs its
+// attestations with. The signature ties a proof to the deployment that
+// issued it; its public key is published so anyone can check that.
 package crypto
 
-// Package crypto is reserved for cryptographic utilities.
-// Add hashing, signing, or other crypto helpers here.
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"noema/internal/jcs"
+)
+
+const (
+	// Algorithm names the signature scheme in signatures and the issuer
+	// document.
+	Algorithm = "Ed25519"
+	// AttestationFormat identifies attestations.
+	AttestationFormat = "noema_attestation"
+	// AttestationVersion is the attestation layout this package signs.
+	AttestationVersion = 1
+	// IssuerFormat identifies the issuer document.
+	IssuerFormat = "noema_issuer"
+
+	pemType = "PRIVATE KEY"
+)
+
+// ErrNoIssuerKey is returned by LoadIssuer when the key file does not exist.
+var ErrNoIssuerKey = errors.New("issuer key not found")
+
+// Issuer is an Ed25519 issuer key.
+type Issuer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// NewIssuer wraps an Ed25519 private key.
+func NewIssuer(key ed25519.PrivateKey) *Issuer {
+	return &Issuer{key: key, keyID: KeyID(key.Public().(ed25519.PublicKey))}
+}
+
+// GenerateIssuer creates a new issuer key and writes it to path as a PKCS #8
+// PEM file readable only by its owner. It refuses to replace an existing
+// key, since proofs signed with it could no longer be attributed.
+func GenerateIssuer(path string) (*Issuer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("issuer key %s already exists", path)
+		}
+		return nil, err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: pemType, Bytes: der}); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return NewIssuer(key), nil
+}
+
+// LoadIssuer reads the issuer key GenerateIssuer wrote to path.
+func LoadIssuer(path string) (*Issuer, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoIssuerKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != pemType {
+		return nil, fmt.Errorf("issuer key %s is not a PEM private key", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("issuer key %s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("issuer key %s is not an Ed25519 key", path)
+	}
+	return NewIssuer(key), nil
+}
+
+// KeyID identifies an issuer public key: "ed25519:" and the first 8 bytes
+// of its SHA-256, in hex.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return "ed25519:" + hex.EncodeToString(sum[:8])
+}
+
+// KeyID returns the issuer's key ID.
+func (i *Issuer) KeyID() string {
+	return i.keyID
+}
+
+// PublicKey returns the issuer's public key.
+func (i *Issuer) PublicKey() ed25519.PublicKey {
+	return i.key.Public().(ed25519.PublicKey)
+}
+
+// Attestation is the statement an issuer signs about a run: that it issued
+// the proof with these public inputs, against this verifying key, at
+// IssuedAt.
+type Attestation struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	RunID   string `json:"run_id"`
+	// Commitment is empty when the proof keeps its commitment private.
+	Commitment      string `json:"commitment,omitempty"`
+	PublicInputsB64 string `json:"public_inputs_b64"`
+	VKFingerprint   string `json:"vk_fingerprint"`
+	// DatasetDigestAlg says how the dataset digest the commitment binds was
+	// computed. The proof can't tell "sha256" from "jcs_sha256", so only
+	// the signature vouches for it.
+	DatasetDigestAlg string `json:"dataset_digest_alg,omitempty"`
+	// IssuedAt is an RFC 3339 UTC timestamp.
+	IssuedAt string `json:"issued_at"`
+}
+
+// Canonical returns the bytes a signature covers: the RFC 8785 canonical
+// JSON of a, with Format and Version set to the ones this package signs.
+func (a Attestation) Canonical() ([]byte, error) {
+	a.Format = AttestationFormat
+	a.Version = AttestationVersion
+	raw, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return jcs.Canonicalize(raw)
+}
+
+// Signature is a detached issuer signature over an attestation. Value is
+// the base64 encoded Ed25519 signature.
+type Signature struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"key_id"`
+	Value     string `json:"sig"`
+}
+
+// Sign signs the canonical form of a.
+func (i *Issuer) Sign(a Attestation) (Signature, error) {
+	msg, err := a.Canonical()
+	if err != nil {
+		return Signature{}, err
+	}
+	return Signature{
+		Algorithm: Algorithm,
+		KeyID:     i.keyID,
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(i.key, msg)),
+	}, nil
+}
+
+// Verify checks that sig is pub's signature over a.
+func Verify(pub ed25519.PublicKey, a Attestation, sig Signature) error {
+	if sig.Algorithm != Algorithm {
+		return fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm)
+	}
+	if sig.KeyID != KeyID(pub) {
+		return fmt.Errorf("signature key_id does not match the issuer key")
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil || len(raw) != ed25519.SignatureSize {
+		return fmt.Errorf("invalid signature encoding")
+	}
+	msg, err := a.Canonical()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, msg, raw) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// IssuerDocument publishes an issuer's public key, as served at
+// /.well-known/noema-issuer.json.
+type IssuerDocument struct {
+	Format    string `json:"format"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"key_id"`
+	// PublicKey is the base64 encoded 32-byte Ed25519 public key.
+	PublicKey string `json:"public_key"`
+	// Attestation names the attestation format the key signs.
+	Attestation string `json:"attestation"`
+}
+
+// Document returns the issuer document for i.
+func (i *Issuer) Document() IssuerDocument {
+	return IssuerDocument{
+		Format:      IssuerFormat,
+		Algorithm:   Algorithm,
+		KeyID:       i.keyID,
+		PublicKey:   base64.StdEncoding.EncodeToString(i.PublicKey()),
+		Attestation: fmt.Sprintf("%s_v%d", AttestationFormat, AttestationVersion),
+	}
+}
+
+// Key decodes the public key d publishes, checking that it matches d's
+// key ID.
+func (d IssuerDocument) Key() (ed25519.PublicKey, error) {
+	if d.Algorithm != Algorithm {
+		return nil, fmt.Errorf("unsupported issuer algorithm %q", d.Algorithm)
+	}
+	raw, err := base64.StdEncoding.DecodeString(d.PublicKey)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid issuer public key")
+	}
+	pub := ed25519.PublicKey(raw)
+	if KeyID(pub) != d.KeyID {
+		return nil, fmt.Errorf("issuer key_id does not match its public key")
+	}
+	return pub, nil
+}
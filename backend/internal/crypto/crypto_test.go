@@ -0,0 +1,104 @@
+package crypto
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testAttestation() Attestation {
+	return Attestation{
+		RunID:            "run_1",
+		Commitment:       "0x01",
+		PublicInputsB64:  "cHVibGlj",
+		VKFingerprint:    "ab",
+		DatasetDigestAlg: "jcs_sha256",
+		IssuedAt:         "2026-01-02T03:04:05Z",
+	}
+}
+
+func TestIssuerRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "issuer.pem")
+	if _, err := LoadIssuer(path); !errors.Is(err, ErrNoIssuerKey) {
+		t.Fatalf("expected ErrNoIssuerKey, got %v", err)
+	}
+	issuer, err := GenerateIssuer(path)
+	if err != nil {
+		t.Fatalf("GenerateIssuer error: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat key: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected key file mode 0600, got %v", info.Mode().Perm())
+	}
+	if _, err := GenerateIssuer(path); err == nil {
+		t.Fatalf("expected GenerateIssuer to refuse an existing key")
+	}
+	loaded, err := LoadIssuer(path)
+	if err != nil {
+		t.Fatalf("LoadIssuer error: %v", err)
+	}
+	if !loaded.PublicKey().Equal(issuer.PublicKey()) || loaded.KeyID() != issuer.KeyID() {
+		t.Fatalf("loaded key differs from the generated one")
+	}
+
+	doc := issuer.Document()
+	pub, err := doc.Key()
+	if err != nil || !pub.Equal(issuer.PublicKey()) {
+		t.Fatalf("document does not round-trip the public key: %v", err)
+	}
+	doc.KeyID = "ed25519:0000000000000000"
+	if _, err := doc.Key(); err == nil {
+		t.Fatalf("expected a mismatched key_id to be rejected")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	issuer, err := GenerateIssuer(filepath.Join(t.TempDir(), "issuer.pem"))
+	if err != nil {
+		t.Fatalf("GenerateIssuer error: %v", err)
+	}
+	att := testAttestation()
+	sig, err := issuer.Sign(att)
+	if err != nil {
+		t.Fatalf("Sign error: %v", err)
+	}
+	if sig.Algorithm != Algorithm || sig.KeyID != issuer.KeyID() {
+		t.Fatalf("unexpected signature metadata %+v", sig)
+	}
+	if err := Verify(issuer.PublicKey(), att, sig); err != nil {
+		t.Fatalf("Verify error: %v", err)
+	}
+
+	tampered := att
+	tampered.PublicInputsB64 = "b3RoZXI="
+	if err := Verify(issuer.PublicKey(), tampered, sig); err == nil {
+		t.Fatalf("expected a changed attestation to fail")
+	}
+	other, err := GenerateIssuer(filepath.Join(t.TempDir(), "other.pem"))
+	if err != nil {
+		t.Fatalf("GenerateIssuer error: %v", err)
+	}
+	if err := Verify(other.PublicKey(), att, sig); err == nil {
+		t.Fatalf("expected another issuer's key to fail")
+	}
+	bad := sig
+	bad.Value = "not base64"
+	if err := Verify(issuer.PublicKey(), att, bad); err == nil {
+		t.Fatalf("expected a malformed signature to fail")
+	}
+}
+
+func TestAttestationCanonical(t *testing.T) {
+	got, err := testAttestation().Canonical()
+	if err != nil {
+		t.Fatalf("Canonical error: %v", err)
+	}
+	want := `{"commitment":"0x01","dataset_digest_alg":"jcs_sha256","format":"noema_attestation","issued_at":"2026-01-02T03:04:05Z","public_inputs_b64":"cHVibGlj","run_id":"run_1","version":1,"vk_fingerprint":"ab"}`
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+package evaluate
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"noema/internal/bundle"
+	"noema/internal/config"
+	"noema/internal/httputil"
+	"noema/internal/zk/aggregate"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AggregateRequest is the JSON body for POST /api/aggregate.
+type AggregateRequest struct {
+	RunIDs []string `json:"run_ids"`
+}
+
+// AggregateResponse is the aggregate proof over the requested runs. Its
+// commitments are in run_ids order.
+type AggregateResponse struct {
+	RunIDs []string `json:"run_ids"`
+	aggregate.Result
+}
+
+// AggregateHandler handles POST /api/aggregate. It checks that the proofs
+// of every listed stored run verify and pass, then queues the aggregate
+// proof on jobs and responds 202 with its job, to be polled at GET
+// /api/jobs/:id. Aggregation keys are set up ahead of time with noema
+// aggregate setup; a request they are missing for is refused. Expects
+// CookieAuth to have run first.
+func AggregateHandler(store RunStore, agg *aggregate.Aggregator, jobs *Jobs) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxAggregateBytes)
+
+		var req AggregateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			if httputil.IsBodyTooLarge(err) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+			return
+		}
+		if n := len(req.RunIDs); n < aggregate.MinChildren || n > agg.MaxChildren() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("run_ids must list %d to %d runs", aggregate.MinChildren, agg.MaxChildren())})
+			return
+		}
+
+		children, err := aggregateChildren(store, req.RunIDs)
+		if err != nil {
+			respondRunError(c, err)
+			return
+		}
+		_, err = agg.Check(children)
+		var ce *aggregate.ChildError
+		switch {
+		case errors.As(err, &ce):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": ce.Reason, "run_id": req.RunIDs[ce.Index]})
+			return
+		case errors.Is(err, aggregate.ErrNoKeys):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			respondRunError(c, aggregateError(req.RunIDs, err))
+			return
+		}
+
+		runID, err := store.Create()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create run"})
+			return
+		}
+		job, err := jobs.submitAggregate(runID, req)
+		if err != nil {
+			_ = store.Delete(runID)
+			if errors.Is(err, ErrJobQueueFull) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("submit aggregation job %s: %v", runID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue aggregation"})
+			return
+		}
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// aggregate proves the aggregation req with the jobs' aggregator.
+func (j *Jobs) aggregate(req AggregateRequest) (AggregateResponse, error) {
+	if j.agg == nil {
+		return AggregateResponse{}, internalRunError("aggregation is not enabled")
+	}
+	children, err := aggregateChildren(j.runner.store, req.RunIDs)
+	if err != nil {
+		return AggregateResponse{}, err
+	}
+	res, err := j.agg.Aggregate(children)
+	if err != nil {
+		return AggregateResponse{}, aggregateError(req.RunIDs, err)
+	}
+	return AggregateResponse{RunIDs: req.RunIDs, Result: res}, nil
+}
+
+// aggregateChildren loads the proofs of the runs runIDs, which must be
+// distinct. Failures are *runErrors.
+func aggregateChildren(store RunStore, runIDs []string) ([]aggregate.Child, error) {
+	seen := make(map[string]bool, len(runIDs))
+	children := make([]aggregate.Child, len(runIDs))
+	for i, runID := range runIDs {
+		if seen[runID] {
+			return nil, &runError{status: http.StatusBadRequest, msg: "duplicate run_id " + runID}
+		}
+		seen[runID] = true
+		raw, err := LoadBundle(store, runID)
+		if errors.Is(err, ErrRunNotFound) {
+			return nil, &runError{status: http.StatusNotFound, msg: "run not found: " + runID}
+		}
+		if err != nil {
+			log.Printf("load bundle for %s: %v", runID, err)
+			return nil, internalRunError("failed to load bundle")
+		}
+		b, err := bundle.Parse(raw)
+		if err != nil {
+			log.Printf("parse bundle for %s: %v", runID, err)
+			return nil, internalRunError("failed to load bundle")
+		}
+		children[i] = aggregate.Child{ProofB64: b.Proof.ProofB64, PublicInputsB64: b.Proof.PublicInputsB64}
+	}
+	return children, nil
+}
+
+// aggregateError turns an aggregator error into the *runError it is
+// reported as.
+func aggregateError(runIDs []string, err error) error {
+	var ce *aggregate.ChildError
+	switch {
+	case errors.As(err, &ce):
+		return &runError{status: http.StatusUnprocessableEntity, msg: fmt.Sprintf("run %s: %s", runIDs[ce.Index], ce.Reason)}
+	case errors.Is(err, aggregate.ErrMixedKeys):
+		return &runError{status: http.StatusUnprocessableEntity, msg: "runs were proved with different keys"}
+	case errors.Is(err, aggregate.ErrNoKeys):
+		return &runError{status: http.StatusServiceUnavailable, msg: err.Error()}
+	}
+	log.Printf("aggregate %v: %v", runIDs, err)
+	return internalRunError("failed to aggregate proofs")
+}
+
+func respondRunError(c *gin.Context, err error) {
+	var re *runError
+	if errors.As(err, &re) {
+		c.JSON(re.status, gin.H{"error": re.msg})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to aggregate proofs"})
+}
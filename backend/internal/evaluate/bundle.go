@@ -0,0 +1,51 @@
+package evaluate
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"noema/internal/bundle"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bundleFile is the run's proof bundle. It holds nothing secret.
+const bundleFile = "bundle" + bundle.FileExtension
+
+func saveBundle(store RunStore, runID string, b bundle.Bundle) error {
+	raw, err := bundle.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return store.SaveArtifact(runID, bundleFile, raw)
+}
+
+// LoadBundle returns the stored bundle file of a run.
+func LoadBundle(store RunStore, runID string) ([]byte, error) {
+	raw, err := store.Load(runID, bundleFile)
+	if errors.Is(err, ErrArtifactNotFound) {
+		return nil, ErrRunNotFound
+	}
+	return raw, err
+}
+
+// BundleHandler handles GET /api/runs/:id/bundle, serving the run's .noema
+// bundle as a download. Expects CookieAuth to have run first.
+func BundleHandler(store RunStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		runID := c.Param("id")
+		raw, err := LoadBundle(store, runID)
+		if errors.Is(err, ErrRunNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "bundle not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("load bundle for %s: %v", runID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load bundle"})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+runID+bundle.FileExtension+`"`)
+		c.Data(http.StatusOK, bundle.MediaType, raw)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"noema/internal/sampling"
 )
 
 type CachedGeminiOutput struct {
@@ -26,22 +28,29 @@ type GeminiUsage struct {
 	CachedTokenCount int32 `json:"cached_token_count"`
 }
 
-func cacheKey(dataset []byte, policyConfig []byte, model string, sampleLimit int) string {
+// cacheKey keys an evaluation by what the evaluator is sent. A sampled
+// dataset is keyed by its full digest with the sample's seed and limit,
+// which pick the items sent, so runs over the same dataset share a cached
+// result. Other datasets are keyed by their bytes.
+func cacheKey(dataset []byte, datasetDigest string, sample *sampling.Sample, policyConfig []byte, model string) string {
 	h := sha256.New()
-	h.Write(dataset)
+	if sample != nil {
+		fmt.Fprintf(h, "sample|%s|%s|%d|", datasetDigest, sample.Seed, sample.Limit)
+	} else {
+		h.Write(dataset)
+	}
 	h.Write(policyConfig)
 	h.Write([]byte(model))
 	h.Write([]byte(promptVersion))
-	h.Write([]byte(fmt.Sprintf("sample:%d", sampleLimit)))
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-func cachePath(runsDir, key string) string {
-	return filepath.Join(runsDir, "cache", key, "gemini_output.json")
+func cachePath(cacheDir, key string) string {
+	return filepath.Join(cacheDir, key, "gemini_output.json")
 }
 
-func loadCache(runsDir, key string) (*CachedGeminiOutput, error) {
-	path := cachePath(runsDir, key)
+func loadCache(cacheDir, key string) (*CachedGeminiOutput, error) {
+	path := cachePath(cacheDir, key)
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -53,8 +62,8 @@ func loadCache(runsDir, key string) (*CachedGeminiOutput, error) {
 	return &out, nil
 }
 
-func saveCache(runsDir, key string, out CachedGeminiOutput) error {
-	path := cachePath(runsDir, key)
+func saveCache(cacheDir, key string, out CachedGeminiOutput) error {
+	path := cachePath(cacheDir, key)
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return err
 	}
@@ -2,6 +2,15 @@ package evaluate
 
 import (
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"noema/internal/sampling"
+	"noema/internal/zk"
+
+	"github.com/gin-gonic/gin"
 )
 
 func commitmentFromHash(hash string) string {
@@ -10,3 +19,155 @@ func commitmentFromHash(hash string) string {
 	}
 	return "0x" + hex.EncodeToString([]byte(hash))
 }
+
+// commitmentFile holds the secret opening material for a run's commitment.
+// It is written owner-only since the salt is what keeps the commitment hiding.
+const commitmentFile = "commitment.json"
+
+// CommitmentRecord is the stored opening for a run's Poseidon commitment.
+// Together with policy_config.json and evaluation_result.json it is enough to
+// recompute the commitment.
+type CommitmentRecord struct {
+	Version       int    `json:"version"`
+	Salt          string `json:"salt,omitempty"`
+	DatasetDigest string `json:"dataset_digest"`
+	// DatasetDigestAlg is how DatasetDigest was computed. Runs stored
+	// before it existed used DatasetDigestSHA256.
+	DatasetDigestAlg string `json:"dataset_digest_alg,omitempty"`
+	// DatasetSalt is the secret the Merkle leaf salts of a
+	// DatasetDigestMerkle digest are derived from.
+	DatasetSalt string `json:"dataset_salt,omitempty"`
+	// Sample is the part of the dataset the evaluator was given, when it
+	// was given a sample; the commitment binds it with the digest.
+	Sample *sampling.Sample `json:"sample,omitempty"`
+	// Provenance is the evaluator the severities came from, which the
+	// commitment binds.
+	Provenance *zk.Provenance `json:"provenance,omitempty"`
+	Commitment string         `json:"commitment"`
+}
+
+// digestAlg returns the algorithm of rec's dataset digest.
+func (rec CommitmentRecord) digestAlg() string {
+	if rec.DatasetDigestAlg == "" {
+		return DatasetDigestSHA256
+	}
+	return rec.DatasetDigestAlg
+}
+
+func saveCommitmentRecord(store RunStore, runID string, rec CommitmentRecord) error {
+	return saveArtifactJSON(store, runID, commitmentFile, rec)
+}
+
+// ErrNoOpening is returned for runs stored before commitment records existed.
+var ErrNoOpening = errors.New("run has no commitment opening")
+
+// LoadCommitmentOpening rebuilds the opening of a stored run's commitment
+// from its commitment record, policy_config.json and evaluation_result.json.
+// It refuses to return an opening that doesn't reproduce the stored
+// commitment.
+func LoadCommitmentOpening(store RunStore, runID string) (zk.CommitmentOpening, error) {
+	rec, err := loadCommitmentRecord(store, runID)
+	if err != nil {
+		return zk.CommitmentOpening{}, err
+	}
+	var cfg PolicyConfig
+	if err := loadArtifactJSON(store, runID, "policy_config.json", &cfg); err != nil {
+		return zk.CommitmentOpening{}, err
+	}
+	var evalOut EvaluationResult
+	if err := loadArtifactJSON(store, runID, "evaluation_result.json", &evalOut); err != nil {
+		return zk.CommitmentOpening{}, err
+	}
+
+	if rec.Version != zk.CommitmentVersionV5 {
+		return zk.CommitmentOpening{}, fmt.Errorf("unsupported commitment version %d", rec.Version)
+	}
+	witness, err := buildPolicyWitness(cfg, evalOut)
+	if err != nil {
+		return zk.CommitmentOpening{}, err
+	}
+	witness.Salt = rec.Salt
+	witness.DatasetDigestHex = rec.DatasetDigest
+	witness.Provenance = rec.Provenance
+	opening := zk.OpeningFromWitness(witness)
+	if rec.Sample != nil {
+		opening = zk.SampledOpening(witness, *rec.Sample)
+	}
+
+	commitment, err := opening.Commitment()
+	if err != nil {
+		return zk.CommitmentOpening{}, err
+	}
+	if commitment != rec.Commitment {
+		return zk.CommitmentOpening{}, fmt.Errorf("stored opening does not reproduce commitment %s", rec.Commitment)
+	}
+	return opening, nil
+}
+
+// loadCommitmentRecord returns a stored run's commitment record.
+func loadCommitmentRecord(store RunStore, runID string) (CommitmentRecord, error) {
+	var rec CommitmentRecord
+	if err := loadArtifactJSON(store, runID, commitmentFile, &rec); err != nil {
+		if errors.Is(err, ErrArtifactNotFound) {
+			return CommitmentRecord{}, ErrNoOpening
+		}
+		return CommitmentRecord{}, err
+	}
+	return rec, nil
+}
+
+// OpeningResponse is the JSON response for GET /api/runs/:id/opening.
+type OpeningResponse struct {
+	RunID      string `json:"run_id"`
+	Commitment string `json:"commitment"`
+	// DatasetDigestAlg says how the opening's dataset digest was computed.
+	DatasetDigestAlg string `json:"dataset_digest_alg"`
+	// DatasetSalt is set for DatasetDigestMerkle runs; recomputing the
+	// digest from the dataset takes it.
+	DatasetSalt string               `json:"dataset_salt,omitempty"`
+	Opening     zk.CommitmentOpening `json:"opening"`
+}
+
+// LoadOpeningResponse loads a stored run's opening as GET
+// /api/runs/:id/opening serves it.
+func LoadOpeningResponse(store RunStore, runID string) (OpeningResponse, error) {
+	opening, err := LoadCommitmentOpening(store, runID)
+	if err != nil {
+		return OpeningResponse{}, err
+	}
+	rec, err := loadCommitmentRecord(store, runID)
+	if err != nil {
+		return OpeningResponse{}, err
+	}
+	commitment, err := opening.Commitment()
+	if err != nil {
+		return OpeningResponse{}, fmt.Errorf("recompute commitment: %w", err)
+	}
+	return OpeningResponse{RunID: runID, Commitment: commitment, DatasetDigestAlg: rec.digestAlg(), DatasetSalt: rec.DatasetSalt, Opening: opening}, nil
+}
+
+// OpeningHandler handles GET /api/runs/:id/opening. It exports the secret
+// preimage of a run's commitment for the dataset owner to hand to an auditor,
+// who can check it with POST /api/commitment/open. Expects CookieAuth to have
+// run first.
+func OpeningHandler(store RunStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		runID := c.Param("id")
+		resp, err := LoadOpeningResponse(store, runID)
+		if errors.Is(err, ErrRunNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "run not found"})
+			return
+		}
+		if errors.Is(err, ErrNoOpening) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "run has no commitment opening"})
+			return
+		}
+		if err != nil {
+			log.Printf("load opening for %s: %v", runID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load commitment opening"})
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, resp)
+	}
+}
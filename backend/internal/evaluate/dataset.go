@@ -2,7 +2,9 @@ package evaluate
 
 import (
 	"bytes"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -12,6 +14,24 @@ import (
 	"strings"
 
 	"noema/internal/config"
+	"noema/internal/jcs"
+	"noema/internal/merkle"
+)
+
+// Dataset digest algorithms, chosen per run with the dataset_digest form
+// field. The digest is what the commitment binds the dataset by.
+const (
+	// DatasetDigestSHA256 hashes the uploaded file as is. It is the legacy
+	// mode, and the default for datasets that don't match the item schema.
+	DatasetDigestSHA256 = "sha256"
+	// DatasetDigestJCS hashes the RFC 8785 canonical form of the dataset,
+	// so re-serializing it (key order, whitespace, escapes) keeps the
+	// digest. It is the default for datasets matching the item schema.
+	DatasetDigestJCS = "jcs_sha256"
+	// DatasetDigestMerkle is the RFC 6962 Merkle root over the items'
+	// salted canonical encodings (MerkleLeaf), in dataset order. It lets the
+	// owner prove single items were evaluated; see InclusionProofs.
+	DatasetDigestMerkle = "merkle_sha256"
 )
 
 type Dataset struct {
@@ -130,11 +150,13 @@ func parseDatasetSchema(raw []byte) (Dataset, error) {
 	return ds, nil
 }
 
-func sampleDataset(ds Dataset, limit int) Dataset {
-	if limit <= 0 || len(ds.Items) <= limit {
-		return ds
+// sampleDataset returns the items of ds at indices, in order.
+func sampleDataset(ds Dataset, indices []int) Dataset {
+	items := make([]DatasetItem, len(indices))
+	for i, idx := range indices {
+		items[i] = ds.Items[idx]
 	}
-	return Dataset{Items: ds.Items[:limit]}
+	return Dataset{Items: items}
 }
 
 func datasetDigestHex(fh *multipart.FileHeader) (string, error) {
@@ -154,3 +176,144 @@ func datasetDigestHex(fh *multipart.FileHeader) (string, error) {
 	sum := sha256.Sum256(raw)
 	return hex.EncodeToString(sum[:]), nil
 }
+
+// defaultDigestAlg is the digest algorithm for an upload when the request
+// doesn't name one.
+func defaultDigestAlg(fh *multipart.FileHeader) string {
+	if _, _, err := readDatasetFile(fh); err != nil {
+		return DatasetDigestSHA256
+	}
+	return DatasetDigestJCS
+}
+
+// datasetDigest computes the digest alg names for the uploaded dataset.
+// salt is the dataset salt of DatasetDigestMerkle digests.
+func datasetDigest(fh *multipart.FileHeader, alg, salt string) (string, error) {
+	switch alg {
+	case DatasetDigestSHA256:
+		return datasetDigestHex(fh)
+	case DatasetDigestJCS, DatasetDigestMerkle:
+		raw, _, err := readDatasetFile(fh)
+		if err != nil {
+			return "", fmt.Errorf("dataset_digest %s: %w", alg, err)
+		}
+		return DatasetDigestBytes(raw, alg, salt)
+	default:
+		return "", errUnknownDigestAlg
+	}
+}
+
+var errUnknownDigestAlg = fmt.Errorf("dataset_digest must be %s, %s or %s", DatasetDigestJCS, DatasetDigestSHA256, DatasetDigestMerkle)
+
+// DatasetDigestBytes computes the digest alg names for a dataset file's
+// contents, as datasetDigest does for an upload. salt is only used by
+// DatasetDigestMerkle.
+func DatasetDigestBytes(raw []byte, alg, salt string) (string, error) {
+	switch alg {
+	case DatasetDigestSHA256:
+		sum := sha256.Sum256(raw)
+		return hex.EncodeToString(sum[:]), nil
+	case DatasetDigestJCS:
+		if _, err := parseDatasetSchema(raw); err != nil {
+			return "", fmt.Errorf("dataset_digest %s: %w", alg, err)
+		}
+		canonical, err := jcs.Canonicalize(raw)
+		if err != nil {
+			return "", fmt.Errorf("dataset_digest %s: %w", alg, err)
+		}
+		sum := sha256.Sum256(canonical)
+		return hex.EncodeToString(sum[:]), nil
+	case DatasetDigestMerkle:
+		ds, err := parseDatasetSchema(raw)
+		if err != nil {
+			return "", fmt.Errorf("dataset_digest %s: %w", alg, err)
+		}
+		leaves, err := datasetLeaves(ds, salt)
+		if err != nil {
+			return "", err
+		}
+		root := merkle.Root(leaves)
+		return hex.EncodeToString(root[:]), nil
+	default:
+		return "", errUnknownDigestAlg
+	}
+}
+
+// DatasetItemLeaf is the canonical encoding of item as a Merkle leaf: the
+// RFC 8785 (JCS) form of its JSON, with empty optional fields left out.
+func DatasetItemLeaf(item DatasetItem) ([]byte, error) {
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return nil, fmt.Errorf("encode dataset item %s: %w", item.ID, err)
+	}
+	leaf, err := jcs.Canonicalize(raw)
+	if err != nil {
+		return nil, fmt.Errorf("encode dataset item %s: %w", item.ID, err)
+	}
+	return leaf, nil
+}
+
+// datasetSaltBytes is the length of the secret a Merkle digest's leaf salts
+// are derived from.
+const datasetSaltBytes = 32
+
+// leafSaltDomain prefixes the hash leaf salts are derived by.
+const leafSaltDomain = "noema_merkle_leaf_salt_v1|"
+
+// newDatasetSalt returns a fresh dataset salt for a Merkle digest, as hex.
+func newDatasetSalt() (string, error) {
+	b := make([]byte, datasetSaltBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate dataset salt: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// leafSalts derives the salt of each of n leaves from the hex dataset salt:
+// SHA-256("noema_merkle_leaf_salt_v1|" || salt || index), with the index as
+// a big-endian uint64. A leaf's salt gives nothing away about the others.
+func leafSalts(datasetSalt string, n int) ([][]byte, error) {
+	salt, err := hex.DecodeString(datasetSalt)
+	if err != nil || len(salt) != datasetSaltBytes {
+		return nil, fmt.Errorf("dataset salt must be %d hex encoded bytes", datasetSaltBytes)
+	}
+	out := make([][]byte, n)
+	for i := range out {
+		h := sha256.New()
+		h.Write([]byte(leafSaltDomain))
+		h.Write(salt)
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+		out[i] = h.Sum(nil)
+	}
+	return out, nil
+}
+
+// MerkleLeaf is the data of the Merkle leaf holding item: its leaf salt
+// followed by DatasetItemLeaf(item). The salt keeps the audit paths handed
+// out for other items from confirming a guess at this one.
+func MerkleLeaf(leafSalt []byte, item DatasetItem) ([]byte, error) {
+	if len(leafSalt) != sha256.Size {
+		return nil, fmt.Errorf("leaf salt must be %d bytes", sha256.Size)
+	}
+	raw, err := DatasetItemLeaf(item)
+	if err != nil {
+		return nil, err
+	}
+	return append(bytes.Clone(leafSalt), raw...), nil
+}
+
+func datasetLeaves(ds Dataset, datasetSalt string) ([]merkle.Hash, error) {
+	salts, err := leafSalts(datasetSalt, len(ds.Items))
+	if err != nil {
+		return nil, err
+	}
+	leaves := make([]merkle.Hash, len(ds.Items))
+	for i, item := range ds.Items {
+		raw, err := MerkleLeaf(salts[i], item)
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = merkle.LeafHash(raw)
+	}
+	return leaves, nil
+}
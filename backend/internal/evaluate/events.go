@@ -0,0 +1,175 @@
+package evaluate
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Job event types, as the SSE event names of GET /api/jobs/:id/events.
+const (
+	EventStage       = "stage"
+	EventCache       = "cache"
+	EventGeminiChunk = "gemini_chunk"
+	EventProof       = "proof"
+	EventResult      = "result"
+)
+
+// JobEvent is a step of a running job. Data is sent as the event's JSON.
+type JobEvent struct {
+	Type string
+	Data any
+}
+
+type stageData struct {
+	Stage JobStage `json:"stage"`
+}
+
+func stageEvent(stage JobStage) JobEvent {
+	return JobEvent{Type: EventStage, Data: stageData{Stage: stage}}
+}
+
+// cacheEvent reports whether the evaluator's result came from the cache.
+func cacheEvent(hit bool) JobEvent {
+	status := "miss"
+	if hit {
+		status = "hit"
+	}
+	return JobEvent{Type: EventCache, Data: gin.H{"cache": status}}
+}
+
+func chunkEvent(text string) JobEvent {
+	return JobEvent{Type: EventGeminiChunk, Data: gin.H{"text": text}}
+}
+
+// proofEvent reports that proof generation started or finished.
+func proofEvent(status string) JobEvent {
+	return JobEvent{Type: EventProof, Data: gin.H{"proof": status}}
+}
+
+// subscriberBuffer is how many events a slow client may fall behind before
+// it misses some. It still gets the job's final state.
+const subscriberBuffer = 64
+
+// jobEvents fans a job's events out to the clients following it. Events
+// are not stored; a client that connects late starts from the job's state.
+type jobEvents struct {
+	mu   sync.Mutex
+	subs map[string]map[chan JobEvent]struct{}
+}
+
+func newJobEvents() *jobEvents {
+	return &jobEvents{subs: make(map[string]map[chan JobEvent]struct{})}
+}
+
+func (e *jobEvents) subscribe(jobID string) (<-chan JobEvent, func()) {
+	ch := make(chan JobEvent, subscriberBuffer)
+	e.mu.Lock()
+	if e.subs[jobID] == nil {
+		e.subs[jobID] = make(map[chan JobEvent]struct{})
+	}
+	e.subs[jobID][ch] = struct{}{}
+	e.mu.Unlock()
+	return ch, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if _, ok := e.subs[jobID][ch]; ok {
+			delete(e.subs[jobID], ch)
+			if len(e.subs[jobID]) == 0 {
+				delete(e.subs, jobID)
+			}
+			close(ch)
+		}
+	}
+}
+
+// publish sends ev to jobID's subscribers, dropping it for any that are
+// too far behind.
+func (e *jobEvents) publish(jobID string, ev JobEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs[jobID] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// finish closes jobID's subscriptions once the job's final state is saved.
+func (e *jobEvents) finish(jobID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs[jobID] {
+		close(ch)
+	}
+	delete(e.subs, jobID)
+}
+
+// sseKeepAlive is how often an idle stream gets a comment, so proxies don't
+// close it during a long Gemini call or proof.
+const sseKeepAlive = 15 * time.Second
+
+// JobEventsHandler handles GET /api/jobs/:id/events, streaming the job's
+// progress as Server-Sent Events: its current stage first, then stage
+// changes, cache hits and misses, partial Gemini output and proof
+// generation, and finally a "result" event with the job as GET
+// /api/jobs/:id reports it. Expects CookieAuth to have run first.
+func JobEventsHandler(jobs *Jobs) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID := c.Param("id")
+		// Subscribe before reading the job's state, so nothing between the
+		// two is missed.
+		events, unsubscribe := jobs.events.subscribe(jobID)
+		defer unsubscribe()
+		job, err := LoadJob(jobs.runner.store, jobID)
+		if errors.Is(err, ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("load job %s: %v", jobID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load job"})
+			return
+		}
+
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		c.SSEvent(EventStage, stageData{Stage: job.Stage})
+		if job.Stage.finished() {
+			c.SSEvent(EventResult, job)
+			return
+		}
+		c.Writer.Flush()
+
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case <-keepAlive.C:
+				_, _ = io.WriteString(w, ": keep-alive\n\n")
+				return true
+			case ev, ok := <-events:
+				if ok {
+					c.SSEvent(ev.Type, ev.Data)
+					return true
+				}
+				// The job finished; its saved state is the result.
+				job, err := LoadJob(jobs.runner.store, jobID)
+				if err != nil {
+					log.Printf("load job %s: %v", jobID, err)
+					return false
+				}
+				c.SSEvent(EventResult, job)
+				return false
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package evaluate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FSRunStore keeps each run as a directory of artifact files under one
+// directory, with index.json listing the finished runs newest first.
+type FSRunStore struct {
+	dir string
+	// mu serializes changes to index.json.
+	mu sync.Mutex
+}
+
+// NewFSRunStore returns the store of the runs in dir. dir is created with
+// the first run.
+func NewFSRunStore(dir string) *FSRunStore {
+	return &FSRunStore{dir: dir}
+}
+
+// runDir returns the directory of the stored run runID. IDs that genRunID
+// could not have produced are rejected before touching the filesystem, so
+// they can't name anything outside the store.
+func (s *FSRunStore) runDir(runID string) (string, error) {
+	rest, ok := strings.CutPrefix(runID, "run_")
+	if !ok || rest == "" {
+		return "", ErrRunNotFound
+	}
+	for _, r := range rest {
+		if (r < '0' || r > '9') && r != '_' {
+			return "", ErrRunNotFound
+		}
+	}
+	path := filepath.Join(s.dir, runID)
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrRunNotFound
+		}
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", ErrRunNotFound
+	}
+	return path, nil
+}
+
+func (s *FSRunStore) Create() (string, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", err
+	}
+	const maxAttempts = 5
+	for i := 0; i < maxAttempts; i++ {
+		runID := genRunID()
+		if err := os.Mkdir(filepath.Join(s.dir, runID), 0755); err == nil {
+			return runID, nil
+		} else if !os.IsExist(err) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("failed to create unique run directory after %d attempts", maxAttempts)
+}
+
+func (s *FSRunStore) SaveArtifact(runID, name string, data []byte) error {
+	if err := checkArtifactName(name); err != nil {
+		return err
+	}
+	runPath, err := s.runDir(runID)
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	if name == commitmentFile {
+		// The commitment record holds the salt that keeps the commitment
+		// hiding.
+		mode = 0600
+	}
+	path := filepath.Join(runPath, name)
+	if err := writeAtomic(path, mode, func(tmp *os.File) error {
+		if _, err := tmp.Write(data); err != nil {
+			return fmt.Errorf("write %s: %w", path, err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if name != runManifestFile {
+		return nil
+	}
+	entry, err := manifestEntry(data)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateIndex(func(entries []RunIndexEntry) []RunIndexEntry {
+		entries = slices.DeleteFunc(entries, func(e RunIndexEntry) bool {
+			return e.RunID == runID
+		})
+		return append(entries, *entry)
+	})
+}
+
+func (s *FSRunStore) Load(runID, name string) ([]byte, error) {
+	if err := checkArtifactName(name); err != nil {
+		return nil, err
+	}
+	runPath, err := s.runDir(runID)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(runPath, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrArtifactNotFound
+	}
+	return b, err
+}
+
+func (s *FSRunStore) List() ([]StoredRun, error) {
+	dirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	s.mu.Lock()
+	index, err := s.readIndex()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]RunIndexEntry, len(index))
+	for _, e := range index {
+		entries[e.RunID] = e
+	}
+	var runs []StoredRun
+	for _, d := range dirs {
+		if !d.IsDir() || !strings.HasPrefix(d.Name(), "run_") {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(s.dir, d.Name()))
+		if err != nil {
+			continue
+		}
+		run := StoredRun{ID: d.Name(), UpdatedAt: info.ModTime()}
+		for _, f := range files {
+			// Skip writeAtomic's temporary files.
+			if !f.IsDir() && !strings.Contains(f.Name(), ".tmp-") {
+				run.Artifacts = append(run.Artifacts, f.Name())
+			}
+		}
+		if e, ok := entries[d.Name()]; ok {
+			run.Entry = &e
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].UpdatedAt.Equal(runs[j].UpdatedAt) {
+			return runs[i].UpdatedAt.After(runs[j].UpdatedAt)
+		}
+		return runs[i].ID > runs[j].ID
+	})
+	return runs, nil
+}
+
+func (s *FSRunStore) Delete(runID string, keep ...string) error {
+	runPath, err := s.runDir(runID)
+	if err != nil {
+		return err
+	}
+	if len(keep) == 0 {
+		if err := os.RemoveAll(runPath); err != nil {
+			return err
+		}
+	} else {
+		files, err := os.ReadDir(runPath)
+		if err != nil {
+			return err
+		}
+		kept := 0
+		for _, f := range files {
+			if slices.Contains(keep, f.Name()) {
+				kept++
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(runPath, f.Name())); err != nil {
+				return err
+			}
+		}
+		if kept == 0 {
+			if err := os.Remove(runPath); err != nil {
+				return err
+			}
+		} else if slices.Contains(keep, runManifestFile) {
+			return nil
+		}
+	}
+	return s.removeFromIndex([]string{runID})
+}
+
+func (s *FSRunStore) Prune(keep int, busy func(runID string) bool) ([]string, error) {
+	runs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	runs = slices.DeleteFunc(runs, func(r StoredRun) bool {
+		return busy != nil && busy(r.ID)
+	})
+	var removed []string
+	defer func() {
+		if err := s.removeFromIndex(removed); err != nil {
+			log.Printf("runs index update: %v", err)
+		}
+	}()
+	for i := keep; i < len(runs); i++ {
+		if err := os.RemoveAll(filepath.Join(s.dir, runs[i].ID)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, runs[i].ID)
+	}
+	return removed, nil
+}
+
+func (s *FSRunStore) Reindex() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.rebuildIndex()
+	return err
+}
+
+func (s *FSRunStore) Close() error {
+	return nil
+}
+
+func (s *FSRunStore) removeFromIndex(runIDs []string) error {
+	if len(runIDs) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Without an index there is nothing to drop: it is rebuilt from the
+	// runs left once it is read.
+	if _, err := os.Stat(filepath.Join(s.dir, runsIndexFile)); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return s.updateIndex(func(entries []RunIndexEntry) []RunIndexEntry {
+		return slices.DeleteFunc(entries, func(e RunIndexEntry) bool {
+			return slices.Contains(runIDs, e.RunID)
+		})
+	})
+}
+
+// updateIndex rewrites index.json with update applied. Callers hold s.mu.
+func (s *FSRunStore) updateIndex(update func([]RunIndexEntry) []RunIndexEntry) error {
+	entries, err := s.readIndex()
+	if err != nil {
+		return err
+	}
+	entries = update(entries)
+	sortRunsIndex(entries)
+	return saveJSON(filepath.Join(s.dir, runsIndexFile), entries)
+}
+
+// readIndex returns the runs index, rebuilding it when index.json is
+// missing or can't be decoded. A corrupt index is kept next to the new one.
+// Callers hold s.mu.
+func (s *FSRunStore) readIndex() ([]RunIndexEntry, error) {
+	indexPath := filepath.Join(s.dir, runsIndexFile)
+	b, err := os.ReadFile(indexPath)
+	if err == nil {
+		var entries []RunIndexEntry
+		if err := json.Unmarshal(b, &entries); err == nil {
+			return entries, nil
+		}
+		backup := indexPath + ".corrupt-" + strconv.FormatInt(time.Now().UnixMilli(), 10)
+		if err := os.Rename(indexPath, backup); err != nil {
+			return nil, fmt.Errorf("runs index corrupted; failed to archive: %w", err)
+		}
+		log.Printf("runs index corrupted; archived as %s, rebuilding", backup)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return s.rebuildIndex()
+}
+
+// rebuildIndex rewrites index.json from the runs' manifests. Callers hold
+// s.mu.
+func (s *FSRunStore) rebuildIndex() ([]RunIndexEntry, error) {
+	dirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []RunIndexEntry{}, nil
+		}
+		return nil, err
+	}
+	entries := []RunIndexEntry{}
+	for _, d := range dirs {
+		if !d.IsDir() || !strings.HasPrefix(d.Name(), "run_") {
+			continue
+		}
+		entry, err := reindexEntry(s, d.Name())
+		if err != nil {
+			log.Printf("runs index: skip %s: %v", d.Name(), err)
+			continue
+		}
+		if entry != nil {
+			entries = append(entries, *entry)
+		}
+	}
+	sortRunsIndex(entries)
+	if err := saveJSON(filepath.Join(s.dir, runsIndexFile), entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
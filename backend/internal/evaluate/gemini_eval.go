@@ -2,76 +2,114 @@ package evaluate
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"mime/multipart"
 	"os"
 	"time"
 
 	"noema/internal/config"
 	"noema/internal/gemini"
+	"noema/internal/sampling"
+	"noema/internal/zk"
 )
 
 const geminiEvalTimeout = 45 * time.Second
 
-func resolveEvaluationResult(ctx context.Context, form *multipart.Form, cfg PolicyConfig, runsDir string, datasetFile *multipart.FileHeader, imageFiles []*multipart.FileHeader) (EvaluationResult, error) {
-	if out, provided, err := parseEvaluationResultProvided(form, cfg); err != nil {
-		return EvaluationResult{}, err
-	} else if provided {
-		return out, nil
+// evaluation is a run's evaluation result and where it came from.
+type evaluation struct {
+	Result     EvaluationResult
+	Provenance zk.Provenance
+	// Sample is the sample of the dataset the evaluator was given. It is
+	// nil for client results and for datasets that don't match the item
+	// schema, which go to the evaluator whole.
+	Sample *sampling.Sample
+}
+
+// resolveEvaluationResult returns the client's evaluation_result, or has
+// the evaluator produce one from the dataset and images saved with the run
+// runID. Gemini's results are cached in cacheDir.
+func resolveEvaluationResult(ctx context.Context, in runInput, cacheDir string, store RunStore, runID string, emit func(JobEvent)) (evaluation, error) {
+	cfg := in.PolicyConfig
+	if in.EvaluationResult != "" {
+		out, err := parseEvaluationResult(in.EvaluationResult)
+		if err != nil {
+			return evaluation{}, err
+		}
+		if err := validateEvaluationResult(out, cfg); err != nil {
+			return evaluation{}, err
+		}
+		return evaluation{Result: out, Provenance: zk.Provenance{
+			Kind:         zk.EvaluatorClient,
+			ResponseHash: zk.ResponseHash([]byte(in.EvaluationResult)),
+		}}, nil
+	}
+	rawDataset, err := store.Load(runID, runDatasetFile)
+	if err != nil {
+		return evaluation{}, fmt.Errorf("could not read dataset")
 	}
-	return evalWithGemini(ctx, cfg, runsDir, datasetFile, imageFiles), nil
+	ds, err := parseDatasetSchema(rawDataset)
+	if err != nil {
+		return evalWithGemini(ctx, cfg, cacheDir, rawDataset, in.DatasetDigest, nil, store, runID, in.Images, emit), nil
+	}
+	sample, err := sampling.New(in.DatasetDigest, len(ds.Items), config.SampleItemsLimit())
+	if err != nil {
+		return evaluation{}, err
+	}
+	sampled, err := marshalSampledDataset(sampleDataset(ds, sample.Indices))
+	if err != nil {
+		return evaluation{}, err
+	}
+	return evalWithGemini(ctx, cfg, cacheDir, sampled, in.DatasetDigest, &sample, store, runID, in.Images, emit), nil
+}
+
+// evalWithGemini evaluates dataset, which is the sampled items when sample
+// is set and the raw upload otherwise; datasetDigest is the whole upload's. It falls back to the stub result
+// when Gemini is unavailable or its output is unusable. emit is told of
+// cache hits and misses and of Gemini's output as it streams.
+func evalWithGemini(ctx context.Context, cfg PolicyConfig, cacheDir string, dataset []byte, datasetDigest string, sample *sampling.Sample, store RunStore, runID string, images []runImage, emit func(JobEvent)) evaluation {
+	ev := geminiEvaluation(ctx, cfg, cacheDir, dataset, datasetDigest, sample, store, runID, images, emit)
+	ev.Sample = sample
+	return ev
 }
 
-func evalWithGemini(ctx context.Context, cfg PolicyConfig, runsDir string, datasetFile *multipart.FileHeader, imageFiles []*multipart.FileHeader) EvaluationResult {
+func geminiEvaluation(ctx context.Context, cfg PolicyConfig, cacheDir string, dataset []byte, datasetDigest string, sample *sampling.Sample, store RunStore, runID string, imageFiles []runImage, emit func(JobEvent)) evaluation {
 	if config.GeminiAPIKey() == "" {
 		log.Printf("gemini disabled: missing GEMINI_API_KEY")
-		return stubEvaluationResult(cfg)
+		return stubEvaluation(cfg)
 	}
 
-	rawDataset, err := readDatasetBytes(datasetFile)
-	if err != nil {
-		log.Printf("gemini fallback: read dataset failed: %v", err)
-		return stubEvaluationResult(cfg)
-	}
-
-	sampleLimit := config.SampleItemsLimit()
 	model := gemini.ModelName()
 	policyJSON, err := jsonBytes(cfg)
 	if err != nil {
 		log.Printf("gemini fallback: marshal policy_config failed: %v", err)
-		return stubEvaluationResult(cfg)
+		return stubEvaluation(cfg)
+	}
+	if sample != nil {
+		log.Printf("gemini request: model=%s sampled=%d/%d", model, len(sample.Indices), sample.DatasetSize)
+	} else {
+		log.Printf("gemini request: model=%s unsampled", model)
 	}
-	log.Printf("gemini request: model=%s sample_limit=%d", model, sampleLimit)
-	key := cacheKey(rawDataset, policyJSON, model, sampleLimit)
-	if cached, err := loadCache(runsDir, key); err == nil {
+	key := cacheKey(dataset, datasetDigest, sample, policyJSON, model)
+	if cached, err := loadCache(cacheDir, key); err == nil {
 		if err := validateEvaluationResult(cached.Output, cfg); err == nil {
 			log.Printf("gemini cache hit: %s", key)
-			return cached.Output
+			emit(cacheEvent(true))
+			return evaluation{Result: cached.Output, Provenance: geminiProvenance(cached.Model, cached.PromptVersion, cached.RawText)}
 		}
-		_ = os.Remove(cachePath(runsDir, key))
+		_ = os.Remove(cachePath(cacheDir, key))
 	} else if !os.IsNotExist(err) {
-		_ = os.Remove(cachePath(runsDir, key))
+		_ = os.Remove(cachePath(cacheDir, key))
 	}
 
-	var sampledJSON []byte
-	if ds, err := parseDatasetSchema(rawDataset); err == nil {
-		sampled := sampleDataset(ds, sampleLimit)
-		sampledJSON, err = marshalSampledDataset(sampled)
-		if err != nil {
-			log.Printf("gemini marshal dataset: %v", err)
-			return stubEvaluationResult(cfg)
-		}
-	} else {
-		sampledJSON = rawDataset
-	}
+	emit(cacheEvent(false))
 
-	images, err := readImages(imageFiles)
+	images, err := loadRunImages(store, runID, imageFiles)
 	if err != nil {
 		log.Printf("gemini fallback: read images failed: %v", err)
-		return stubEvaluationResult(cfg)
+		return stubEvaluation(cfg)
 	}
 
-	prompt := buildUserPrompt(cfg, sampledJSON, images)
+	prompt := buildUserPrompt(cfg, dataset, images)
 	req := gemini.EvalRequest{
 		SystemPrompt:    buildSystemPrompt(),
 		UserPrompt:      prompt,
@@ -86,21 +124,23 @@ func evalWithGemini(ctx context.Context, cfg PolicyConfig, runsDir string, datas
 	ctx, cancel := withGeminiTimeout(ctx)
 	defer cancel()
 	log.Printf("gemini call: sending request")
-	resp, err := gemini.Evaluate(ctx, req)
+	resp, err := gemini.EvaluateStream(ctx, req, func(chunk string) {
+		emit(chunkEvent(chunk))
+	})
 	if err != nil {
 		log.Printf("gemini fallback: evaluate failed: %v", err)
-		return stubEvaluationResult(cfg)
+		return stubEvaluation(cfg)
 	}
 	log.Printf("gemini output: %s", resp.Text)
 
 	out, err := parseEvaluationResult(resp.Text)
 	if err != nil {
 		log.Printf("gemini fallback: parse output failed: %v", err)
-		return stubEvaluationResult(cfg)
+		return stubEvaluation(cfg)
 	}
 	if err := validateEvaluationResult(out, cfg); err != nil {
 		log.Printf("gemini fallback: validate output failed: %v", err)
-		return stubEvaluationResult(cfg)
+		return stubEvaluation(cfg)
 	}
 
 	cacheOut := CachedGeminiOutput{
@@ -110,11 +150,32 @@ func evalWithGemini(ctx context.Context, cfg PolicyConfig, runsDir string, datas
 		RawText:       resp.Text,
 		Usage:         toGeminiUsage(resp.Usage),
 	}
-	if err := saveCache(runsDir, key, cacheOut); err != nil {
+	if err := saveCache(cacheDir, key, cacheOut); err != nil {
 		log.Printf("gemini cache save: %v", err)
 	}
 
-	return out
+	return evaluation{Result: out, Provenance: geminiProvenance(resp.Model, promptVersion, resp.Text)}
+}
+
+// geminiProvenance hashes the raw model output the result was parsed from.
+func geminiProvenance(model, version, rawText string) zk.Provenance {
+	return zk.Provenance{
+		Kind:          zk.EvaluatorGemini,
+		Model:         model,
+		PromptVersion: version,
+		ResponseHash:  zk.ResponseHash([]byte(rawText)),
+	}
+}
+
+// stubEvaluation is the fallback result. Its response hash covers the
+// result's own JSON, since there was no evaluator response.
+func stubEvaluation(cfg PolicyConfig) evaluation {
+	out := stubEvaluationResult(cfg)
+	raw, _ := jsonBytes(out)
+	return evaluation{Result: out, Provenance: zk.Provenance{
+		Kind:         zk.EvaluatorStub,
+		ResponseHash: zk.ResponseHash(raw),
+	}}
 }
 
 func withGeminiTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
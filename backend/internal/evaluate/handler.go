@@ -1,18 +1,20 @@
 package evaluate
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
+	"noema/internal/bundle"
 	"noema/internal/config"
+	"noema/internal/crypto"
 	"noema/internal/httputil"
 	"noema/internal/zk"
 
@@ -24,36 +26,57 @@ type EvaluateResponse struct {
 	RunID           string       `json:"run_id"`
 	Status          string       `json:"status"` // PASS or FAIL
 	OverallPass     bool         `json:"overall_pass"`
-	MaxSeverity     int          `json:"max_severity"`
-	Commitment      string       `json:"commitment"`
+	MaxSeverity     *int         `json:"max_severity,omitempty"`
+	Commitment      string       `json:"commitment,omitempty"`
 	ProofB64        string       `json:"proof_b64"`
 	PublicInputsB64 string       `json:"public_inputs_b64"`
 	PublicOutput    PublicOutput `json:"public_output"`
 	Proof           Proof        `json:"proof"`
 	Verified        bool         `json:"verified"`
+	// SnarkJS is the proof in snarkjs proof.json and public.json form.
+	SnarkJS *SnarkJSOutput `json:"snarkjs,omitempty"`
+	// Attestation and Signature are only set when the server has an issuer
+	// key. The signature, which the bundle also carries, covers the
+	// attestation's canonical form.
+	Attestation *crypto.Attestation `json:"attestation,omitempty"`
+	Signature   *bundle.Signature   `json:"signature,omitempty"`
 }
 
-type PublicOutput struct {
-	OverallPass     bool   `json:"overall_pass"`
-	MaxSeverity     int    `json:"max_severity"`
-	PolicyThreshold int    `json:"policy_threshold"`
-	Commitment      string `json:"commitment"`
+// SnarkJSOutput is a proof and its public signals as snarkjs writes them.
+type SnarkJSOutput struct {
+	Proof         zk.SnarkJSProof `json:"proof"`
+	PublicSignals []string        `json:"public_signals"`
 }
 
-type Proof struct {
-	System          string `json:"system"`
-	Curve           string `json:"curve"`
-	ProofB64        string `json:"proof_b64"`
-	PublicInputsB64 string `json:"public_inputs_b64"`
-}
+// PublicOutput is what the proof discloses. Outputs the policy keeps private
+// are omitted and missing from Disclosed.
+type PublicOutput = zk.DisclosedOutputs
+
+// Proof is the proof and the key metadata needed to verify it, as it
+// appears in bundles.
+type Proof = bundle.Proof
 
-// Handler handles POST /api/evaluate. Expects CookieAuth to have run first.
-func Handler(runsDir string, maxRuns int) gin.HandlerFunc {
+// Handler handles POST /api/evaluate. Runs are signed with issuer unless it
+// is nil. With ?async=1 the run is queued on jobs and the response is 202
+// with its job, to be polled at GET /api/jobs/:id. Expects CookieAuth to
+// have run first.
+func Handler(store RunStore, cacheDir string, maxRuns int, issuer *crypto.Issuer, jobs *Jobs) gin.HandlerFunc {
+	r := runner{store: store, cacheDir: cacheDir, maxRuns: maxRuns, issuer: issuer}
 	return func(c *gin.Context) {
 		const multipartOverhead = 2 << 20
 		maxBody := int64(config.MaxDatasetBytes) + int64(config.MaxImages*config.MaxImageBytes) + multipartOverhead
 		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
 
+		async, err := asyncQuery(c.Query("async"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if async && jobs == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "asynchronous evaluation is not enabled"})
+			return
+		}
+
 		// Parse multipart: policy_config (string), dataset (file, required), images (files, optional)
 		form, err := c.MultipartForm()
 		if err != nil {
@@ -66,216 +89,380 @@ func Handler(runsDir string, maxRuns int) gin.HandlerFunc {
 		}
 		defer form.RemoveAll()
 
-		policyRaw, policyProvided, err := optionalFormValue(form, "policy_config")
+		in, datasetFile, imageFiles, err := parseRunInput(form)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		var policyConfig PolicyConfig
-		if policyProvided {
-			policyConfig, err = parsePolicyConfig(policyRaw)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
-			}
-			if err := validatePolicyConfig(policyConfig); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
-			}
-		} else if len(form.Value["spec"]) > 0 {
-			spec, err := parseSpec(form)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
-			}
-			if err := validateSpec(spec); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
-			}
-			policyConfig = policyConfigFromSpec(spec)
-		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "missing field: policy_config"})
-			return
-		}
 
-		datasetFile, imageFiles, err := parseUploads(form)
+		runID, err := store.Create()
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
-		runID, runPath, err := createRunDir(runsDir)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create run directory"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create run"})
 			return
 		}
 		cleanupRun := true
 		defer func() {
 			if cleanupRun {
-				_ = os.RemoveAll(runPath)
+				_ = store.Delete(runID)
 			}
 		}()
 
-		if err := saveRunFiles(runPath, datasetFile, imageFiles); err != nil {
+		in.Images, err = saveRunFiles(store, runID, datasetFile, imageFiles)
+		if err != nil {
 			log.Printf("save run files: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save run files"})
 			return
 		}
 
-		evalOut, err := resolveEvaluationResult(c.Request.Context(), form, policyConfig, runsDir, datasetFile, imageFiles)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if async {
+			job, err := jobs.submit(runID, in)
+			if errors.Is(err, ErrJobQueueFull) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				log.Printf("submit job %s: %v", runID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue evaluation"})
+				return
+			}
+			cleanupRun = false
+			c.JSON(http.StatusAccepted, job)
 			return
 		}
 
-		overallPass, maxSeverity, policyThreshold := computePolicyResult(evalOut, policyConfig)
-		status := "FAIL"
-		if overallPass {
-			status = "PASS"
-		}
-
-		policyJSON, err := jsonBytes(policyConfig)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode policy_config"})
-			return
-		}
-		evalJSON, err := jsonBytes(evalOut)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode evaluation result"})
-			return
-		}
-		datasetDigest, err := datasetDigestHex(datasetFile)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute dataset digest"})
-			return
-		}
-		witness, err := buildPolicyWitness(policyConfig, evalOut)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "proof generation failed"})
-			return
-		}
-		witness.DatasetDigestHex = datasetDigest
-		commitment, err := zk.CommitmentPoseidon(datasetDigest, witness.Enabled, witness.MaxAllowed, witness.Severity)
+		resp, err := r.run(c.Request.Context(), runID, in, nil)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "proof generation failed"})
+			var re *runError
+			if errors.As(err, &re) {
+				c.JSON(re.status, gin.H{"error": re.msg})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "evaluation failed"})
+			}
 			return
 		}
+		cleanupRun = false
+		c.JSON(http.StatusOK, resp)
+	}
+}
 
-		log.Printf("policy_config=%s", string(policyJSON))
-		log.Printf("evaluation_result=%s", string(evalJSON))
-		proof, err := zk.GenerateProof(zk.PublicInputs{
-			PolicyThreshold: policyThreshold,
-			MaxSeverity:     maxSeverity,
-			OverallPass:     overallPass,
-			Commitment:      commitment,
-			Witness:         witness,
-		})
+func asyncQuery(v string) (bool, error) {
+	switch v {
+	case "", "0", "false":
+		return false, nil
+	case "1", "true":
+		return true, nil
+	default:
+		return false, fmt.Errorf("async must be 1 or 0")
+	}
+}
+
+// runInput is what a run is evaluated from besides the files saved in its
+// directory. Queued jobs persist it, so they can be resumed after a restart.
+type runInput struct {
+	PolicyConfig     PolicyConfig `json:"policy_config"`
+	EvaluationName   string       `json:"evaluation_name,omitempty"`
+	DatasetDigestAlg string       `json:"dataset_digest_alg"`
+	DatasetDigest    string       `json:"dataset_digest"`
+	// DatasetSalt is the secret the leaf salts of a DatasetDigestMerkle
+	// digest are derived from.
+	DatasetSalt string `json:"dataset_salt,omitempty"`
+	// EvaluationResult is the client's evaluation_result, if it sent one.
+	EvaluationResult string     `json:"evaluation_result,omitempty"`
+	Images           []runImage `json:"images,omitempty"`
+}
+
+// runImage is an uploaded image saved as the run's artifact File.
+type runImage struct {
+	File     string `json:"file"`
+	Filename string `json:"filename"`
+	MIMEType string `json:"mime_type"`
+}
+
+// parseRunInput validates an evaluate form. Every error it returns is the
+// client's.
+func parseRunInput(form *multipart.Form) (runInput, *multipart.FileHeader, []*multipart.FileHeader, error) {
+	var in runInput
+	policyRaw, policyProvided, err := optionalFormValue(form, "policy_config")
+	if err != nil {
+		return runInput{}, nil, nil, err
+	}
+	if policyProvided {
+		in.PolicyConfig, err = parsePolicyConfig(policyRaw)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "proof generation failed"})
-			return
+			return runInput{}, nil, nil, err
+		}
+		if err := validatePolicyConfig(in.PolicyConfig); err != nil {
+			return runInput{}, nil, nil, err
 		}
-		verified, reason, err := zk.VerifyProof(proof.ProofB64, proof.PublicInputsB64)
+	} else if len(form.Value["spec"]) > 0 {
+		spec, err := parseSpec(form)
 		if err != nil {
-			log.Printf("proof verify error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "proof verification failed"})
-			return
+			return runInput{}, nil, nil, err
 		}
-		if !verified {
-			log.Printf("proof verify failed: %s", reason)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "proof verification failed"})
-			return
+		if err := validateSpec(spec); err != nil {
+			return runInput{}, nil, nil, err
 		}
+		in.PolicyConfig = policyConfigFromSpec(spec)
+		in.EvaluationName = spec.EvaluationName
+	} else {
+		return runInput{}, nil, nil, fmt.Errorf("missing field: policy_config")
+	}
 
-		if err := saveRunMetadata(runPath, policyConfig, evalOut); err != nil {
-			log.Printf("save run metadata: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to persist run metadata"})
-			return
+	datasetFile, imageFiles, err := parseUploads(form)
+	if err != nil {
+		return runInput{}, nil, nil, err
+	}
+	digestAlg, digestProvided, err := optionalFormValue(form, "dataset_digest")
+	if err != nil {
+		return runInput{}, nil, nil, err
+	}
+	if !digestProvided {
+		digestAlg = defaultDigestAlg(datasetFile)
+	}
+	in.DatasetDigestAlg = digestAlg
+	if digestAlg == DatasetDigestMerkle {
+		if in.DatasetSalt, err = newDatasetSalt(); err != nil {
+			return runInput{}, nil, nil, err
 		}
+	}
+	in.DatasetDigest, err = datasetDigest(datasetFile, digestAlg, in.DatasetSalt)
+	if err != nil {
+		return runInput{}, nil, nil, err
+	}
+	if _, provided, err := parseEvaluationResultProvided(form, in.PolicyConfig); err != nil {
+		return runInput{}, nil, nil, err
+	} else if provided {
+		in.EvaluationResult, _, _ = rawEvaluationResult(form)
+	}
+	return in, datasetFile, imageFiles, nil
+}
 
-		cleanupRun = false
-		if err := updateRunsIndex(runsDir, config.RunsIndexLimit(), RunIndexEntry{
-			RunID:          runID,
-			Status:         status,
-			Timestamp:      time.Now().Unix(),
-			EvaluationName: "",
-		}); err != nil {
-			log.Printf("runs index update: %v", err)
-		}
+// runner runs the evaluation pipeline for requests and queued jobs alike.
+type runner struct {
+	store RunStore
+	// cacheDir holds Gemini's cached results.
+	cacheDir string
+	maxRuns  int
+	issuer   *crypto.Issuer
+}
 
-		if err := pruneRuns(runsDir, maxRuns); err != nil {
-			log.Printf("prune runs: %v", err)
-		}
+// runError is a pipeline failure with the status and message a synchronous
+// request reports it with.
+type runError struct {
+	status int
+	msg    string
+}
 
-		c.JSON(http.StatusOK, EvaluateResponse{
-			RunID:           runID,
-			Status:          status,
-			OverallPass:     overallPass,
-			MaxSeverity:     maxSeverity,
-			Commitment:      commitment,
-			ProofB64:        proof.ProofB64,
-			PublicInputsB64: proof.PublicInputsB64,
-			PublicOutput: PublicOutput{
-				OverallPass:     overallPass,
-				MaxSeverity:     maxSeverity,
-				PolicyThreshold: policyThreshold,
-				Commitment:      commitment,
-			},
-			Proof: Proof{
-				System:          proof.System,
-				Curve:           proof.Curve,
-				ProofB64:        proof.ProofB64,
-				PublicInputsB64: proof.PublicInputsB64,
-			},
-			Verified: verified,
-		})
-	}
+func (e *runError) Error() string {
+	return e.msg
 }
 
-type runEntry struct {
-	path    string
-	modTime time.Time
+func internalRunError(msg string) error {
+	return &runError{status: http.StatusInternalServerError, msg: msg}
 }
 
-func pruneRuns(runsDir string, maxRuns int) error {
-	if maxRuns <= 0 {
-		return nil
+// run evaluates the stored run runID, proves the policy result and
+// persists the run's artifacts. emit, if set, is told of each step.
+func (r runner) run(ctx context.Context, runID string, in runInput, emit func(JobEvent)) (EvaluateResponse, error) {
+	if emit == nil {
+		emit = func(JobEvent) {}
 	}
-	entries, err := os.ReadDir(runsDir)
+	policyConfig, evaluationName, digestAlg, datasetDigest := in.PolicyConfig, in.EvaluationName, in.DatasetDigestAlg, in.DatasetDigest
+
+	emit(stageEvent(JobEvaluating))
+	ev, err := resolveEvaluationResult(ctx, in, r.cacheDir, r.store, runID, emit)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return err
+		return EvaluateResponse{}, &runError{status: http.StatusBadRequest, msg: err.Error()}
 	}
+	evalOut, sample := ev.Result, ev.Sample
 
-	var runs []runEntry
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-		if !strings.HasPrefix(entry.Name(), "run_") {
-			continue
+	emit(stageEvent(JobProving))
+	overallPass, maxSeverity, policyThreshold := computePolicyResult(evalOut, policyConfig)
+	status := "FAIL"
+	if overallPass {
+		status = "PASS"
+	}
+
+	policyJSON, err := jsonBytes(policyConfig)
+	if err != nil {
+		return EvaluateResponse{}, internalRunError("failed to encode policy_config")
+	}
+	evalJSON, err := jsonBytes(evalOut)
+	if err != nil {
+		return EvaluateResponse{}, internalRunError("failed to encode evaluation result")
+	}
+	witness, err := buildPolicyWitness(policyConfig, evalOut)
+	if err != nil {
+		return EvaluateResponse{}, &runError{status: http.StatusBadRequest, msg: err.Error()}
+	}
+	witness.DatasetDigestHex = datasetDigest
+	witness.Provenance = &ev.Provenance
+	witness.Salt, err = zk.NewCommitmentSalt()
+	if err != nil {
+		log.Printf("commitment salt: %v", err)
+		return EvaluateResponse{}, internalRunError("proof generation failed")
+	}
+	opening := zk.OpeningFromWitness(witness)
+	if sample != nil {
+		opening = zk.SampledOpening(witness, *sample)
+	}
+	witness, err = opening.Witness()
+	if err != nil {
+		log.Printf("commitment witness: %v", err)
+		return EvaluateResponse{}, internalRunError("proof generation failed")
+	}
+	commitment, err := zk.CommitmentPoseidon(witness)
+	if err != nil {
+		return EvaluateResponse{}, internalRunError("proof generation failed")
+	}
+	policyHash, err := zk.PolicyHashPoseidon(witness)
+	if err != nil {
+		return EvaluateResponse{}, internalRunError("proof generation failed")
+	}
+	reveal := policyConfig.revealAll()
+
+	log.Printf("policy_config=%s", string(policyJSON))
+	log.Printf("evaluation_result=%s", string(evalJSON))
+	emit(proofEvent("started"))
+	proof, err := zk.GenerateProof(zk.PublicInputs{
+		PolicyThreshold: policyThreshold,
+		MaxSeverity:     maxSeverity,
+		OverallPass:     overallPass,
+		Commitment:      commitment,
+		PolicyHash:      policyHash,
+		HideMaxSeverity: !reveal.MaxSeverity,
+		HideCommitment:  !reveal.Commitment,
+		Witness:         witness,
+	})
+	if err != nil {
+		log.Printf("generate proof for %s: %v", runID, err)
+		return EvaluateResponse{}, internalRunError("proof generation failed")
+	}
+	publicInputs, err := zk.DecodePublicInputsB64(proof.PublicInputsB64)
+	if err != nil {
+		log.Printf("decode public inputs: %v", err)
+		return EvaluateResponse{}, internalRunError("proof generation failed")
+	}
+	publicOutput := publicInputs.Outputs()
+	verified, reason, err := zk.VerifyProof(proof.ProofB64, proof.PublicInputsB64)
+	if err != nil {
+		log.Printf("proof verify error: %v", err)
+		return EvaluateResponse{}, internalRunError("proof verification failed")
+	}
+	if !verified {
+		log.Printf("proof verify failed: %s", reason)
+		return EvaluateResponse{}, internalRunError("proof verification failed")
+	}
+	emit(proofEvent("finished"))
+
+	if err := saveRunMetadata(r.store, runID, policyConfig, evalOut); err != nil {
+		log.Printf("save run metadata: %v", err)
+		return EvaluateResponse{}, internalRunError("failed to persist run metadata")
+	}
+	if err := saveCommitmentRecord(r.store, runID, CommitmentRecord{
+		Version:          opening.Version,
+		Salt:             witness.Salt,
+		DatasetDigest:    datasetDigest,
+		DatasetDigestAlg: digestAlg,
+		DatasetSalt:      in.DatasetSalt,
+		Sample:           sample,
+		Provenance:       witness.Provenance,
+		Commitment:       commitment,
+	}); err != nil {
+		log.Printf("save commitment: %v", err)
+		return EvaluateResponse{}, internalRunError("failed to persist run metadata")
+	}
+
+	proofBundle := bundle.FromProof(proof, bundle.Run{
+		RunID:            runID,
+		CreatedAt:        time.Now().UTC().Format(time.RFC3339),
+		EvaluationName:   evaluationName,
+		PolicyVersion:    policyConfig.PolicyVersion,
+		Status:           status,
+		DatasetDigestAlg: digestAlg,
+		PublicOutput:     publicOutput,
+	})
+	if r.issuer != nil {
+		if err := bundle.Sign(&proofBundle, r.issuer); err != nil {
+			log.Printf("sign attestation: %v", err)
+			return EvaluateResponse{}, internalRunError("failed to sign attestation")
 		}
-		info, err := entry.Info()
-		if err != nil {
-			continue
+	}
+	if err := saveBundle(r.store, runID, proofBundle); err != nil {
+		log.Printf("save bundle: %v", err)
+		return EvaluateResponse{}, internalRunError("failed to persist run metadata")
+	}
+
+	resp := EvaluateResponse{
+		RunID:           runID,
+		Status:          status,
+		OverallPass:     overallPass,
+		MaxSeverity:     publicOutput.MaxSeverity,
+		Commitment:      publicOutput.Commitment,
+		ProofB64:        proof.ProofB64,
+		PublicInputsB64: proof.PublicInputsB64,
+		PublicOutput:    publicOutput,
+		Proof:           proofBundle.Proof,
+		Verified:        verified,
+	}
+	if proof.System == zk.ProofSystemGroth16 {
+		if sj, err := snarkJSOutput(proof); err == nil {
+			resp.SnarkJS = sj
+		} else {
+			log.Printf("snarkjs export: %v", err)
 		}
-		runs = append(runs, runEntry{
-			path:    filepath.Join(runsDir, entry.Name()),
-			modTime: info.ModTime(),
-		})
+	}
+	if proofBundle.Signature != nil {
+		att := bundle.Attestation(proofBundle)
+		resp.Attestation = &att
+		resp.Signature = proofBundle.Signature
+	}
+	manifest := RunManifest{
+		EvaluateResponse: resp,
+		CreatedAt:        proofBundle.Run.CreatedAt,
+		EvaluationName:   evaluationName,
+		PolicyVersion:    policyConfig.PolicyVersion,
+		DatasetDigest:    datasetDigest,
+		DatasetDigestAlg: digestAlg,
+		Provenance:       witness.Provenance,
+	}
+	if err := saveRunManifest(r.store, runID, manifest); err != nil {
+		log.Printf("save run manifest: %v", err)
+		return EvaluateResponse{}, internalRunError("failed to persist run metadata")
 	}
 
-	if len(runs) <= maxRuns {
-		return nil
+	if err := pruneRuns(r.store, r.maxRuns); err != nil {
+		log.Printf("prune runs: %v", err)
 	}
 
-	sort.Slice(runs, func(i, j int) bool {
-		return runs[i].modTime.After(runs[j].modTime)
-	})
+	return resp, nil
+}
 
-	for i := maxRuns; i < len(runs); i++ {
-		if err := os.RemoveAll(runs[i].path); err != nil {
+func snarkJSOutput(proof zk.Proof) (*SnarkJSOutput, error) {
+	p, err := zk.SnarkJSProofB64(proof.ProofB64, proof.PublicInputsB64)
+	if err != nil {
+		return nil, err
+	}
+	signals, err := zk.SnarkJSPublicSignals(proof.PublicInputsB64)
+	if err != nil {
+		return nil, err
+	}
+	return &SnarkJSOutput{Proof: p, PublicSignals: signals}, nil
+}
+
+// pruneRuns deletes the least recently updated runs beyond maxRuns. The
+// runs of aggregation jobs don't count toward it: they are pruned beyond
+// maxRuns of their own, so aggregating never pushes out a run. Runs whose
+// jobs haven't finished are kept.
+func pruneRuns(store RunStore, maxRuns int) error {
+	if maxRuns <= 0 {
+		return nil
+	}
+	for _, aggregations := range []bool{false, true} {
+		if _, err := store.Prune(maxRuns, func(runID string) bool {
+			active, aggregation := jobState(store, runID)
+			return active || aggregation != aggregations
+		}); err != nil {
 			return err
 		}
 	}
@@ -316,35 +503,42 @@ func jsonBytes(v any) ([]byte, error) {
 }
 
 func parseEvaluationResultProvided(form *multipart.Form, cfg PolicyConfig) (EvaluationResult, bool, error) {
+	raw, provided, err := rawEvaluationResult(form)
+	if err != nil || !provided {
+		return EvaluationResult{}, provided, err
+	}
+	out, err := parseEvaluationResult(raw)
+	if err != nil {
+		return EvaluationResult{}, true, err
+	}
+	if err := validateEvaluationResult(out, cfg); err != nil {
+		return EvaluationResult{}, true, err
+	}
+	return out, true, nil
+}
+
+// rawEvaluationResult returns the client's evaluation_result form value,
+// or the legacy eval_output, trimmed.
+func rawEvaluationResult(form *multipart.Form) (string, bool, error) {
 	if form == nil {
-		return EvaluationResult{}, false, nil
+		return "", false, nil
 	}
 	if len(form.Value["evaluation_result"]) > 1 || len(form.Value["eval_output"]) > 1 {
-		return EvaluationResult{}, true, fmt.Errorf("only one evaluation_result value allowed")
+		return "", true, fmt.Errorf("only one evaluation_result value allowed")
 	}
 	hasEval := len(form.Value["evaluation_result"]) > 0
 	hasLegacy := len(form.Value["eval_output"]) > 0
 	raw := strings.TrimSpace(formValue(form, "evaluation_result"))
 	if raw == "" && hasEval {
-		return EvaluationResult{}, true, fmt.Errorf("evaluation_result must be non-empty")
+		return "", true, fmt.Errorf("evaluation_result must be non-empty")
 	}
 	if raw == "" {
 		raw = strings.TrimSpace(formValue(form, "eval_output"))
 		if raw == "" && hasLegacy {
-			return EvaluationResult{}, true, fmt.Errorf("evaluation_result must be non-empty")
+			return "", true, fmt.Errorf("evaluation_result must be non-empty")
 		}
 	}
-	if raw == "" {
-		return EvaluationResult{}, false, nil
-	}
-	out, err := parseEvaluationResult(raw)
-	if err != nil {
-		return EvaluationResult{}, true, err
-	}
-	if err := validateEvaluationResult(out, cfg); err != nil {
-		return EvaluationResult{}, true, err
-	}
-	return out, true, nil
+	return raw, raw != "", nil
 }
 
 func singleFormValue(form *multipart.Form, key string) (string, error) {
@@ -382,66 +576,36 @@ func formValue(form *multipart.Form, key string) string {
 	return form.Value[key][0]
 }
 
-var policyConstraintOrder = []string{
-	"pii_exposure_risk",
-	"regulated_sensitive_data_presence",
-	"data_provenance_or_consent_violation_risk",
-	"safety_critical_advisory_presence",
-	"harm_enabling_content_risk",
-	"dataset_intended_use_mismatch",
-}
-
+// buildPolicyWitness lays out one circuit slot per policy constraint, in
+// config order. Preset and custom constraints are treated alike; the circuit
+// binds each slot to its constraint ID.
 func buildPolicyWitness(cfg PolicyConfig, out EvaluationResult) (*zk.WitnessInputs, error) {
-	if len(policyConstraintOrder) != zk.PolicyGateConstraintCount {
-		return nil, fmt.Errorf("policy constraint ordering mismatch")
-	}
-	cfgByID := make(map[string]PolicyConstraint, len(cfg.Constraints))
-	for _, c := range cfg.Constraints {
-		cfgByID[c.ID] = c
+	if len(cfg.Constraints) > zk.MaxPolicyConstraints {
+		return nil, fmt.Errorf("policy has %d constraints; at most %d are supported", len(cfg.Constraints), zk.MaxPolicyConstraints)
 	}
 	resultsByID := make(map[string]EvalResultItem, len(out.Results))
 	for _, r := range out.Results {
 		resultsByID[r.ID] = r
 	}
 
-	known := make(map[string]struct{}, len(policyConstraintOrder))
-	for _, id := range policyConstraintOrder {
-		known[id] = struct{}{}
+	n := len(cfg.Constraints)
+	witness := &zk.WitnessInputs{
+		ConstraintIDs: make([]string, n),
+		Enabled:       make([]uint64, n),
+		MaxAllowed:    make([]uint64, n),
+		Severity:      make([]uint64, n),
 	}
-	for id := range cfgByID {
-		if _, ok := known[id]; !ok {
-			return nil, fmt.Errorf("unsupported constraint id: %s", id)
-		}
-	}
-
-	var enabled [zk.PolicyGateConstraintCount]uint64
-	var maxAllowed [zk.PolicyGateConstraintCount]uint64
-	var severity [zk.PolicyGateConstraintCount]uint64
-
-	for i, id := range policyConstraintOrder {
-		c, ok := cfgByID[id]
+	for i, c := range cfg.Constraints {
+		r, ok := resultsByID[c.ID]
 		if !ok {
-			enabled[i] = 0
-			maxAllowed[i] = 0
-			severity[i] = 0
-			continue
+			return nil, fmt.Errorf("missing evaluation result for %s", c.ID)
 		}
+		witness.ConstraintIDs[i] = c.ID
 		if c.Enabled {
-			enabled[i] = 1
-		} else {
-			enabled[i] = 0
+			witness.Enabled[i] = 1
 		}
-		maxAllowed[i] = uint64(c.MaxAllowed)
-		r, ok := resultsByID[id]
-		if !ok {
-			return nil, fmt.Errorf("missing evaluation result for %s", id)
-		}
-		severity[i] = uint64(r.Severity)
+		witness.MaxAllowed[i] = uint64(c.MaxAllowed)
+		witness.Severity[i] = uint64(r.Severity)
 	}
-
-	return &zk.WitnessInputs{
-		Enabled:    enabled,
-		MaxAllowed: maxAllowed,
-		Severity:   severity,
-	}, nil
+	return witness, nil
 }
@@ -2,14 +2,21 @@ package evaluate
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"noema/internal/bundle"
+	"noema/internal/crypto"
+	"noema/internal/zk"
+	"noema/internal/zk/aggregate"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -17,7 +24,8 @@ func TestEvaluateHandler_WithEvaluationResult(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
 	runsDir := t.TempDir()
-	router.POST("/api/evaluate", Handler(runsDir, 0))
+	store := NewFSRunStore(runsDir)
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, nil))
 
 	cfg := PolicyConfig{
 		PolicyVersion: "noema_policy_v1",
@@ -49,19 +57,643 @@ func TestEvaluateHandler_WithEvaluationResult(t *testing.T) {
 	if resp.Status != "FAIL" {
 		t.Fatalf("expected status FAIL, got %s", resp.Status)
 	}
-	if resp.PublicOutput.MaxSeverity != 2 {
-		t.Fatalf("expected max severity 2, got %d", resp.PublicOutput.MaxSeverity)
+	if resp.PublicOutput.MaxSeverity == nil || *resp.PublicOutput.MaxSeverity != 2 {
+		t.Fatalf("expected max severity 2, got %v", resp.PublicOutput.MaxSeverity)
 	}
 	if resp.Proof.ProofB64 == "" || resp.Proof.PublicInputsB64 == "" {
 		t.Fatalf("expected proof fields to be populated")
 	}
+	if resp.Proof.VKFingerprint == "" || resp.Proof.CircuitID == "" || resp.Proof.KeyID == "" {
+		t.Fatalf("expected proof to carry circuit id, key id and vk fingerprint")
+	}
+
+	recPath := filepath.Join(runsDir, resp.RunID, commitmentFile)
+	info, err := os.Stat(recPath)
+	if err != nil {
+		t.Fatalf("stat commitment record: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected commitment record to be owner-only, got %v", info.Mode().Perm())
+	}
+	raw, err := os.ReadFile(recPath)
+	if err != nil {
+		t.Fatalf("read commitment record: %v", err)
+	}
+	var stored CommitmentRecord
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		t.Fatalf("decode commitment record: %v", err)
+	}
+	if stored.Version != zk.CommitmentVersionV5 || stored.Salt == "" || stored.Commitment != resp.Commitment {
+		t.Fatalf("unexpected commitment record %+v", stored)
+	}
+	// A client-supplied result is bound as such, with the hash of the raw
+	// form value.
+	rawEval, err := json.Marshal(evalOut)
+	if err != nil {
+		t.Fatalf("marshal evaluation result: %v", err)
+	}
+	if p := stored.Provenance; p == nil || p.Kind != zk.EvaluatorClient || p.Model != "" || p.PromptVersion != "" || p.ResponseHash != zk.ResponseHash(rawEval) {
+		t.Fatalf("unexpected provenance %+v", stored.Provenance)
+	}
+	if resp.PublicOutput.EvaluatorKind != zk.EvaluatorClient {
+		t.Fatalf("expected the client evaluator kind to be disclosed, got %+v", resp.PublicOutput)
+	}
+	witness, err := buildPolicyWitness(cfg, evalOut)
+	if err != nil {
+		t.Fatalf("buildPolicyWitness error: %v", err)
+	}
+	witness.Salt = stored.Salt
+	witness.DatasetDigestHex = stored.DatasetDigest
+	witness.Provenance = stored.Provenance
+	reopened, err := zk.CommitmentPoseidon(witness)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	if reopened != resp.Commitment {
+		t.Fatalf("expected stored opening to recompute the commitment")
+	}
+}
+
+func TestOpeningHandler_ExportsStoredOpening(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := NewFSRunStore(t.TempDir())
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, nil))
+	router.GET("/api/runs/:id/opening", OpeningHandler(store))
+
+	cfg := PolicyConfig{
+		PolicyVersion: "noema_policy_v1",
+		Constraints: []PolicyConstraint{
+			{ID: "pii_exposure_risk", Enabled: true, MaxAllowed: 1},
+			{ID: "custom_tone", Enabled: false, MaxAllowed: 0},
+		},
+	}
+	body, contentType := buildMultipartEvalRequest(t, cfg, EvaluationResult{}, false)
+	req := httptest.NewRequest(http.MethodPost, "/api/evaluate", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var evalResp EvaluateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&evalResp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs/"+evalResp.RunID+"/opening", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp OpeningResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode opening: %v", err)
+	}
+	if resp.Commitment != evalResp.Commitment || resp.Opening.Version != zk.CommitmentVersionV5 || resp.DatasetDigestAlg != DatasetDigestJCS {
+		t.Fatalf("unexpected opening response %+v", resp)
+	}
+	// Without a Gemini key the stub evaluated the run, and the proof says so.
+	if p := resp.Opening.Provenance; p == nil || p.Kind != zk.EvaluatorStub || p.ResponseHash == "" {
+		t.Fatalf("expected stub provenance, got %+v", resp.Opening.Provenance)
+	}
+	if evalResp.PublicOutput.EvaluatorKind != zk.EvaluatorStub || evalResp.PublicOutput.PromptVersion != "" {
+		t.Fatalf("expected the stub evaluator kind to be disclosed, got %+v", evalResp.PublicOutput)
+	}
+	if resp.Opening.Sample == nil || len(resp.Opening.Sample.Indices) != 1 {
+		t.Fatalf("expected the opening to bind the evaluator's sample, got %+v", resp.Opening.Sample)
+	}
+	if strings.Join(resp.Opening.ConstraintIDs, ",") != "pii_exposure_risk,custom_tone" {
+		t.Fatalf("expected opening to list constraints in policy order, got %v", resp.Opening.ConstraintIDs)
+	}
+	pi, err := zk.DecodePublicInputsB64(evalResp.Proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("DecodePublicInputsB64 error: %v", err)
+	}
+	check, err := resp.Opening.Check(pi)
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if !check.Matches() {
+		t.Fatalf("expected exported opening to match the proof, got %+v", check)
+	}
+
+	for _, id := range []string{"run_999", "..", "run_1%2F..%2F..", "index.json"} {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs/"+id+"/opening", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for %q, got %d", id, rec.Code)
+		}
+	}
+}
+
+func TestBundleHandler_ServesRunBundle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := NewFSRunStore(t.TempDir())
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, nil))
+	router.GET("/api/runs/:id/bundle", BundleHandler(store))
+
+	cfg := PolicyConfig{
+		PolicyVersion: "noema_policy_v1",
+		Constraints: []PolicyConstraint{
+			{ID: "pii_exposure_risk", Enabled: true, MaxAllowed: 1},
+		},
+	}
+	body, contentType := buildMultipartEvalRequest(t, cfg, EvaluationResult{}, false)
+	req := httptest.NewRequest(http.MethodPost, "/api/evaluate", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var evalResp EvaluateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&evalResp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs/"+evalResp.RunID+"/bundle", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Disposition"); !strings.Contains(got, evalResp.RunID+bundle.FileExtension) {
+		t.Fatalf("unexpected Content-Disposition %q", got)
+	}
+	b, err := bundle.Parse(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if b.Run.RunID != evalResp.RunID || b.Run.Status != evalResp.Status || b.Proof != evalResp.Proof {
+		t.Fatalf("bundle does not match the evaluate response: %+v", b)
+	}
+	if b.Run.DatasetDigestAlg != DatasetDigestJCS {
+		t.Fatalf("expected bundle to record the dataset digest algorithm, got %q", b.Run.DatasetDigestAlg)
+	}
+	res, err := bundle.Verify(b)
+	if err != nil || !res.Verified {
+		t.Fatalf("expected stored bundle to verify, got %+v, %v", res, err)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs/run_404/bundle", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown run, got %d", rec.Code)
+	}
+}
+
+func TestRunHandlers_ServeStoredRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := NewFSRunStore(t.TempDir())
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, nil))
+	router.GET("/api/runs/:id", RunHandler(store))
+	router.GET("/api/public/runs/:id", PublicRunHandler(store))
+
+	cfg := PolicyConfig{
+		PolicyVersion: "noema_policy_v1",
+		Constraints: []PolicyConstraint{
+			{ID: "pii_exposure_risk", Enabled: true, MaxAllowed: 1},
+			{ID: "custom_tone", Enabled: false, MaxAllowed: 0},
+		},
+	}
+	body, contentType := buildMultipartEvalRequest(t, cfg, EvaluationResult{}, false)
+	req := httptest.NewRequest(http.MethodPost, "/api/evaluate", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var evalResp EvaluateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&evalResp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	getDetail := func() RunDetail {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs/"+evalResp.RunID, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var d RunDetail
+		if err := json.NewDecoder(rec.Body).Decode(&d); err != nil {
+			t.Fatalf("decode run: %v", err)
+		}
+		return d
+	}
+	d := getDetail()
+	if d.RunID != evalResp.RunID || d.Status != evalResp.Status || d.Commitment != evalResp.Commitment ||
+		d.ProofB64 != evalResp.ProofB64 || d.PublicInputsB64 != evalResp.PublicInputsB64 || d.Proof != evalResp.Proof || !d.Verified {
+		t.Fatalf("stored run does not match the evaluate response: %+v", d.EvaluateResponse)
+	}
+	if d.ManifestVersion != RunManifestVersion || d.DatasetDigest == "" || d.DatasetDigestAlg != DatasetDigestJCS || d.PolicyVersion != cfg.PolicyVersion {
+		t.Fatalf("unexpected manifest %+v", d.RunManifest)
+	}
+	if d.Provenance == nil || d.Provenance.Kind != zk.EvaluatorStub {
+		t.Fatalf("expected stub provenance, got %+v", d.Provenance)
+	}
+	if len(d.ConstraintResults) != 2 || d.ConstraintResults[0].Rationale == "" || !d.ConstraintResults[1].Pass || d.ConstraintResults[1].Enabled {
+		t.Fatalf("unexpected constraint results %+v", d.ConstraintResults)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/public/runs/"+evalResp.RunID, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &fields); err != nil {
+		t.Fatalf("decode public run: %v", err)
+	}
+	for _, private := range []string{"dataset_digest", "policy_config", "evaluation_result", "constraint_results", "provenance"} {
+		if _, ok := fields[private]; ok {
+			t.Fatalf("public run exposes %s: %s", private, rec.Body.String())
+		}
+	}
+	if strings.Contains(rec.Body.String(), "rationale") {
+		t.Fatalf("public run exposes rationales: %s", rec.Body.String())
+	}
+	var pub PublicRun
+	if err := json.Unmarshal(rec.Body.Bytes(), &pub); err != nil {
+		t.Fatalf("decode public run: %v", err)
+	}
+	if pub.RunID != evalResp.RunID || pub.Status != evalResp.Status || pub.Proof != evalResp.Proof {
+		t.Fatalf("unexpected public run %+v", pub)
+	}
+
+	// Runs stored before run.json was written are read from their bundle.
+	runPath, err := store.runDir(evalResp.RunID)
+	if err != nil {
+		t.Fatalf("runDir: %v", err)
+	}
+	if err := os.Remove(filepath.Join(runPath, runManifestFile)); err != nil {
+		t.Fatalf("remove manifest: %v", err)
+	}
+	legacy := getDetail()
+	if legacy.Status != d.Status || legacy.Proof != d.Proof || legacy.DatasetDigest != d.DatasetDigest || legacy.CreatedAt != d.CreatedAt {
+		t.Fatalf("legacy run does not match its manifest: %+v", legacy.RunManifest)
+	}
+
+	for _, path := range []string{"/api/runs/run_404", "/api/public/runs/run_404", "/api/public/runs/..%2Fx"} {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for %s, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestEvaluateHandler_SignsAttestation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := NewFSRunStore(t.TempDir())
+	issuer, err := crypto.GenerateIssuer(filepath.Join(t.TempDir(), "issuer.pem"))
+	if err != nil {
+		t.Fatalf("GenerateIssuer error: %v", err)
+	}
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, issuer, nil))
+	router.GET("/api/runs/:id/bundle", BundleHandler(store))
+
+	cfg := PolicyConfig{
+		PolicyVersion: "noema_policy_v1",
+		Constraints: []PolicyConstraint{
+			{ID: "pii_exposure_risk", Enabled: true, MaxAllowed: 1},
+		},
+	}
+	body, contentType := buildMultipartEvalRequest(t, cfg, EvaluationResult{}, false)
+	req := httptest.NewRequest(http.MethodPost, "/api/evaluate", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var evalResp EvaluateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&evalResp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if evalResp.Attestation == nil || evalResp.Signature == nil {
+		t.Fatalf("expected a signed attestation, got %+v", evalResp)
+	}
+	att := *evalResp.Attestation
+	if att.RunID != evalResp.RunID || att.PublicInputsB64 != evalResp.PublicInputsB64 ||
+		att.VKFingerprint != evalResp.Proof.VKFingerprint || att.Commitment != evalResp.Commitment {
+		t.Fatalf("attestation does not describe the run: %+v", att)
+	}
+	if err := crypto.Verify(issuer.PublicKey(), att, *evalResp.Signature); err != nil {
+		t.Fatalf("expected response signature to verify: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs/"+evalResp.RunID+"/bundle", nil))
+	b, err := bundle.Parse(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if err := bundle.VerifySignature(b, issuer.PublicKey()); err != nil {
+		t.Fatalf("expected bundle signature to verify: %v", err)
+	}
+	b.Run.CreatedAt = "2000-01-01T00:00:00Z"
+	if err := bundle.VerifySignature(b, issuer.PublicKey()); err == nil {
+		t.Fatalf("expected signature over an edited bundle to fail")
+	}
+}
+
+func TestAggregateHandler_RejectsRuns(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := NewFSRunStore(t.TempDir())
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, nil))
+	agg := aggregate.New("", 4)
+	jobs := NewJobs(store, t.TempDir(), 0, nil, agg, 1, 4)
+	router.POST("/api/aggregate", AggregateHandler(store, agg, jobs))
+
+	cfg := PolicyConfig{
+		PolicyVersion: "noema_policy_v1",
+		Constraints: []PolicyConstraint{
+			{ID: "pii_exposure_risk", Enabled: true, MaxAllowed: 1},
+		},
+	}
+	evaluateRun := func(evalOut EvaluationResult, include bool) EvaluateResponse {
+		body, contentType := buildMultipartEvalRequest(t, cfg, evalOut, include)
+		req := httptest.NewRequest(http.MethodPost, "/api/evaluate", body)
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp EvaluateResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp
+	}
+	passed := evaluateRun(EvaluationResult{}, false)
+	passed2 := evaluateRun(EvaluationResult{}, false)
+	failed := evaluateRun(EvaluationResult{
+		EvalVersion: "noema_eval_v1",
+		Results: []EvalResultItem{
+			{ID: "pii_exposure_risk", Severity: 2, Rationale: "clear identifiers"},
+		},
+	}, true)
+
+	cases := []struct {
+		body   string
+		status int
+		want   string
+	}{
+		{`{"run_ids":["` + passed.RunID + `","` + failed.RunID + `"]}`, http.StatusUnprocessableEntity, `"run_id":"` + failed.RunID + `"`},
+		{`{"run_ids":["` + passed.RunID + `","` + passed2.RunID + `"]}`, http.StatusServiceUnavailable, "noema aggregate setup"},
+		{`{"run_ids":["` + passed.RunID + `"]}`, http.StatusBadRequest, "run_ids must list 2 to 4 runs"},
+		{`{"run_ids":["` + passed.RunID + `","` + passed.RunID + `"]}`, http.StatusBadRequest, "duplicate run_id"},
+		{`{"run_ids":["` + passed.RunID + `","run_404"]}`, http.StatusNotFound, "run not found: run_404"},
+		{`{"run_ids":`, http.StatusBadRequest, "invalid JSON body"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/aggregate", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tc.status || !strings.Contains(rec.Body.String(), tc.want) {
+			t.Fatalf("%s: expected %d with %q, got %d: %s", tc.body, tc.status, tc.want, rec.Code, rec.Body.String())
+		}
+	}
+
+	// A job whose keys are gone by the time it runs fails without setting
+	// them up.
+	runID, err := store.Create()
+	if err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+	if _, err := jobs.submitAggregate(runID, AggregateRequest{RunIDs: []string{passed.RunID, passed2.RunID}}); err != nil {
+		t.Fatalf("submitAggregate error: %v", err)
+	}
+	jobs.process(context.Background(), runID)
+	job, err := LoadJob(store, runID)
+	if err != nil {
+		t.Fatalf("LoadJob error: %v", err)
+	}
+	if job.Stage != JobFailed || !strings.Contains(job.Error, "not set up") || job.Aggregate != nil {
+		t.Fatalf("expected the job to fail for want of keys, got %+v", job)
+	}
+}
+
+func TestEvaluateHandler_SamplesVerifiably(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("NOEMA_SAMPLE_ITEMS", "2")
+	router := gin.New()
+	store := NewFSRunStore(t.TempDir())
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, nil))
+	router.GET("/api/runs/:id/opening", OpeningHandler(store))
+
+	cfg := PolicyConfig{
+		PolicyVersion: "noema_policy_v1",
+		Constraints: []PolicyConstraint{
+			{ID: "pii_exposure_risk", Enabled: true, MaxAllowed: 1},
+		},
+	}
+	dataset := `{"items":[
+		{"id":"a","text":"first"},
+		{"id":"b","text":"second"},
+		{"id":"c","text":"third"},
+		{"id":"d","text":"fourth"},
+		{"id":"e","text":"fifth"}
+	]}`
+	body, contentType := buildMultipartEvalRequestWithDataset(t, cfg, dataset, nil)
+	req := httptest.NewRequest(http.MethodPost, "/api/evaluate", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var evalResp EvaluateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&evalResp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs/"+evalResp.RunID+"/opening", nil))
+	var resp OpeningResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode opening: %v", err)
+	}
+	sample := resp.Opening.Sample
+	if resp.Opening.Version != zk.CommitmentVersionV5 || sample == nil {
+		t.Fatalf("expected a sampled opening, got %+v", resp.Opening)
+	}
+	if sample.DatasetSize != 5 || sample.Limit != 2 || len(sample.Indices) != 2 {
+		t.Fatalf("unexpected sample %+v", sample)
+	}
+	pi, err := zk.DecodePublicInputsB64(evalResp.Proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("DecodePublicInputsB64 error: %v", err)
+	}
+	if check, err := resp.Opening.Check(pi); err != nil || !check.Matches() {
+		t.Fatalf("expected opening to match the proof, got %+v, %v", check, err)
+	}
+
+	items, err := SampledItems([]byte(dataset), resp.DatasetDigestAlg, resp.DatasetSalt, resp.Opening)
+	if err != nil {
+		t.Fatalf("SampledItems error: %v", err)
+	}
+	var sampled Dataset
+	if err := json.Unmarshal(items, &sampled); err != nil {
+		t.Fatalf("decode sampled items: %v", err)
+	}
+	ids := "abcde"
+	if len(sampled.Items) != 2 || sampled.Items[0].ID != ids[sample.Indices[0]:sample.Indices[0]+1] || sampled.Items[1].ID != ids[sample.Indices[1]:sample.Indices[1]+1] {
+		t.Fatalf("expected the items at %v, got %+v", sample.Indices, sampled.Items)
+	}
+	if _, err := SampledItems([]byte(strings.Replace(dataset, "fifth", "5th", 1)), resp.DatasetDigestAlg, resp.DatasetSalt, resp.Opening); err == nil {
+		t.Fatalf("expected another dataset not to reproduce the sample")
+	}
+
+	tampered := resp.Opening
+	moved := *sample
+	moved.Indices = []int{sample.Indices[0], (sample.Indices[1] + 1) % 5}
+	if moved.Indices[1] == moved.Indices[0] {
+		moved.Indices[1] = (moved.Indices[1] + 1) % 5
+	}
+	tampered.Sample = &moved
+	if _, err := tampered.Check(pi); err == nil {
+		t.Fatalf("expected a changed sample to be rejected")
+	}
+}
+
+func TestInclusionHandler_ProvesItems(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := NewFSRunStore(t.TempDir())
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, nil))
+	router.GET("/api/runs/:id/opening", OpeningHandler(store))
+	router.GET("/api/runs/:id/inclusion", InclusionHandler(store))
+
+	cfg := PolicyConfig{
+		PolicyVersion: "noema_policy_v1",
+		Constraints: []PolicyConstraint{
+			{ID: "pii_exposure_risk", Enabled: true, MaxAllowed: 1},
+		},
+	}
+	dataset := `{"items":[
+		{"id":"a","text":"first"},
+		{"id":"b","text":"second","metadata":{"z":1,"a":[true,null]}},
+		{"id":"c","text":"third <&>"}
+	]}`
+	evaluateRun := func(fields map[string]string) (int, EvaluateResponse) {
+		body, contentType := buildMultipartEvalRequestWithDataset(t, cfg, dataset, fields)
+		req := httptest.NewRequest(http.MethodPost, "/api/evaluate", body)
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var resp EvaluateResponse
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+		}
+		return rec.Code, resp
+	}
+	code, evalResp := evaluateRun(map[string]string{"dataset_digest": DatasetDigestMerkle})
+	if code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs/"+evalResp.RunID+"/opening", nil))
+	var opening OpeningResponse
+	if err := json.NewDecoder(rec.Body).Decode(&opening); err != nil {
+		t.Fatalf("decode opening: %v", err)
+	}
+	if opening.DatasetDigestAlg != DatasetDigestMerkle {
+		t.Fatalf("expected a Merkle digest, got %q", opening.DatasetDigestAlg)
+	}
+	if digest, err := DatasetDigestBytes([]byte(dataset), DatasetDigestMerkle, opening.DatasetSalt); err != nil || digest != opening.Opening.DatasetDigest {
+		t.Fatalf("expected the dataset and its salt to reproduce %s, got %s %v", opening.Opening.DatasetDigest, digest, err)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs/"+evalResp.RunID+"/inclusion?item_id=b&item_id=c", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp InclusionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode inclusion proofs: %v", err)
+	}
+	if resp.DatasetDigest != opening.Opening.DatasetDigest || resp.TreeSize != 3 || len(resp.Proofs) != 2 {
+		t.Fatalf("unexpected inclusion response %+v", resp)
+	}
+	for _, p := range resp.Proofs {
+		if err := VerifyInclusion(resp.DatasetDigest, resp.TreeSize, p); err != nil {
+			t.Fatalf("proof for %s does not verify: %v", p.ItemID, err)
+		}
+	}
+	if resp.Proofs[0].LeafSalt == resp.Proofs[1].LeafSalt || strings.Contains(rec.Body.String(), opening.DatasetSalt) {
+		t.Fatalf("expected distinct leaf salts and no dataset salt, got %+v", resp.Proofs)
+	}
+
+	// The dataset opening ties the root to the proof without the salt or
+	// the severities.
+	pi, err := zk.DecodePublicInputsB64(evalResp.Proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("DecodePublicInputsB64 error: %v", err)
+	}
+	if ok, err := resp.DatasetOpening.Check(pi); err != nil || !ok {
+		t.Fatalf("expected the dataset opening to reproduce the commitment, got %v %v", ok, err)
+	}
+	if resp.DatasetOpening.DatasetDigest != resp.DatasetDigest || strings.Contains(rec.Body.String(), opening.Opening.Salt) {
+		t.Fatalf("unexpected dataset opening %+v", resp.DatasetOpening)
+	}
+
+	forged := resp.Proofs[0]
+	forged.LeafSalt = resp.Proofs[1].LeafSalt
+	if err := VerifyInclusion(resp.DatasetDigest, resp.TreeSize, forged); err == nil {
+		t.Fatalf("expected another leaf's salt to fail")
+	}
+	forged = resp.Proofs[0]
+	forged.Item = json.RawMessage(`{"id":"b","text":"edited"}`)
+	if err := VerifyInclusion(resp.DatasetDigest, resp.TreeSize, forged); err == nil {
+		t.Fatalf("expected an edited item to fail")
+	}
+	forged = resp.Proofs[0]
+	forged.Item = json.RawMessage(`{"metadata":{"a":[true,null],"z":1},"text":"second","id":"b"}`)
+	if err := VerifyInclusion(resp.DatasetDigest, resp.TreeSize, forged); err != nil {
+		t.Fatalf("expected any encoding of the item to verify: %v", err)
+	}
+
+	for path, status := range map[string]int{
+		"/api/runs/" + evalResp.RunID + "/inclusion?item_id=zzz": http.StatusNotFound,
+		"/api/runs/" + evalResp.RunID + "/inclusion":             http.StatusBadRequest,
+		"/api/runs/run_404/inclusion?item_id=a":                  http.StatusNotFound,
+	} {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != status {
+			t.Fatalf("%s: expected %d, got %d", path, status, rec.Code)
+		}
+	}
+
+	_, flat := evaluateRun(nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs/"+flat.RunID+"/inclusion?item_id=a", nil))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a run without a Merkle digest, got %d", rec.Code)
+	}
+	if code, _ := evaluateRun(map[string]string{"dataset_digest": "md5"}); code != http.StatusBadRequest {
+		t.Fatalf("expected an unknown digest to be rejected, got %d", code)
+	}
 }
 
 func TestEvaluateHandler_StubEvaluationResult(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	runsDir := t.TempDir()
-	router.POST("/api/evaluate", Handler(runsDir, 0))
+	store := NewFSRunStore(t.TempDir())
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, nil))
 
 	cfg := PolicyConfig{
 		PolicyVersion: "noema_policy_v1",
@@ -88,19 +720,110 @@ func TestEvaluateHandler_StubEvaluationResult(t *testing.T) {
 	if resp.Status != "PASS" {
 		t.Fatalf("expected status PASS, got %s", resp.Status)
 	}
-	if resp.PublicOutput.MaxSeverity != 0 {
-		t.Fatalf("expected max severity 0, got %d", resp.PublicOutput.MaxSeverity)
+	if resp.PublicOutput.MaxSeverity == nil || *resp.PublicOutput.MaxSeverity != 0 {
+		t.Fatalf("expected max severity 0, got %v", resp.PublicOutput.MaxSeverity)
 	}
 	if resp.Proof.ProofB64 == "" || resp.Proof.PublicInputsB64 == "" {
 		t.Fatalf("expected proof fields to be populated")
 	}
 }
 
+func TestEvaluateHandler_HonorsReveal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := NewFSRunStore(t.TempDir())
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, nil))
+
+	cfg := PolicyConfig{
+		PolicyVersion: "noema_policy_v1",
+		Constraints: []PolicyConstraint{
+			{ID: "pii_exposure_risk", Enabled: true, MaxAllowed: 1},
+		},
+		Reveal: &RevealPolicy{MaxSeverity: false, Commitment: true},
+	}
+
+	body, contentType := buildMultipartEvalRequest(t, cfg, EvaluationResult{}, false)
+	req := httptest.NewRequest(http.MethodPost, "/api/evaluate", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), `"max_severity"`) {
+		t.Fatalf("expected max severity to be left out of the response: %s", rec.Body.String())
+	}
+
+	var resp EvaluateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Commitment == "" || resp.PublicOutput.Commitment != resp.Commitment {
+		t.Fatalf("expected commitment to be disclosed")
+	}
+	if strings.Join(resp.PublicOutput.Disclosed, ",") != "commitment,overall_pass,policy_threshold,policy_hash,evaluator_kind,prompt_version" {
+		t.Fatalf("unexpected disclosed outputs %v", resp.PublicOutput.Disclosed)
+	}
+	pi, err := zk.DecodePublicInputsB64(resp.Proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("DecodePublicInputsB64 error: %v", err)
+	}
+	if !pi.HideMaxSeverity || pi.HideCommitment {
+		t.Fatalf("expected public inputs to hide only max severity, got %+v", pi)
+	}
+	if !resp.Verified {
+		t.Fatalf("expected proof to verify")
+	}
+}
+
+func TestEvaluateHandler_ProvesCustomConstraints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := NewFSRunStore(t.TempDir())
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, nil))
+
+	cfg := PolicyConfig{
+		PolicyVersion: "noema_policy_v1",
+		Constraints: []PolicyConstraint{
+			{ID: "pii_exposure_risk", Enabled: true, MaxAllowed: 1},
+			{ID: "custom_medical_claims", Enabled: true, MaxAllowed: 0},
+		},
+	}
+	evalOut := EvaluationResult{
+		EvalVersion: "noema_eval_v1",
+		Results: []EvalResultItem{
+			{ID: "pii_exposure_risk", Severity: 0, Rationale: "none found"},
+			{ID: "custom_medical_claims", Severity: 1, Rationale: "one unsupported claim"},
+		},
+	}
+
+	body, contentType := buildMultipartEvalRequest(t, cfg, evalOut, true)
+	req := httptest.NewRequest(http.MethodPost, "/api/evaluate", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp EvaluateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Status != "FAIL" || !resp.Verified {
+		t.Fatalf("expected a verified FAIL from the custom constraint, got %s verified=%v", resp.Status, resp.Verified)
+	}
+	if resp.Proof.CircuitID != zk.PolicyGateCircuitID(8) {
+		t.Fatalf("expected the smallest circuit, got %s", resp.Proof.CircuitID)
+	}
+}
+
 func TestEvaluateHandler_AllowsAnyJSONDataset(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	runsDir := t.TempDir()
-	router.POST("/api/evaluate", Handler(runsDir, 0))
+	store := NewFSRunStore(t.TempDir())
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, nil))
 
 	cfg := PolicyConfig{
 		PolicyVersion: "noema_policy_v1",
@@ -109,7 +832,7 @@ func TestEvaluateHandler_AllowsAnyJSONDataset(t *testing.T) {
 		},
 	}
 
-	body, contentType := buildMultipartEvalRequestWithDataset(t, cfg, `{"any":"json","array":[1,2,3]}`)
+	body, contentType := buildMultipartEvalRequestWithDataset(t, cfg, `{"any":"json","array":[1,2,3]}`, nil)
 	req := httptest.NewRequest(http.MethodPost, "/api/evaluate", body)
 	req.Header.Set("Content-Type", contentType)
 	rec := httptest.NewRecorder()
@@ -118,13 +841,37 @@ func TestEvaluateHandler_AllowsAnyJSONDataset(t *testing.T) {
 	if rec.Code != http.StatusOK {
 		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
 	}
+
+	var resp EvaluateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	stored, err := loadCommitmentRecord(store, resp.RunID)
+	if err != nil {
+		t.Fatalf("loadCommitmentRecord error: %v", err)
+	}
+	if stored.DatasetDigestAlg != DatasetDigestSHA256 {
+		t.Fatalf("expected a non-items dataset to default to the raw digest, got %q", stored.DatasetDigestAlg)
+	}
+
+	// Merkle and canonical digests need items to build on.
+	for _, alg := range []string{DatasetDigestMerkle, DatasetDigestJCS} {
+		body, contentType = buildMultipartEvalRequestWithDataset(t, cfg, `{"any":"json","array":[1,2,3]}`, map[string]string{"dataset_digest": alg})
+		req = httptest.NewRequest(http.MethodPost, "/api/evaluate", body)
+		req.Header.Set("Content-Type", contentType)
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "dataset must match schema") {
+			t.Fatalf("expected status 400 for %s over a non-items dataset, got %d: %s", alg, rec.Code, rec.Body.String())
+		}
+	}
 }
 
 func TestEvaluateHandler_InvalidEvaluationResult(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	runsDir := t.TempDir()
-	router.POST("/api/evaluate", Handler(runsDir, 0))
+	store := NewFSRunStore(t.TempDir())
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, nil))
 
 	cfg := PolicyConfig{
 		PolicyVersion: "noema_policy_v1",
@@ -154,7 +901,8 @@ func TestEvaluateHandler_CleansUpFailedRun(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
 	runsDir := t.TempDir()
-	router.POST("/api/evaluate", Handler(runsDir, 0))
+	store := NewFSRunStore(runsDir)
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, nil))
 
 	cfg := PolicyConfig{
 		PolicyVersion: "noema_policy_v1",
@@ -193,8 +941,8 @@ func TestEvaluateHandler_CleansUpFailedRun(t *testing.T) {
 func TestEvaluateHandler_WithImages(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	runsDir := t.TempDir()
-	router.POST("/api/evaluate", Handler(runsDir, 0))
+	store := NewFSRunStore(t.TempDir())
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, nil))
 
 	cfg := PolicyConfig{
 		PolicyVersion: "noema_policy_v1",
@@ -253,7 +1001,7 @@ func buildMultipartEvalRequest(t *testing.T, cfg PolicyConfig, evalOut Evaluatio
 	return &buf, writer.FormDataContentType()
 }
 
-func buildMultipartEvalRequestWithDataset(t *testing.T, cfg PolicyConfig, datasetJSON string) (*bytes.Buffer, string) {
+func buildMultipartEvalRequestWithDataset(t *testing.T, cfg PolicyConfig, datasetJSON string, fields map[string]string) (*bytes.Buffer, string) {
 	t.Helper()
 
 	var buf bytes.Buffer
@@ -266,6 +1014,11 @@ func buildMultipartEvalRequestWithDataset(t *testing.T, cfg PolicyConfig, datase
 	if err := writer.WriteField("policy_config", string(policyRaw)); err != nil {
 		t.Fatalf("write policy_config field: %v", err)
 	}
+	for k, v := range fields {
+		if err := writer.WriteField(k, v); err != nil {
+			t.Fatalf("write %s field: %v", k, err)
+		}
+	}
 
 	part, err := writer.CreateFormFile("dataset", "dataset.json")
 	if err != nil {
@@ -2,16 +2,26 @@ package evaluate
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"mime/multipart"
+	"net/http"
 	"net/textproto"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"testing"
 	"time"
+
+	"noema/internal/gemini"
+	"noema/internal/sampling"
+	"noema/internal/zk"
+
+	"github.com/gin-gonic/gin"
 )
 
 type formFile struct {
@@ -273,6 +283,116 @@ func TestValidateDatasetJSON_RejectsEmptyFile(t *testing.T) {
 	}
 }
 
+func TestDatasetDigestBytes_CanonicalizesItems(t *testing.T) {
+	compact := []byte(`{"items":[{"id":"1","text":"caf\u00e9","metadata":{"b":1.0,"a":true}}]}`)
+	pretty := []byte("{\n  \"items\": [\n    {\"metadata\": {\"a\": true, \"b\": 1}, \"id\": \"1\", \"text\": \"café\"}\n  ]\n}\n")
+
+	a, err := DatasetDigestBytes(compact, DatasetDigestJCS, "")
+	if err != nil {
+		t.Fatalf("DatasetDigestBytes error: %v", err)
+	}
+	b, err := DatasetDigestBytes(pretty, DatasetDigestJCS, "")
+	if err != nil {
+		t.Fatalf("DatasetDigestBytes error: %v", err)
+	}
+	if a != b {
+		t.Fatalf("expected re-serialized datasets to share a canonical digest, got %s and %s", a, b)
+	}
+	rawA, _ := DatasetDigestBytes(compact, DatasetDigestSHA256, "")
+	rawB, _ := DatasetDigestBytes(pretty, DatasetDigestSHA256, "")
+	if rawA == rawB || rawA == a {
+		t.Fatalf("expected the legacy digest to hash the bytes as uploaded")
+	}
+
+	if _, err := DatasetDigestBytes([]byte(`{"items":[{"id":"1","text":"x"}],"items":[{"id":"2","text":"y"}]}`), DatasetDigestJCS, ""); err == nil {
+		t.Fatalf("expected duplicate members to be rejected")
+	}
+	if _, err := DatasetDigestBytes(compact, "md5", ""); err == nil {
+		t.Fatalf("expected unknown algorithm to be rejected")
+	}
+}
+
+func TestDatasetItemLeaf_IsJCS(t *testing.T) {
+	item := DatasetItem{ID: "1", Text: "a < b & c", Metadata: map[string]any{"z": "<tag>", "a": 1.5}}
+	leaf, err := DatasetItemLeaf(item)
+	if err != nil {
+		t.Fatalf("DatasetItemLeaf error: %v", err)
+	}
+	want := `{"id":"1","metadata":{"a":1.5,"z":"<tag>"},"text":"a < b & c"}`
+	if string(leaf) != want {
+		t.Fatalf("expected leaf %s, got %s", want, leaf)
+	}
+}
+
+func TestResolveEvaluationResult_SameDatasetSharesCache(t *testing.T) {
+	t.Setenv("GEMINI_API_KEY", "test")
+	t.Setenv("NOEMA_SAMPLE_ITEMS", "2")
+	cfg := PolicyConfig{
+		PolicyVersion: "noema_policy_v1",
+		Constraints: []PolicyConstraint{
+			{ID: "pii_exposure_risk", Enabled: true, MaxAllowed: 1},
+		},
+	}
+	dataset := []byte(`{"items":[{"id":"1","text":"a"},{"id":"2","text":"b"},{"id":"3","text":"c"},{"id":"4","text":"d"},{"id":"5","text":"e"}]}`)
+	digest, err := DatasetDigestBytes(dataset, DatasetDigestJCS, "")
+	if err != nil {
+		t.Fatalf("DatasetDigestBytes error: %v", err)
+	}
+	store := NewFSRunStore(t.TempDir())
+	cacheDir := t.TempDir()
+	newRun := func() string {
+		t.Helper()
+		runID, err := store.Create()
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := store.SaveArtifact(runID, runDatasetFile, dataset); err != nil {
+			t.Fatalf("SaveArtifact: %v", err)
+		}
+		return runID
+	}
+
+	// An earlier run over the same dataset cached Gemini's output for its sample.
+	sample, err := sampling.New(digest, 5, 2)
+	if err != nil {
+		t.Fatalf("sampling.New error: %v", err)
+	}
+	policyJSON, err := jsonBytes(cfg)
+	if err != nil {
+		t.Fatalf("jsonBytes: %v", err)
+	}
+	cached := stubEvaluationResult(cfg)
+	cached.Results[0].Rationale = "cached"
+	key := cacheKey(nil, digest, &sample, policyJSON, gemini.ModelName())
+	if err := saveCache(cacheDir, key, CachedGeminiOutput{Model: gemini.ModelName(), PromptVersion: promptVersion, Output: cached}); err != nil {
+		t.Fatalf("saveCache: %v", err)
+	}
+
+	second := newRun()
+	in := runInput{PolicyConfig: cfg, DatasetDigestAlg: DatasetDigestJCS, DatasetDigest: digest}
+	hit := false
+	ev, err := resolveEvaluationResult(context.Background(), in, cacheDir, store, second, func(e JobEvent) {
+		if e.Type == EventCache {
+			hit = e.Data.(gin.H)["cache"] == "hit"
+		}
+	})
+	if err != nil {
+		t.Fatalf("resolveEvaluationResult error: %v", err)
+	}
+	if !hit || ev.Result.Results[0].Rationale != "cached" {
+		t.Fatalf("expected the second run to hit the earlier run's cache entry, got %+v", ev.Result)
+	}
+	if ev.Sample == nil || ev.Sample.Seed != sample.Seed || !slices.Equal(ev.Sample.Indices, sample.Indices) {
+		t.Fatalf("expected the second run to sample %v, got %+v", sample.Indices, ev.Sample)
+	}
+
+	other := sample
+	other.Seed = strings.Repeat("07", sampling.SeedBytes)
+	if cacheKey(nil, digest, &other, policyJSON, gemini.ModelName()) == key {
+		t.Fatalf("expected runs with different seeds to use different cache entries")
+	}
+}
+
 func TestParseUploads_RejectsMultipleDatasetFiles(t *testing.T) {
 	dataset := `{"items":[{"id":"1","text":"hello"}]}`
 	form := buildMultipartForm(t, []formFile{
@@ -346,6 +466,53 @@ func TestValidatePolicyConfig_RejectsInvalidVersion(t *testing.T) {
 	}
 }
 
+func TestValidatePolicyConfig_RejectsTooManyConstraints(t *testing.T) {
+	cfg := PolicyConfig{PolicyVersion: "noema_policy_v1"}
+	for i := 0; i <= zk.MaxPolicyConstraints; i++ {
+		cfg.Constraints = append(cfg.Constraints, PolicyConstraint{ID: fmt.Sprintf("custom_%d", i), Enabled: true, MaxAllowed: 1})
+	}
+	if err := validatePolicyConfig(cfg); err == nil {
+		t.Fatalf("expected error for more than %d constraints", zk.MaxPolicyConstraints)
+	}
+}
+
+func TestValidateSpec_RejectsTooManyConstraints(t *testing.T) {
+	spec := Spec{SchemaVersion: 1, EvaluationName: "too many"}
+	for i := 0; i <= zk.MaxPolicyConstraints; i++ {
+		spec.CustomConstraints = append(spec.CustomConstraints, CustomConstraint{ID: fmt.Sprintf("custom_%d", i), Enabled: true, AllowedMaxSeverity: 1})
+	}
+	if err := validateSpec(spec); err == nil {
+		t.Fatalf("expected error for more than %d constraints", zk.MaxPolicyConstraints)
+	}
+}
+
+func TestRun_PolicyWitnessErrorIsClientError(t *testing.T) {
+	t.Setenv("GEMINI_API_KEY", "")
+	cfg := PolicyConfig{PolicyVersion: "noema_policy_v1"}
+	for i := 0; i <= zk.MaxPolicyConstraints; i++ {
+		cfg.Constraints = append(cfg.Constraints, PolicyConstraint{ID: fmt.Sprintf("custom_%d", i), Enabled: true, MaxAllowed: 1})
+	}
+	store := NewFSRunStore(t.TempDir())
+	runID, err := store.Create()
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	dataset := []byte(`{"items":[{"id":"1","text":"a"}]}`)
+	if err := store.SaveArtifact(runID, runDatasetFile, dataset); err != nil {
+		t.Fatalf("SaveArtifact: %v", err)
+	}
+	digest, err := DatasetDigestBytes(dataset, DatasetDigestJCS, "")
+	if err != nil {
+		t.Fatalf("DatasetDigestBytes error: %v", err)
+	}
+	in := runInput{PolicyConfig: cfg, DatasetDigestAlg: DatasetDigestJCS, DatasetDigest: digest}
+	_, err = runner{store: store, cacheDir: t.TempDir()}.run(context.Background(), runID, in, nil)
+	var re *runError
+	if !errors.As(err, &re) || re.status != http.StatusBadRequest || !strings.Contains(re.msg, "constraints") {
+		t.Fatalf("expected a 400 naming the constraint count, got %v", err)
+	}
+}
+
 func TestParsePolicyConfig_RejectsUnknownFields(t *testing.T) {
 	raw := `{"policy_version":"noema_policy_v1","constraints":[{"id":"pii_exposure_risk","enabled":true,"max_allowed":1}],"extra":true}`
 	if _, err := parsePolicyConfig(raw); err == nil {
@@ -353,6 +520,21 @@ func TestParsePolicyConfig_RejectsUnknownFields(t *testing.T) {
 	}
 }
 
+func TestPolicyConfigFromSpec_CarriesReveal(t *testing.T) {
+	spec := Spec{
+		Policy:      Policy{Reveal: RevealPolicy{MaxSeverity: false, Commitment: true}},
+		Constraints: []Constraint{{ID: "pii_exposure_risk", Enabled: true, AllowedMaxSeverity: 1}},
+	}
+	cfg := policyConfigFromSpec(spec)
+	if got := cfg.revealAll(); got != spec.Policy.Reveal {
+		t.Fatalf("expected reveal %+v, got %+v", spec.Policy.Reveal, got)
+	}
+	// policy_config without reveal keeps disclosing everything.
+	if got := (PolicyConfig{}).revealAll(); !got.MaxSeverity || !got.Commitment {
+		t.Fatalf("expected default to reveal all outputs, got %+v", got)
+	}
+}
+
 func TestPruneRuns_IgnoresNonRunDirectories(t *testing.T) {
 	base := t.TempDir()
 
@@ -376,7 +558,7 @@ func TestPruneRuns_IgnoresNonRunDirectories(t *testing.T) {
 		t.Fatalf("chtimes run_new: %v", err)
 	}
 
-	if err := pruneRuns(base, 1); err != nil {
+	if err := pruneRuns(NewFSRunStore(base), 1); err != nil {
 		t.Fatalf("pruneRuns error: %v", err)
 	}
 
@@ -394,9 +576,66 @@ func TestPruneRuns_IgnoresNonRunDirectories(t *testing.T) {
 	}
 }
 
+func TestPruneRuns_AggregationsDontPushOutRuns(t *testing.T) {
+	base := t.TempDir()
+	store := NewFSRunStore(base)
+	runs := []struct {
+		id               string
+		job, aggregation bool
+		kept             bool
+	}{
+		{id: "run_1", kept: false},
+		{id: "run_2", kept: true},
+		{id: "run_3", job: true, aggregation: true, kept: true},
+		{id: "run_4", job: true, aggregation: true, kept: true},
+		// A failed evaluation job counts as a run.
+		{id: "run_5", job: true, kept: true},
+	}
+	now := time.Now()
+	for i, run := range runs {
+		dir := filepath.Join(base, run.id)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("mkdir %s: %v", dir, err)
+		}
+		if run.job {
+			rec := jobRecord{Job: Job{JobID: run.id, Stage: JobFailed}, Aggregation: run.aggregation}
+			if run.aggregation {
+				rec.Stage = JobDone
+			}
+			if err := saveArtifactJSON(store, run.id, jobFile, rec); err != nil {
+				t.Fatalf("save job %s: %v", run.id, err)
+			}
+		}
+		at := now.Add(time.Duration(i-len(runs)) * time.Hour)
+		if err := os.Chtimes(dir, at, at); err != nil {
+			t.Fatalf("chtimes %s: %v", dir, err)
+		}
+	}
+
+	if err := pruneRuns(store, 2); err != nil {
+		t.Fatalf("pruneRuns error: %v", err)
+	}
+	for _, run := range runs {
+		_, err := os.Stat(filepath.Join(base, run.id))
+		if run.kept != (err == nil) {
+			t.Fatalf("%s: expected kept=%v, got err %v", run.id, run.kept, err)
+		}
+	}
+
+	// Aggregations are bounded by a limit of their own.
+	if err := pruneRuns(store, 1); err != nil {
+		t.Fatalf("pruneRuns error: %v", err)
+	}
+	for id, kept := range map[string]bool{"run_2": false, "run_3": false, "run_4": true, "run_5": true} {
+		if _, err := os.Stat(filepath.Join(base, id)); kept != (err == nil) {
+			t.Fatalf("%s: expected kept=%v, got err %v", id, kept, err)
+		}
+	}
+}
+
 func TestPruneRuns_MissingDirNoError(t *testing.T) {
 	base := filepath.Join(t.TempDir(), "missing")
-	if err := pruneRuns(base, 1); err != nil {
+	if err := pruneRuns(NewFSRunStore(base), 1); err != nil {
 		t.Fatalf("expected no error for missing dir, got %v", err)
 	}
 }
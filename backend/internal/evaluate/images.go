@@ -2,13 +2,10 @@ package evaluate
 
 import (
 	"fmt"
-	"io"
 	"mime"
 	"mime/multipart"
 	"path/filepath"
 	"strings"
-
-	"noema/internal/config"
 )
 
 type ImageInfo struct {
@@ -17,36 +14,32 @@ type ImageInfo struct {
 	Data     []byte
 }
 
-func readImages(files []*multipart.FileHeader) ([]ImageInfo, error) {
-	out := make([]ImageInfo, 0, len(files))
-	for _, fh := range files {
-		src, err := fh.Open()
-		if err != nil {
-			return nil, fmt.Errorf("could not read image %q: %w", fh.Filename, err)
-		}
-		data, err := io.ReadAll(io.LimitReader(src, int64(config.MaxImageBytes)+1))
-		closeErr := src.Close()
+// loadRunImages reads the images saved with the run runID.
+func loadRunImages(store RunStore, runID string, images []runImage) ([]ImageInfo, error) {
+	out := make([]ImageInfo, 0, len(images))
+	for _, img := range images {
+		data, err := store.Load(runID, img.File)
 		if err != nil {
-			return nil, fmt.Errorf("could not read image %q: %w", fh.Filename, err)
-		}
-		if len(data) > config.MaxImageBytes {
-			return nil, fmt.Errorf("image %q exceeds limit of %s", fh.Filename, formatBytes(int64(config.MaxImageBytes)))
-		}
-		if closeErr != nil {
-			return nil, fmt.Errorf("could not close image %q: %w", fh.Filename, closeErr)
-		}
-		mimeType := strings.TrimSpace(fh.Header.Get("Content-Type"))
-		if mimeType == "" {
-			mimeType = mime.TypeByExtension(strings.ToLower(filepath.Ext(fh.Filename)))
-		}
-		if mimeType == "" {
-			mimeType = "application/octet-stream"
+			return nil, fmt.Errorf("could not read image %q: %w", img.Filename, err)
 		}
 		out = append(out, ImageInfo{
-			Filename: fh.Filename,
-			MIMEType: mimeType,
+			Filename: img.Filename,
+			MIMEType: img.MIMEType,
 			Data:     data,
 		})
 	}
 	return out, nil
 }
+
+// imageMIMEType is the declared type of an uploaded image, or the one its
+// extension implies.
+func imageMIMEType(fh *multipart.FileHeader) string {
+	mimeType := strings.TrimSpace(fh.Header.Get("Content-Type"))
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(strings.ToLower(filepath.Ext(fh.Filename)))
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return mimeType
+}
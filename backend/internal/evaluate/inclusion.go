@@ -0,0 +1,198 @@
+package evaluate
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"noema/internal/merkle"
+	"noema/internal/zk"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrNotMerkle is returned for runs whose dataset digest is not a Merkle
+// root, so no inclusion proofs exist for them.
+var ErrNotMerkle = errors.New("run dataset digest is not a Merkle root")
+
+// ErrItemNotFound is returned when an item ID is not in a run's dataset.
+var ErrItemNotFound = errors.New("dataset item not found")
+
+// InclusionProof proves that one item is a leaf of a dataset's Merkle
+// digest. Path is the RFC 6962 audit path, hex encoded, from the leaf up.
+type InclusionProof struct {
+	ItemID    string `json:"item_id"`
+	LeafIndex int    `json:"leaf_index"`
+	// Item is the item's canonical encoding, which the leaf's data ends
+	// with.
+	Item json.RawMessage `json:"item"`
+	// LeafSalt is the hex salt the leaf's data starts with.
+	LeafSalt string   `json:"leaf_salt"`
+	Path     []string `json:"path"`
+}
+
+// InclusionResponse is the JSON response for GET /api/runs/:id/inclusion.
+// DatasetOpening ties DatasetDigest to the commitment the run's proof
+// discloses without opening anything else the commitment binds.
+type InclusionResponse struct {
+	RunID            string            `json:"run_id"`
+	DatasetDigest    string            `json:"dataset_digest"`
+	DatasetDigestAlg string            `json:"dataset_digest_alg"`
+	TreeSize         int               `json:"tree_size"`
+	DatasetOpening   zk.DatasetOpening `json:"dataset_opening"`
+	Proofs           []InclusionProof  `json:"proofs"`
+}
+
+// InclusionProofs proves that the items itemIDs were part of a stored run's
+// dataset. The run must have been evaluated with DatasetDigestMerkle.
+func InclusionProofs(store RunStore, runID string, itemIDs []string) (InclusionResponse, error) {
+	rec, err := loadCommitmentRecord(store, runID)
+	if errors.Is(err, ErrNoOpening) {
+		return InclusionResponse{}, ErrNotMerkle
+	}
+	if err != nil {
+		return InclusionResponse{}, err
+	}
+	if rec.digestAlg() != DatasetDigestMerkle {
+		return InclusionResponse{}, ErrNotMerkle
+	}
+	raw, err := store.Load(runID, runDatasetFile)
+	if err != nil {
+		return InclusionResponse{}, err
+	}
+	ds, err := parseDatasetSchema(raw)
+	if err != nil {
+		return InclusionResponse{}, fmt.Errorf("stored dataset: %w", err)
+	}
+	salts, err := leafSalts(rec.DatasetSalt, len(ds.Items))
+	if err != nil {
+		return InclusionResponse{}, err
+	}
+	leaves, err := datasetLeaves(ds, rec.DatasetSalt)
+	if err != nil {
+		return InclusionResponse{}, err
+	}
+	root := merkle.Root(leaves)
+	if hex.EncodeToString(root[:]) != rec.DatasetDigest {
+		return InclusionResponse{}, fmt.Errorf("stored dataset does not reproduce digest %s", rec.DatasetDigest)
+	}
+	opening, err := LoadCommitmentOpening(store, runID)
+	if err != nil {
+		return InclusionResponse{}, err
+	}
+	datasetOpening, err := opening.DatasetOpening()
+	if err != nil {
+		return InclusionResponse{}, err
+	}
+
+	index := make(map[string]int, len(ds.Items))
+	for i, item := range ds.Items {
+		index[item.ID] = i
+	}
+	resp := InclusionResponse{
+		RunID:            runID,
+		DatasetDigest:    rec.DatasetDigest,
+		DatasetDigestAlg: DatasetDigestMerkle,
+		TreeSize:         len(leaves),
+		DatasetOpening:   datasetOpening,
+	}
+	for _, id := range itemIDs {
+		i, ok := index[id]
+		if !ok {
+			return InclusionResponse{}, fmt.Errorf("%w: %s", ErrItemNotFound, id)
+		}
+		path, err := merkle.Proof(leaves, i)
+		if err != nil {
+			return InclusionResponse{}, err
+		}
+		item, err := DatasetItemLeaf(ds.Items[i])
+		if err != nil {
+			return InclusionResponse{}, err
+		}
+		p := InclusionProof{ItemID: id, LeafIndex: i, Item: item, LeafSalt: hex.EncodeToString(salts[i]), Path: make([]string, len(path))}
+		for j, h := range path {
+			p.Path[j] = hex.EncodeToString(h[:])
+		}
+		resp.Proofs = append(resp.Proofs, p)
+	}
+	return resp, nil
+}
+
+// VerifyInclusion checks p against a Merkle dataset digest over treeSize
+// items. The item is canonicalized again, so any JSON encoding of it is
+// accepted.
+func VerifyInclusion(datasetDigest string, treeSize int, p InclusionProof) error {
+	root, err := decodeHash(datasetDigest)
+	if err != nil {
+		return fmt.Errorf("invalid dataset digest")
+	}
+	var item DatasetItem
+	dec := json.NewDecoder(bytes.NewReader(p.Item))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&item); err != nil {
+		return fmt.Errorf("item must match the dataset item schema")
+	}
+	if item.ID != p.ItemID {
+		return fmt.Errorf("item id does not match item_id")
+	}
+	salt, err := hex.DecodeString(p.LeafSalt)
+	if err != nil {
+		return fmt.Errorf("invalid leaf_salt")
+	}
+	leaf, err := MerkleLeaf(salt, item)
+	if err != nil {
+		return err
+	}
+	path := make([]merkle.Hash, len(p.Path))
+	for i, h := range p.Path {
+		if path[i], err = decodeHash(h); err != nil {
+			return fmt.Errorf("invalid path entry %d", i)
+		}
+	}
+	if !merkle.Verify(root, merkle.LeafHash(leaf), p.LeafIndex, treeSize, path) {
+		return fmt.Errorf("item is not included in the dataset digest")
+	}
+	return nil
+}
+
+func decodeHash(s string) (merkle.Hash, error) {
+	var h merkle.Hash
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != len(h) {
+		return h, fmt.Errorf("invalid hash %q", s)
+	}
+	copy(h[:], raw)
+	return h, nil
+}
+
+// InclusionHandler handles GET /api/runs/:id/inclusion?item_id=...,
+// issuing inclusion proofs for one or more item IDs of a run evaluated with
+// a Merkle dataset digest. Expects CookieAuth to have run first.
+func InclusionHandler(store RunStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		runID := c.Param("id")
+		itemIDs := c.QueryArray("item_id")
+		if len(itemIDs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing item_id"})
+			return
+		}
+		resp, err := InclusionProofs(store, runID, itemIDs)
+		switch {
+		case errors.Is(err, ErrRunNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "run not found"})
+		case errors.Is(err, ErrItemNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrNotMerkle):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case err != nil:
+			log.Printf("inclusion proofs for %s: %v", runID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build inclusion proofs"})
+		default:
+			c.JSON(http.StatusOK, resp)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package evaluate
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"noema/internal/crypto"
+	"noema/internal/zk/aggregate"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JobStage is how far an asynchronous evaluation or aggregation has got.
+type JobStage string
+
+const (
+	JobQueued     JobStage = "queued"
+	JobEvaluating JobStage = "evaluating"
+	JobProving    JobStage = "proving"
+	JobDone       JobStage = "done"
+	JobFailed     JobStage = "failed"
+)
+
+func (s JobStage) finished() bool {
+	return s == JobDone || s == JobFailed
+}
+
+// jobFile holds a job's state in the directory of the run it produces.
+const jobFile = "job.json"
+
+var (
+	// ErrJobQueueFull is returned when every worker is busy and the queue
+	// holds as many jobs as it may.
+	ErrJobQueueFull = errors.New("evaluation queue is full")
+	// ErrJobNotFound is returned when a job ID doesn't name a job.
+	ErrJobNotFound = errors.New("job not found")
+)
+
+// Job is the state of an asynchronous evaluation or aggregation, as GET
+// /api/jobs/:id reports it. A job's ID is the ID of the run it produces; an
+// aggregation's run holds nothing but the job.
+type Job struct {
+	JobID     string   `json:"job_id"`
+	Stage     JobStage `json:"stage"`
+	Error     string   `json:"error,omitempty"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+	// Result is the evaluate response, once the job is done.
+	Result *EvaluateResponse `json:"result,omitempty"`
+	// Aggregate is the aggregate proof, once an aggregation job is done.
+	Aggregate *AggregateResponse `json:"aggregate,omitempty"`
+}
+
+type jobRecord struct {
+	Job
+	// Input is what the job runs from. It is dropped when the job finishes.
+	Input          *runInput         `json:"input,omitempty"`
+	AggregateInput *AggregateRequest `json:"aggregate_input,omitempty"`
+	// Aggregation marks an aggregation job, whose run holds nothing else.
+	Aggregation bool `json:"aggregation,omitempty"`
+}
+
+// Jobs runs queued evaluations and aggregations on a fixed number of workers. Job state is
+// kept with the runs, so nothing is lost when the server stops: Start picks
+// up the jobs that hadn't finished.
+type Jobs struct {
+	runner  runner
+	agg     *aggregate.Aggregator
+	workers int
+	queue   chan string
+	events  *jobEvents
+}
+
+// NewJobs returns a pool of workers running jobs for the runs in store, with
+// room for queueSize jobs to wait. Gemini's results are cached in cacheDir.
+// Runs are signed with issuer unless it is nil; aggregations are proved by
+// agg, and aren't available when it is nil.
+func NewJobs(store RunStore, cacheDir string, maxRuns int, issuer *crypto.Issuer, agg *aggregate.Aggregator, workers, queueSize int) *Jobs {
+	return &Jobs{
+		runner:  runner{store: store, cacheDir: cacheDir, maxRuns: maxRuns, issuer: issuer},
+		agg:     agg,
+		workers: workers,
+		queue:   make(chan string, queueSize),
+		events:  newJobEvents(),
+	}
+}
+
+// Start requeues the jobs that were queued or running when the server last
+// stopped, oldest first, and starts the workers. Workers stop taking jobs
+// when ctx is done; a job that was interrupted is resumed by the next Start.
+func (j *Jobs) Start(ctx context.Context) error {
+	pending, err := pendingJobs(j.runner.store)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		log.Printf("resuming %d jobs", len(pending))
+	}
+	for i := 0; i < j.workers; i++ {
+		go j.work(ctx)
+	}
+	go func() {
+		for _, id := range pending {
+			select {
+			case j.queue <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// submit queues the stored run runID.
+func (j *Jobs) submit(runID string, in runInput) (Job, error) {
+	return j.enqueue(jobRecord{Job: newJob(runID), Input: &in})
+}
+
+// submitAggregate queues the aggregation req in the empty run runID. The
+// runs it lists have already been checked with agg.Check.
+func (j *Jobs) submitAggregate(runID string, req AggregateRequest) (Job, error) {
+	return j.enqueue(jobRecord{Job: newJob(runID), AggregateInput: &req, Aggregation: true})
+}
+
+func newJob(runID string) Job {
+	now := time.Now().UTC().Format(time.RFC3339)
+	return Job{JobID: runID, Stage: JobQueued, CreatedAt: now, UpdatedAt: now}
+}
+
+func (j *Jobs) enqueue(rec jobRecord) (Job, error) {
+	runID := rec.JobID
+	if err := saveArtifactJSON(j.runner.store, runID, jobFile, rec); err != nil {
+		return Job{}, err
+	}
+	select {
+	case j.queue <- runID:
+		return rec.Job, nil
+	default:
+		return Job{}, ErrJobQueueFull
+	}
+}
+
+func (j *Jobs) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-j.queue:
+			// A job that has started runs to completion even if ctx is
+			// done, so a shutdown doesn't turn a Gemini call into a stub.
+			j.process(context.WithoutCancel(ctx), id)
+		}
+	}
+}
+
+func (j *Jobs) process(ctx context.Context, runID string) {
+	store := j.runner.store
+	var rec jobRecord
+	if err := loadArtifactJSON(store, runID, jobFile, &rec); err != nil {
+		log.Printf("job %s: %v", runID, err)
+		return
+	}
+	if rec.Stage.finished() || (rec.Input == nil && rec.AggregateInput == nil) {
+		return
+	}
+	setStage := func(stage JobStage) {
+		rec.Stage = stage
+		rec.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		if err := saveArtifactJSON(store, runID, jobFile, rec); err != nil {
+			log.Printf("job %s: save state: %v", runID, err)
+		}
+	}
+	// Followers get the final state from job.json once finish closes
+	// their streams.
+	defer j.events.finish(runID)
+	if req := rec.AggregateInput; req != nil {
+		setStage(JobProving)
+		j.events.publish(runID, stageEvent(JobProving))
+		resp, err := j.aggregate(*req)
+		rec.AggregateInput = nil
+		if err != nil {
+			log.Printf("job %s failed: %v", runID, err)
+			rec.Error = err.Error()
+			setStage(JobFailed)
+			return
+		}
+		rec.Aggregate = &resp
+		setStage(JobDone)
+		return
+	}
+	resp, err := j.runner.run(ctx, runID, *rec.Input, func(ev JobEvent) {
+		if sd, ok := ev.Data.(stageData); ok {
+			setStage(sd.Stage)
+		}
+		j.events.publish(runID, ev)
+	})
+	rec.Input = nil
+	if err != nil {
+		log.Printf("job %s failed: %v", runID, err)
+		// Keep only the job's state.
+		if err := store.Delete(runID, jobFile); err != nil {
+			log.Printf("job %s: clear run: %v", runID, err)
+		}
+		rec.Error = err.Error()
+		setStage(JobFailed)
+		return
+	}
+	rec.Result = &resp
+	setStage(JobDone)
+}
+
+// pendingJobs returns the IDs of the unfinished jobs in store, oldest
+// first, and marks them queued again.
+func pendingJobs(store RunStore) ([]string, error) {
+	runs, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	var pending []jobRecord
+	for _, run := range runs {
+		if !slices.Contains(run.Artifacts, jobFile) {
+			continue
+		}
+		var rec jobRecord
+		if err := loadArtifactJSON(store, run.ID, jobFile, &rec); err != nil {
+			log.Printf("job %s: %v", run.ID, err)
+			continue
+		}
+		if rec.Stage.finished() {
+			continue
+		}
+		if rec.Stage != JobQueued {
+			rec.Stage = JobQueued
+			rec.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+			if err := saveArtifactJSON(store, run.ID, jobFile, rec); err != nil {
+				return nil, err
+			}
+		}
+		pending = append(pending, rec)
+	}
+	sort.Slice(pending, func(a, b int) bool {
+		if pending[a].CreatedAt != pending[b].CreatedAt {
+			return pending[a].CreatedAt < pending[b].CreatedAt
+		}
+		return pending[a].JobID < pending[b].JobID
+	})
+	ids := make([]string, len(pending))
+	for i, rec := range pending {
+		ids[i] = rec.JobID
+	}
+	return ids, nil
+}
+
+// jobState reports whether the run runID is a job that hasn't finished, and
+// whether it is an aggregation job.
+func jobState(store RunStore, runID string) (active, aggregation bool) {
+	var rec jobRecord
+	if err := loadArtifactJSON(store, runID, jobFile, &rec); err != nil {
+		return false, false
+	}
+	return !rec.Stage.finished(), rec.Aggregation
+}
+
+// LoadJob returns the state of the job jobID.
+func LoadJob(store RunStore, jobID string) (Job, error) {
+	var rec jobRecord
+	err := loadArtifactJSON(store, jobID, jobFile, &rec)
+	if errors.Is(err, ErrRunNotFound) || errors.Is(err, ErrArtifactNotFound) {
+		return Job{}, ErrJobNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	return rec.Job, nil
+}
+
+// JobHandler handles GET /api/jobs/:id. Expects CookieAuth to have run first.
+func JobHandler(store RunStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID := c.Param("id")
+		job, err := LoadJob(store, jobID)
+		if errors.Is(err, ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("load job %s: %v", jobID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load job"})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
@@ -0,0 +1,318 @@
+package evaluate
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func jobTestConfig() PolicyConfig {
+	return PolicyConfig{
+		PolicyVersion: "noema_policy_v1",
+		Constraints: []PolicyConstraint{
+			{ID: "pii_exposure_risk", Enabled: true, MaxAllowed: 1},
+		},
+	}
+}
+
+func waitForJob(t *testing.T, store RunStore, jobID string) Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Minute)
+	for time.Now().Before(deadline) {
+		job, err := LoadJob(store, jobID)
+		if err != nil {
+			t.Fatalf("LoadJob error: %v", err)
+		}
+		if job.Stage.finished() {
+			return job
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", jobID)
+	return Job{}
+}
+
+func TestEvaluateHandler_Async(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewFSRunStore(t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	jobs := NewJobs(store, t.TempDir(), 0, nil, nil, 1, 4)
+	if err := jobs.Start(ctx); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	router := gin.New()
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, jobs))
+	router.GET("/api/jobs/:id", JobHandler(store))
+
+	body, contentType := buildMultipartEvalRequest(t, jobTestConfig(), EvaluationResult{}, false)
+	req := httptest.NewRequest(http.MethodPost, "/api/evaluate?async=1", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var queued Job
+	if err := json.NewDecoder(rec.Body).Decode(&queued); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if queued.JobID == "" || queued.Stage != JobQueued {
+		t.Fatalf("expected a queued job, got %+v", queued)
+	}
+
+	job := waitForJob(t, store, queued.JobID)
+	if job.Stage != JobDone || job.Result == nil {
+		t.Fatalf("expected job to be done, got %+v", job)
+	}
+	if job.Result.RunID != queued.JobID || !job.Result.Verified {
+		t.Fatalf("unexpected job result %+v", job.Result)
+	}
+	if _, err := LoadBundle(store, queued.JobID); err != nil {
+		t.Fatalf("expected the job's run to have a bundle: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/jobs/"+queued.JobID, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var polled map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&polled); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if polled["stage"] != string(JobDone) || polled["input"] != nil {
+		t.Fatalf("unexpected job response %v", polled)
+	}
+
+	for _, id := range []string{"run_404", "../etc"} {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/jobs/"+id, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for %q, got %d", id, rec.Code)
+		}
+	}
+}
+
+func TestEvaluateHandler_AsyncRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	runsDir := t.TempDir()
+	store := NewFSRunStore(runsDir)
+	// Never started, so nothing drains the one-slot queue.
+	jobs := NewJobs(store, t.TempDir(), 0, nil, nil, 1, 1)
+
+	post := func(h gin.HandlerFunc, query string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.POST("/api/evaluate", h)
+		body, contentType := buildMultipartEvalRequest(t, jobTestConfig(), EvaluationResult{}, false)
+		req := httptest.NewRequest(http.MethodPost, "/api/evaluate"+query, body)
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := post(Handler(store, t.TempDir(), 0, nil, nil), "?async=1"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a job pool, got %d", rec.Code)
+	}
+	if rec := post(Handler(store, t.TempDir(), 0, nil, jobs), "?async=yes"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad async value, got %d", rec.Code)
+	}
+	if rec := post(Handler(store, t.TempDir(), 0, nil, jobs), "?async=1"); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post(Handler(store, t.TempDir(), 0, nil, jobs), "?async=1"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 with a full queue, got %d", rec.Code)
+	}
+	entries, err := os.ReadDir(runsDir)
+	if err != nil {
+		t.Fatalf("read runs dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only the queued run to remain, got %d entries", len(entries))
+	}
+}
+
+// writeInterruptedJob leaves a run in store as a server that stopped
+// mid-job would.
+func writeInterruptedJob(t *testing.T, store RunStore, stage JobStage, withDataset bool) string {
+	t.Helper()
+	runID, err := store.Create()
+	if err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+	dataset := []byte(`{"items":[{"id":"1","text":"hello"}]}`)
+	if withDataset {
+		if err := store.SaveArtifact(runID, runDatasetFile, dataset); err != nil {
+			t.Fatalf("write dataset: %v", err)
+		}
+	}
+	digest, err := DatasetDigestBytes(dataset, DatasetDigestJCS, "")
+	if err != nil {
+		t.Fatalf("DatasetDigestBytes error: %v", err)
+	}
+	rec := jobRecord{
+		Job: Job{JobID: runID, Stage: stage, CreatedAt: "2026-01-01T00:00:00Z", UpdatedAt: "2026-01-01T00:00:00Z"},
+		Input: &runInput{
+			PolicyConfig:     jobTestConfig(),
+			DatasetDigestAlg: DatasetDigestJCS,
+			DatasetDigest:    digest,
+		},
+	}
+	if err := saveArtifactJSON(store, runID, jobFile, rec); err != nil {
+		t.Fatalf("save job: %v", err)
+	}
+	return runID
+}
+
+func TestJobsResumeAfterRestart(t *testing.T) {
+	runsDir := t.TempDir()
+	store := NewFSRunStore(runsDir)
+	proving := writeInterruptedJob(t, store, JobProving, true)
+	broken := writeInterruptedJob(t, store, JobEvaluating, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := NewJobs(store, t.TempDir(), 0, nil, nil, 2, 1).Start(ctx); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+
+	job := waitForJob(t, store, proving)
+	if job.Stage != JobDone || job.Result == nil || job.Result.RunID != proving {
+		t.Fatalf("expected the interrupted job to finish, got %+v", job)
+	}
+
+	job = waitForJob(t, store, broken)
+	if job.Stage != JobFailed || job.Error == "" {
+		t.Fatalf("expected a job without its dataset to fail, got %+v", job)
+	}
+	entries, err := os.ReadDir(filepath.Join(runsDir, broken))
+	if err != nil {
+		t.Fatalf("read run dir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != jobFile {
+		t.Fatalf("expected a failed job to keep only its state, got %v", entries)
+	}
+	if _, err := LoadBundle(store, broken); !errors.Is(err, ErrRunNotFound) {
+		t.Fatalf("expected no bundle for a failed job, got %v", err)
+	}
+}
+
+// readEvents reads SSE events from r until it closes, passing each
+// event's name and data to onEvent.
+func readEvents(t *testing.T, r io.Reader, onEvent func(name, data string)) {
+	t.Helper()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4<<20)
+	var name, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		case line == "" && name != "":
+			onEvent(name, data)
+			name, data = "", ""
+		}
+	}
+}
+
+func TestJobEventsHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewFSRunStore(t.TempDir())
+	jobs := NewJobs(store, t.TempDir(), 0, nil, nil, 1, 4)
+	router := gin.New()
+	router.POST("/api/evaluate", Handler(store, t.TempDir(), 0, nil, jobs))
+	router.GET("/api/jobs/:id/events", JobEventsHandler(jobs))
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	body, contentType := buildMultipartEvalRequest(t, jobTestConfig(), EvaluationResult{}, false)
+	res, err := http.Post(srv.URL+"/api/evaluate?async=1", contentType, body)
+	if err != nil {
+		t.Fatalf("POST error: %v", err)
+	}
+	var queued Job
+	err = json.NewDecoder(res.Body).Decode(&queued)
+	res.Body.Close()
+	if err != nil || res.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected a queued job, got %d, %v", res.StatusCode, err)
+	}
+
+	res, err = http.Get(srv.URL + "/api/jobs/" + queued.JobID + "/events")
+	if err != nil {
+		t.Fatalf("GET events error: %v", err)
+	}
+	defer res.Body.Close()
+	if got := res.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/event-stream") {
+		t.Fatalf("unexpected Content-Type %q", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var names []string
+	var result Job
+	started := false
+	readEvents(t, res.Body, func(name, data string) {
+		// The queued stage arrives before any worker runs, so the stream
+		// sees the whole job.
+		if !started {
+			if err := jobs.Start(ctx); err != nil {
+				t.Fatalf("Start error: %v", err)
+			}
+			started = true
+		}
+		names = append(names, name+":"+data)
+		if name == EventResult {
+			if err := json.Unmarshal([]byte(data), &result); err != nil {
+				t.Fatalf("decode result: %v", err)
+			}
+		}
+	})
+	want := []string{
+		`stage:{"stage":"queued"}`,
+		`stage:{"stage":"evaluating"}`,
+		`stage:{"stage":"proving"}`,
+		`proof:{"proof":"started"}`,
+		`proof:{"proof":"finished"}`,
+	}
+	if len(names) != len(want)+1 || strings.Join(names[:len(want)], "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected events:\n%s", strings.Join(names, "\n"))
+	}
+	if result.Stage != JobDone || result.Result == nil || result.Result.RunID != queued.JobID {
+		t.Fatalf("unexpected result event %+v", result)
+	}
+
+	// A finished job's stream is its state and result.
+	res, err = http.Get(srv.URL + "/api/jobs/" + queued.JobID + "/events")
+	if err != nil {
+		t.Fatalf("GET events error: %v", err)
+	}
+	defer res.Body.Close()
+	names = nil
+	readEvents(t, res.Body, func(name, data string) { names = append(names, name) })
+	if strings.Join(names, ",") != "stage,result" {
+		t.Fatalf("unexpected events for a finished job: %v", names)
+	}
+
+	res, err = http.Get(srv.URL + "/api/jobs/run_404/events")
+	if err != nil {
+		t.Fatalf("GET events error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown job, got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,79 @@
+package evaluate
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// MigrateStats counts what MigrateRuns did.
+type MigrateStats struct {
+	// Copied runs weren't in the destination before.
+	Copied int
+	// Skipped runs were already there, from an earlier migration.
+	Skipped int
+	// Deleted runs were removed from the source after being copied.
+	Deleted int
+}
+
+// MigrateRuns copies every run in src into dst under the same ID, with all of
+// its artifacts, and rebuilds dst's index. Runs already in dst are skipped, so
+// an interrupted migration can be run again. With deleteSource, a run is
+// removed from src once dst holds an identical copy of it. Nothing else may
+// write to either store meanwhile.
+func MigrateRuns(src RunStore, dst *SQLiteRunStore, deleteSource bool) (MigrateStats, error) {
+	var stats MigrateStats
+	runs, err := src.List()
+	if err != nil {
+		return stats, fmt.Errorf("list runs: %w", err)
+	}
+	// Oldest first, so a partial migration holds the runs pruning would
+	// remove last.
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		artifacts := make(map[string][]byte, len(run.Artifacts))
+		for _, name := range run.Artifacts {
+			data, err := src.Load(run.ID, name)
+			if err != nil {
+				return stats, fmt.Errorf("load %s/%s: %w", run.ID, name, err)
+			}
+			artifacts[name] = data
+		}
+		copied, err := dst.importRun(run, artifacts)
+		if err != nil {
+			return stats, fmt.Errorf("copy %s: %w", run.ID, err)
+		}
+		if copied {
+			stats.Copied++
+		} else {
+			stats.Skipped++
+		}
+		if !deleteSource {
+			continue
+		}
+		if err := sameArtifacts(dst, run.ID, artifacts); err != nil {
+			return stats, fmt.Errorf("verify %s: %w", run.ID, err)
+		}
+		if err := src.Delete(run.ID); err != nil {
+			return stats, fmt.Errorf("delete %s: %w", run.ID, err)
+		}
+		stats.Deleted++
+	}
+	if err := dst.Reindex(); err != nil {
+		return stats, fmt.Errorf("reindex: %w", err)
+	}
+	return stats, nil
+}
+
+// sameArtifacts reports whether runID in store holds exactly artifacts.
+func sameArtifacts(store RunStore, runID string, artifacts map[string][]byte) error {
+	for name, want := range artifacts {
+		got, err := store.Load(runID, name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("%s differs from the source", name)
+		}
+	}
+	return nil
+}
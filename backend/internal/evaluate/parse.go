@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"noema/internal/config"
+	"noema/internal/zk"
 )
 
 func parseSpec(form *multipart.Form) (Spec, error) {
@@ -42,6 +43,9 @@ func validateSpec(spec Spec) error {
 	if trimmedName != spec.EvaluationName {
 		return fmt.Errorf("evaluation_name must not include leading/trailing whitespace")
 	}
+	if n := len(spec.Constraints) + len(spec.CustomConstraints); n > zk.MaxPolicyConstraints {
+		return fmt.Errorf("spec has %d constraints and custom_constraints; at most %d are supported", n, zk.MaxPolicyConstraints)
+	}
 	seenIDs := make(map[string]struct{}, len(spec.Constraints)+len(spec.CustomConstraints))
 	for _, cn := range spec.Constraints {
 		id := strings.TrimSpace(cn.ID)
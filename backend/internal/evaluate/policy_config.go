@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"strings"
+
+	"noema/internal/zk"
 )
 
 type PolicyConstraint struct {
@@ -17,6 +19,16 @@ type PolicyConstraint struct {
 type PolicyConfig struct {
 	PolicyVersion string             `json:"policy_version"`
 	Constraints   []PolicyConstraint `json:"constraints"`
+	// Reveal selects which outputs the proof discloses. Nil discloses all of them.
+	Reveal *RevealPolicy `json:"reveal,omitempty"`
+}
+
+// revealAll reports which optional outputs cfg discloses.
+func (cfg PolicyConfig) revealAll() RevealPolicy {
+	if cfg.Reveal == nil {
+		return RevealPolicy{MaxSeverity: true, Commitment: true}
+	}
+	return *cfg.Reveal
 }
 
 func parsePolicyConfig(raw string) (PolicyConfig, error) {
@@ -39,6 +51,9 @@ func validatePolicyConfig(cfg PolicyConfig) error {
 	if len(cfg.Constraints) == 0 {
 		return fmt.Errorf("constraints must be non-empty")
 	}
+	if len(cfg.Constraints) > zk.MaxPolicyConstraints {
+		return fmt.Errorf("at most %d constraints are supported", zk.MaxPolicyConstraints)
+	}
 	seen := make(map[string]struct{}, len(cfg.Constraints))
 	for _, c := range cfg.Constraints {
 		id := strings.TrimSpace(c.ID)
@@ -63,6 +78,7 @@ func policyConfigFromSpec(spec Spec) PolicyConfig {
 	cfg := PolicyConfig{
 		PolicyVersion: "noema_policy_v1",
 		Constraints:   make([]PolicyConstraint, 0, len(spec.Constraints)+len(spec.CustomConstraints)),
+		Reveal:        &RevealPolicy{MaxSeverity: spec.Policy.Reveal.MaxSeverity, Commitment: spec.Policy.Reveal.Commitment},
 	}
 	for _, c := range spec.Constraints {
 		cfg.Constraints = append(cfg.Constraints, PolicyConstraint{
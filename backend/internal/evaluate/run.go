@@ -0,0 +1,332 @@
+package evaluate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+
+	"noema/internal/bundle"
+	"noema/internal/config"
+	"noema/internal/crypto"
+	"noema/internal/httputil"
+	"noema/internal/zk"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runManifestFile is the run's manifest. It holds nothing secret.
+const runManifestFile = "run.json"
+
+// RunManifestVersion is the run.json layout this package writes. Bump it
+// when a field changes meaning.
+const RunManifestVersion = 1
+
+// RunManifest is a finished run as run.json records it: the evaluate
+// response, and what the run was evaluated with.
+type RunManifest struct {
+	ManifestVersion int `json:"manifest_version"`
+	EvaluateResponse
+	CreatedAt        string `json:"created_at"`
+	EvaluationName   string `json:"evaluation_name,omitempty"`
+	PolicyVersion    string `json:"policy_version"`
+	DatasetDigest    string `json:"dataset_digest"`
+	DatasetDigestAlg string `json:"dataset_digest_alg"`
+	// Provenance says which evaluator produced the severities.
+	Provenance *zk.Provenance `json:"provenance,omitempty"`
+	// Tags are the owner's labels for the run, set with PATCH /api/runs/:id.
+	Tags []string `json:"tags,omitempty"`
+}
+
+func saveRunManifest(store RunStore, runID string, m RunManifest) error {
+	m.ManifestVersion = RunManifestVersion
+	return saveArtifactJSON(store, runID, runManifestFile, m)
+}
+
+// LoadRunManifest returns a stored run's manifest. Runs from before run.json
+// was written get one rebuilt from their bundle and commitment record.
+func LoadRunManifest(store RunStore, runID string) (RunManifest, error) {
+	var m RunManifest
+	err := loadArtifactJSON(store, runID, runManifestFile, &m)
+	if err == nil {
+		return m, nil
+	}
+	if !errors.Is(err, ErrArtifactNotFound) {
+		return RunManifest{}, err
+	}
+	return legacyRunManifest(store, runID)
+}
+
+func legacyRunManifest(store RunStore, runID string) (RunManifest, error) {
+	raw, err := LoadBundle(store, runID)
+	if err != nil {
+		return RunManifest{}, err
+	}
+	b, err := bundle.Parse(raw)
+	if err != nil {
+		return RunManifest{}, err
+	}
+	out := b.Run.PublicOutput
+	m := RunManifest{
+		ManifestVersion: RunManifestVersion,
+		EvaluateResponse: EvaluateResponse{
+			RunID:           runID,
+			Status:          b.Run.Status,
+			OverallPass:     out.OverallPass,
+			MaxSeverity:     out.MaxSeverity,
+			Commitment:      out.Commitment,
+			ProofB64:        b.Proof.ProofB64,
+			PublicInputsB64: b.Proof.PublicInputsB64,
+			PublicOutput:    out,
+			Proof:           b.Proof,
+			// Bundles were only written for proofs that verified.
+			Verified: true,
+		},
+		CreatedAt:        b.Run.CreatedAt,
+		EvaluationName:   b.Run.EvaluationName,
+		PolicyVersion:    b.Run.PolicyVersion,
+		DatasetDigestAlg: b.Run.DatasetDigestAlg,
+	}
+	if b.Signature != nil {
+		att := bundle.Attestation(b)
+		m.Attestation = &att
+		m.Signature = b.Signature
+	}
+	if b.Proof.System == zk.ProofSystemGroth16 {
+		if sj, err := snarkJSOutput(zk.Proof{ProofB64: b.Proof.ProofB64, PublicInputsB64: b.Proof.PublicInputsB64}); err == nil {
+			m.SnarkJS = sj
+		}
+	}
+	if rec, err := loadCommitmentRecord(store, runID); err == nil {
+		m.DatasetDigest = rec.DatasetDigest
+		m.DatasetDigestAlg = rec.digestAlg()
+		m.Provenance = rec.Provenance
+	}
+	return m, nil
+}
+
+// ConstraintResult is how one constraint of a run's policy fared.
+type ConstraintResult struct {
+	ID                 string `json:"id"`
+	Enabled            bool   `json:"enabled"`
+	Severity           int    `json:"severity"`
+	AllowedMaxSeverity int    `json:"allowed_max_severity"`
+	// Pass is true for disabled constraints, which can't fail a run.
+	Pass      bool   `json:"pass"`
+	Rationale string `json:"rationale,omitempty"`
+}
+
+// RunDetail is the JSON response for GET /api/runs/:id: the run's manifest
+// with the policy and evaluation behind it, rationales included.
+type RunDetail struct {
+	RunManifest
+	PolicyConfig      PolicyConfig       `json:"policy_config"`
+	EvaluationResult  EvaluationResult   `json:"evaluation_result"`
+	ConstraintResults []ConstraintResult `json:"constraint_results"`
+}
+
+// LoadRunDetail returns a stored run as GET /api/runs/:id serves it.
+func LoadRunDetail(store RunStore, runID string) (RunDetail, error) {
+	m, err := LoadRunManifest(store, runID)
+	if err != nil {
+		return RunDetail{}, err
+	}
+	d := RunDetail{RunManifest: m}
+	if err := loadArtifactJSON(store, runID, "policy_config.json", &d.PolicyConfig); err != nil {
+		return RunDetail{}, err
+	}
+	if err := loadArtifactJSON(store, runID, "evaluation_result.json", &d.EvaluationResult); err != nil {
+		return RunDetail{}, err
+	}
+	d.ConstraintResults = constraintResults(d.PolicyConfig, d.EvaluationResult)
+	return d, nil
+}
+
+func constraintResults(cfg PolicyConfig, out EvaluationResult) []ConstraintResult {
+	byID := make(map[string]EvalResultItem, len(out.Results))
+	for _, r := range out.Results {
+		byID[r.ID] = r
+	}
+	results := make([]ConstraintResult, 0, len(cfg.Constraints))
+	for _, c := range cfg.Constraints {
+		r := byID[c.ID]
+		results = append(results, ConstraintResult{
+			ID:                 c.ID,
+			Enabled:            c.Enabled,
+			Severity:           r.Severity,
+			AllowedMaxSeverity: c.MaxAllowed,
+			Pass:               !c.Enabled || r.Severity <= c.MaxAllowed,
+			Rationale:          r.Rationale,
+		})
+	}
+	return results
+}
+
+// PublicRun is the JSON response for GET /api/public/runs/:id. It holds
+// only what the proof discloses and what is needed to verify it; the
+// policy, evaluation and dataset digest stay private.
+type PublicRun struct {
+	RunID        string       `json:"run_id"`
+	Status       string       `json:"status"`
+	PublicOutput PublicOutput `json:"public_output"`
+	Proof        Proof        `json:"proof"`
+	// Attestation and Signature are set for runs the issuer signed.
+	Attestation *crypto.Attestation `json:"attestation,omitempty"`
+	Signature   *bundle.Signature   `json:"signature,omitempty"`
+}
+
+// LoadPublicRun returns a stored run as GET /api/public/runs/:id serves it.
+func LoadPublicRun(store RunStore, runID string) (PublicRun, error) {
+	m, err := LoadRunManifest(store, runID)
+	if err != nil {
+		return PublicRun{}, err
+	}
+	return PublicRun{
+		RunID:        m.RunID,
+		Status:       m.Status,
+		PublicOutput: m.PublicOutput,
+		Proof:        m.Proof,
+		Attestation:  m.Attestation,
+		Signature:    m.Signature,
+	}, nil
+}
+
+// RunHandler handles GET /api/runs/:id. Expects CookieAuth to have run first.
+func RunHandler(store RunStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		runID := c.Param("id")
+		d, err := LoadRunDetail(store, runID)
+		if errors.Is(err, ErrRunNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "run not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("load run %s: %v", runID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load run"})
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+// PublicRunHandler handles GET /api/public/runs/:id.
+func PublicRunHandler(store RunStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		runID := c.Param("id")
+		pub, err := LoadPublicRun(store, runID)
+		if errors.Is(err, ErrRunNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "run not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("load public run %s: %v", runID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load run"})
+			return
+		}
+		c.JSON(http.StatusOK, pub)
+	}
+}
+
+const (
+	maxRunTags   = 16
+	maxRunTagLen = 64
+)
+
+// normalizeTags checks tags and returns them sorted without duplicates.
+// A tag is 1 to 64 letters, digits, '-', '_', '.' or ':'.
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) > maxRunTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxRunTags)
+	}
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag == "" || len(tag) > maxRunTagLen {
+			return nil, fmt.Errorf("tags must be 1 to %d characters", maxRunTagLen)
+		}
+		for _, r := range tag {
+			if !isTagRune(r) {
+				return nil, fmt.Errorf("tag %q may only contain letters, digits, '-', '_', '.' and ':'", tag)
+			}
+		}
+		out = append(out, tag)
+	}
+	slices.Sort(out)
+	return slices.Compact(out), nil
+}
+
+func isTagRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+		r == '-' || r == '_' || r == '.' || r == ':'
+}
+
+// tagsMu keeps concurrent tag edits from overwriting each other's manifest.
+var tagsMu sync.Mutex
+
+// SetRunTags replaces the tags of the finished run runID and returns its
+// updated index entry. The tags are kept in the run's manifest, so they
+// survive a rebuild of the index.
+func SetRunTags(store RunStore, runID string, tags []string) (RunIndexEntry, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return RunIndexEntry{}, err
+	}
+	tagsMu.Lock()
+	defer tagsMu.Unlock()
+	m, err := LoadRunManifest(store, runID)
+	if err != nil {
+		return RunIndexEntry{}, err
+	}
+	if len(tags) == 0 {
+		tags = nil
+	}
+	m.Tags = tags
+	if err := saveRunManifest(store, runID, m); err != nil {
+		return RunIndexEntry{}, err
+	}
+	return indexEntry(m), nil
+}
+
+type runPatchRequest struct {
+	Tags *[]string `json:"tags"`
+}
+
+// RunPatchHandler handles PATCH /api/runs/:id. The body is {"tags": [...]},
+// which replaces the run's tags; an empty list clears them. Responds with
+// the run's index entry. Expects CookieAuth to have run first.
+func RunPatchHandler(store RunStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		runID := c.Param("id")
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxRunPatchBytes)
+
+		var req runPatchRequest
+		dec := json.NewDecoder(c.Request.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil || req.Tags == nil {
+			if httputil.IsBodyTooLarge(err) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": `body must be {"tags": [...]}`})
+			return
+		}
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		entry, err := SetRunTags(store, runID, tags)
+		if errors.Is(err, ErrRunNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "run not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("set tags of run %s: %v", runID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update run"})
+			return
+		}
+		c.JSON(http.StatusOK, entry)
+	}
+}
@@ -0,0 +1,207 @@
+package evaluate
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runsIndexFile is where FSRunStore lists the finished runs. It is derived
+// from the runs' manifests and can be rebuilt from them at any time.
+const runsIndexFile = "index.json"
+
+// RunIndexEntry is a finished run as index.json lists it and GET /api/runs
+// returns it.
+type RunIndexEntry struct {
+	RunID  string `json:"run_id"`
+	Status string `json:"status"`
+	// Timestamp is when the run was created, in Unix seconds.
+	Timestamp      int64    `json:"ts"`
+	EvaluationName string   `json:"evaluation_name,omitempty"`
+	PolicyVersion  string   `json:"policy_version,omitempty"`
+	DatasetDigest  string   `json:"dataset_digest,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+}
+
+// indexEntry returns m's entry in the runs index. Entries are only ever
+// built from manifests, so a rebuilt index matches an updated one.
+func indexEntry(m RunManifest) RunIndexEntry {
+	var ts int64
+	if t, err := time.Parse(time.RFC3339, m.CreatedAt); err == nil {
+		ts = t.Unix()
+	}
+	return RunIndexEntry{
+		RunID:          m.RunID,
+		Status:         m.Status,
+		Timestamp:      ts,
+		EvaluationName: m.EvaluationName,
+		PolicyVersion:  m.PolicyVersion,
+		DatasetDigest:  m.DatasetDigest,
+		Tags:           m.Tags,
+	}
+}
+
+func sortRunsIndex(entries []RunIndexEntry) {
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a].Timestamp != entries[b].Timestamp {
+			return entries[a].Timestamp > entries[b].Timestamp
+		}
+		return entries[a].RunID > entries[b].RunID
+	})
+}
+
+// RunFilter selects runs from the index. Zero fields match every run.
+type RunFilter struct {
+	// Status is PASS or FAIL.
+	Status string
+	// From and To bound the run's creation time, inclusive.
+	From, To time.Time
+	// EvaluationName matches names containing it, ignoring case.
+	EvaluationName string
+	DatasetDigest  string
+	PolicyVersion  string
+	// Tags matches runs carrying every one of them.
+	Tags []string
+}
+
+func (f RunFilter) match(e RunIndexEntry) bool {
+	if f.Status != "" && e.Status != f.Status {
+		return false
+	}
+	if !f.From.IsZero() && e.Timestamp < f.From.Unix() {
+		return false
+	}
+	if !f.To.IsZero() && e.Timestamp > f.To.Unix() {
+		return false
+	}
+	if f.EvaluationName != "" && !strings.Contains(strings.ToLower(e.EvaluationName), strings.ToLower(f.EvaluationName)) {
+		return false
+	}
+	if f.DatasetDigest != "" && !strings.EqualFold(e.DatasetDigest, f.DatasetDigest) {
+		return false
+	}
+	if f.PolicyVersion != "" && e.PolicyVersion != f.PolicyVersion {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !slices.Contains(e.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// RunList is a page of runs, as GET /api/runs returns it. Total counts every
+// run the filter matched.
+type RunList struct {
+	Runs   []RunIndexEntry `json:"runs"`
+	Total  int             `json:"total"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
+
+// ListRuns returns up to limit of the finished runs in store that match f,
+// newest first, skipping the first offset.
+func ListRuns(store RunStore, f RunFilter, limit, offset int) (RunList, error) {
+	runs, err := store.List()
+	if err != nil {
+		return RunList{}, err
+	}
+	var matched []RunIndexEntry
+	for _, r := range runs {
+		if r.Entry != nil && f.match(*r.Entry) {
+			matched = append(matched, *r.Entry)
+		}
+	}
+	sortRunsIndex(matched)
+	list := RunList{Runs: []RunIndexEntry{}, Total: len(matched), Limit: limit, Offset: offset}
+	if offset < len(matched) {
+		list.Runs = matched[offset:min(offset+limit, len(matched))]
+	}
+	return list, nil
+}
+
+const (
+	defaultRunsPage = 20
+	maxRunsPage     = 100
+)
+
+// parseRunsQuery reads GET /api/runs's filter and page from its query.
+func parseRunsQuery(c *gin.Context) (RunFilter, int, int, error) {
+	f := RunFilter{
+		Status:         strings.ToUpper(c.Query("status")),
+		EvaluationName: c.Query("evaluation_name"),
+		DatasetDigest:  c.Query("dataset_digest"),
+		PolicyVersion:  c.Query("policy_version"),
+		Tags:           c.QueryArray("tag"),
+	}
+	if f.Status != "" && f.Status != "PASS" && f.Status != "FAIL" {
+		return RunFilter{}, 0, 0, fmt.Errorf("status must be PASS or FAIL")
+	}
+	var err error
+	if f.From, err = parseRunsTime(c.Query("from"), false); err != nil {
+		return RunFilter{}, 0, 0, fmt.Errorf("from: %w", err)
+	}
+	if f.To, err = parseRunsTime(c.Query("to"), true); err != nil {
+		return RunFilter{}, 0, 0, fmt.Errorf("to: %w", err)
+	}
+	limit, offset := defaultRunsPage, 0
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxRunsPage {
+			return RunFilter{}, 0, 0, fmt.Errorf("limit must be between 1 and %d", maxRunsPage)
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return RunFilter{}, 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	return f, limit, offset, nil
+}
+
+// parseRunsTime parses an RFC 3339 time or a YYYY-MM-DD date. A date used as
+// an upper bound covers the whole day.
+func parseRunsTime(v string, endOfDay bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected an RFC 3339 time or a YYYY-MM-DD date")
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
+}
+
+// RunsHandler handles GET /api/runs, listing finished runs newest first.
+// Query parameters status, from, to, evaluation_name, dataset_digest,
+// policy_version and tag (repeatable) filter the list; limit and offset page
+// through it. Expects CookieAuth to have run first.
+func RunsHandler(store RunStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		f, limit, offset, err := parseRunsQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		list, err := ListRuns(store, f, limit, offset)
+		if err != nil {
+			log.Printf("list runs: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list runs"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
@@ -0,0 +1,209 @@
+package evaluate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"noema/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// writeTestRun stores a finished run with manifest m in store.
+func writeTestRun(t *testing.T, store *FSRunStore, m RunManifest) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(store.dir, m.RunID), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := saveRunManifest(store, m.RunID, m); err != nil {
+		t.Fatalf("save manifest: %v", err)
+	}
+}
+
+func testRuns(t *testing.T) *FSRunStore {
+	t.Helper()
+	store := NewFSRunStore(t.TempDir())
+	for _, m := range []RunManifest{
+		{EvaluateResponse: EvaluateResponse{RunID: "run_1", Status: "PASS"}, CreatedAt: "2026-03-01T10:00:00Z", EvaluationName: "Support bot", PolicyVersion: "noema_policy_v1", DatasetDigest: "aa11"},
+		{EvaluateResponse: EvaluateResponse{RunID: "run_2", Status: "FAIL"}, CreatedAt: "2026-03-02T10:00:00Z", EvaluationName: "Support bot v2", PolicyVersion: "noema_policy_v1", DatasetDigest: "bb22", Tags: []string{"prod"}},
+		{EvaluateResponse: EvaluateResponse{RunID: "run_3", Status: "PASS"}, CreatedAt: "2026-03-03T10:00:00Z", EvaluationName: "Search", PolicyVersion: "noema_policy_v2", DatasetDigest: "aa11", Tags: []string{"prod", "q1"}},
+		{EvaluateResponse: EvaluateResponse{RunID: "run_4", Status: "PASS"}, CreatedAt: "2026-03-04T10:00:00Z", EvaluationName: "Search", PolicyVersion: "noema_policy_v2", DatasetDigest: "cc33"},
+	} {
+		writeTestRun(t, store, m)
+	}
+	// A job that hasn't finished has no manifest and isn't listed.
+	if err := os.Mkdir(filepath.Join(store.dir, "run_5"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	return store
+}
+
+func runIDs(entries []RunIndexEntry) string {
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.RunID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestRunsHandler_FiltersAndPages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := testRuns(t)
+	router := gin.New()
+	router.GET("/api/runs", RunsHandler(store))
+
+	cases := []struct {
+		query string
+		want  string
+		total int
+	}{
+		{"", "run_4,run_3,run_2,run_1", 4},
+		{"?status=pass", "run_4,run_3,run_1", 3},
+		{"?from=2026-03-02&to=2026-03-03", "run_3,run_2", 2},
+		{"?from=2026-03-02T10:00:01Z", "run_4,run_3", 2},
+		{"?evaluation_name=support", "run_2,run_1", 2},
+		{"?dataset_digest=AA11", "run_3,run_1", 2},
+		{"?policy_version=noema_policy_v2", "run_4,run_3", 2},
+		{"?tag=prod", "run_3,run_2", 2},
+		{"?tag=prod&tag=q1", "run_3", 1},
+		{"?limit=2", "run_4,run_3", 4},
+		{"?limit=2&offset=2", "run_2,run_1", 4},
+		{"?offset=10", "", 4},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs"+tc.query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", tc.query, rec.Code, rec.Body.String())
+		}
+		var list RunList
+		if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+			t.Fatalf("%s: decode: %v", tc.query, err)
+		}
+		if got := runIDs(list.Runs); got != tc.want || list.Total != tc.total {
+			t.Fatalf("%s: got %q (total %d), want %q (total %d)", tc.query, got, list.Total, tc.want, tc.total)
+		}
+	}
+
+	for _, query := range []string{"?status=maybe", "?from=yesterday", "?limit=0", "?limit=101", "?offset=-1"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/runs"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestRunPatchHandler_TagsSurviveRebuild(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := testRuns(t)
+	router := gin.New()
+	router.PATCH("/api/runs/:id", RunPatchHandler(store))
+
+	patch := func(runID, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/api/runs/"+runID, strings.NewReader(body)))
+		return rec
+	}
+	rec := patch("run_1", `{"tags": ["q1", "audit", "q1"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var entry RunIndexEntry
+	if err := json.NewDecoder(rec.Body).Decode(&entry); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if strings.Join(entry.Tags, ",") != "audit,q1" || entry.EvaluationName != "Support bot" {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+	if rec := patch("run_3", `{"tags": []}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 clearing tags, got %d", rec.Code)
+	}
+
+	for body, want := range map[string]int{
+		`{"tags": ["has space"]}`:      http.StatusBadRequest,
+		`{"tags": [""]}`:               http.StatusBadRequest,
+		`{}`:                           http.StatusBadRequest,
+		`{"tags": [], "status": "OK"}`: http.StatusBadRequest,
+	} {
+		if rec := patch("run_1", body); rec.Code != want {
+			t.Fatalf("%s: expected status %d, got %d", body, want, rec.Code)
+		}
+	}
+	if rec := patch("run_1", `{"tags": ["`+strings.Repeat("x", config.MaxRunPatchBytes)+`"]}`); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status 413 for an oversized body, got %d", rec.Code)
+	}
+	for _, runID := range []string{"run_404", "run_5"} {
+		if rec := patch(runID, `{"tags": ["x"]}`); rec.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected status 404, got %d", runID, rec.Code)
+		}
+	}
+
+	before, err := ListRuns(store, RunFilter{}, maxRunsPage, 0)
+	if err != nil {
+		t.Fatalf("ListRuns: %v", err)
+	}
+	if err := os.Remove(filepath.Join(store.dir, runsIndexFile)); err != nil {
+		t.Fatalf("remove index: %v", err)
+	}
+	after, err := ListRuns(store, RunFilter{}, maxRunsPage, 0)
+	if err != nil {
+		t.Fatalf("ListRuns: %v", err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("rebuilt index differs:\nbefore %+v\nafter  %+v", before.Runs, after.Runs)
+	}
+	tagged, err := ListRuns(store, RunFilter{Tags: []string{"q1"}}, maxRunsPage, 0)
+	if err != nil {
+		t.Fatalf("ListRuns: %v", err)
+	}
+	if got := runIDs(tagged.Runs); got != "run_1" {
+		t.Fatalf("expected tags to survive the rebuild, got %q", got)
+	}
+}
+
+func TestRunsIndex_RebuildsCorruptIndex(t *testing.T) {
+	store := testRuns(t)
+	if err := os.WriteFile(filepath.Join(store.dir, runsIndexFile), []byte("{not json"), 0o644); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+	writeTestRun(t, store, RunManifest{EvaluateResponse: EvaluateResponse{RunID: "run_6", Status: "PASS"}})
+	list, err := ListRuns(store, RunFilter{}, maxRunsPage, 0)
+	if err != nil {
+		t.Fatalf("ListRuns: %v", err)
+	}
+	if got := runIDs(list.Runs); got != "run_4,run_3,run_2,run_1,run_6" {
+		t.Fatalf("expected the index rebuilt around the new run, got %q", got)
+	}
+	backups, _ := filepath.Glob(filepath.Join(store.dir, runsIndexFile+".corrupt-*"))
+	if len(backups) != 1 {
+		t.Fatalf("expected the corrupt index to be archived, got %v", backups)
+	}
+}
+
+func TestPruneRuns_DropsIndexEntries(t *testing.T) {
+	store := testRuns(t)
+	if err := pruneRuns(store, 2); err != nil {
+		t.Fatalf("pruneRuns: %v", err)
+	}
+	list, err := ListRuns(store, RunFilter{}, maxRunsPage, 0)
+	if err != nil {
+		t.Fatalf("ListRuns: %v", err)
+	}
+	if err := store.Reindex(); err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+	rebuilt, err := ListRuns(store, RunFilter{}, maxRunsPage, 0)
+	if err != nil {
+		t.Fatalf("ListRuns: %v", err)
+	}
+	if runIDs(list.Runs) != runIDs(rebuilt.Runs) {
+		t.Fatalf("index after pruning %q doesn't match the run directories %q", runIDs(list.Runs), runIDs(rebuilt.Runs))
+	}
+}
@@ -0,0 +1,40 @@
+package evaluate
+
+import (
+	"errors"
+	"fmt"
+
+	"noema/internal/zk"
+)
+
+// ErrNotSampled is returned for openings that bind no evaluator sample.
+var ErrNotSampled = errors.New("opening does not bind a sample")
+
+// SampledItems recomputes, from a run's dataset file and its commitment
+// opening, exactly what the evaluator was sent: the sampled items encoded as
+// they were in the prompt. It fails unless the dataset reproduces the
+// opening's digest under alg, with the dataset salt of Merkle digests, and
+// the sample is the one the digest yields.
+func SampledItems(raw []byte, alg, salt string, opening zk.CommitmentOpening) ([]byte, error) {
+	if opening.Sample == nil {
+		return nil, ErrNotSampled
+	}
+	digest, err := DatasetDigestBytes(raw, alg, salt)
+	if err != nil {
+		return nil, err
+	}
+	if digest != opening.DatasetDigest {
+		return nil, fmt.Errorf("dataset does not reproduce digest %s", opening.DatasetDigest)
+	}
+	if err := opening.Sample.Verify(digest); err != nil {
+		return nil, err
+	}
+	ds, err := parseDatasetSchema(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(ds.Items) != opening.Sample.DatasetSize {
+		return nil, fmt.Errorf("dataset has %d items, sample was drawn from %d", len(ds.Items), opening.Sample.DatasetSize)
+	}
+	return marshalSampledDataset(sampleDataset(ds, opening.Sample.Indices))
+}
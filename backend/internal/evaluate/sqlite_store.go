@@ -0,0 +1,338 @@
+package evaluate
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	// Registers the pure Go "sqlite" driver.
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id         TEXT PRIMARY KEY,
+	updated_at INTEGER NOT NULL,
+	entry      TEXT
+);
+CREATE TABLE IF NOT EXISTS artifacts (
+	run_id TEXT NOT NULL,
+	name   TEXT NOT NULL,
+	data   BLOB NOT NULL,
+	PRIMARY KEY (run_id, name)
+);
+`
+
+// SQLiteRunStore keeps runs in an embedded SQLite database: a row per run,
+// holding its index entry, and a row per artifact.
+type SQLiteRunStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteRunStore opens the SQLite database at path, creating it and its
+// tables as needed.
+func OpenSQLiteRunStore(path string) (*SQLiteRunStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// One connection serializes writers, which SQLite would otherwise
+	// answer with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create run store tables in %s: %w", path, err)
+	}
+	return &SQLiteRunStore{db: db}, nil
+}
+
+func (s *SQLiteRunStore) Create() (string, error) {
+	const maxAttempts = 5
+	for i := 0; i < maxAttempts; i++ {
+		runID := genRunID()
+		res, err := s.db.Exec(`INSERT OR IGNORE INTO runs (id, updated_at) VALUES (?, ?)`, runID, time.Now().UnixNano())
+		if err != nil {
+			return "", err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return runID, nil
+		}
+	}
+	return "", fmt.Errorf("failed to create unique run after %d attempts", maxAttempts)
+}
+
+func (s *SQLiteRunStore) SaveArtifact(runID, name string, data []byte) error {
+	if err := checkArtifactName(name); err != nil {
+		return err
+	}
+	var entry *RunIndexEntry
+	if name == runManifestFile {
+		var err error
+		if entry, err = manifestEntry(data); err != nil {
+			return err
+		}
+	}
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := touchRun(tx, runID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO artifacts (run_id, name, data) VALUES (?, ?, ?)
+			ON CONFLICT (run_id, name) DO UPDATE SET data = excluded.data`, runID, name, data); err != nil {
+			return err
+		}
+		if entry == nil {
+			return nil
+		}
+		return setEntry(tx, runID, entry)
+	})
+}
+
+func (s *SQLiteRunStore) Load(runID, name string) ([]byte, error) {
+	if err := checkArtifactName(name); err != nil {
+		return nil, err
+	}
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM artifacts WHERE run_id = ? AND name = ?`, runID, name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		if err := s.runExists(runID); err != nil {
+			return nil, err
+		}
+		return nil, ErrArtifactNotFound
+	}
+	return data, err
+}
+
+func (s *SQLiteRunStore) List() ([]StoredRun, error) {
+	rows, err := s.db.Query(`SELECT id, updated_at, entry FROM runs`)
+	if err != nil {
+		return nil, err
+	}
+	var runs []StoredRun
+	byID := make(map[string]int)
+	for rows.Next() {
+		var (
+			run     StoredRun
+			updated int64
+			entry   sql.NullString
+		)
+		if err := rows.Scan(&run.ID, &updated, &entry); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		run.UpdatedAt = time.Unix(0, updated)
+		if entry.Valid {
+			var e RunIndexEntry
+			if err := json.Unmarshal([]byte(entry.String), &e); err != nil {
+				log.Printf("run store: index entry of %s: %v", run.ID, err)
+			} else {
+				run.Entry = &e
+			}
+		}
+		byID[run.ID] = len(runs)
+		runs = append(runs, run)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(`SELECT run_id, name FROM artifacts ORDER BY run_id, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var runID, name string
+		if err := rows.Scan(&runID, &name); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[runID]; ok {
+			runs[i].Artifacts = append(runs[i].Artifacts, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].UpdatedAt.Equal(runs[j].UpdatedAt) {
+			return runs[i].UpdatedAt.After(runs[j].UpdatedAt)
+		}
+		return runs[i].ID > runs[j].ID
+	})
+	return runs, nil
+}
+
+func (s *SQLiteRunStore) Delete(runID string, keep ...string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := runExistsTx(tx, runID); err != nil {
+			return err
+		}
+		return deleteRun(tx, runID, keep)
+	})
+}
+
+func (s *SQLiteRunStore) Prune(keep int, busy func(runID string) bool) ([]string, error) {
+	runs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	kept := 0
+	for _, run := range runs {
+		if busy != nil && busy(run.ID) {
+			continue
+		}
+		if kept < keep {
+			kept++
+			continue
+		}
+		if err := s.inTx(func(tx *sql.Tx) error { return deleteRun(tx, run.ID, nil) }); err != nil {
+			return removed, err
+		}
+		removed = append(removed, run.ID)
+	}
+	return removed, nil
+}
+
+func (s *SQLiteRunStore) Reindex() error {
+	runs, err := s.List()
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		entry, err := reindexEntry(s, run.ID)
+		if err != nil {
+			log.Printf("runs index: skip %s: %v", run.ID, err)
+			continue
+		}
+		if err := s.inTx(func(tx *sql.Tx) error { return setEntry(tx, run.ID, entry) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteRunStore) Close() error {
+	return s.db.Close()
+}
+
+// importRun copies a run into the store under its own ID, with all of its
+// artifacts, in one transaction. A run that is already there is left as
+// it is.
+func (s *SQLiteRunStore) importRun(run StoredRun, artifacts map[string][]byte) (bool, error) {
+	imported := false
+	err := s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`INSERT OR IGNORE INTO runs (id, updated_at) VALUES (?, ?)`, run.ID, run.UpdatedAt.UnixNano())
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		for name, data := range artifacts {
+			if _, err := tx.Exec(`INSERT INTO artifacts (run_id, name, data) VALUES (?, ?, ?)`, run.ID, name, data); err != nil {
+				return err
+			}
+		}
+		imported = true
+		return nil
+	})
+	return imported, err
+}
+
+func (s *SQLiteRunStore) inTx(fn func(*sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteRunStore) runExists(runID string) error {
+	var one int
+	err := s.db.QueryRow(`SELECT 1 FROM runs WHERE id = ?`, runID).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRunNotFound
+	}
+	return err
+}
+
+func runExistsTx(tx *sql.Tx, runID string) error {
+	var one int
+	err := tx.QueryRow(`SELECT 1 FROM runs WHERE id = ?`, runID).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRunNotFound
+	}
+	return err
+}
+
+// touchRun marks runID updated now.
+func touchRun(tx *sql.Tx, runID string) error {
+	res, err := tx.Exec(`UPDATE runs SET updated_at = ? WHERE id = ?`, time.Now().UnixNano(), runID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRunNotFound
+	}
+	return nil
+}
+
+func setEntry(tx *sql.Tx, runID string, entry *RunIndexEntry) error {
+	var value any
+	if entry != nil {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		value = string(b)
+	}
+	_, err := tx.Exec(`UPDATE runs SET entry = ? WHERE id = ?`, value, runID)
+	return err
+}
+
+func deleteRun(tx *sql.Tx, runID string, keep []string) error {
+	if len(keep) == 0 {
+		if _, err := tx.Exec(`DELETE FROM artifacts WHERE run_id = ?`, runID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM runs WHERE id = ?`, runID)
+		return err
+	}
+	args := []any{runID}
+	for _, name := range keep {
+		args = append(args, name)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(keep)), ", ")
+	if _, err := tx.Exec(`DELETE FROM artifacts WHERE run_id = ? AND name NOT IN (`+placeholders+`)`, args...); err != nil {
+		return err
+	}
+	var left int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM artifacts WHERE run_id = ?`, runID).Scan(&left); err != nil {
+		return err
+	}
+	if left == 0 {
+		// Nothing kept was there; drop the run as a plain Delete would.
+		return deleteRun(tx, runID, nil)
+	}
+	for _, name := range keep {
+		if name == runManifestFile {
+			return nil
+		}
+	}
+	return setEntry(tx, runID, nil)
+}
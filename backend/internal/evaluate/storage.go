@@ -3,13 +3,13 @@ package evaluate
 import (
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
 	"mime/multipart"
 	"os"
 	"path/filepath"
-	"strconv"
 	"sync/atomic"
 	"time"
 )
@@ -25,64 +25,54 @@ func genRunID() string {
 	return fmt.Sprintf("run_%d_%d_%d", time.Now().UnixMilli(), os.Getpid(), counter)
 }
 
-func createRunDir(runsDir string) (string, string, error) {
-	if err := os.MkdirAll(runsDir, 0755); err != nil {
-		return "", "", err
-	}
-	const maxAttempts = 5
-	for i := 0; i < maxAttempts; i++ {
-		runID := genRunID()
-		path := filepath.Join(runsDir, runID)
-		if err := os.Mkdir(path, 0755); err == nil {
-			return runID, path, nil
-		} else if os.IsExist(err) {
-			continue
-		} else {
-			return "", "", err
-		}
-	}
-	return "", "", fmt.Errorf("failed to create unique run directory after %d attempts", maxAttempts)
-}
+// ErrRunNotFound is returned when a run ID doesn't name a stored run.
+var ErrRunNotFound = errors.New("run not found")
+
+// runDatasetFile is the run's uploaded dataset.
+const runDatasetFile = "dataset.json"
 
-func saveRunFiles(runPath string, dataset *multipart.FileHeader, images []*multipart.FileHeader) error {
-	if err := saveUpload(dataset, filepath.Join(runPath, "dataset.json")); err != nil {
-		return fmt.Errorf("failed to save dataset: %w", err)
+// saveRunFiles saves a run's uploads as artifacts of runID and returns
+// where its images went.
+func saveRunFiles(store RunStore, runID string, dataset *multipart.FileHeader, images []*multipart.FileHeader) ([]runImage, error) {
+	if err := saveUpload(store, runID, runDatasetFile, dataset); err != nil {
+		return nil, fmt.Errorf("failed to save dataset: %w", err)
 	}
+	saved := make([]runImage, 0, len(images))
 	for i, f := range images {
 		ext := filepath.Ext(f.Filename)
 		if ext == "" {
 			ext = ".bin"
 		}
-		dst := filepath.Join(runPath, fmt.Sprintf("image_%d%s", i, ext))
-		if err := saveUpload(f, dst); err != nil {
-			return fmt.Errorf("failed to save image %d: %w", i, err)
+		name := fmt.Sprintf("image_%d%s", i, ext)
+		if err := saveUpload(store, runID, name, f); err != nil {
+			return nil, fmt.Errorf("failed to save image %d: %w", i, err)
 		}
+		saved = append(saved, runImage{File: name, Filename: f.Filename, MIMEType: imageMIMEType(f)})
 	}
-	return nil
+	return saved, nil
 }
 
-func saveRunMetadata(runPath string, policyConfig PolicyConfig, evalOut EvaluationResult) error {
-	if err := saveJSON(filepath.Join(runPath, "policy_config.json"), policyConfig); err != nil {
+func saveRunMetadata(store RunStore, runID string, policyConfig PolicyConfig, evalOut EvaluationResult) error {
+	if err := saveArtifactJSON(store, runID, "policy_config.json", policyConfig); err != nil {
 		return fmt.Errorf("failed to save policy_config: %w", err)
 	}
-	if err := saveJSON(filepath.Join(runPath, "evaluation_result.json"), evalOut); err != nil {
+	if err := saveArtifactJSON(store, runID, "evaluation_result.json", evalOut); err != nil {
 		return fmt.Errorf("failed to save evaluation result: %w", err)
 	}
 	return nil
 }
 
-func saveUpload(fh *multipart.FileHeader, dst string) error {
+func saveUpload(store RunStore, runID, name string, fh *multipart.FileHeader) error {
 	src, err := fh.Open()
 	if err != nil {
 		return fmt.Errorf("open upload: %w", err)
 	}
 	defer src.Close()
-	return writeAtomic(dst, 0644, func(tmp *os.File) error {
-		if _, err := io.Copy(tmp, src); err != nil {
-			return fmt.Errorf("copy to %s: %w", dst, err)
-		}
-		return nil
-	})
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return fmt.Errorf("read upload: %w", err)
+	}
+	return store.SaveArtifact(runID, name, data)
 }
 
 func saveJSON(path string, v any) error {
@@ -137,37 +127,3 @@ func writeAtomic(path string, mode os.FileMode, write func(*os.File) error) erro
 	}
 	return nil
 }
-
-type RunIndexEntry struct {
-	RunID          string `json:"run_id"`
-	Status         string `json:"status"`
-	Timestamp      int64  `json:"ts"`
-	EvaluationName string `json:"evaluation_name,omitempty"`
-}
-
-func updateRunsIndex(runsDir string, limit int, entry RunIndexEntry) error {
-	if limit <= 0 {
-		return nil
-	}
-	indexPath := filepath.Join(runsDir, "index.json")
-	var entries []RunIndexEntry
-	var corruptedErr error
-	if b, err := os.ReadFile(indexPath); err == nil {
-		if err := json.Unmarshal(b, &entries); err != nil {
-			backup := indexPath + ".corrupt-" + strconv.FormatInt(time.Now().UnixMilli(), 10)
-			if renameErr := os.Rename(indexPath, backup); renameErr != nil {
-				corruptedErr = fmt.Errorf("runs index corrupted; failed to archive: %w", renameErr)
-			} else {
-				corruptedErr = fmt.Errorf("runs index corrupted; archived as %s", backup)
-			}
-		}
-	}
-	entries = append([]RunIndexEntry{entry}, entries...)
-	if len(entries) > limit {
-		entries = entries[:limit]
-	}
-	if err := saveJSON(indexPath, entries); err != nil {
-		return err
-	}
-	return corruptedErr
-}
@@ -7,18 +7,16 @@ import (
 	"testing"
 )
 
-func TestCreateRunDir(t *testing.T) {
+func TestFSRunStoreCreate(t *testing.T) {
 	runsDir := t.TempDir()
-	runID, runPath, err := createRunDir(runsDir)
+	runID, err := NewFSRunStore(runsDir).Create()
 	if err != nil {
-		t.Fatalf("createRunDir error: %v", err)
+		t.Fatalf("Create error: %v", err)
 	}
 	if !strings.HasPrefix(runID, "run_") {
 		t.Fatalf("expected runID to start with run_, got %q", runID)
 	}
-	if runPath != filepath.Join(runsDir, runID) {
-		t.Fatalf("unexpected runPath: %q", runPath)
-	}
+	runPath := filepath.Join(runsDir, runID)
 	info, err := os.Stat(runPath)
 	if err != nil {
 		t.Fatalf("stat runPath error: %v", err)
@@ -28,20 +26,20 @@ func TestCreateRunDir(t *testing.T) {
 	}
 }
 
-func TestCreateRunDirCreatesBase(t *testing.T) {
+func TestFSRunStoreCreateCreatesBase(t *testing.T) {
 	baseDir := t.TempDir()
 	runsDir := filepath.Join(baseDir, "nested", "runs")
 	if _, err := os.Stat(runsDir); !os.IsNotExist(err) {
 		t.Fatalf("expected runsDir to not exist yet")
 	}
-	runID, runPath, err := createRunDir(runsDir)
+	runID, err := NewFSRunStore(runsDir).Create()
 	if err != nil {
-		t.Fatalf("createRunDir error: %v", err)
+		t.Fatalf("Create error: %v", err)
 	}
 	if !strings.HasPrefix(runID, "run_") {
 		t.Fatalf("expected runID to start with run_, got %q", runID)
 	}
-	info, err := os.Stat(runPath)
+	info, err := os.Stat(filepath.Join(runsDir, runID))
 	if err != nil {
 		t.Fatalf("stat runPath error: %v", err)
 	}
@@ -0,0 +1,116 @@
+package evaluate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrArtifactNotFound is returned when a stored run has no artifact by the
+// name asked for.
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// RunStore keeps runs and the artifacts they produce: named blobs such as
+// the uploaded dataset, job.json, run.json or the .noema bundle. Run IDs
+// come from Create. Methods given an ID that doesn't name a stored run
+// return ErrRunNotFound.
+type RunStore interface {
+	// Create makes a new run with no artifacts and returns its ID.
+	Create() (string, error)
+	// SaveArtifact stores data as the run's artifact name, replacing any
+	// artifact of that name. Saving run.json updates the run's index entry.
+	SaveArtifact(runID, name string, data []byte) error
+	// Load returns the run's artifact name, or ErrArtifactNotFound.
+	Load(runID, name string) ([]byte, error)
+	// List returns every stored run, most recently updated first.
+	List() ([]StoredRun, error)
+	// Delete removes a run and its artifacts. Artifacts named in keep are
+	// left, and so is the run when there are any.
+	Delete(runID string, keep ...string) error
+	// Prune deletes the least recently updated runs until at most keep
+	// remain, leaving alone, and not counting, those busy reports. It
+	// returns the IDs of the runs it deleted.
+	Prune(keep int, busy func(runID string) bool) ([]string, error)
+	// Reindex rebuilds the index entries List reports from the runs'
+	// manifests.
+	Reindex() error
+	Close() error
+}
+
+// StoredRun is a run as RunStore.List reports it.
+type StoredRun struct {
+	ID string
+	// UpdatedAt is when an artifact of the run was last saved.
+	UpdatedAt time.Time
+	// Artifacts names the run's artifacts, sorted.
+	Artifacts []string
+	// Entry is the run's index entry, nil until its manifest is saved.
+	Entry *RunIndexEntry
+}
+
+// manifestEntry returns the index entry of the run whose run.json is raw.
+func manifestEntry(raw []byte) (*RunIndexEntry, error) {
+	var m RunManifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", runManifestFile, err)
+	}
+	entry := indexEntry(m)
+	return &entry, nil
+}
+
+// reindexEntry returns the index entry of a stored run, reading its
+// manifest or rebuilding one for runs from before run.json. Runs without
+// one, such as jobs that haven't finished, have none.
+func reindexEntry(store RunStore, runID string) (*RunIndexEntry, error) {
+	m, err := LoadRunManifest(store, runID)
+	if errors.Is(err, ErrRunNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := indexEntry(m)
+	return &entry, nil
+}
+
+// checkArtifactName rejects names that aren't a single path element.
+func checkArtifactName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid artifact name %q", name)
+	}
+	return nil
+}
+
+func saveArtifactJSON(store RunStore, runID, name string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.SaveArtifact(runID, name, b)
+}
+
+func loadArtifactJSON(store RunStore, runID, name string, v any) error {
+	b, err := store.Load(runID, name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("decode %s: %w", name, err)
+	}
+	return nil
+}
+
+// OpenRunStore opens the run store kind: "fs" keeps runs as directories in
+// runsDir, "sqlite" keeps them in the SQLite database dbPath.
+func OpenRunStore(kind, runsDir, dbPath string) (RunStore, error) {
+	switch kind {
+	case "", "fs":
+		return NewFSRunStore(runsDir), nil
+	case "sqlite":
+		return OpenSQLiteRunStore(dbPath)
+	default:
+		return nil, fmt.Errorf("unknown run store %q (want fs or sqlite)", kind)
+	}
+}
@@ -0,0 +1,240 @@
+package evaluate
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testStores(t *testing.T) map[string]RunStore {
+	t.Helper()
+	db, err := OpenSQLiteRunStore(filepath.Join(t.TempDir(), "runs.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteRunStore: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return map[string]RunStore{
+		"fs":     NewFSRunStore(filepath.Join(t.TempDir(), "runs")),
+		"sqlite": db,
+	}
+}
+
+func TestRunStore_Contract(t *testing.T) {
+	for kind, store := range testStores(t) {
+		t.Run(kind, func(t *testing.T) {
+			create := func() string {
+				t.Helper()
+				runID, err := store.Create()
+				if err != nil {
+					t.Fatalf("Create: %v", err)
+				}
+				// Keep the runs' update times apart.
+				time.Sleep(10 * time.Millisecond)
+				return runID
+			}
+			older, newer := create(), create()
+
+			if err := store.SaveArtifact(older, runDatasetFile, []byte("dataset")); err != nil {
+				t.Fatalf("SaveArtifact: %v", err)
+			}
+			if b, err := store.Load(older, runDatasetFile); err != nil || string(b) != "dataset" {
+				t.Fatalf("Load = %q, %v", b, err)
+			}
+			if _, err := store.Load(older, jobFile); !errors.Is(err, ErrArtifactNotFound) {
+				t.Fatalf("expected ErrArtifactNotFound, got %v", err)
+			}
+			if _, err := store.Load("run_404", jobFile); !errors.Is(err, ErrRunNotFound) {
+				t.Fatalf("expected ErrRunNotFound loading from a missing run, got %v", err)
+			}
+			if err := store.SaveArtifact("run_404", jobFile, []byte("{}")); !errors.Is(err, ErrRunNotFound) {
+				t.Fatalf("expected ErrRunNotFound saving to a missing run, got %v", err)
+			}
+			if err := store.SaveArtifact(older, "../escape", []byte("x")); err == nil {
+				t.Fatalf("expected an artifact name with a path to be rejected")
+			}
+
+			m := RunManifest{EvaluateResponse: EvaluateResponse{RunID: older, Status: "PASS"}, CreatedAt: "2026-03-01T10:00:00Z", Tags: []string{"prod"}}
+			if err := saveRunManifest(store, older, m); err != nil {
+				t.Fatalf("saveRunManifest: %v", err)
+			}
+			if err := saveArtifactJSON(store, older, jobFile, jobRecord{}); err != nil {
+				t.Fatalf("saveArtifactJSON: %v", err)
+			}
+			runs, err := store.List()
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(runs) != 2 || runs[0].ID != older || runs[1].ID != newer {
+				t.Fatalf("expected the last updated run first, got %+v", runs)
+			}
+			if want := []string{runDatasetFile, jobFile, runManifestFile}; !slices.Equal(runs[0].Artifacts, sorted(want)) {
+				t.Fatalf("expected artifacts %v, got %v", sorted(want), runs[0].Artifacts)
+			}
+			if e := runs[0].Entry; e == nil || !reflect.DeepEqual(*e, indexEntry(m)) {
+				t.Fatalf("expected the manifest's index entry, got %+v", e)
+			}
+			if runs[1].Entry != nil || len(runs[1].Artifacts) != 0 {
+				t.Fatalf("expected an empty run, got %+v", runs[1])
+			}
+
+			if err := store.Delete(older, jobFile); err != nil {
+				t.Fatalf("Delete keeping %s: %v", jobFile, err)
+			}
+			if _, err := store.Load(older, jobFile); err != nil {
+				t.Fatalf("expected %s to be kept: %v", jobFile, err)
+			}
+			if _, err := store.Load(older, runManifestFile); !errors.Is(err, ErrArtifactNotFound) {
+				t.Fatalf("expected %s to be deleted, got %v", runManifestFile, err)
+			}
+			if list, err := ListRuns(store, RunFilter{}, maxRunsPage, 0); err != nil || list.Total != 0 {
+				t.Fatalf("expected no listed runs, got %+v, %v", list, err)
+			}
+
+			if err := store.Delete(newer); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := store.Load(newer, jobFile); !errors.Is(err, ErrRunNotFound) {
+				t.Fatalf("expected the deleted run to be gone, got %v", err)
+			}
+			if err := store.Delete(newer); !errors.Is(err, ErrRunNotFound) {
+				t.Fatalf("expected ErrRunNotFound deleting twice, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRunStore_DeleteKeep(t *testing.T) {
+	for kind, store := range testStores(t) {
+		t.Run(kind, func(t *testing.T) {
+			withJob, err := store.Create()
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			withoutJob, err := store.Create()
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			m := RunManifest{EvaluateResponse: EvaluateResponse{Status: "PASS"}, CreatedAt: "2026-03-01T10:00:00Z"}
+			for _, runID := range []string{withJob, withoutJob} {
+				m.RunID = runID
+				if err := saveRunManifest(store, runID, m); err != nil {
+					t.Fatalf("saveRunManifest: %v", err)
+				}
+			}
+			if err := saveArtifactJSON(store, withJob, jobFile, jobRecord{}); err != nil {
+				t.Fatalf("saveArtifactJSON: %v", err)
+			}
+
+			for _, runID := range []string{withJob, withoutJob} {
+				if err := store.Delete(runID, jobFile); err != nil {
+					t.Fatalf("Delete %s keeping %s: %v", runID, jobFile, err)
+				}
+			}
+			runs, err := store.List()
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(runs) != 1 || runs[0].ID != withJob || !slices.Equal(runs[0].Artifacts, []string{jobFile}) || runs[0].Entry != nil {
+				t.Fatalf("expected only %s left, holding just %s, got %+v", withJob, jobFile, runs)
+			}
+			if _, err := store.Load(withoutJob, jobFile); !errors.Is(err, ErrRunNotFound) {
+				t.Fatalf("expected the run with nothing kept to be gone, got %v", err)
+			}
+			if list, err := ListRuns(store, RunFilter{}, maxRunsPage, 0); err != nil || list.Total != 0 {
+				t.Fatalf("expected no listed runs, got %+v, %v", list, err)
+			}
+		})
+	}
+}
+
+func TestRunStore_Prune(t *testing.T) {
+	for kind, store := range testStores(t) {
+		t.Run(kind, func(t *testing.T) {
+			var ids []string
+			for i := 0; i < 4; i++ {
+				runID, err := store.Create()
+				if err != nil {
+					t.Fatalf("Create: %v", err)
+				}
+				ids = append(ids, runID)
+				time.Sleep(10 * time.Millisecond)
+			}
+			busy := ids[0]
+			removed, err := store.Prune(2, func(runID string) bool { return runID == busy })
+			if err != nil {
+				t.Fatalf("Prune: %v", err)
+			}
+			if !slices.Equal(removed, []string{ids[1]}) {
+				t.Fatalf("expected only %s pruned, got %v", ids[1], removed)
+			}
+			runs, err := store.List()
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var left []string
+			for _, r := range runs {
+				left = append(left, r.ID)
+			}
+			if want := []string{ids[3], ids[2], ids[0]}; !slices.Equal(left, want) {
+				t.Fatalf("expected %v to remain, got %v", want, left)
+			}
+		})
+	}
+}
+
+func TestMigrateRuns(t *testing.T) {
+	src := testRuns(t)
+	if err := src.SaveArtifact("run_2", commitmentFile, []byte(`{"salt":"secret"}`)); err != nil {
+		t.Fatalf("SaveArtifact: %v", err)
+	}
+	dst, err := OpenSQLiteRunStore(filepath.Join(t.TempDir(), "runs.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteRunStore: %v", err)
+	}
+	defer dst.Close()
+
+	stats, err := MigrateRuns(src, dst, false)
+	if err != nil {
+		t.Fatalf("MigrateRuns: %v", err)
+	}
+	if stats != (MigrateStats{Copied: 5}) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	want, err := ListRuns(src, RunFilter{}, maxRunsPage, 0)
+	if err != nil {
+		t.Fatalf("ListRuns: %v", err)
+	}
+	got, err := ListRuns(dst, RunFilter{}, maxRunsPage, 0)
+	if err != nil {
+		t.Fatalf("ListRuns: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("migrated index differs:\nwant %+v\ngot  %+v", want.Runs, got.Runs)
+	}
+	if b, err := dst.Load("run_2", commitmentFile); err != nil || string(b) != `{"salt":"secret"}` {
+		t.Fatalf("expected the commitment record migrated, got %q, %v", b, err)
+	}
+
+	stats, err = MigrateRuns(src, dst, true)
+	if err != nil {
+		t.Fatalf("MigrateRuns again: %v", err)
+	}
+	if stats != (MigrateStats{Skipped: 5, Deleted: 5}) {
+		t.Fatalf("unexpected stats migrating again %+v", stats)
+	}
+	if runs, err := src.List(); err != nil || len(runs) != 0 {
+		t.Fatalf("expected the source emptied, got %v, %v", runs, err)
+	}
+	if got, err := ListRuns(dst, RunFilter{}, maxRunsPage, 0); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the migrated runs to stay, got %+v, %v", got, err)
+	}
+}
+
+func sorted(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
@@ -150,8 +150,9 @@ func EvaluateStream(ctx context.Context, req EvalRequest, onChunk func(string))
 		if err != nil {
 			return EvalResponse{}, fmt.Errorf("generate content stream: %w", err)
 		}
-		if usage == nil {
-			usage = extractUsage(result.UsageMetadata)
+		// Later chunks carry the running totals.
+		if u := extractUsage(result.UsageMetadata); u != nil {
+			usage = u
 		}
 		chunk := result.Text()
 		if chunk == "" {
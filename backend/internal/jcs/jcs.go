@@ -0,0 +1,208 @@
+// Package jcs implements the JSON Canonicalization Scheme of RFC 8785:
+// object members sorted by their UTF-16 code units, no insignificant
+// whitespace, strings with minimal escaping and numbers in their ECMAScript
+// shortest form. Two encodings of the same JSON value canonicalize to the
+// same bytes, so hashes over the canonical form survive re-serialization.
+package jcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Canonicalize returns the canonical form of the single JSON value in raw.
+// It rejects what RFC 8785 can't canonicalize: duplicate object members,
+// invalid UTF-8, and numbers outside the range of IEEE 754 doubles.
+func Canonicalize(raw []byte) ([]byte, error) {
+	if !utf8.Valid(raw) {
+		return nil, fmt.Errorf("jcs: invalid UTF-8")
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	if err := writeValue(&buf, dec); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("jcs: trailing data after JSON value")
+	}
+	return buf.Bytes(), nil
+}
+
+func writeValue(buf *bytes.Buffer, dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("jcs: %w", err)
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '{' {
+			return writeObject(buf, dec)
+		}
+		if v == '[' {
+			return writeArray(buf, dec)
+		}
+		return fmt.Errorf("jcs: unexpected %v", v)
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		s, err := formatNumber(v)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+	case string:
+		writeString(buf, v)
+	}
+	return nil
+}
+
+func writeArray(buf *bytes.Buffer, dec *json.Decoder) error {
+	buf.WriteByte('[')
+	for i := 0; dec.More(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeValue(buf, dec); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("jcs: %w", err)
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+func writeObject(buf *bytes.Buffer, dec *json.Decoder) error {
+	type member struct {
+		key   string
+		value []byte
+	}
+	var members []member
+	seen := make(map[string]bool)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("jcs: %w", err)
+		}
+		key := tok.(string)
+		if seen[key] {
+			return fmt.Errorf("jcs: duplicate member %q", key)
+		}
+		seen[key] = true
+		var value bytes.Buffer
+		if err := writeValue(&value, dec); err != nil {
+			return err
+		}
+		members = append(members, member{key, value.Bytes()})
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("jcs: %w", err)
+	}
+	slices.SortFunc(members, func(a, b member) int {
+		return slices.Compare(utf16.Encode([]rune(a.key)), utf16.Encode([]rune(b.key)))
+	})
+	buf.WriteByte('{')
+	for i, m := range members {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeString(buf, m.key)
+		buf.WriteByte(':')
+		buf.Write(m.value)
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// writeString escapes only what JSON requires, with the short escapes
+// where they exist and lowercase \u00XX for other control characters.
+func writeString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// formatNumber serializes n as ECMAScript's Number.prototype.toString does
+// for the double n parses to (RFC 8785, section 3.2.2.3).
+func formatNumber(n json.Number) (string, error) {
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil || math.IsInf(f, 0) {
+		return "", fmt.Errorf("jcs: number %s is not an IEEE 754 double", n)
+	}
+	if f == 0 {
+		return "0", nil
+	}
+	sign := ""
+	if f < 0 {
+		sign, f = "-", -f
+	}
+	// Shortest round-trip digits d1.d2...dk and exponent e, so the value
+	// is 0.d1...dk * 10^n with n = e+1.
+	mantissa, exp, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	e, _ := strconv.Atoi(exp)
+	k, pos := len(digits), e+1
+
+	var out string
+	switch {
+	case k <= pos && pos <= 21:
+		out = digits + strings.Repeat("0", pos-k)
+	case 0 < pos && pos <= 21:
+		out = digits[:pos] + "." + digits[pos:]
+	case -6 < pos && pos <= 0:
+		out = "0." + strings.Repeat("0", -pos) + digits
+	default:
+		out = digits[:1]
+		if k > 1 {
+			out += "." + digits[1:]
+		}
+		expSign := "+"
+		if pos-1 < 0 {
+			expSign = "-"
+		}
+		out += "e" + expSign + strconv.Itoa(abs(pos-1))
+	}
+	return sign + out, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,107 @@
+package jcs
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"testing"
+)
+
+// The example of RFC 8785, section 3.2.2.
+func TestCanonicalizeRFC8785Example(t *testing.T) {
+	in := `{
+  "numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+  "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+  "literals": [null, true, false]
+}`
+	want := `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`
+	got, err := Canonicalize([]byte(in))
+	if err != nil {
+		t.Fatalf("Canonicalize error: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+// The property sorting example of RFC 8785, section 3.2.3: keys compare
+// as UTF-16 code units, so the emoji sorts before U+FB33.
+func TestCanonicalizeSortsByUTF16(t *testing.T) {
+	in := `{"\u20ac":1,"\r":2,"\ufb33":3,"1":4,"\ud83d\ude00":5,"\u0080":6,"\u00f6":7}`
+	want := "{\"\\r\":2,\"1\":4,\"\u0080\":6,\"\u00f6\":7,\"\u20ac\":1,\"\U0001F600\":5,\"\ufb33\":3}"
+	got, err := Canonicalize([]byte(in))
+	if err != nil {
+		t.Fatalf("Canonicalize error: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+// Number serialization samples from RFC 8785, appendix B.
+func TestFormatNumberRFC8785Samples(t *testing.T) {
+	cases := map[uint64]string{
+		0x0000000000000000: "0",
+		0x8000000000000000: "0",
+		0x0000000000000001: "5e-324",
+		0x8000000000000001: "-5e-324",
+		0x7fefffffffffffff: "1.7976931348623157e+308",
+		0xffefffffffffffff: "-1.7976931348623157e+308",
+		0x4340000000000000: "9007199254740992",
+		0xc340000000000000: "-9007199254740992",
+		0x4430000000000000: "295147905179352830000",
+		0x44b52d02c7e14af5: "9.999999999999997e+22",
+		0x44b52d02c7e14af6: "1e+23",
+		0x44b52d02c7e14af7: "1.0000000000000001e+23",
+		0x444b1ae4d6e2ef4e: "999999999999999700000",
+		0x444b1ae4d6e2ef4f: "999999999999999900000",
+		0x444b1ae4d6e2ef50: "1e+21",
+		0x3eb0c6f7a0b5ed8c: "9.999999999999997e-7",
+		0x3eb0c6f7a0b5ed8d: "0.000001",
+		0x41b3de4355555553: "333333333.3333332",
+		0x41b3de4355555554: "333333333.33333325",
+		0x41b3de4355555555: "333333333.3333333",
+		0x41b3de4355555556: "333333333.3333334",
+		0x41b3de4355555557: "333333333.33333343",
+		0xbecbf647612f3696: "-0.0000033333333333333333",
+		0x43143ff3c1cb0959: "1424953923781206.2",
+	}
+	for bits, want := range cases {
+		n := json.Number(strconv.FormatFloat(math.Float64frombits(bits), 'g', -1, 64))
+		got, err := formatNumber(n)
+		if err != nil {
+			t.Fatalf("formatNumber(%s) error: %v", n, err)
+		}
+		if got != want {
+			t.Fatalf("%016x: got %s, want %s", bits, got, want)
+		}
+	}
+}
+
+func TestCanonicalizeIgnoresEncoding(t *testing.T) {
+	a, err := Canonicalize([]byte(`{"items":[{"id":"1","text":"caf\u00e9","metadata":{"b":1.0,"a":[]}}]}`))
+	if err != nil {
+		t.Fatalf("Canonicalize error: %v", err)
+	}
+	b, err := Canonicalize([]byte("{ \"items\" : [ { \"metadata\" : { \"a\" : [ ], \"b\" : 1 }, \"text\" : \"café\", \"id\" : \"1\" } ] }\n"))
+	if err != nil {
+		t.Fatalf("Canonicalize error: %v", err)
+	}
+	if string(a) != string(b) {
+		t.Fatalf("expected equal canonical forms, got %s and %s", a, b)
+	}
+}
+
+func TestCanonicalizeRejects(t *testing.T) {
+	for _, in := range []string{
+		`{"a":1,"a":2}`,
+		`[1e400]`,
+		`{"a":1} {}`,
+		`{"a":`,
+		"\"\xff\"",
+	} {
+		if _, err := Canonicalize([]byte(in)); err == nil {
+			t.Fatalf("expected error for %q", in)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package merkle implements the SHA-256 Merkle tree of RFC 6962 (Certificate
+// Transparency): leaves and interior nodes are hashed with distinct prefixes,
+// and a tree of n leaves splits at the largest power of two below n. Audit
+// paths are the ones RFC 6962 defines, so any CT-style verifier checks them.
+package merkle
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// Hash is a leaf or node hash.
+type Hash = [sha256.Size]byte
+
+// LeafHash hashes one leaf's data.
+func LeafHash(data []byte) Hash {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(data)
+	var out Hash
+	h.Sum(out[:0])
+	return out
+}
+
+func nodeHash(left, right Hash) Hash {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left[:])
+	h.Write(right[:])
+	var out Hash
+	h.Sum(out[:0])
+	return out
+}
+
+// Root returns the tree hash over leaves, which are LeafHash values. The
+// root of an empty tree is the hash of the empty string.
+func Root(leaves []Hash) Hash {
+	switch len(leaves) {
+	case 0:
+		return sha256.Sum256(nil)
+	case 1:
+		return leaves[0]
+	}
+	k := split(len(leaves))
+	return nodeHash(Root(leaves[:k]), Root(leaves[k:]))
+}
+
+// Proof returns the audit path for leaves[index], from the leaf up.
+func Proof(leaves []Hash, index int) ([]Hash, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("leaf index %d out of range for %d leaves", index, len(leaves))
+	}
+	var path []Hash
+	for len(leaves) > 1 {
+		k := split(len(leaves))
+		if index < k {
+			path = append(path, Root(leaves[k:]))
+			leaves = leaves[:k]
+		} else {
+			path = append(path, Root(leaves[:k]))
+			leaves = leaves[k:]
+			index -= k
+		}
+	}
+	// Collected from the root down; audit paths run from the leaf up.
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, nil
+}
+
+// Verify reports whether path proves that leaf is at index in the tree of
+// size leaves with the given root (RFC 9162, section 2.1.3.2).
+func Verify(root, leaf Hash, index, size int, path []Hash) bool {
+	if index < 0 || index >= size {
+		return false
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range path {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			if fn&1 == 0 {
+				for fn&1 == 0 && fn != 0 {
+					fn >>= 1
+					sn >>= 1
+				}
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && r == root
+}
+
+// split is the largest power of two smaller than n, for n > 1.
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
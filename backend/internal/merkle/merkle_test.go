@@ -0,0 +1,62 @@
+package merkle
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func leaves(data ...string) []Hash {
+	out := make([]Hash, len(data))
+	for i, d := range data {
+		raw, err := hex.DecodeString(d)
+		if err != nil {
+			panic(err)
+		}
+		out[i] = LeafHash(raw)
+	}
+	return out
+}
+
+// The eight-leaf tree from the Certificate Transparency test data.
+func TestRootMatchesRFC6962Vector(t *testing.T) {
+	tree := leaves("", "00", "10", "2021", "3031", "40414243", "5051525354555657", "606162636465666768696a6b6c6d6e6f")
+	root := Root(tree)
+	if got := hex.EncodeToString(root[:]); got != "5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328" {
+		t.Fatalf("unexpected root %s", got)
+	}
+}
+
+func TestProofsVerify(t *testing.T) {
+	for size := 1; size <= 17; size++ {
+		data := make([]string, size)
+		for i := range data {
+			data[i] = hex.EncodeToString([]byte{byte(i)})
+		}
+		tree := leaves(data...)
+		root := Root(tree)
+		for i := range tree {
+			path, err := Proof(tree, i)
+			if err != nil {
+				t.Fatalf("Proof(%d of %d) error: %v", i, size, err)
+			}
+			if !Verify(root, tree[i], i, size, path) {
+				t.Fatalf("proof for leaf %d of %d does not verify", i, size)
+			}
+			if Verify(root, tree[(i+1)%size], i, size, path) && size > 1 {
+				t.Fatalf("proof for leaf %d of %d verifies another leaf", i, size)
+			}
+			if size > 1 && Verify(root, tree[i], (i+1)%size, size, path) {
+				t.Fatalf("proof for leaf %d of %d verifies at another index", i, size)
+			}
+			if len(path) > 0 {
+				path[0][0] ^= 1
+				if Verify(root, tree[i], i, size, path) {
+					t.Fatalf("tampered proof for leaf %d of %d verifies", i, size)
+				}
+			}
+		}
+	}
+	if _, err := Proof(leaves("00"), 1); err == nil {
+		t.Fatalf("expected an out of range index to be rejected")
+	}
+}
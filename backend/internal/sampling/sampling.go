@@ -0,0 +1,188 @@
+// Package sampling picks the dataset items an evaluator sees. The indices
+// are derived from the dataset digest alone, through a seed hashed from it,
+// so anyone holding the dataset can recompute exactly which items were
+// sampled. The owner can't draw again by resubmitting: the only way to a
+// different sample is a different dataset, which the proof then binds.
+package sampling
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"slices"
+)
+
+// SeedBytes is the length of a sampling seed.
+const SeedBytes = 32
+
+// domain prefixes every hash this package computes but the seed's.
+const domain = "noema_sample_v1|"
+
+// seedDomain prefixes the hash a seed is derived by.
+const seedDomain = "noema_sample_seed_v1|"
+
+// Sample records how a run's evaluator input was drawn from its dataset.
+type Sample struct {
+	// Seed is the hex encoded seed the dataset digest yields.
+	Seed string `json:"seed"`
+	// DatasetSize is the number of items in the dataset.
+	DatasetSize int `json:"dataset_size"`
+	// Limit is the most items the evaluator was given; 0 means no limit.
+	Limit int `json:"limit"`
+	// Indices are the sampled item positions, ascending.
+	Indices []int `json:"indices"`
+}
+
+// Seed returns the seed a dataset with the given digest is sampled with, as
+// hex: SHA-256("noema_sample_seed_v1|" || digest).
+func Seed(datasetDigest string) (string, error) {
+	digest, err := hex.DecodeString(datasetDigest)
+	if err != nil || len(digest) != sha256.Size {
+		return "", fmt.Errorf("invalid dataset digest")
+	}
+	sum := sha256.Sum256(slices.Concat([]byte(seedDomain), digest))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// New draws a sample of at most limit items from a dataset of size items
+// with the given digest.
+func New(datasetDigest string, size, limit int) (Sample, error) {
+	seed, err := Seed(datasetDigest)
+	if err != nil {
+		return Sample{}, err
+	}
+	indices, err := Indices(datasetDigest, seed, size, limit)
+	if err != nil {
+		return Sample{}, err
+	}
+	return Sample{Seed: seed, DatasetSize: size, Limit: limit, Indices: indices}, nil
+}
+
+// Indices returns the ascending positions of the items sampled from a
+// dataset of size items. When the dataset fits in limit, or limit is 0,
+// every item is sampled. Otherwise the first limit steps of a Fisher-Yates
+// shuffle pick the items, with randomness from the stream
+// SHA-256("noema_sample_v1|" || digest || seed || counter).
+func Indices(datasetDigest, seed string, size, limit int) ([]int, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("dataset size must be positive")
+	}
+	if limit < 0 {
+		return nil, fmt.Errorf("sample limit must not be negative")
+	}
+	digest, seedRaw, err := decodeInputs(datasetDigest, seed)
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 || size <= limit {
+		all := make([]int, size)
+		for i := range all {
+			all[i] = i
+		}
+		return all, nil
+	}
+
+	s := stream{prefix: slices.Concat([]byte(domain), digest, seedRaw)}
+	perm := make([]int, size)
+	for i := range perm {
+		perm[i] = i
+	}
+	for i := 0; i < limit; i++ {
+		j := i + int(s.below(uint64(size-i)))
+		perm[i], perm[j] = perm[j], perm[i]
+	}
+	picked := perm[:limit:limit]
+	slices.Sort(picked)
+	return picked, nil
+}
+
+// Verify checks that s is the sample a dataset with the given digest
+// yields.
+func (s Sample) Verify(datasetDigest string) error {
+	seed, err := Seed(datasetDigest)
+	if err != nil {
+		return err
+	}
+	if s.Seed != seed {
+		return fmt.Errorf("sampling seed does not follow from the dataset digest")
+	}
+	want, err := Indices(datasetDigest, s.Seed, s.DatasetSize, s.Limit)
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(want, s.Indices) {
+		return fmt.Errorf("sample indices do not match the dataset digest and seed")
+	}
+	return nil
+}
+
+// Binding is the digest a run's commitment binds in place of the dataset
+// digest when the evaluator saw a sample, as hex:
+// SHA-256("noema_sample_v1|" || digest || seed || size || limit || count || indices),
+// with integers as big-endian uint64. It commits to the dataset, the seed
+// and the exact items sampled. s must verify against datasetDigest.
+func Binding(datasetDigest string, s Sample) (string, error) {
+	if err := s.Verify(datasetDigest); err != nil {
+		return "", err
+	}
+	digest, seedRaw, err := decodeInputs(datasetDigest, s.Seed)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(domain))
+	h.Write(digest)
+	h.Write(seedRaw)
+	for _, v := range []int{s.DatasetSize, s.Limit, len(s.Indices)} {
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(v)))
+	}
+	for _, i := range s.Indices {
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func decodeInputs(datasetDigest, seed string) ([]byte, []byte, error) {
+	digest, err := hex.DecodeString(datasetDigest)
+	if err != nil || len(digest) != sha256.Size {
+		return nil, nil, fmt.Errorf("invalid dataset digest")
+	}
+	seedRaw, err := hex.DecodeString(seed)
+	if err != nil || len(seedRaw) != SeedBytes {
+		return nil, nil, fmt.Errorf("sampling seed must be %d hex encoded bytes", SeedBytes)
+	}
+	return digest, seedRaw, nil
+}
+
+// stream is a deterministic source of uniform integers: SHA-256 over prefix
+// and a block counter, read as big-endian uint64s.
+type stream struct {
+	prefix  []byte
+	counter uint64
+	buf     []byte
+}
+
+func (s *stream) uint64() uint64 {
+	if len(s.buf) == 0 {
+		h := sha256.New()
+		h.Write(s.prefix)
+		h.Write(binary.BigEndian.AppendUint64(nil, s.counter))
+		s.counter++
+		s.buf = h.Sum(nil)
+	}
+	v := binary.BigEndian.Uint64(s.buf)
+	s.buf = s.buf[8:]
+	return v
+}
+
+// below returns a uniform integer in [0, n), rejecting the values that
+// would bias x % n.
+func (s *stream) below(n uint64) uint64 {
+	thresh := -n % n
+	for {
+		if x := s.uint64(); x >= thresh {
+			return x % n
+		}
+	}
+}
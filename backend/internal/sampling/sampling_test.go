@@ -0,0 +1,133 @@
+package sampling
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+var (
+	testDigest = strings.Repeat("ab", 32)
+	testSeed   = strings.Repeat("01", SeedBytes)
+)
+
+func TestIndicesKeepsSmallDatasets(t *testing.T) {
+	for _, limit := range []int{0, 5, 9} {
+		got, err := Indices(testDigest, testSeed, 5, limit)
+		if err != nil {
+			t.Fatalf("Indices error: %v", err)
+		}
+		if !slices.Equal(got, []int{0, 1, 2, 3, 4}) {
+			t.Fatalf("limit %d: expected every item, got %v", limit, got)
+		}
+	}
+}
+
+func TestIndicesAreDeterministicDistinctAndSorted(t *testing.T) {
+	got, err := Indices(testDigest, testSeed, 1000, 50)
+	if err != nil {
+		t.Fatalf("Indices error: %v", err)
+	}
+	again, _ := Indices(testDigest, testSeed, 1000, 50)
+	if !slices.Equal(got, again) {
+		t.Fatalf("expected the same indices for the same digest and seed")
+	}
+	if len(got) != 50 || !slices.IsSorted(got) || len(slices.Compact(slices.Clone(got))) != 50 {
+		t.Fatalf("expected 50 distinct sorted indices, got %v", got)
+	}
+	if got[0] < 0 || got[len(got)-1] >= 1000 {
+		t.Fatalf("indices out of range: %v", got)
+	}
+	if slices.Equal(got, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Fatalf("expected a shuffled sample, got the first items")
+	}
+
+	otherSeed, _ := Indices(testDigest, strings.Repeat("02", SeedBytes), 1000, 50)
+	otherDigest, _ := Indices(strings.Repeat("cd", 32), testSeed, 1000, 50)
+	if slices.Equal(got, otherSeed) || slices.Equal(got, otherDigest) {
+		t.Fatalf("expected the seed and the digest to change the sample")
+	}
+}
+
+// Pins the derivation so it can't change under existing commitments.
+func TestIndicesVector(t *testing.T) {
+	got, err := Indices(testDigest, testSeed, 20, 4)
+	if err != nil {
+		t.Fatalf("Indices error: %v", err)
+	}
+	if want := []int{2, 6, 7, 13}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestSampleVerifyAndBinding(t *testing.T) {
+	s, err := New(testDigest, 20, 4)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	if err := s.Verify(testDigest); err != nil {
+		t.Fatalf("Verify error: %v", err)
+	}
+	binding, err := Binding(testDigest, s)
+	if err != nil {
+		t.Fatalf("Binding error: %v", err)
+	}
+	if len(binding) != 64 || binding == testDigest {
+		t.Fatalf("unexpected binding %q", binding)
+	}
+
+	tampered := s
+	tampered.Indices = slices.Clone(s.Indices)
+	tampered.Indices[0] = (tampered.Indices[0] + 1) % 20
+	if err := tampered.Verify(testDigest); err == nil {
+		t.Fatalf("expected tampered indices to fail verification")
+	}
+	if _, err := Binding(testDigest, tampered); err == nil {
+		t.Fatalf("expected no binding for tampered indices")
+	}
+	if err := s.Verify(strings.Repeat("cd", 32)); err == nil {
+		t.Fatalf("expected another digest to fail verification")
+	}
+
+	// A seed the owner picked, even with indices that follow from it, is not
+	// the sample of this dataset.
+	picked, err := Indices(testDigest, testSeed, 20, 4)
+	if err != nil {
+		t.Fatalf("Indices error: %v", err)
+	}
+	chosen := Sample{Seed: testSeed, DatasetSize: 20, Limit: 4, Indices: picked}
+	if err := chosen.Verify(testDigest); err == nil {
+		t.Fatalf("expected a seed that doesn't follow from the digest to fail verification")
+	}
+}
+
+// Pins the seed derivation so it can't change under existing commitments.
+func TestSeedVector(t *testing.T) {
+	got, err := Seed(testDigest)
+	if err != nil {
+		t.Fatalf("Seed error: %v", err)
+	}
+	if want := "23c8c04d7aa08ef6ee4766e2166a73c1f5f0cd8c1721d45c0a1734bee82a904c"; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	if _, err := Seed("abcd"); err == nil {
+		t.Fatalf("expected error for a short digest")
+	}
+}
+
+func TestIndicesRejectsBadInputs(t *testing.T) {
+	cases := []struct {
+		digest, seed string
+		size, limit  int
+	}{
+		{"zz", testSeed, 10, 2},
+		{testDigest, "0102", 10, 2},
+		{testDigest, testSeed, 0, 2},
+		{testDigest, testSeed, 10, -1},
+	}
+	for _, tc := range cases {
+		if _, err := Indices(tc.digest, tc.seed, tc.size, tc.limit); err == nil {
+			t.Fatalf("expected error for %+v", tc)
+		}
+	}
+}
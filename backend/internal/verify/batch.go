@@ -0,0 +1,173 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"noema/internal/config"
+	"noema/internal/crypto"
+	"noema/internal/httputil"
+	"noema/internal/zk"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BatchVerifyRequest is the JSON body for POST /api/verify/batch. Each item
+// is either a proof, with the fields of VerifyRequest, or a .noema bundle
+// in its "bundle" field.
+type BatchVerifyRequest struct {
+	Items []json.RawMessage `json:"items"`
+}
+
+// BatchItem is one entry of BatchVerifyRequest.Items.
+type BatchItem struct {
+	VerifyRequest
+	Bundle json.RawMessage `json:"bundle,omitempty"`
+}
+
+// BatchItemResult is the outcome for one item. An item that could not be
+// checked at all is unverified with the reason in Message, in the words
+// POST /api/verify would have used for its error.
+type BatchItemResult struct {
+	Index     int                  `json:"index"`
+	RunID     string               `json:"run_id,omitempty"`
+	Verified  bool                 `json:"verified"`
+	Message   string               `json:"message,omitempty"`
+	KeyID     string               `json:"key_id,omitempty"`
+	KeyStatus zk.KeyStatus         `json:"key_status,omitempty"`
+	Disclosed *zk.DisclosedOutputs `json:"disclosed,omitempty"`
+	// Bundle is set for bundle items.
+	Bundle bool `json:"bundle,omitempty"`
+	// The signature fields report a bundle's signature as
+	// BundleVerifyResponse does.
+	Signed           bool   `json:"signed,omitempty"`
+	SignatureValid   bool   `json:"signature_valid,omitempty"`
+	IssuerKeyID      string `json:"issuer_key_id,omitempty"`
+	SignatureMessage string `json:"signature_message,omitempty"`
+}
+
+// BatchVerifyResponse is the JSON response for POST /api/verify/batch.
+// Results are in request order.
+type BatchVerifyResponse struct {
+	Results  []BatchItemResult `json:"results"`
+	Verified int               `json:"verified"`
+	Failed   int               `json:"failed"`
+}
+
+// BatchHandler handles POST /api/verify/batch. Items are checked
+// concurrently; one bad item never fails the others. Bundle signatures are
+// checked against issuer, which may be nil.
+func BatchHandler(issuer *crypto.Issuer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxBatchVerifyBytes)
+
+		var req BatchVerifyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			if httputil.IsBodyTooLarge(err) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+			return
+		}
+		if len(req.Items) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing items"})
+			return
+		}
+		if len(req.Items) > config.MaxBatchVerifyItems {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("too many items (max %d)", config.MaxBatchVerifyItems)})
+			return
+		}
+
+		resp := BatchVerifyResponse{Results: verifyBatch(req.Items, issuer)}
+		for _, r := range resp.Results {
+			if r.Verified {
+				resp.Verified++
+			} else {
+				resp.Failed++
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// verifyBatch checks items on one worker per CPU.
+func verifyBatch(items []json.RawMessage, issuer *crypto.Issuer) []BatchItemResult {
+	results := make([]BatchItemResult, len(items))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), len(items)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = verifyBatchItem(items[i], issuer)
+				results[i].Index = i
+			}
+		}()
+	}
+	for i := range items {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+func verifyBatchItem(raw json.RawMessage, issuer *crypto.Issuer) BatchItemResult {
+	if len(raw) > config.MaxVerifyBytes {
+		return BatchItemResult{Message: "item too large"}
+	}
+	var item BatchItem
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return BatchItemResult{Message: "invalid item JSON"}
+	}
+
+	if len(item.Bundle) > 0 {
+		if errMsg := validateRequireEvaluator(item.RequireEvaluator); errMsg != "" {
+			return BatchItemResult{RunID: item.RunID, Message: errMsg, Bundle: true}
+		}
+		resp, errMsg := verifyBundle(item.Bundle, issuer)
+		if errMsg != "" {
+			return BatchItemResult{RunID: item.RunID, Message: errMsg, Bundle: true}
+		}
+		if resp.Verified && len(item.RequireEvaluator) > 0 {
+			pi := zk.PublicInputs{}
+			if resp.Disclosed != nil {
+				pi.EvaluatorKind = resp.Disclosed.EvaluatorKind
+			}
+			if err := pi.CheckEvaluator(item.RequireEvaluator); err != nil {
+				resp.Verified, resp.Message = false, err.Error()
+			}
+		}
+		return BatchItemResult{
+			RunID:     resp.RunID,
+			Verified:  resp.Verified,
+			Message:   resp.Message,
+			KeyID:     resp.KeyID,
+			KeyStatus: resp.KeyStatus,
+			Disclosed: resp.Disclosed,
+			Bundle:    true,
+
+			Signed:           resp.Signed,
+			SignatureValid:   resp.SignatureValid,
+			IssuerKeyID:      resp.IssuerKeyID,
+			SignatureMessage: resp.SignatureMessage,
+		}
+	}
+	resp, errMsg := verifyRequest(item.VerifyRequest)
+	if errMsg != "" {
+		return BatchItemResult{RunID: item.RunID, Message: errMsg}
+	}
+	return BatchItemResult{
+		RunID:     resp.RunID,
+		Verified:  resp.Verified,
+		Message:   resp.Message,
+		KeyID:     resp.KeyID,
+		KeyStatus: resp.KeyStatus,
+		Disclosed: resp.Disclosed,
+	}
+}
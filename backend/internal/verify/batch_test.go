@@ -0,0 +1,116 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"noema/internal/config"
+	"noema/internal/zk"
+)
+
+func postBatch(t *testing.T, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	r := setupRouter()
+	r.POST("/api/verify/batch", BatchHandler(nil))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/verify/batch", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestBatchHandlerReportsEachItem(t *testing.T) {
+	_, proof := openTestProof(t)
+	bundleFile := testBundleFile(t)
+	mismatched := strings.Replace(string(bundleFile), `"status": "PASS"`, `"status": "FAIL"`, 1)
+
+	items := []any{
+		VerifyRequest{RunID: "run_a", ProofB64: proof.ProofB64, PublicInputsB64: proof.PublicInputsB64},
+		map[string]json.RawMessage{"bundle": bundleFile},
+		VerifyRequest{RunID: "run_b", ProofB64: "%%%", PublicInputsB64: proof.PublicInputsB64},
+		VerifyRequest{RunID: "run_c", ProofB64: proof.ProofB64, PublicInputsB64: tamperedKeyInputs(t, proof.PublicInputsB64)},
+		map[string]json.RawMessage{"bundle": json.RawMessage(mismatched)},
+		VerifyRequest{ProofB64: proof.ProofB64, PublicInputsB64: proof.PublicInputsB64},
+		"not an object",
+	}
+	body, err := json.Marshal(map[string]any{"items": items})
+	if err != nil {
+		t.Fatalf("marshal batch: %v", err)
+	}
+	w := postBatch(t, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp BatchVerifyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := []struct {
+		runID    string
+		verified bool
+		message  string
+	}{
+		{"run_a", true, "verified"},
+		{"run_1_1", true, "verified"},
+		{"run_b", false, "invalid proof encoding"},
+		{"run_c", false, "unknown verifying key"},
+		{"run_1_1", false, "bundle status does not match public inputs"},
+		{"", false, "missing run_id"},
+		{"", false, "invalid item JSON"},
+	}
+	if len(resp.Results) != len(want) || resp.Verified != 2 || resp.Failed != len(want)-2 {
+		t.Fatalf("unexpected batch summary %+v", resp)
+	}
+	for i, r := range resp.Results {
+		if r.Index != i || r.RunID != want[i].runID || r.Verified != want[i].verified || r.Message != want[i].message {
+			t.Fatalf("item %d: expected %+v, got %+v", i, want[i], r)
+		}
+	}
+	if resp.Results[0].KeyID == "" || resp.Results[0].Disclosed == nil || !resp.Results[1].Bundle {
+		t.Fatalf("expected key and disclosure details, got %+v", resp.Results[:2])
+	}
+}
+
+func TestBatchHandlerLimits(t *testing.T) {
+	if w := postBatch(t, []byte(`{"items":[]}`)); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for an empty batch, got %d", w.Code)
+	}
+	tooMany := `{"items":[` + strings.Repeat(`{},`, config.MaxBatchVerifyItems) + `{}]}`
+	if w := postBatch(t, []byte(tooMany)); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for too many items, got %d", w.Code)
+	}
+	huge := `{"items":[{"run_id":"big","proof_b64":"` + strings.Repeat("A", config.MaxVerifyBytes) + `"}]}`
+	w := postBatch(t, []byte(huge))
+	var resp BatchVerifyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0].Message != "item too large" {
+		t.Fatalf("expected an oversized item to be reported, got %+v", resp)
+	}
+	body := `{"items":[{"proof_b64":"` + strings.Repeat("A", config.MaxBatchVerifyBytes) + `"}]}`
+	if w := postBatch(t, []byte(body)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status 413, got %d", w.Code)
+	}
+}
+
+// tamperedKeyInputs points the public inputs at a key version that doesn't
+// exist.
+func tamperedKeyInputs(t *testing.T, publicInputsB64 string) string {
+	t.Helper()
+	pi, err := zk.DecodePublicInputsB64(publicInputsB64)
+	if err != nil {
+		t.Fatalf("DecodePublicInputsB64 error: %v", err)
+	}
+	pi.KeyID += "99"
+	raw, err := zk.EncodePublicInputs(pi)
+	if err != nil {
+		t.Fatalf("EncodePublicInputs error: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
@@ -0,0 +1,142 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"noema/internal/bundle"
+	"noema/internal/config"
+	"noema/internal/crypto"
+	"noema/internal/httputil"
+	"noema/internal/zk"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BundleVerifyResponse is the JSON response for POST /api/verify/bundle.
+type BundleVerifyResponse struct {
+	RunID     string       `json:"run_id"`
+	Verified  bool         `json:"verified"`
+	Message   string       `json:"message,omitempty"`
+	KeyID     string       `json:"key_id,omitempty"`
+	KeyStatus zk.KeyStatus `json:"key_status,omitempty"`
+	// Run is the run metadata as the bundle states it. Its status and
+	// public output are checked against the proof; the fields listed in
+	// Unauthenticated are not.
+	Run       bundle.Run           `json:"run"`
+	Disclosed *zk.DisclosedOutputs `json:"disclosed,omitempty"`
+	Signed    bool                 `json:"signed"`
+	// SignatureValid is set when the bundle's signature is this server's
+	// issuer's over the bundle as it is. It says nothing of the proof.
+	SignatureValid bool `json:"signature_valid"`
+	// IssuerKeyID is the issuer key the signature names.
+	IssuerKeyID string `json:"issuer_key_id,omitempty"`
+	// SignatureMessage says why a signature isn't valid.
+	SignatureMessage string `json:"signature_message,omitempty"`
+	// Unauthenticated lists the Run fields nothing vouches for: anyone
+	// holding the bundle could have edited them.
+	Unauthenticated []string `json:"unauthenticated"`
+}
+
+// BundleHandler handles POST /api/verify/bundle. The .noema file is either the
+// raw request body or the "bundle" file of a multipart form. Signatures are
+// checked against issuer, which may be nil when the server has no issuer key.
+func BundleHandler(issuer *crypto.Issuer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxVerifyBytes)
+
+		raw, err := readBundle(c)
+		if err != nil {
+			if httputil.IsBodyTooLarge(err) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		resp, errMsg := verifyBundle(raw, issuer)
+		if errMsg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// verifyBundle checks a .noema file, and its signature against issuer. A
+// file that can't be checked at all returns the reason as errMsg.
+func verifyBundle(raw []byte, issuer *crypto.Issuer) (resp BundleVerifyResponse, errMsg string) {
+	b, err := bundle.Parse(raw)
+	if err != nil {
+		return BundleVerifyResponse{}, err.Error()
+	}
+	res, err := bundle.Verify(b)
+	if err != nil {
+		return BundleVerifyResponse{}, res.Message
+	}
+
+	resp = BundleVerifyResponse{
+		RunID:    b.Run.RunID,
+		Verified: res.Verified,
+		Message:  res.Message,
+		Run:      b.Run,
+		Signed:   b.Signature != nil,
+	}
+	if b.Signature != nil {
+		resp.IssuerKeyID = b.Signature.KeyID
+		resp.SignatureValid, resp.SignatureMessage = checkSignature(b, issuer)
+	}
+	resp.Unauthenticated = slices.Clone(bundle.UnauthenticatedRunFields)
+	if !resp.SignatureValid {
+		resp.Unauthenticated = append(resp.Unauthenticated, bundle.SignedRunFields...)
+	}
+	if len(res.Outputs.Disclosed) > 0 {
+		resp.Disclosed = &res.Outputs
+	}
+	if key, err := zk.KeyForPublicInputs(b.Proof.PublicInputsB64); err == nil {
+		resp.KeyID = key.KeyID
+		resp.KeyStatus = key.Status
+	}
+	return resp, ""
+}
+
+// checkSignature reports whether signed bundle b carries issuer's signature
+// over its attestation, and why not otherwise.
+func checkSignature(b bundle.Bundle, issuer *crypto.Issuer) (bool, string) {
+	if issuer == nil {
+		return false, "server has no issuer key to check the signature with"
+	}
+	if err := bundle.VerifySignature(b, issuer.PublicKey()); err != nil {
+		return false, err.Error()
+	}
+	return true, ""
+}
+
+func readBundle(c *gin.Context) ([]byte, error) {
+	if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		raw, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) == 0 {
+			return nil, fmt.Errorf("missing bundle")
+		}
+		return raw, nil
+	}
+	fh, err := c.FormFile("bundle")
+	if err != nil {
+		if httputil.IsBodyTooLarge(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("missing bundle file")
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, fmt.Errorf("missing bundle file")
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
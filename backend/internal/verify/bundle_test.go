@@ -0,0 +1,202 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"noema/internal/bundle"
+	"noema/internal/crypto"
+	"noema/internal/zk"
+)
+
+func testBundleFile(t *testing.T) []byte {
+	t.Helper()
+	_, proof := openTestProof(t)
+	pi, err := zk.DecodePublicInputsB64(proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("DecodePublicInputsB64 error: %v", err)
+	}
+	raw, err := bundle.Marshal(bundle.FromProof(proof, bundle.Run{
+		RunID:         "run_1_1",
+		CreatedAt:     "2026-01-02T03:04:05Z",
+		PolicyVersion: "noema_policy_v1",
+		Status:        "PASS",
+		PublicOutput:  pi.Outputs(),
+	}))
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	return raw
+}
+
+func postBundle(t *testing.T, body *bytes.Buffer, contentType string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := setupRouter()
+	r.POST("/api/verify/bundle", BundleHandler(nil))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/verify/bundle", body)
+	req.Header.Set("Content-Type", contentType)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestBundleHandlerVerifiesRawAndMultipart(t *testing.T) {
+	raw := testBundleFile(t)
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, err := mw.CreateFormFile("bundle", "run_1_1.noema")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	if _, err := fw.Write(raw); err != nil {
+		t.Fatalf("write form file: %v", err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("close multipart: %v", err)
+	}
+
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"raw":       postBundle(t, bytes.NewBuffer(raw), bundle.MediaType),
+		"multipart": postBundle(t, &form, mw.FormDataContentType()),
+	} {
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", name, w.Code, w.Body.String())
+		}
+		var resp BundleVerifyResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: decode response: %v", name, err)
+		}
+		if !resp.Verified || resp.RunID != "run_1_1" || resp.KeyID == "" || resp.Disclosed == nil || resp.Signed {
+			t.Fatalf("%s: unexpected response %+v", name, resp)
+		}
+	}
+}
+
+func TestBundleHandlerMarksUnauthenticatedFields(t *testing.T) {
+	b, err := bundle.Parse(testBundleFile(t))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	b.Run.EvaluationName = "edited"
+	b.Run.PolicyVersion = "edited"
+	b.Run.CreatedAt = "2030-01-01T00:00:00Z"
+	raw, err := bundle.Marshal(b)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	w := postBundle(t, bytes.NewBuffer(raw), bundle.MediaType)
+	var resp BundleVerifyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !resp.Verified {
+		t.Fatalf("expected the proof to verify despite edited metadata: %+v", resp)
+	}
+	for _, field := range []string{"evaluation_name", "policy_version", "created_at", "dataset_digest_alg", "run_id"} {
+		if !slices.Contains(resp.Unauthenticated, field) {
+			t.Fatalf("expected %s to be marked unauthenticated, got %v", field, resp.Unauthenticated)
+		}
+	}
+	if slices.Contains(resp.Unauthenticated, "status") {
+		t.Fatalf("status is checked against the proof, got %v", resp.Unauthenticated)
+	}
+}
+
+func TestBundleHandlerChecksSignature(t *testing.T) {
+	issuer, err := crypto.GenerateIssuer(filepath.Join(t.TempDir(), "issuer.pem"))
+	if err != nil {
+		t.Fatalf("GenerateIssuer error: %v", err)
+	}
+	b, err := bundle.Parse(testBundleFile(t))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if err := bundle.Sign(&b, issuer); err != nil {
+		t.Fatalf("Sign error: %v", err)
+	}
+	signed, err := bundle.Marshal(b)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	relabeled := b
+	relabeled.Run.DatasetDigestAlg = "sha256"
+	if relabeled.Run.DatasetDigestAlg == b.Run.DatasetDigestAlg {
+		relabeled.Run.DatasetDigestAlg = "jcs_sha256"
+	}
+	edited, err := bundle.Marshal(relabeled)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	tampered := *b.Signature
+	tampered.Value = "A" + tampered.Value[1:]
+	if tampered.Value == b.Signature.Value {
+		tampered.Value = "B" + tampered.Value[1:]
+	}
+	b.Signature = &tampered
+	forged, err := bundle.Marshal(b)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		issuer *crypto.Issuer
+		raw    []byte
+		valid  bool
+		reason string
+	}{
+		{"signed", issuer, signed, true, ""},
+		{"tampered", issuer, forged, false, "invalid signature"},
+		{"edited dataset_digest_alg", issuer, edited, false, "invalid signature"},
+		{"no issuer key", nil, signed, false, "no issuer key"},
+	} {
+		r := setupRouter()
+		r.POST("/api/verify/bundle", BundleHandler(tc.issuer))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/verify/bundle", bytes.NewReader(tc.raw)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", tc.name, w.Code, w.Body.String())
+		}
+		var resp BundleVerifyResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: decode response: %v", tc.name, err)
+		}
+		if !resp.Verified || !resp.Signed || resp.IssuerKeyID != issuer.KeyID() {
+			t.Fatalf("%s: unexpected response %+v", tc.name, resp)
+		}
+		if resp.SignatureValid != tc.valid || !strings.Contains(resp.SignatureMessage, tc.reason) {
+			t.Fatalf("%s: expected signature_valid=%v (%q), got %v (%q)", tc.name, tc.valid, tc.reason, resp.SignatureValid, resp.SignatureMessage)
+		}
+		if got := slices.Contains(resp.Unauthenticated, "run_id"); got == tc.valid {
+			t.Fatalf("%s: expected run_id unauthenticated=%v, got %v", tc.name, !tc.valid, resp.Unauthenticated)
+		}
+	}
+}
+
+func TestBundleHandlerRejectsInvalidBundles(t *testing.T) {
+	w := postBundle(t, bytes.NewBufferString(`{"format":"noema_bundle","version":1}`), "application/json")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+	w = postBundle(t, &bytes.Buffer{}, "application/json")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for empty body, got %d", w.Code)
+	}
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	_ = mw.WriteField("other", "x")
+	_ = mw.Close()
+	w = postBundle(t, &form, mw.FormDataContentType())
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for missing file, got %d", w.Code)
+	}
+}
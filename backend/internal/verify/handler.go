@@ -1,6 +1,7 @@
 package verify
 
 import (
+	"encoding/json"
 	"net/http"
 	"strings"
 
@@ -11,18 +12,30 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// VerifyRequest is the JSON body for POST /api/verify.
+// VerifyRequest is the JSON body for POST /api/verify. Proof and
+// PublicSignals take a snarkjs proof.json and public.json in place of
+// ProofB64 and PublicInputsB64.
 type VerifyRequest struct {
-	RunID           string `json:"run_id"`
-	ProofB64        string `json:"proof_b64"`
-	PublicInputsB64 string `json:"public_inputs_b64"`
+	RunID           string          `json:"run_id"`
+	ProofB64        string          `json:"proof_b64"`
+	PublicInputsB64 string          `json:"public_inputs_b64"`
+	Proof           json.RawMessage `json:"proof,omitempty"`
+	PublicSignals   json.RawMessage `json:"public_signals,omitempty"`
+	// RequireEvaluator lists the evaluator kinds to accept, e.g. ["gemini"]
+	// to refuse proofs over stub or self-reported evaluations. A proof whose
+	// public inputs bind another kind, or none, is reported unverified.
+	RequireEvaluator []string `json:"require_evaluator,omitempty"`
 }
 
 // VerifyResponse is the JSON response for POST /api/verify.
 type VerifyResponse struct {
-	RunID    string `json:"run_id"`
-	Verified bool   `json:"verified"`
-	Message  string `json:"message,omitempty"`
+	RunID     string       `json:"run_id"`
+	Verified  bool         `json:"verified"`
+	Message   string       `json:"message,omitempty"`
+	KeyID     string       `json:"key_id,omitempty"`
+	KeyStatus zk.KeyStatus `json:"key_status,omitempty"`
+	// Disclosed holds the outputs the public inputs disclose, if they decode.
+	Disclosed *zk.DisclosedOutputs `json:"disclosed,omitempty"`
 }
 
 // Handler handles POST /api/verify.
@@ -39,28 +52,71 @@ func Handler() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
 			return
 		}
-		runID := strings.TrimSpace(req.RunID)
-		proofB64 := strings.TrimSpace(req.ProofB64)
-		publicInputsB64 := strings.TrimSpace(req.PublicInputsB64)
-
-		if runID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "missing run_id"})
+		resp, errMsg := verifyRequest(req)
+		if errMsg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
 			return
 		}
-		if proofB64 == "" || publicInputsB64 == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "missing proof or public inputs"})
-			return
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// verifyRequest checks one proof. A request that can't be checked at all,
+// such as one with a malformed proof, returns the reason as errMsg.
+func verifyRequest(req VerifyRequest) (resp VerifyResponse, errMsg string) {
+	runID := strings.TrimSpace(req.RunID)
+	proofB64 := strings.TrimSpace(req.ProofB64)
+	publicInputsB64 := strings.TrimSpace(req.PublicInputsB64)
+	if proofB64 == "" {
+		proofB64 = strings.TrimSpace(string(req.Proof))
+	}
+	if publicInputsB64 == "" {
+		publicInputsB64 = strings.TrimSpace(string(req.PublicSignals))
+	}
+
+	if runID == "" {
+		return VerifyResponse{}, "missing run_id"
+	}
+	if proofB64 == "" || publicInputsB64 == "" {
+		return VerifyResponse{}, "missing proof or public inputs"
+	}
+	if errMsg := validateRequireEvaluator(req.RequireEvaluator); errMsg != "" {
+		return VerifyResponse{}, errMsg
+	}
+	proofB64, publicInputsB64, err := zk.BinaryEncoding(proofB64, publicInputsB64)
+	if err != nil {
+		return VerifyResponse{}, err.Error()
+	}
+
+	verified, msg, err := zk.VerifyProof(proofB64, publicInputsB64)
+	if err != nil {
+		return VerifyResponse{}, msg
+	}
+	resp = VerifyResponse{
+		RunID:    runID,
+		Verified: verified,
+		Message:  msg,
+	}
+	if pi, err := zk.DecodePublicInputsB64(publicInputsB64); err == nil {
+		out := pi.Outputs()
+		resp.Disclosed = &out
+		if err := pi.CheckEvaluator(req.RequireEvaluator); err != nil && resp.Verified {
+			resp.Verified = false
+			resp.Message = err.Error()
 		}
+	}
+	if key, err := zk.KeyForPublicInputs(publicInputsB64); err == nil {
+		resp.KeyID = key.KeyID
+		resp.KeyStatus = key.Status
+	}
+	return resp, ""
+}
 
-		verified, msg, err := zk.VerifyProof(proofB64, publicInputsB64)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
-			return
+func validateRequireEvaluator(kinds []string) string {
+	for _, kind := range kinds {
+		if !zk.ValidEvaluatorKind(kind) {
+			return "unknown evaluator kind: " + kind
 		}
-		c.JSON(http.StatusOK, VerifyResponse{
-			RunID:    runID,
-			Verified: verified,
-			Message:  msg,
-		})
 	}
+	return ""
 }
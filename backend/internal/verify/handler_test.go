@@ -1,6 +1,7 @@
 package verify
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"testing"
 
 	"noema/internal/config"
+	"noema/internal/zk"
 
 	"github.com/gin-gonic/gin"
 )
@@ -124,3 +126,77 @@ func TestVerifyHandlerBodyTooLargeReturns413(t *testing.T) {
 		t.Fatalf("expected request body too large, got %q", resp.Error)
 	}
 }
+
+func TestVerifyHandlerAcceptsSnarkJS(t *testing.T) {
+	_, proof := openTestProof(t)
+	p, err := zk.SnarkJSProofB64(proof.ProofB64, proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("SnarkJSProofB64 error: %v", err)
+	}
+	signals, err := zk.SnarkJSPublicSignals(proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("SnarkJSPublicSignals error: %v", err)
+	}
+	body, err := json.Marshal(map[string]any{"run_id": "run_1_1", "proof": p, "public_signals": signals})
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/verify", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	setupRouter().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp VerifyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !resp.Verified || resp.KeyID != proof.KeyID || resp.Disclosed == nil {
+		t.Fatalf("expected snarkjs proof to verify with key %s, got %+v", proof.KeyID, resp)
+	}
+}
+
+func TestVerifyHandlerRequireEvaluator(t *testing.T) {
+	_, proof := openTestProof(t)
+	r := setupRouter()
+	post := func(require []string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(VerifyRequest{
+			RunID:            "run_1",
+			ProofB64:         proof.ProofB64,
+			PublicInputsB64:  proof.PublicInputsB64,
+			RequireEvaluator: require,
+		})
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/verify", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post([]string{zk.EvaluatorGemini})
+	var resp VerifyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || !resp.Verified || resp.Disclosed.EvaluatorKind != zk.EvaluatorGemini {
+		t.Fatalf("expected gemini proof to verify, got %d %+v", w.Code, resp)
+	}
+
+	w = post([]string{zk.EvaluatorStub, zk.EvaluatorClient})
+	resp = VerifyResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || resp.Verified || !strings.Contains(resp.Message, "not accepted") {
+		t.Fatalf("expected the evaluator kind to be refused, got %d %+v", w.Code, resp)
+	}
+
+	w = post([]string{"oracle"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for an unknown evaluator kind, got %d", w.Code)
+	}
+}
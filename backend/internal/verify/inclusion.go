@@ -0,0 +1,92 @@
+package verify
+
+import (
+	"net/http"
+	"strings"
+
+	"noema/internal/config"
+	"noema/internal/evaluate"
+	"noema/internal/httputil"
+	"noema/internal/zk"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InclusionVerifyRequest is the JSON body for POST
+// /api/dataset/inclusion/verify: one proof from GET /api/runs/:id/inclusion
+// with the digest and tree size it was issued for. DatasetOpening and
+// PublicInputsB64 are optional; when given, the digest is also checked
+// against the commitment the public inputs disclose.
+type InclusionVerifyRequest struct {
+	DatasetDigest string `json:"dataset_digest"`
+	TreeSize      int    `json:"tree_size"`
+	evaluate.InclusionProof
+	DatasetOpening  *zk.DatasetOpening `json:"dataset_opening,omitempty"`
+	PublicInputsB64 string             `json:"public_inputs_b64,omitempty"`
+}
+
+// InclusionVerifyResponse is the JSON response for POST
+// /api/dataset/inclusion/verify. Included also requires the dataset
+// opening to match when one was given; DatasetOpeningMatches is only set
+// then.
+type InclusionVerifyResponse struct {
+	Included              bool   `json:"included"`
+	DatasetOpeningMatches *bool  `json:"dataset_opening_matches,omitempty"`
+	Message               string `json:"message,omitempty"`
+}
+
+// InclusionHandler handles POST /api/dataset/inclusion/verify. It checks
+// that an item is a leaf of a Merkle dataset digest and, given the
+// run's dataset opening and a proof's public inputs, that the proof's
+// commitment binds that digest.
+func InclusionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxVerifyBytes)
+
+		var req InclusionVerifyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			if httputil.IsBodyTooLarge(err) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+			return
+		}
+		if req.DatasetDigest == "" || req.ItemID == "" || len(req.Item) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing dataset_digest, item_id or item"})
+			return
+		}
+		publicInputsB64 := strings.TrimSpace(req.PublicInputsB64)
+		if (req.DatasetOpening == nil) != (publicInputsB64 == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dataset_opening and public_inputs_b64 go together"})
+			return
+		}
+		var resp InclusionVerifyResponse
+		if req.DatasetOpening != nil {
+			pi, err := zk.DecodePublicInputsB64(publicInputsB64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid public inputs"})
+				return
+			}
+			matches, err := req.DatasetOpening.Check(pi)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			matches = matches && req.DatasetOpening.DatasetDigest == req.DatasetDigest
+			resp.DatasetOpeningMatches = &matches
+			if !matches {
+				resp.Message = "dataset opening does not reproduce the commitment for this dataset digest"
+				c.JSON(http.StatusOK, resp)
+				return
+			}
+		}
+		if err := evaluate.VerifyInclusion(req.DatasetDigest, req.TreeSize, req.InclusionProof); err != nil {
+			resp.Message = err.Error()
+			c.JSON(http.StatusOK, resp)
+			return
+		}
+		resp.Included = true
+		c.JSON(http.StatusOK, resp)
+	}
+}
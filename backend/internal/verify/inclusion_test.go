@@ -0,0 +1,141 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"noema/internal/evaluate"
+	"noema/internal/merkle"
+	"noema/internal/zk"
+)
+
+func TestInclusionHandler(t *testing.T) {
+	items := []evaluate.DatasetItem{{ID: "a", Text: "first"}, {ID: "b", Text: "second"}, {ID: "c", Text: "third"}}
+	salts := make([][]byte, len(items))
+	leaves := make([]merkle.Hash, len(items))
+	for i, item := range items {
+		salts[i] = bytes.Repeat([]byte{byte(i + 1)}, 32)
+		raw, err := evaluate.MerkleLeaf(salts[i], item)
+		if err != nil {
+			t.Fatalf("MerkleLeaf error: %v", err)
+		}
+		leaves[i] = merkle.LeafHash(raw)
+	}
+	root := merkle.Root(leaves)
+	path, err := merkle.Proof(leaves, 2)
+	if err != nil {
+		t.Fatalf("Proof error: %v", err)
+	}
+	req := InclusionVerifyRequest{
+		DatasetDigest: hexHash(root),
+		TreeSize:      len(items),
+		InclusionProof: evaluate.InclusionProof{
+			ItemID:    "c",
+			LeafIndex: 2,
+			Item:      json.RawMessage(`{"id":"c","text":"third"}`),
+			LeafSalt:  hex.EncodeToString(salts[2]),
+		},
+	}
+	for _, h := range path {
+		req.Path = append(req.Path, hexHash(h))
+	}
+
+	post := func(body any) (int, InclusionVerifyResponse) {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		r := setupRouter()
+		r.POST("/api/dataset/inclusion/verify", InclusionHandler())
+		w := httptest.NewRecorder()
+		hr := httptest.NewRequest(http.MethodPost, "/api/dataset/inclusion/verify", bytes.NewReader(raw))
+		hr.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, hr)
+		var resp InclusionVerifyResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+	if code, resp := post(req); code != http.StatusOK || !resp.Included {
+		t.Fatalf("expected the item to be included, got %d %+v", code, resp)
+	}
+	wrong := req
+	wrong.LeafIndex = 1
+	if _, resp := post(wrong); resp.Included || resp.Message == "" {
+		t.Fatalf("expected the wrong index to fail, got %+v", resp)
+	}
+	wrong = req
+	wrong.LeafSalt = hex.EncodeToString(salts[1])
+	if _, resp := post(wrong); resp.Included {
+		t.Fatalf("expected the wrong leaf salt to fail")
+	}
+	wrong = req
+	wrong.Item = json.RawMessage(`{"id":"c","text":"third","extra":1}`)
+	if _, resp := post(wrong); resp.Included {
+		t.Fatalf("expected an item with unknown fields to fail")
+	}
+	if code, _ := post(map[string]string{"dataset_digest": req.DatasetDigest}); code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for a request without an item, got %d", code)
+	}
+
+	// With the run's dataset opening, the root is checked against the
+	// commitment a proof discloses.
+	opening, publicInputsB64 := datasetOpeningInputs(t, req.DatasetDigest)
+	bound := req
+	bound.DatasetOpening = &opening
+	bound.PublicInputsB64 = publicInputsB64
+	if code, resp := post(bound); code != http.StatusOK || !resp.Included || resp.DatasetOpeningMatches == nil || !*resp.DatasetOpeningMatches {
+		t.Fatalf("expected the item to be included under the proof's commitment, got %d %+v", code, resp)
+	}
+	other, _ := datasetOpeningInputs(t, req.DatasetDigest)
+	wrong = bound
+	wrong.DatasetOpening = &other
+	if _, resp := post(wrong); resp.Included || resp.DatasetOpeningMatches == nil || *resp.DatasetOpeningMatches {
+		t.Fatalf("expected another run's dataset opening not to match, got %+v", resp)
+	}
+	wrong = bound
+	wrong.PublicInputsB64 = ""
+	if code, _ := post(wrong); code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for a dataset opening without public inputs, got %d", code)
+	}
+}
+
+// datasetOpeningInputs commits to datasetDigest under a fresh salt and
+// returns the dataset opening with public inputs disclosing the commitment.
+func datasetOpeningInputs(t *testing.T, datasetDigest string) (zk.DatasetOpening, string) {
+	t.Helper()
+	salt, err := zk.NewCommitmentSalt()
+	if err != nil {
+		t.Fatalf("NewCommitmentSalt error: %v", err)
+	}
+	opening := zk.OpeningFromWitness(&zk.WitnessInputs{
+		Salt:             salt,
+		DatasetDigestHex: datasetDigest,
+		ConstraintIDs:    []string{"pii_exposure_risk"},
+		Enabled:          []uint64{1},
+		MaxAllowed:       []uint64{1},
+		Severity:         []uint64{0},
+		Provenance:       &zk.Provenance{Kind: zk.EvaluatorClient, ResponseHash: zk.ResponseHash([]byte("{}"))},
+	})
+	commitment, err := opening.Commitment()
+	if err != nil {
+		t.Fatalf("Commitment error: %v", err)
+	}
+	d, err := opening.DatasetOpening()
+	if err != nil {
+		t.Fatalf("DatasetOpening error: %v", err)
+	}
+	raw, err := zk.EncodePublicInputs(zk.PublicInputs{PolicyThreshold: 1, OverallPass: true, Commitment: commitment})
+	if err != nil {
+		t.Fatalf("EncodePublicInputs error: %v", err)
+	}
+	return d, base64.StdEncoding.EncodeToString(raw)
+}
+
+func hexHash(h merkle.Hash) string {
+	return hex.EncodeToString(h[:])
+}
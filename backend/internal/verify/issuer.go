@@ -0,0 +1,22 @@
+package verify
+
+import (
+	"net/http"
+
+	"noema/internal/crypto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IssuerHandler handles GET /.well-known/noema-issuer.json, publishing the
+// public key the server signs attestations with. It is 404 when the server
+// has no issuer key.
+func IssuerHandler(issuer *crypto.Issuer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if issuer == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "issuer key not configured"})
+			return
+		}
+		c.JSON(http.StatusOK, issuer.Document())
+	}
+}
@@ -0,0 +1,45 @@
+package verify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"noema/internal/crypto"
+)
+
+func TestIssuerHandler(t *testing.T) {
+	issuer, err := crypto.GenerateIssuer(filepath.Join(t.TempDir(), "issuer.pem"))
+	if err != nil {
+		t.Fatalf("GenerateIssuer error: %v", err)
+	}
+	r := setupRouter()
+	r.GET("/.well-known/noema-issuer.json", IssuerHandler(issuer))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/noema-issuer.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var doc crypto.IssuerDocument
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	pub, err := doc.Key()
+	if err != nil {
+		t.Fatalf("Key error: %v", err)
+	}
+	if !pub.Equal(issuer.PublicKey()) || doc.KeyID != issuer.KeyID() {
+		t.Fatalf("document does not publish the issuer key: %+v", doc)
+	}
+
+	r = setupRouter()
+	r.GET("/.well-known/noema-issuer.json", IssuerHandler(nil))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/noema-issuer.json", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without an issuer key, got %d", w.Code)
+	}
+}
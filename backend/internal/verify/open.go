@@ -0,0 +1,88 @@
+package verify
+
+import (
+	"net/http"
+	"strings"
+
+	"noema/internal/config"
+	"noema/internal/httputil"
+	"noema/internal/zk"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenRequest is the JSON body for POST /api/commitment/open. ProofB64 is
+// optional; when given, the proof is verified against the same public inputs.
+type OpenRequest struct {
+	Opening         zk.CommitmentOpening `json:"opening"`
+	PublicInputsB64 string               `json:"public_inputs_b64"`
+	ProofB64        string               `json:"proof_b64,omitempty"`
+}
+
+// OpenResponse is the JSON response for POST /api/commitment/open.
+type OpenResponse struct {
+	// Opened is set when the opening reproduces the public commitment and
+	// policy hash, and the proof verifies if one was given.
+	Opened bool `json:"opened"`
+	zk.OpeningCheck
+	ProofVerified *bool  `json:"proof_verified,omitempty"`
+	Message       string `json:"message,omitempty"`
+}
+
+// OpenHandler handles POST /api/commitment/open. It recomputes the commitment
+// from an opening exported by the dataset owner and checks it against the
+// commitment a proof's public inputs disclose.
+func OpenHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxVerifyBytes)
+
+		var req OpenRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			if httputil.IsBodyTooLarge(err) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+			return
+		}
+		publicInputsB64 := strings.TrimSpace(req.PublicInputsB64)
+		proofB64 := strings.TrimSpace(req.ProofB64)
+		if publicInputsB64 == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing public inputs"})
+			return
+		}
+		pi, err := zk.DecodePublicInputsB64(publicInputsB64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid public inputs"})
+			return
+		}
+		check, err := req.Opening.Check(pi)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := OpenResponse{Opened: check.Matches(), OpeningCheck: check}
+		switch {
+		case !check.CommitmentMatches:
+			resp.Message = "opening does not reproduce the commitment"
+		case !check.Matches():
+			resp.Message = "opening does not reproduce the policy hash"
+		}
+		if proofB64 != "" {
+			verified, msg, err := zk.VerifyProof(proofB64, publicInputsB64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+			resp.ProofVerified = &verified
+			if !verified {
+				resp.Opened = false
+				if resp.Message == "" {
+					resp.Message = msg
+				}
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
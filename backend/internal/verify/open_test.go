@@ -0,0 +1,128 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"noema/internal/zk"
+)
+
+func openTestProof(t *testing.T) (zk.CommitmentOpening, zk.Proof) {
+	t.Helper()
+	salt, err := zk.NewCommitmentSalt()
+	if err != nil {
+		t.Fatalf("NewCommitmentSalt error: %v", err)
+	}
+	witness := &zk.WitnessInputs{
+		Salt:             salt,
+		DatasetDigestHex: "00112233445566778899aabbccddeeffffeeddccbbaa99887766554433221100",
+		ConstraintIDs:    []string{"pii_exposure_risk", "custom_tone"},
+		Enabled:          []uint64{1, 1},
+		MaxAllowed:       []uint64{1, 2},
+		Severity:         []uint64{1, 2},
+		Provenance:       &zk.Provenance{Kind: zk.EvaluatorGemini, Model: "gemini-2.5-flash", PromptVersion: "noema-eval-v2", ResponseHash: zk.ResponseHash([]byte("{}"))},
+	}
+	commitment, err := zk.CommitmentPoseidon(witness)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	policyHash, err := zk.PolicyHashPoseidon(witness)
+	if err != nil {
+		t.Fatalf("PolicyHashPoseidon error: %v", err)
+	}
+	proof, err := zk.GenerateProof(zk.PublicInputs{
+		PolicyThreshold: zk.PolicyThreshold(witness.Enabled, witness.MaxAllowed),
+		MaxSeverity:     2,
+		OverallPass:     true,
+		Commitment:      commitment,
+		PolicyHash:      policyHash,
+		Witness:         witness,
+	})
+	if err != nil {
+		t.Fatalf("GenerateProof error: %v", err)
+	}
+	return zk.OpeningFromWitness(witness), proof
+}
+
+func postOpen(t *testing.T, req OpenRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	r := setupRouter()
+	r.POST("/api/commitment/open", OpenHandler())
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/commitment/open", bytes.NewReader(body))
+	httpReq.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, httpReq)
+	return w
+}
+
+func TestOpenHandlerChecksOpening(t *testing.T) {
+	opening, proof := openTestProof(t)
+
+	w := postOpen(t, OpenRequest{Opening: opening, PublicInputsB64: proof.PublicInputsB64, ProofB64: proof.ProofB64})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp OpenResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !resp.Opened || !resp.CommitmentMatches || resp.PolicyHashMatches == nil || !*resp.PolicyHashMatches {
+		t.Fatalf("expected opening to match, got %+v", resp)
+	}
+	if resp.ProofVerified == nil || !*resp.ProofVerified {
+		t.Fatalf("expected proof to verify")
+	}
+
+	opening.Severity = []uint64{0, 2}
+	w = postOpen(t, OpenRequest{Opening: opening, PublicInputsB64: proof.PublicInputsB64})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	resp = OpenResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Opened || resp.CommitmentMatches || resp.ProofVerified != nil {
+		t.Fatalf("expected altered severity not to open the commitment, got %+v", resp)
+	}
+}
+
+func TestOpenHandlerRejectsBadRequests(t *testing.T) {
+	opening, _ := openTestProof(t)
+	cases := []struct {
+		name string
+		req  OpenRequest
+	}{
+		{"missing public inputs", OpenRequest{Opening: opening}},
+		{"invalid public inputs", OpenRequest{Opening: opening, PublicInputsB64: "%%%"}},
+		{"unknown version", OpenRequest{Opening: zk.CommitmentOpening{Version: 9}, PublicInputsB64: hiddenCommitmentInputs(t, false)}},
+		{"hidden commitment", OpenRequest{Opening: opening, PublicInputsB64: hiddenCommitmentInputs(t, true)}},
+	}
+	for _, tc := range cases {
+		if w := postOpen(t, tc.req); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status 400, got %d: %s", tc.name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func hiddenCommitmentInputs(t *testing.T, hide bool) string {
+	t.Helper()
+	pi := zk.PublicInputs{PolicyThreshold: 1, OverallPass: true, HideCommitment: hide}
+	if !hide {
+		pi.Commitment = "0x" + strings.Repeat("0", 63) + "1"
+	}
+	raw, err := zk.EncodePublicInputs(pi)
+	if err != nil {
+		t.Fatalf("EncodePublicInputs error: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
@@ -0,0 +1,90 @@
+package verify
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"noema/internal/zk"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VKResponse is the JSON response for GET /api/vk.
+type VKResponse struct {
+	zk.VerifyingKeyExport
+	VKB64 string `json:"vk_b64"`
+}
+
+// VKHandler handles GET /api/vk. Returns the verifying key as JSON by default,
+// the raw gnark binary encoding with ?format=bin, or snarkjs
+// verification_key.json with ?format=snarkjs. ?key_id selects a
+// specific key version, including retired ones; the default is the key new
+// proofs are made with.
+func VKHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		vk, err := zk.ExportVerifyingKey(strings.TrimSpace(c.Query("key_id")))
+		if errors.Is(err, zk.ErrUnknownKey) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown key_id"})
+			return
+		}
+		if err != nil {
+			log.Printf("export vk: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "verifying key unavailable"})
+			return
+		}
+		c.Header("X-Noema-VK-Fingerprint", vk.Fingerprint)
+		c.Header("X-Noema-Circuit-ID", vk.CircuitID)
+		c.Header("X-Noema-Key-ID", vk.KeyID)
+		switch c.DefaultQuery("format", "json") {
+		case "json":
+			c.JSON(http.StatusOK, VKResponse{
+				VerifyingKeyExport: vk,
+				VKB64:              base64.StdEncoding.EncodeToString(vk.Raw),
+			})
+		case "bin":
+			c.Header("Content-Disposition", `attachment; filename="`+vk.KeyID+`.vk"`)
+			c.Data(http.StatusOK, "application/octet-stream", vk.Raw)
+		case "snarkjs":
+			sj, err := zk.SnarkJSVerifyingKeyFor(vk.KeyID)
+			if errors.Is(err, zk.ErrGroth16Only) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				log.Printf("export snarkjs vk: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "verifying key unavailable"})
+				return
+			}
+			c.Header("Content-Disposition", `attachment; filename="`+vk.KeyID+`.verification_key.json"`)
+			c.JSON(http.StatusOK, sj)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, bin or snarkjs"})
+		}
+	}
+}
+
+// SolidityHandler handles GET /api/vk/solidity, serving the Solidity verifier
+// contract for a verifying key. ?key_id selects the key as for GET /api/vk.
+// Each key needs its own contract.
+func SolidityHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, err := zk.ExportSolidity(strings.TrimSpace(c.Query("key_id")))
+		if errors.Is(err, zk.ErrUnknownKey) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown key_id"})
+			return
+		}
+		if err != nil {
+			log.Printf("export solidity verifier: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "solidity verifier unavailable"})
+			return
+		}
+		c.Header("X-Noema-VK-Fingerprint", v.Fingerprint)
+		c.Header("X-Noema-Circuit-ID", v.CircuitID)
+		c.Header("X-Noema-Key-ID", v.KeyID)
+		c.Header("Content-Disposition", `attachment; filename="`+v.KeyID+`.sol"`)
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", v.Source)
+	}
+}
@@ -0,0 +1,153 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"noema/internal/zk"
+)
+
+func TestVKHandlerJSON(t *testing.T) {
+	r := setupRouter()
+	r.GET("/api/vk", VKHandler())
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/vk", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp VKResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(resp.VKB64)
+	if err != nil {
+		t.Fatalf("decode vk_b64: %v", err)
+	}
+	if got := zk.VKFingerprint(resp.CircuitID, raw); got != resp.Fingerprint {
+		t.Fatalf("fingerprint %s does not match exported key (%s)", resp.Fingerprint, got)
+	}
+	if len(resp.K) != len(resp.PublicSignals)+1 {
+		t.Fatalf("expected %d K points, got %d", len(resp.PublicSignals)+1, len(resp.K))
+	}
+	if w.Header().Get("X-Noema-VK-Fingerprint") != resp.Fingerprint {
+		t.Fatalf("expected fingerprint header to match body")
+	}
+}
+
+func TestVKHandlerBinary(t *testing.T) {
+	r := setupRouter()
+	r.GET("/api/vk", VKHandler())
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/vk?format=bin", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	raw, err := io.ReadAll(w.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	vk, err := zk.ExportVerifyingKey("")
+	if err != nil {
+		t.Fatalf("ExportVerifyingKey error: %v", err)
+	}
+	if !bytes.Equal(raw, vk.Raw) {
+		t.Fatalf("expected binary body to match exported key")
+	}
+	if got := zk.VKFingerprint(vk.CircuitID, raw); got != w.Header().Get("X-Noema-VK-Fingerprint") {
+		t.Fatalf("expected fingerprint header to match binary body")
+	}
+}
+
+func TestVKHandlerRejectsUnknownFormat(t *testing.T) {
+	r := setupRouter()
+	r.GET("/api/vk", VKHandler())
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/vk?format=xml", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+}
+
+func TestVKHandlerKeyID(t *testing.T) {
+	r := setupRouter()
+	r.GET("/api/vk", VKHandler())
+
+	vk, err := zk.ExportVerifyingKey("")
+	if err != nil {
+		t.Fatalf("ExportVerifyingKey error: %v", err)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/vk?key_id="+vk.KeyID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if w.Header().Get("X-Noema-Key-ID") != vk.KeyID {
+		t.Fatalf("expected key id header %q, got %q", vk.KeyID, w.Header().Get("X-Noema-Key-ID"))
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/vk?key_id="+zk.FormatKeyID(vk.CircuitID, 99), nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", w.Code)
+	}
+}
+
+func TestSolidityHandler(t *testing.T) {
+	r := setupRouter()
+	r.GET("/api/vk/solidity", SolidityHandler())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/vk/solidity", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("function verifyProof(")) {
+		t.Fatalf("expected a verifier contract")
+	}
+	vk, err := zk.ExportVerifyingKey("")
+	if err != nil {
+		t.Fatalf("ExportVerifyingKey error: %v", err)
+	}
+	if w.Header().Get("X-Noema-Key-ID") != vk.KeyID || w.Header().Get("X-Noema-VK-Fingerprint") != vk.Fingerprint {
+		t.Fatalf("expected headers to name the default key")
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/vk/solidity?key_id=nope.k1", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", w.Code)
+	}
+}
+
+func TestVKHandlerSnarkJS(t *testing.T) {
+	r := setupRouter()
+	r.GET("/api/vk", VKHandler())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/vk?format=snarkjs", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp zk.SnarkJSVerifyingKey
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Protocol != "groth16" || resp.Curve != "bn128" {
+		t.Fatalf("unexpected protocol/curve %s/%s", resp.Protocol, resp.Curve)
+	}
+	if resp.NPublic != len(zk.PolicyGatePublicSignals) || len(resp.IC) != resp.NPublic+1 {
+		t.Fatalf("unexpected nPublic=%d IC=%d", resp.NPublic, len(resp.IC))
+	}
+}
@@ -0,0 +1,563 @@
+package aggregate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	stdgroth16 "github.com/consensys/gnark/std/recursion/groth16"
+
+	"noema/internal/zk"
+)
+
+// CircuitFamily names the aggregation circuits; CircuitID adds the number of
+// children.
+const CircuitFamily = "noema_aggregate_v1"
+
+// MinChildren is the smallest aggregate worth proving.
+const MinChildren = 2
+
+const (
+	csFile       = "circuit.r1cs"
+	pkFile       = "proving.key"
+	vkFile       = "verifying.key"
+	manifestFile = "manifest.json"
+)
+
+// CircuitID is the aggregation circuit for n children.
+func CircuitID(n int) string {
+	return fmt.Sprintf("%s_n%d", CircuitFamily, n)
+}
+
+// ErrMixedKeys is returned when the children were proved with different
+// keys. An aggregate verifies one child key.
+var ErrMixedKeys = errors.New("proofs were made with different keys")
+
+// ErrNoKeys is returned when no keys have been set up for the child key and
+// size being aggregated. Setting them up takes tens of minutes, so it is
+// left to noema aggregate setup rather than done on demand.
+var ErrNoKeys = errors.New("aggregation keys are not set up")
+
+// ChildError reports why one child can't be aggregated.
+type ChildError struct {
+	Index  int
+	Reason string
+}
+
+func (e *ChildError) Error() string {
+	return fmt.Sprintf("proof %d: %s", e.Index, e.Reason)
+}
+
+// Child is one policy gate proof to aggregate.
+type Child struct {
+	ProofB64        string
+	PublicInputsB64 string
+}
+
+// Result is an aggregate proof. Its public inputs are Commitments, in child
+// order.
+type Result struct {
+	CircuitID       string   `json:"circuit_id"`
+	ChildKeyID      string   `json:"child_key_id"`
+	Commitments     []string `json:"commitments"`
+	ProofB64        string   `json:"proof_b64"`
+	VerifyingKeyB64 string   `json:"verifying_key_b64"`
+	VKFingerprint   string   `json:"vk_fingerprint"`
+}
+
+// Manifest describes one persisted set of aggregation keys.
+type Manifest struct {
+	CircuitID          string `json:"circuit_id"`
+	ChildKeyID         string `json:"child_key_id"`
+	ChildVKFingerprint string `json:"child_vk_fingerprint"`
+	VKFingerprint      string `json:"vk_fingerprint"`
+	Constraints        int    `json:"constraints"`
+	CreatedAt          string `json:"created_at"`
+}
+
+type keySet struct {
+	manifest Manifest
+	ccs      constraint.ConstraintSystem
+	pk       groth16.ProvingKey
+	vk       groth16.VerifyingKey
+	vkRaw    []byte
+}
+
+// Aggregator proves aggregates with keys set up ahead of time by Setup and
+// persisted under dir; an empty dir keeps them in memory only. Setups and
+// aggregations run one at a time, since each one needs about a million
+// constraints per child.
+type Aggregator struct {
+	dir         string
+	maxChildren int
+
+	// mu serializes setups and proofs; keysMu guards keys alone, so
+	// HasKeys doesn't wait for a proof to finish.
+	mu     sync.Mutex
+	keysMu sync.Mutex
+	keys   map[string]*keySet
+}
+
+// New returns an Aggregator for up to maxChildren children.
+func New(dir string, maxChildren int) *Aggregator {
+	return &Aggregator{dir: dir, maxChildren: maxChildren, keys: map[string]*keySet{}}
+}
+
+// MaxChildren is the largest number of proofs one aggregate can hold.
+func (a *Aggregator) MaxChildren() int {
+	return a.maxChildren
+}
+
+// HasKeys reports whether keys aggregating n proofs of the child key
+// childKeyID have been set up.
+func (a *Aggregator) HasKeys(childKeyID string, n int) bool {
+	a.keysMu.Lock()
+	ks := a.keys[keyName(childKeyID, n)]
+	a.keysMu.Unlock()
+	if ks != nil {
+		return true
+	}
+	if a.dir == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(a.keyDir(childKeyID, n), manifestFile))
+	return err == nil
+}
+
+// Check checks every child natively, without proving anything, and returns
+// the key they were proved with. A child that would make the circuit
+// unsatisfiable is reported as a *ChildError; when the keys for that child
+// key and size are missing the error wraps ErrNoKeys.
+func (a *Aggregator) Check(children []Child) (zk.KeyInfo, error) {
+	inputs, err := a.check(children)
+	if err != nil {
+		return zk.KeyInfo{}, err
+	}
+	if !a.HasKeys(inputs[0].Key.KeyID, len(inputs)) {
+		return zk.KeyInfo{}, noKeysError(inputs[0].Key.KeyID, len(inputs))
+	}
+	return inputs[0].Key, nil
+}
+
+// Aggregate checks every child as Check does, then proves that all of them
+// verify and pass.
+func (a *Aggregator) Aggregate(children []Child) (Result, error) {
+	inputs, err := a.check(children)
+	if err != nil {
+		return Result{}, err
+	}
+	layout, err := layoutFor(inputs[0].Signals)
+	if err != nil {
+		return Result{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ks, err := a.loadKeys(inputs[0].Key, len(inputs))
+	if err != nil {
+		return Result{}, err
+	}
+	assignment, err := assign(inputs, layout)
+	if err != nil {
+		return Result{}, err
+	}
+	w, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		return Result{}, fmt.Errorf("aggregate witness: %w", err)
+	}
+	proof, err := groth16.Prove(ks.ccs, ks.pk, w)
+	if err != nil {
+		return Result{}, fmt.Errorf("prove aggregate: %w", err)
+	}
+	var buf bytes.Buffer
+	if _, err := proof.WriteTo(&buf); err != nil {
+		return Result{}, fmt.Errorf("encode aggregate proof: %w", err)
+	}
+	res := Result{
+		CircuitID:       ks.manifest.CircuitID,
+		ChildKeyID:      ks.manifest.ChildKeyID,
+		ProofB64:        base64.StdEncoding.EncodeToString(buf.Bytes()),
+		VerifyingKeyB64: base64.StdEncoding.EncodeToString(ks.vkRaw),
+		VKFingerprint:   ks.manifest.VKFingerprint,
+	}
+	for _, in := range inputs {
+		res.Commitments = append(res.Commitments, in.Inputs.Commitment)
+	}
+	return res, nil
+}
+
+// Setup sets up and persists the keys aggregating n proofs of child's key,
+// unless they already exist. It reports whether it set them up.
+func (a *Aggregator) Setup(child zk.RecursionInput, n int) (Manifest, bool, error) {
+	if n < MinChildren || n > a.maxChildren {
+		return Manifest{}, false, fmt.Errorf("need %d to %d proofs, got %d", MinChildren, a.maxChildren, n)
+	}
+	layout, err := layoutFor(child.Signals)
+	if err != nil {
+		return Manifest{}, false, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ks, err := a.loadKeys(child.Key, n)
+	if err == nil {
+		return ks.manifest, false, nil
+	}
+	if !errors.Is(err, ErrNoKeys) {
+		return Manifest{}, false, err
+	}
+	if ks, err = setUp(child, n, layout); err != nil {
+		return Manifest{}, false, err
+	}
+	if a.dir != "" {
+		if err := saveKeySet(a.keyDir(child.Key.KeyID, n), ks); err != nil {
+			return Manifest{}, false, err
+		}
+	}
+	a.keysMu.Lock()
+	a.keys[keyName(child.Key.KeyID, n)] = ks
+	a.keysMu.Unlock()
+	return ks.manifest, true, nil
+}
+
+// check verifies every child natively.
+func (a *Aggregator) check(children []Child) ([]zk.RecursionInput, error) {
+	if len(children) < MinChildren || len(children) > a.maxChildren {
+		return nil, fmt.Errorf("need %d to %d proofs, got %d", MinChildren, a.maxChildren, len(children))
+	}
+	inputs := make([]zk.RecursionInput, len(children))
+	for i, c := range children {
+		in, msg, err := zk.ForRecursion(c.ProofB64, c.PublicInputsB64)
+		if msg != "" {
+			return nil, &ChildError{Index: i, Reason: msg}
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !in.Inputs.OverallPass:
+			return nil, &ChildError{Index: i, Reason: "policy gate did not pass"}
+		case in.Inputs.HideCommitment:
+			return nil, &ChildError{Index: i, Reason: "commitment is not disclosed"}
+		case i > 0 && in.Key.KeyID != inputs[0].Key.KeyID:
+			return nil, ErrMixedKeys
+		}
+		inputs[i] = in
+	}
+	return inputs, nil
+}
+
+// Verify checks an aggregate proof against its own verifying key and
+// commitments. Callers that trust a particular key compare VKFingerprint
+// first.
+func Verify(res Result) error {
+	vkRaw, err := base64.StdEncoding.DecodeString(res.VerifyingKeyB64)
+	if err != nil {
+		return fmt.Errorf("invalid verifying key encoding")
+	}
+	if fingerprint(res.CircuitID, vkRaw) != res.VKFingerprint {
+		return fmt.Errorf("verifying key fingerprint mismatch")
+	}
+	vk := groth16.NewVerifyingKey(ecc.BN254)
+	if _, err := vk.ReadFrom(bytes.NewReader(vkRaw)); err != nil {
+		return fmt.Errorf("invalid verifying key: %w", err)
+	}
+	proofRaw, err := base64.StdEncoding.DecodeString(res.ProofB64)
+	if err != nil {
+		return fmt.Errorf("invalid proof encoding")
+	}
+	proof := groth16.NewProof(ecc.BN254)
+	if _, err := proof.ReadFrom(bytes.NewReader(proofRaw)); err != nil {
+		return fmt.Errorf("invalid proof encoding")
+	}
+	if res.CircuitID != CircuitID(len(res.Commitments)) {
+		return fmt.Errorf("circuit %s does not aggregate %d proofs", res.CircuitID, len(res.Commitments))
+	}
+	public := &Circuit{Commitments: make([]frontend.Variable, len(res.Commitments))}
+	for i, c := range res.Commitments {
+		v, err := zk.ParseCommitment(c)
+		if err != nil {
+			return fmt.Errorf("invalid commitment %d: %w", i, err)
+		}
+		public.Commitments[i] = v
+	}
+	w, err := frontend.NewWitness(public, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		return fmt.Errorf("invalid public witness: %w", err)
+	}
+	if err := groth16.Verify(proof, vk, w); err != nil {
+		return fmt.Errorf("invalid proof")
+	}
+	return nil
+}
+
+// assign builds the full outer witness for inputs.
+func assign(inputs []zk.RecursionInput, layout signalLayout) (*Circuit, error) {
+	c := &Circuit{
+		Commitments: make([]frontend.Variable, len(inputs)),
+		Proofs:      make([]childProof, len(inputs)),
+		Witnesses:   make([]childWitness, len(inputs)),
+		layout:      layout,
+	}
+	for i, in := range inputs {
+		var err error
+		if c.Proofs[i], err = stdgroth16.ValueOfProof[sw_bn254.G1Affine, sw_bn254.G2Affine](in.Proof); err != nil {
+			return nil, fmt.Errorf("proof %d: %w", i, err)
+		}
+		if c.Witnesses[i], err = stdgroth16.ValueOfWitness[sw_bn254.ScalarField](in.Public); err != nil {
+			return nil, fmt.Errorf("witness %d: %w", i, err)
+		}
+		commitment, err := publicSignal(in, layout.commitment)
+		if err != nil {
+			return nil, err
+		}
+		c.Commitments[i] = commitment
+	}
+	return c, nil
+}
+
+func publicSignal(in zk.RecursionInput, i int) (*big.Int, error) {
+	vec, ok := in.Public.Vector().(fr.Vector)
+	if !ok || i >= len(vec) {
+		return nil, fmt.Errorf("unexpected public witness")
+	}
+	return vec[i].BigInt(new(big.Int)), nil
+}
+
+// placeholder is the circuit compiled for n children of in's key.
+func placeholder(in zk.RecursionInput, n int, layout signalLayout) (*Circuit, error) {
+	vk, err := stdgroth16.ValueOfVerifyingKeyFixed[sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](in.VerifyingKey)
+	if err != nil {
+		return nil, fmt.Errorf("child verifying key: %w", err)
+	}
+	c := &Circuit{
+		Commitments:  make([]frontend.Variable, n),
+		Proofs:       make([]childProof, n),
+		Witnesses:    make([]childWitness, n),
+		VerifyingKey: vk,
+		layout:       layout,
+	}
+	for i := range n {
+		c.Proofs[i] = stdgroth16.PlaceholderProof[sw_bn254.G1Affine, sw_bn254.G2Affine](in.CS)
+		c.Witnesses[i] = stdgroth16.PlaceholderWitness[sw_bn254.ScalarField](in.CS)
+	}
+	return c, nil
+}
+
+func keyName(childKeyID string, n int) string {
+	return CircuitID(n) + "/" + childKeyID
+}
+
+func (a *Aggregator) keyDir(childKeyID string, n int) string {
+	return filepath.Join(a.dir, CircuitID(n), childKeyID)
+}
+
+func noKeysError(childKeyID string, n int) error {
+	return fmt.Errorf("%w for %d proofs of key %s; run noema aggregate setup -key %s -n %d", ErrNoKeys, n, childKeyID, childKeyID, n)
+}
+
+// loadKeys returns the keys aggregating n children of key, loading them from
+// dir the first time. Callers hold a.mu.
+func (a *Aggregator) loadKeys(key zk.KeyInfo, n int) (*keySet, error) {
+	name := keyName(key.KeyID, n)
+	a.keysMu.Lock()
+	ks := a.keys[name]
+	a.keysMu.Unlock()
+	if ks != nil {
+		return ks, nil
+	}
+	if a.dir == "" {
+		return nil, noKeysError(key.KeyID, n)
+	}
+	dir := a.keyDir(key.KeyID, n)
+	ks, err := loadKeySet(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, noKeysError(key.KeyID, n)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ks.manifest.ChildVKFingerprint != key.VKFingerprint {
+		return nil, fmt.Errorf("keys in %s were set up for another child key", dir)
+	}
+	a.keysMu.Lock()
+	a.keys[name] = ks
+	a.keysMu.Unlock()
+	return ks, nil
+}
+
+// setUp compiles the circuit aggregating n children of in's key and runs
+// the Groth16 setup for it.
+func setUp(in zk.RecursionInput, n int, layout signalLayout) (*keySet, error) {
+	circuitID := CircuitID(n)
+	start := time.Now()
+	circuit, err := placeholder(in, n, layout)
+	if err != nil {
+		return nil, err
+	}
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, circuit)
+	if err != nil {
+		return nil, fmt.Errorf("compile %s: %w", circuitID, err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		return nil, fmt.Errorf("setup %s: %w", circuitID, err)
+	}
+	vkRaw, err := encode(vk)
+	if err != nil {
+		return nil, err
+	}
+	ks := &keySet{
+		manifest: Manifest{
+			CircuitID:          circuitID,
+			ChildKeyID:         in.Key.KeyID,
+			ChildVKFingerprint: in.Key.VKFingerprint,
+			VKFingerprint:      fingerprint(circuitID, vkRaw),
+			Constraints:        ccs.GetNbConstraints(),
+			CreatedAt:          time.Now().UTC().Format(time.RFC3339),
+		},
+		ccs:   ccs,
+		pk:    pk,
+		vk:    vk,
+		vkRaw: vkRaw,
+	}
+	log.Printf("set up %s for %s (%d constraints) in %s", circuitID, in.Key.KeyID, ks.manifest.Constraints, time.Since(start).Round(time.Second))
+	return ks, nil
+}
+
+func saveKeySet(dir string, ks *keySet) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", dir, err)
+	}
+	for _, f := range []struct {
+		name string
+		v    io.WriterTo
+	}{
+		{csFile, ks.ccs},
+		{pkFile, rawProvingKey{ks.pk}},
+		{vkFile, ks.vk},
+	} {
+		if err := writeFileAtomic(filepath.Join(dir, f.name), f.v); err != nil {
+			return err
+		}
+	}
+	raw, err := json.MarshalIndent(ks.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The manifest goes last: a directory without one has no keys.
+	return writeFileAtomic(filepath.Join(dir, manifestFile), bytes.NewBuffer(append(raw, '\n')))
+}
+
+func loadKeySet(dir string) (*keySet, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	ks := &keySet{
+		ccs: groth16.NewCS(ecc.BN254),
+		pk:  groth16.NewProvingKey(ecc.BN254),
+		vk:  groth16.NewVerifyingKey(ecc.BN254),
+	}
+	if err := json.Unmarshal(raw, &ks.manifest); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", manifestFile, err)
+	}
+	for _, f := range []struct {
+		name string
+		v    io.ReaderFrom
+	}{
+		{csFile, ks.ccs},
+		{pkFile, rawProvingKey{ks.pk}},
+		{vkFile, ks.vk},
+	} {
+		if err := readFile(filepath.Join(dir, f.name), f.v); err != nil {
+			return nil, err
+		}
+	}
+	if ks.vkRaw, err = encode(ks.vk); err != nil {
+		return nil, err
+	}
+	if fingerprint(ks.manifest.CircuitID, ks.vkRaw) != ks.manifest.VKFingerprint {
+		return nil, fmt.Errorf("verifying key in %s does not match its manifest", dir)
+	}
+	return ks, nil
+}
+
+// rawProvingKey stores a proving key uncompressed and reads it back without
+// subgroup checks. Decompressing a multi-gigabyte key takes longer than
+// setting it up, and the server only reads keys it wrote itself.
+type rawProvingKey struct {
+	groth16.ProvingKey
+}
+
+func (k rawProvingKey) WriteTo(w io.Writer) (int64, error) {
+	return k.WriteRawTo(w)
+}
+
+func (k rawProvingKey) ReadFrom(r io.Reader) (int64, error) {
+	return k.UnsafeReadFrom(r)
+}
+
+func encode(v io.WriterTo) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := v.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("encode keys: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func fingerprint(circuitID string, vkRaw []byte) string {
+	return zk.VKFingerprint(circuitID, vkRaw)
+}
+
+// writeFileAtomic streams v to path; proving keys run to gigabytes.
+func writeFileAtomic(path string, v io.WriterTo) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp for %s: %w", path, err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	w := bufio.NewWriter(tmp)
+	if _, err := v.WriteTo(w); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", path, err)
+	}
+	return os.Rename(tmpName, path)
+}
+
+func readFile(path string, v io.ReaderFrom) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", filepath.Base(path), err)
+	}
+	defer f.Close()
+	if _, err := v.ReadFrom(bufio.NewReader(f)); err != nil {
+		return fmt.Errorf("decode %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
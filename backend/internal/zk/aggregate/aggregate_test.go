@@ -0,0 +1,242 @@
+package aggregate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/test"
+
+	"noema/internal/zk"
+)
+
+// proveRun proves one policy gate run; it passes unless severity exceeds
+// the allowed level.
+func proveRun(t *testing.T, severity uint64, hideCommitment bool) zk.Proof {
+	t.Helper()
+	salt, err := zk.NewCommitmentSalt()
+	if err != nil {
+		t.Fatalf("NewCommitmentSalt error: %v", err)
+	}
+	witness := &zk.WitnessInputs{
+		Salt:             salt,
+		DatasetDigestHex: "00112233445566778899aabbccddeeffffeeddccbbaa99887766554433221100",
+		ConstraintIDs:    []string{"pii_exposure_risk"},
+		Enabled:          []uint64{1},
+		MaxAllowed:       []uint64{1},
+		Severity:         []uint64{severity},
+		Provenance:       &zk.Provenance{Kind: zk.EvaluatorGemini, Model: "gemini-2.5-flash", PromptVersion: "noema-eval-v2", ResponseHash: zk.ResponseHash([]byte("{}"))},
+	}
+	commitment, err := zk.CommitmentPoseidon(witness)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	policyHash, err := zk.PolicyHashPoseidon(witness)
+	if err != nil {
+		t.Fatalf("PolicyHashPoseidon error: %v", err)
+	}
+	proof, err := zk.GenerateProof(zk.PublicInputs{
+		PolicyThreshold: zk.PolicyThreshold(witness.Enabled, witness.MaxAllowed),
+		MaxSeverity:     int(severity),
+		OverallPass:     severity <= 1,
+		Commitment:      commitment,
+		PolicyHash:      policyHash,
+		HideCommitment:  hideCommitment,
+		Witness:         witness,
+	})
+	if err != nil {
+		t.Fatalf("GenerateProof error: %v", err)
+	}
+	return proof
+}
+
+func recursionInput(t *testing.T, p zk.Proof) zk.RecursionInput {
+	t.Helper()
+	in, msg, err := zk.ForRecursion(p.ProofB64, p.PublicInputsB64)
+	if err != nil || msg != "" {
+		t.Fatalf("ForRecursion: %q, %v", msg, err)
+	}
+	return in
+}
+
+func TestCircuitChecksEveryChild(t *testing.T) {
+	pass := []zk.RecursionInput{recursionInput(t, proveRun(t, 0, false)), recursionInput(t, proveRun(t, 1, false))}
+	layout, err := layoutFor(pass[0].Signals)
+	if err != nil {
+		t.Fatalf("layoutFor error: %v", err)
+	}
+	// Keys are set up from the child key alone, before any proof exists.
+	key, err := zk.RecursionKey(pass[0].Key.KeyID)
+	if err != nil {
+		t.Fatalf("RecursionKey error: %v", err)
+	}
+	circuit, err := placeholder(key, len(pass), layout)
+	if err != nil {
+		t.Fatalf("placeholder error: %v", err)
+	}
+
+	assignment, err := assign(pass, layout)
+	if err != nil {
+		t.Fatalf("assign error: %v", err)
+	}
+	if err := test.IsSolved(circuit, assignment, ecc.BN254.ScalarField()); err != nil {
+		t.Fatalf("expected passing children to satisfy the circuit: %v", err)
+	}
+
+	assignment.Commitments[0], assignment.Commitments[1] = assignment.Commitments[1], assignment.Commitments[0]
+	if err := test.IsSolved(circuit, assignment, ecc.BN254.ScalarField()); err == nil {
+		t.Fatalf("expected swapped commitments to be rejected")
+	}
+
+	// A failing run still has a valid proof; only its overall_pass is 0.
+	failing := []zk.RecursionInput{pass[0], recursionInput(t, proveRun(t, 2, false))}
+	if assignment, err = assign(failing, layout); err != nil {
+		t.Fatalf("assign error: %v", err)
+	}
+	if err := test.IsSolved(circuit, assignment, ecc.BN254.ScalarField()); err == nil {
+		t.Fatalf("expected a failing child to be rejected")
+	}
+}
+
+func TestAggregateRejectsChildren(t *testing.T) {
+	a := New("", 4)
+	ok := proveRun(t, 0, false)
+	child := func(p zk.Proof) Child {
+		return Child{ProofB64: p.ProofB64, PublicInputsB64: p.PublicInputsB64}
+	}
+	other := proveRun(t, 1, false)
+
+	cases := []struct {
+		name     string
+		children []Child
+		index    int
+		reason   string
+	}{
+		{"failing run", []Child{child(ok), child(proveRun(t, 2, false))}, 1, "policy gate did not pass"},
+		{"hidden commitment", []Child{child(proveRun(t, 0, true)), child(ok)}, 0, "commitment is not disclosed"},
+		{"invalid proof", []Child{child(ok), {ProofB64: ok.ProofB64, PublicInputsB64: other.PublicInputsB64}}, 1, "invalid proof"},
+		{"bad encoding", []Child{child(ok), {ProofB64: "%%%", PublicInputsB64: ok.PublicInputsB64}}, 1, "invalid proof encoding"},
+	}
+	for _, tc := range cases {
+		_, err := a.Aggregate(tc.children)
+		var ce *ChildError
+		if !errors.As(err, &ce) || ce.Index != tc.index || ce.Reason != tc.reason {
+			t.Fatalf("%s: expected child %d to be rejected with %q, got %v", tc.name, tc.index, tc.reason, err)
+		}
+	}
+
+	// Passing children wait for keys set up ahead of time.
+	pair := []Child{child(ok), child(other)}
+	if _, err := a.Check(pair); !errors.Is(err, ErrNoKeys) {
+		t.Fatalf("expected Check to report missing keys, got %v", err)
+	}
+	if _, err := a.Aggregate(pair); !errors.Is(err, ErrNoKeys) {
+		t.Fatalf("expected Aggregate to refuse to set keys up, got %v", err)
+	}
+
+	if _, err := a.Aggregate([]Child{child(ok)}); err == nil {
+		t.Fatalf("expected a single proof to be rejected")
+	}
+	five := []Child{child(ok), child(ok), child(ok), child(ok), child(ok)}
+	if _, err := a.Aggregate(five); err == nil {
+		t.Fatalf("expected more than the maximum to be rejected")
+	}
+}
+
+func TestLayoutFor(t *testing.T) {
+	l, err := layoutFor(zk.PolicyGatePublicSignals)
+	if err != nil {
+		t.Fatalf("layoutFor error: %v", err)
+	}
+	if l.commitment != 0 || l.overallPass != 1 || l.revealCommitment != 6 {
+		t.Fatalf("unexpected layout %+v", l)
+	}
+	// Circuits before selective disclosure always reveal the commitment.
+	l, err = layoutFor([]string{"commitment", "overall_pass", "max_severity"})
+	if err != nil || l.revealCommitment != -1 {
+		t.Fatalf("unexpected layout %+v, %v", l, err)
+	}
+	if _, err := layoutFor([]string{"max_severity"}); err == nil {
+		t.Fatalf("expected a layout without a commitment to be rejected")
+	}
+}
+
+type squareCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *squareCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X), c.Y)
+	return nil
+}
+
+// Real aggregation keys take minutes to set up; the storage round trip is
+// the same for any circuit.
+func TestKeySetRoundTrip(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &squareCircuit{})
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatalf("setup error: %v", err)
+	}
+	vkRaw, err := encode(vk)
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	root := t.TempDir()
+	dir := filepath.Join(root, CircuitID(2), "child.k1")
+	saved := &keySet{
+		manifest: Manifest{CircuitID: CircuitID(2), ChildKeyID: "child.k1", VKFingerprint: fingerprint(CircuitID(2), vkRaw)},
+		ccs:      ccs,
+		pk:       pk,
+		vk:       vk,
+		vkRaw:    vkRaw,
+	}
+	if err := saveKeySet(dir, saved); err != nil {
+		t.Fatalf("saveKeySet error: %v", err)
+	}
+	ks, err := loadKeySet(dir)
+	if err != nil {
+		t.Fatalf("loadKeySet error: %v", err)
+	}
+	if ks.manifest != saved.manifest {
+		t.Fatalf("unexpected manifest %+v", ks.manifest)
+	}
+	a := New(root, 4)
+	if !a.HasKeys("child.k1", 2) {
+		t.Fatalf("expected saved keys to be found")
+	}
+	if a.HasKeys("child.k1", 3) || a.HasKeys("child.k2", 2) {
+		t.Fatalf("expected no keys for other sizes or child keys")
+	}
+	w, err := frontend.NewWitness(&squareCircuit{X: 3, Y: 9}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatalf("witness error: %v", err)
+	}
+	proof, err := groth16.Prove(ks.ccs, ks.pk, w)
+	if err != nil {
+		t.Fatalf("prove with loaded keys: %v", err)
+	}
+	public, err := w.Public()
+	if err != nil {
+		t.Fatalf("public witness error: %v", err)
+	}
+	if err := groth16.Verify(proof, ks.vk, public); err != nil {
+		t.Fatalf("verify with loaded keys: %v", err)
+	}
+
+	saved.manifest.VKFingerprint = "00"
+	if err := saveKeySet(dir, saved); err != nil {
+		t.Fatalf("saveKeySet error: %v", err)
+	}
+	if _, err := loadKeySet(dir); err == nil {
+		t.Fatalf("expected a manifest that doesn't match the verifying key to be rejected")
+	}
+}
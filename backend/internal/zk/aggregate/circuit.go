@@ -0,0 +1,96 @@
+// Package aggregate proves that a set of policy gate proofs all verify and
+// all pass, with one Groth16 proof that recursively verifies each of them.
+//
+// The outer proof is over BN254 like the proofs it aggregates, which are
+// verified with emulated arithmetic. That keeps each child's commitment the
+// same field element in both proofs, so the aggregate's public inputs are
+// exactly the commitments the runs published.
+package aggregate
+
+import (
+	"fmt"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/consensys/gnark/std/math/emulated"
+	stdgroth16 "github.com/consensys/gnark/std/recursion/groth16"
+)
+
+type (
+	childProof   = stdgroth16.Proof[sw_bn254.G1Affine, sw_bn254.G2Affine]
+	childWitness = stdgroth16.Witness[sw_bn254.ScalarField]
+	childVK      = stdgroth16.VerifyingKey[sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl]
+)
+
+// Circuit verifies len(Proofs) child proofs made with one fixed verifying
+// key. Each child must have overall_pass = 1 and a revealed commitment equal
+// to the matching public Commitments entry.
+type Circuit struct {
+	Commitments []frontend.Variable `gnark:",public"`
+
+	Proofs    []childProof
+	Witnesses []childWitness
+
+	// VerifyingKey is compiled into the circuit, so each child key gets its
+	// own aggregate keys.
+	VerifyingKey childVK `gnark:"-"`
+
+	layout signalLayout
+}
+
+// signalLayout locates the child public signals the circuit constrains.
+type signalLayout struct {
+	commitment, overallPass int
+	// revealCommitment is -1 for child circuits that always reveal it.
+	revealCommitment int
+}
+
+func layoutFor(signals []string) (signalLayout, error) {
+	l := signalLayout{commitment: -1, overallPass: -1, revealCommitment: -1}
+	for i, s := range signals {
+		switch s {
+		case "commitment":
+			l.commitment = i
+		case "overall_pass":
+			l.overallPass = i
+		case "reveal_commitment":
+			l.revealCommitment = i
+		}
+	}
+	if l.commitment < 0 || l.overallPass < 0 {
+		return signalLayout{}, fmt.Errorf("circuit has no commitment and overall_pass signals")
+	}
+	return l, nil
+}
+
+func (c *Circuit) Define(api frontend.API) error {
+	verifier, err := stdgroth16.NewVerifier[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](api)
+	if err != nil {
+		return fmt.Errorf("new verifier: %w", err)
+	}
+	fr, err := emulated.NewField[sw_bn254.ScalarField](api)
+	if err != nil {
+		return fmt.Errorf("new field: %w", err)
+	}
+	if len(c.Proofs) != len(c.Commitments) || len(c.Witnesses) != len(c.Commitments) {
+		return fmt.Errorf("expected %d proofs and witnesses", len(c.Commitments))
+	}
+	one := fr.One()
+	for i := range c.Proofs {
+		w := c.Witnesses[i]
+		// Hidden outputs and flags are 0 or 1, which the default
+		// incomplete scalar multiplication can't handle.
+		if err := verifier.AssertProof(c.VerifyingKey, c.Proofs[i], w, stdgroth16.WithCompleteArithmetic()); err != nil {
+			return fmt.Errorf("assert proof %d: %w", i, err)
+		}
+		fr.AssertIsEqual(&w.Public[c.layout.overallPass], one)
+		if c.layout.revealCommitment >= 0 {
+			fr.AssertIsEqual(&w.Public[c.layout.revealCommitment], one)
+		}
+		// Both curves share the scalar field, so the emulated commitment
+		// recomposes to the native value.
+		commitment := api.FromBinary(fr.ToBitsCanonical(&w.Public[c.layout.commitment])...)
+		api.AssertIsEqual(commitment, c.Commitments[i])
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package zk
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	bn254 "github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/fft"
+	kzg_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/kzg"
+	"github.com/consensys/gnark/constraint"
+)
+
+// Backend selects the proof system new keys are set up for. Keys of the
+// other system stay in the registry and keep verifying the proofs made
+// with them.
+type Backend struct {
+	// System is ProofSystemGroth16 (the default) or ProofSystemPlonk.
+	System string
+	// SRSFile is a KZG SRS in gnark-crypto's binary encoding, large enough
+	// for the 32-slot circuit (2^17+3 G1 points), used to set up PLONK keys.
+	// Without one a fresh SRS is generated locally. That is fine for
+	// development, but whoever generates an SRS can forge proofs, so
+	// production keys should use one from a public ceremony.
+	SRSFile string
+}
+
+// srsLocal is recorded in KeyManifest.SRS for keys set up with a locally
+// generated SRS.
+const srsLocal = "local"
+
+var (
+	backendMu sync.Mutex
+	backend   = Backend{System: ProofSystemGroth16}
+)
+
+// SetBackend chooses the proof system for keys set up from now on: by Init,
+// GenerateKeys, AddKeyVersion and on-demand setup of larger circuits. Call
+// it before Init.
+func SetBackend(b Backend) error {
+	if b.System == "" {
+		b.System = ProofSystemGroth16
+	}
+	if b.System != ProofSystemGroth16 && b.System != ProofSystemPlonk {
+		return fmt.Errorf("unsupported proof system %q", b.System)
+	}
+	if b.SRSFile != "" && b.System != ProofSystemPlonk {
+		return fmt.Errorf("an SRS file is only used by %s", ProofSystemPlonk)
+	}
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	backend = b
+	return nil
+}
+
+func currentBackend() Backend {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	return backend
+}
+
+var (
+	srsMu     sync.Mutex
+	srsLoaded = map[string]*kzg_bn254.SRS{}
+)
+
+// kzgSRS returns the canonical and Lagrange SRS a PLONK setup of ccs needs,
+// and where they came from for the key manifest.
+func kzgSRS(ccs constraint.ConstraintSystem, srsFile string) (*kzg_bn254.SRS, *kzg_bn254.SRS, string, error) {
+	size := ecc.NextPowerOfTwo(uint64(ccs.GetNbConstraints() + ccs.GetNbPublicVariables()))
+	if srsFile == "" {
+		canonical, lagrange, err := localSRS(size)
+		return canonical, lagrange, srsLocal, err
+	}
+
+	srs, sum, err := loadSRS(srsFile)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if uint64(len(srs.Pk.G1)) < size+3 {
+		return nil, nil, "", fmt.Errorf("kzg srs %s has %d points; this circuit needs %d", srsFile, len(srs.Pk.G1), size+3)
+	}
+	points, err := kzg_bn254.ToLagrangeG1(srs.Pk.G1[:size])
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("kzg srs lagrange form: %w", err)
+	}
+	lagrange := &kzg_bn254.SRS{Vk: srs.Vk}
+	lagrange.Pk.G1 = points
+	return srs, lagrange, sum, nil
+}
+
+// localSRS generates a fresh SRS for a domain of the given size and forgets
+// its secret, so every local setup gets its own keys, as Groth16 setups do.
+// Knowing the secret while it lasts makes the Lagrange form much cheaper to
+// compute than from the canonical points.
+func localSRS(size uint64) (*kzg_bn254.SRS, *kzg_bn254.SRS, error) {
+	tauInt, err := rand.Int(rand.Reader, ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tauInt.SetUint64(0)
+	canonical, err := kzg_bn254.NewSRS(size+3, tauInt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate kzg srs: %w", err)
+	}
+
+	var tau fr.Element
+	tau.SetBigInt(tauInt)
+	defer tau.SetZero()
+	powers := make([]fr.Element, size)
+	powers[0].SetOne()
+	for i := 1; i < len(powers); i++ {
+		powers[i].Mul(&powers[i-1], &tau)
+	}
+	fft.NewDomain(size).FFTInverse(powers, fft.DIF)
+	fft.BitReverse(powers)
+	_, _, g1, _ := bn254.Generators()
+	lagrange := &kzg_bn254.SRS{Vk: canonical.Vk}
+	lagrange.Pk.G1 = bn254.BatchScalarMultiplicationG1(&g1, powers)
+	return canonical, lagrange, nil
+}
+
+// loadSRS reads an SRS file once per process; it is the same for every
+// circuit size.
+func loadSRS(path string) (*kzg_bn254.SRS, string, error) {
+	srsMu.Lock()
+	defer srsMu.Unlock()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("read kzg srs: %w", err)
+	}
+	sum := sha256Hex(raw)
+	if srs, ok := srsLoaded[sum]; ok {
+		return srs, sum, nil
+	}
+	var srs kzg_bn254.SRS
+	if _, err := srs.ReadFrom(bytes.NewReader(raw)); err != nil {
+		return nil, "", fmt.Errorf("decode kzg srs %s: %w", path, err)
+	}
+	srsLoaded[sum] = &srs
+	return &srs, sum, nil
+}
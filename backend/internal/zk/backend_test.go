@@ -0,0 +1,197 @@
+package zk
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	kzg_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/kzg"
+
+	"noema/internal/zk/policyzk"
+)
+
+// TestMain runs the package's tests once per proof system. PLONK setups
+// are slow, so -short only runs Groth16; NOEMA_ZK_TEST_SYSTEMS (e.g.
+// "plonk") picks the systems explicitly.
+func TestMain(m *testing.M) {
+	flag.Parse()
+	systems := []string{ProofSystemGroth16, ProofSystemPlonk}
+	if testing.Short() {
+		systems = systems[:1]
+	}
+	if v := os.Getenv("NOEMA_ZK_TEST_SYSTEMS"); v != "" {
+		systems = strings.Split(v, ",")
+	}
+	code := 0
+	for _, system := range systems {
+		if err := useBackend(Backend{System: system}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		fmt.Printf("--- zk tests with %s\n", system)
+		if c := m.Run(); c != 0 {
+			code = c
+		}
+	}
+	os.Exit(code)
+}
+
+// useBackend selects b and drops the keys set up for the previous backend.
+func useBackend(b Backend) error {
+	if err := SetBackend(b); err != nil {
+		return err
+	}
+	keysMu.Lock()
+	registry = nil
+	keysMu.Unlock()
+	return nil
+}
+
+// switchBackend selects b for the rest of the test.
+func switchBackend(t *testing.T, b Backend) {
+	t.Helper()
+	prev := currentBackend()
+	if err := SetBackend(b); err != nil {
+		t.Fatalf("SetBackend error: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := SetBackend(prev); err != nil {
+			t.Errorf("restore backend: %v", err)
+		}
+	})
+}
+
+func TestSetBackendValidates(t *testing.T) {
+	if err := SetBackend(Backend{System: "stark"}); err == nil {
+		t.Fatalf("expected unsupported proof system to be rejected")
+	}
+	if err := SetBackend(Backend{System: ProofSystemGroth16, SRSFile: "srs.bin"}); err == nil {
+		t.Fatalf("expected an SRS file to be rejected for groth16")
+	}
+}
+
+func TestGroth16AndPlonkKeysVerifySideBySide(t *testing.T) {
+	dir := t.TempDir()
+	switchBackend(t, Backend{System: ProofSystemGroth16})
+	g16, err := openRegistry(dir)
+	if err != nil {
+		t.Fatalf("openRegistry error: %v", err)
+	}
+	g16Proof, g16PI := proveWithRegistry(t, g16)
+
+	// Switching the backend sets up a PLONK key as the next version.
+	switchBackend(t, Backend{System: ProofSystemPlonk})
+	reg, err := openRegistry(dir)
+	if err != nil {
+		t.Fatalf("openRegistry error: %v", err)
+	}
+	plonkProof, plonkPI := proveWithRegistry(t, reg)
+	if g16Proof.System != ProofSystemGroth16 || plonkProof.System != ProofSystemPlonk {
+		t.Fatalf("expected groth16 and plonk proofs, got %s and %s", g16Proof.System, plonkProof.System)
+	}
+	if plonkProof.KeyID != FormatKeyID(defaultCircuitID(), 2) {
+		t.Fatalf("expected the plonk key to be version 2, got %s", plonkProof.KeyID)
+	}
+	assertVerifies(t, reg, g16Proof, g16PI)
+	assertVerifies(t, reg, plonkProof, plonkPI)
+
+	keys, err := ListKeys(dir)
+	if err != nil {
+		t.Fatalf("ListKeys error: %v", err)
+	}
+	if len(keys) != 2 || keys[0].System != ProofSystemGroth16 || keys[1].System != ProofSystemPlonk {
+		t.Fatalf("unexpected keys %+v", keys)
+	}
+
+	// A proof checked against the other system's key must fail.
+	plonkPI.KeyID, plonkPI.VKFingerprint = g16Proof.KeyID, g16Proof.VKFingerprint
+	e, err := reg.forVerifying(plonkPI)
+	if err != nil {
+		t.Fatalf("forVerifying error: %v", err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(plonkProof.ProofB64)
+	if err != nil {
+		t.Fatalf("decode proof: %v", err)
+	}
+	if ok, _, _ := verifyWithKey(e, raw, plonkPI); ok {
+		t.Fatalf("expected a plonk proof to fail against a groth16 key")
+	}
+}
+
+func TestPlonkSetupWithSRSFile(t *testing.T) {
+	ccs, err := compilePolicyGate(ProofSystemPlonk, policyzk.SlotSizes[0])
+	if err != nil {
+		t.Fatalf("compile circuit: %v", err)
+	}
+	size := ecc.NextPowerOfTwo(uint64(ccs.GetNbConstraints() + ccs.GetNbPublicVariables()))
+	srs, err := kzg_bn254.NewSRS(size+3, big.NewInt(42))
+	if err != nil {
+		t.Fatalf("NewSRS error: %v", err)
+	}
+	srsFile := filepath.Join(t.TempDir(), "srs.bin")
+	f, err := os.Create(srsFile)
+	if err != nil {
+		t.Fatalf("create srs file: %v", err)
+	}
+	if _, err := srs.WriteTo(f); err != nil {
+		t.Fatalf("write srs: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("close srs file: %v", err)
+	}
+	raw, err := os.ReadFile(srsFile)
+	if err != nil {
+		t.Fatalf("read srs file: %v", err)
+	}
+
+	switchBackend(t, Backend{System: ProofSystemPlonk, SRSFile: srsFile})
+	dir := t.TempDir()
+	reg, err := openRegistry(dir)
+	if err != nil {
+		t.Fatalf("openRegistry error: %v", err)
+	}
+	proof, pi := proveWithRegistry(t, reg)
+	assertVerifies(t, reg, proof, pi)
+	_, manifest, err := loadKeySet(keyVersionDir(dir, defaultCircuitID(), 1), false)
+	if err != nil {
+		t.Fatalf("loadKeySet error: %v", err)
+	}
+	if manifest.System != ProofSystemPlonk || manifest.SRS != sha256Hex(raw) {
+		t.Fatalf("expected manifest to record the SRS file, got %+v", manifest)
+	}
+
+	// The SRS is too small for the 16-slot circuit.
+	if _, err := setupKeySet(PolicyGateCircuitID(policyzk.SlotSizes[1])); err == nil || !strings.Contains(err.Error(), "needs") {
+		t.Fatalf("expected a too-small SRS to be rejected, got %v", err)
+	}
+}
+
+func TestGroth16OnlyExportsRefusePlonkKeys(t *testing.T) {
+	if currentBackend().System != ProofSystemPlonk {
+		t.Skip("needs the plonk backend")
+	}
+	proof := generateTestProof(t)
+	if _, err := EncodeCalldata(proof.ProofB64, proof.PublicInputsB64); !errors.Is(err, ErrGroth16Only) {
+		t.Fatalf("expected ErrGroth16Only from EncodeCalldata, got %v", err)
+	}
+	if _, err := SnarkJSProofB64(proof.ProofB64, proof.PublicInputsB64); !errors.Is(err, ErrGroth16Only) {
+		t.Fatalf("expected ErrGroth16Only from SnarkJSProofB64, got %v", err)
+	}
+	if _, err := SnarkJSVerifyingKeyFor(proof.KeyID); !errors.Is(err, ErrGroth16Only) {
+		t.Fatalf("expected ErrGroth16Only from SnarkJSVerifyingKeyFor, got %v", err)
+	}
+	vk, err := ExportVerifyingKey(proof.KeyID)
+	if err != nil {
+		t.Fatalf("ExportVerifyingKey error: %v", err)
+	}
+	if vk.System != ProofSystemPlonk || vk.Groth16Points != nil || len(vk.Raw) == 0 {
+		t.Fatalf("unexpected plonk key export %+v", vk)
+	}
+}
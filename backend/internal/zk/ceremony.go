@@ -0,0 +1,483 @@
+package zk
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16/bn254/mpcsetup"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+)
+
+// A phase-2 ceremony replaces the single-party groth16.Setup with one where
+// the keys are only forgeable if every contributor kept their randomness.
+// It lives in its own directory:
+//
+//	ceremony.json   the transcript (CeremonyTranscript)
+//	phase1.bin      the circuit-independent phase-1 parameters
+//	phase2_0000.bin the initial phase-2 parameters, derived from phase 1
+//	phase2_0001.bin each accepted contribution, in order
+//
+// Contributors only ever see files: they take the newest phase2 file, run
+// ContributeCeremony on it and hand the result back to the coordinator,
+// who checks it with AcceptContribution. FinalizeCeremony re-checks the
+// whole chain, seals it with a public random beacon and registers the keys
+// in a key directory.
+const (
+	ceremonyFile       = "ceremony.json"
+	ceremonyPhase1File = "phase1.bin"
+)
+
+// ErrCeremonyFinalized is returned when a finalized ceremony is changed.
+var ErrCeremonyFinalized = errors.New("ceremony is already finalized")
+
+// CeremonyTranscript records a phase-2 ceremony. Contributions[0] is the
+// initial parameters; each later entry built on the one before it.
+type CeremonyTranscript struct {
+	CircuitID  string `json:"circuit_id"`
+	Curve      string `json:"curve"`
+	DomainSize uint64 `json:"domain_size"`
+	R1CSSHA256 string `json:"r1cs_sha256"`
+	// Phase1Local is set when phase 1 was generated by InitCeremony rather
+	// than taken from a phase-1 ceremony. Whoever ran it could have kept its
+	// secrets, so such keys are only fit for development.
+	Phase1Local   bool                   `json:"phase1_local"`
+	Phase1SHA256  string                 `json:"phase1_sha256"`
+	CreatedAt     string                 `json:"created_at"`
+	Contributions []CeremonyContribution `json:"contributions"`
+	Final         *CeremonyFinal         `json:"final,omitempty"`
+}
+
+// CeremonyContribution is one phase-2 parameter file in the transcript.
+type CeremonyContribution struct {
+	Index   int    `json:"index"`
+	Name    string `json:"name,omitempty"`
+	File    string `json:"file"`
+	SHA256  string `json:"sha256"`
+	AddedAt string `json:"added_at"`
+}
+
+// CeremonyFinal records how a ceremony was sealed and the key it produced.
+type CeremonyFinal struct {
+	Beacon        string `json:"beacon"`
+	KeyID         string `json:"key_id"`
+	VKFingerprint string `json:"vk_fingerprint"`
+	FinalizedAt   string `json:"finalized_at"`
+}
+
+// Last returns the newest phase-2 parameters, the ones the next contributor
+// builds on.
+func (t CeremonyTranscript) Last() CeremonyContribution {
+	return t.Contributions[len(t.Contributions)-1]
+}
+
+// InitCeremony starts a ceremony for circuitID (the smallest circuit when
+// empty) in dir. phase1File is a serialized mpcsetup.SrsCommons from a
+// phase-1 ceremony for the circuit's domain size; without one, phase 1 is
+// generated locally, which is only fit for development.
+func InitCeremony(dir, circuitID, phase1File string) (CeremonyTranscript, error) {
+	if circuitID == "" {
+		circuitID = defaultCircuitID()
+	}
+	if _, err := os.Stat(filepath.Join(dir, ceremonyFile)); err == nil {
+		return CeremonyTranscript{}, fmt.Errorf("%s already holds a ceremony", dir)
+	}
+	ccs, r1csSum, err := ceremonyCircuit(circuitID)
+	if err != nil {
+		return CeremonyTranscript{}, err
+	}
+	domain := ecc.NextPowerOfTwo(uint64(ccs.GetNbConstraints()))
+
+	var commons mpcsetup.SrsCommons
+	if phase1File == "" {
+		commons, err = localPhase1(domain)
+		if err != nil {
+			return CeremonyTranscript{}, err
+		}
+	} else {
+		raw, err := os.ReadFile(phase1File)
+		if err != nil {
+			return CeremonyTranscript{}, fmt.Errorf("read phase 1: %w", err)
+		}
+		if _, err := commons.ReadFrom(bytes.NewReader(raw)); err != nil {
+			return CeremonyTranscript{}, fmt.Errorf("decode phase 1: %w", err)
+		}
+	}
+	if n := uint64(len(commons.G2.Tau)); n != domain {
+		return CeremonyTranscript{}, fmt.Errorf("phase 1 is for domain size %d; %s needs %d", n, circuitID, domain)
+	}
+
+	var phase1 bytes.Buffer
+	if _, err := commons.WriteTo(&phase1); err != nil {
+		return CeremonyTranscript{}, fmt.Errorf("encode phase 1: %w", err)
+	}
+	phase1Sum := sha256Hex(phase1.Bytes())
+	start, err := phase2Start(ccs, r1csSum, &commons, phase1Sum)
+	if err != nil {
+		return CeremonyTranscript{}, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return CeremonyTranscript{}, err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, ceremonyPhase1File), phase1.Bytes()); err != nil {
+		return CeremonyTranscript{}, err
+	}
+	initial := phase2FileName(0)
+	if err := writeFileAtomic(filepath.Join(dir, initial), start.initial); err != nil {
+		return CeremonyTranscript{}, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	t := CeremonyTranscript{
+		CircuitID:     circuitID,
+		Curve:         ProofCurve,
+		DomainSize:    domain,
+		R1CSSHA256:    r1csSum,
+		Phase1Local:   phase1File == "",
+		Phase1SHA256:  phase1Sum,
+		CreatedAt:     now,
+		Contributions: []CeremonyContribution{{Index: 0, Name: "initial", File: initial, SHA256: sha256Hex(start.initial), AddedAt: now}},
+	}
+	if err := writeJSONAtomic(filepath.Join(dir, ceremonyFile), t); err != nil {
+		return CeremonyTranscript{}, err
+	}
+	return t, nil
+}
+
+// ContributeCeremony adds fresh randomness to the phase-2 parameters in in
+// and writes the result to out. It returns the SHA-256 of out, which the
+// contributor can later look for in the transcript. The randomness is never
+// stored.
+func ContributeCeremony(in, out string) (string, error) {
+	p, _, err := readPhase2(in)
+	if err != nil {
+		return "", err
+	}
+	p.Contribute()
+	return writeEncoded(out, p)
+}
+
+// AcceptContribution checks that the phase-2 parameters in file correctly
+// build on the newest ones in the ceremony in dir, and if so appends them to
+// the transcript under name.
+func AcceptContribution(dir, file, name string) (CeremonyContribution, error) {
+	t, err := readCeremony(dir)
+	if err != nil {
+		return CeremonyContribution{}, err
+	}
+	if t.Final != nil {
+		return CeremonyContribution{}, ErrCeremonyFinalized
+	}
+	prev, _, err := readTranscriptPhase2(dir, t.Last())
+	if err != nil {
+		return CeremonyContribution{}, err
+	}
+	next, raw, err := readPhase2(file)
+	if err != nil {
+		return CeremonyContribution{}, err
+	}
+	if len(next.Challenge) == 0 {
+		return CeremonyContribution{}, fmt.Errorf("%s is not a contribution", file)
+	}
+	if err := prev.Verify(next); err != nil {
+		return CeremonyContribution{}, fmt.Errorf("invalid contribution: %w", err)
+	}
+
+	c := CeremonyContribution{
+		Index:   len(t.Contributions),
+		Name:    name,
+		File:    phase2FileName(len(t.Contributions)),
+		SHA256:  sha256Hex(raw),
+		AddedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := writeFileAtomic(filepath.Join(dir, c.File), raw); err != nil {
+		return CeremonyContribution{}, err
+	}
+	t.Contributions = append(t.Contributions, c)
+	if err := writeJSONAtomic(filepath.Join(dir, ceremonyFile), t); err != nil {
+		return CeremonyContribution{}, err
+	}
+	return c, nil
+}
+
+// VerifyCeremony re-checks the whole ceremony in dir from phase 1: that the
+// initial parameters follow from it and the circuit, that every
+// contribution builds on the one before it, and, once finalized, that
+// sealing with the recorded beacon gives the recorded verifying key.
+func VerifyCeremony(dir string) (CeremonyTranscript, error) {
+	r, err := replayCeremony(dir)
+	if err != nil {
+		return CeremonyTranscript{}, err
+	}
+	if r.t.Final == nil {
+		return r.t, nil
+	}
+	beacon, err := hex.DecodeString(r.t.Final.Beacon)
+	if err != nil {
+		return CeremonyTranscript{}, fmt.Errorf("invalid beacon in transcript")
+	}
+	ks, err := r.seal(beacon)
+	if err != nil {
+		return CeremonyTranscript{}, err
+	}
+	if ks.fingerprint != r.t.Final.VKFingerprint {
+		return CeremonyTranscript{}, fmt.Errorf("sealed verifying key does not match the transcript")
+	}
+	return r.t, nil
+}
+
+// FinalizeCeremony verifies the ceremony in dir, seals it with beacon (a
+// public random value nobody could predict before the last contribution,
+// such as a later drand round) and registers the keys as the newest active
+// version of the circuit in keysDir.
+func FinalizeCeremony(dir, keysDir string, beacon []byte) (KeyInfo, error) {
+	if len(beacon) == 0 {
+		return KeyInfo{}, fmt.Errorf("a random beacon is required")
+	}
+	r, err := replayCeremony(dir)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	if r.t.Final != nil {
+		return KeyInfo{}, ErrCeremonyFinalized
+	}
+	if len(r.t.Contributions) < 2 {
+		return KeyInfo{}, fmt.Errorf("ceremony has no contributions yet")
+	}
+	ks, err := r.seal(beacon)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	ks.ceremony = r.t.Last().SHA256
+	unlock, err := lockKeyDir(keysDir)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	info, err := registerKeySet(keysDir, ks)
+	unlock()
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	r.t.Final = &CeremonyFinal{
+		Beacon:        hex.EncodeToString(beacon),
+		KeyID:         info.KeyID,
+		VKFingerprint: info.VKFingerprint,
+		FinalizedAt:   info.CreatedAt,
+	}
+	if err := writeJSONAtomic(filepath.Join(dir, ceremonyFile), r.t); err != nil {
+		return KeyInfo{}, err
+	}
+	return info, nil
+}
+
+// ceremonyReplay is a ceremony whose transcript has been checked from phase
+// 1 up to its newest contribution.
+type ceremonyReplay struct {
+	t       CeremonyTranscript
+	ccs     *cs_bn254.R1CS
+	commons mpcsetup.SrsCommons
+	evals   mpcsetup.Phase2Evaluations
+	last    *mpcsetup.Phase2
+}
+
+func replayCeremony(dir string) (*ceremonyReplay, error) {
+	t, err := readCeremony(dir)
+	if err != nil {
+		return nil, err
+	}
+	if t.Curve != ProofCurve {
+		return nil, fmt.Errorf("ceremony uses %s, expected %s", t.Curve, ProofCurve)
+	}
+	ccs, r1csSum, err := ceremonyCircuit(t.CircuitID)
+	if err != nil {
+		return nil, err
+	}
+	if r1csSum != t.R1CSSHA256 {
+		return nil, fmt.Errorf("%s has changed since the ceremony started", t.CircuitID)
+	}
+
+	r := &ceremonyReplay{t: t, ccs: ccs}
+	raw, err := os.ReadFile(filepath.Join(dir, ceremonyPhase1File))
+	if err != nil {
+		return nil, fmt.Errorf("read phase 1: %w", err)
+	}
+	if sha256Hex(raw) != t.Phase1SHA256 {
+		return nil, fmt.Errorf("%s integrity check failed", ceremonyPhase1File)
+	}
+	if _, err := r.commons.ReadFrom(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("decode phase 1: %w", err)
+	}
+
+	// Check every file against the transcript before the slow part.
+	contributions := make([]*mpcsetup.Phase2, len(t.Contributions))
+	for i, c := range t.Contributions {
+		if contributions[i], _, err = readTranscriptPhase2(dir, c); err != nil {
+			return nil, err
+		}
+	}
+	start, err := phase2Start(ccs, r1csSum, &r.commons, t.Phase1SHA256)
+	if err != nil {
+		return nil, err
+	}
+	if sha256Hex(start.initial) != t.Contributions[0].SHA256 {
+		return nil, fmt.Errorf("initial parameters do not follow from phase 1")
+	}
+	r.evals = start.evals
+	prev := contributions[0]
+	for i, next := range contributions[1:] {
+		if err := prev.Verify(next); err != nil {
+			return nil, fmt.Errorf("contribution %d: %w", i+1, err)
+		}
+		prev = next
+	}
+	r.last = prev
+	return r, nil
+}
+
+// seal runs the final beacon contribution and returns the resulting keys.
+// It modifies r.last.
+func (r *ceremonyReplay) seal(beacon []byte) (*keySet, error) {
+	pk, vk := r.last.Seal(&r.commons, &r.evals, beacon)
+	return newKeySet(r.t.CircuitID, r.ccs, pk.(provingKey), vk.(verifyingKey))
+}
+
+// ceremonyCircuit compiles circuitID for Groth16 and returns it with the
+// SHA-256 of its encoding.
+func ceremonyCircuit(circuitID string) (*cs_bn254.R1CS, string, error) {
+	spec, err := lookupCircuit(circuitID)
+	if err != nil {
+		return nil, "", err
+	}
+	if spec.slots == 0 {
+		return nil, "", fmt.Errorf("%s can no longer be set up", circuitID)
+	}
+	ccs, err := compilePolicyGate(ProofSystemGroth16, spec.slots)
+	if err != nil {
+		return nil, "", err
+	}
+	r1cs, ok := ccs.(*cs_bn254.R1CS)
+	if !ok {
+		return nil, "", fmt.Errorf("unexpected constraint system %T", ccs)
+	}
+	var buf bytes.Buffer
+	if _, err := r1cs.WriteTo(&buf); err != nil {
+		return nil, "", err
+	}
+	return r1cs, sha256Hex(buf.Bytes()), nil
+}
+
+// phase2Init is the start of a phase-2 ceremony: the encoded initial
+// parameters and the circuit evaluations sealing needs.
+type phase2Init struct {
+	initial []byte
+	evals   mpcsetup.Phase2Evaluations
+}
+
+var (
+	phase2InitsMu sync.Mutex
+	phase2Inits   = map[string]*phase2Init{}
+)
+
+// phase2Start derives the start of a ceremony from the circuit and phase 1.
+// Phase2.Initialize takes about a minute even for the smallest circuit, so
+// the result is kept for the life of the process.
+func phase2Start(ccs *cs_bn254.R1CS, r1csSum string, commons *mpcsetup.SrsCommons, phase1Sum string) (*phase2Init, error) {
+	phase2InitsMu.Lock()
+	defer phase2InitsMu.Unlock()
+	key := r1csSum + "/" + phase1Sum
+	if start, ok := phase2Inits[key]; ok {
+		return start, nil
+	}
+	var p mpcsetup.Phase2
+	start := &phase2Init{evals: p.Initialize(ccs, commons)}
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("encode phase 2: %w", err)
+	}
+	start.initial = buf.Bytes()
+	phase2Inits[key] = start
+	return start, nil
+}
+
+// localPhase1 runs a one-party phase 1 and forgets its randomness.
+func localPhase1(domain uint64) (mpcsetup.SrsCommons, error) {
+	beacon := make([]byte, 32)
+	if _, err := rand.Read(beacon); err != nil {
+		return mpcsetup.SrsCommons{}, err
+	}
+	p := mpcsetup.NewPhase1(domain)
+	p.Contribute()
+	return p.Seal(beacon), nil
+}
+
+func readCeremony(dir string) (CeremonyTranscript, error) {
+	b, err := os.ReadFile(filepath.Join(dir, ceremonyFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return CeremonyTranscript{}, fmt.Errorf("no ceremony in %s", dir)
+		}
+		return CeremonyTranscript{}, err
+	}
+	var t CeremonyTranscript
+	if err := json.Unmarshal(b, &t); err != nil {
+		return CeremonyTranscript{}, fmt.Errorf("invalid ceremony transcript: %w", err)
+	}
+	if len(t.Contributions) == 0 {
+		return CeremonyTranscript{}, fmt.Errorf("ceremony transcript has no initial parameters")
+	}
+	for i, c := range t.Contributions {
+		if c.Index != i || c.File != phase2FileName(i) {
+			return CeremonyTranscript{}, fmt.Errorf("ceremony transcript entry %d is out of order", i)
+		}
+	}
+	return t, nil
+}
+
+// readTranscriptPhase2 reads the parameters c records and checks them
+// against its hash.
+func readTranscriptPhase2(dir string, c CeremonyContribution) (*mpcsetup.Phase2, []byte, error) {
+	p, raw, err := readPhase2(filepath.Join(dir, c.File))
+	if err != nil {
+		return nil, nil, err
+	}
+	if sha256Hex(raw) != c.SHA256 {
+		return nil, nil, fmt.Errorf("%s integrity check failed", c.File)
+	}
+	return p, raw, nil
+}
+
+func readPhase2(path string) (*mpcsetup.Phase2, []byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := new(mpcsetup.Phase2)
+	n, err := p.ReadFrom(bytes.NewReader(raw))
+	if err != nil || n != int64(len(raw)) {
+		return nil, nil, fmt.Errorf("%s is not phase-2 parameters", path)
+	}
+	return p, raw, nil
+}
+
+func writeEncoded(path string, v io.WriterTo) (string, error) {
+	var buf bytes.Buffer
+	if _, err := v.WriteTo(&buf); err != nil {
+		return "", fmt.Errorf("encode %s: %w", filepath.Base(path), err)
+	}
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return "", err
+	}
+	return sha256Hex(buf.Bytes()), nil
+}
+
+func phase2FileName(i int) string {
+	return fmt.Sprintf("phase2_%04d.bin", i)
+}
@@ -0,0 +1,151 @@
+package zk
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Phase2.Initialize is slow, so the ceremonies below share one phase 1.
+func TestCeremony(t *testing.T) {
+	skipUnlessGroth16(t)
+	dir := filepath.Join(t.TempDir(), "ceremony")
+	t.Run("keys prove and verify", func(t *testing.T) { testCeremonyKeys(t, dir) })
+	t.Run("bad contributions", func(t *testing.T) {
+		testCeremonyRejects(t, filepath.Join(dir, ceremonyPhase1File))
+	})
+}
+
+func testCeremonyKeys(t *testing.T, dir string) {
+	transcript, err := InitCeremony(dir, "", "")
+	if err != nil {
+		t.Fatalf("InitCeremony error: %v", err)
+	}
+	if !transcript.Phase1Local || transcript.CircuitID != defaultCircuitID() {
+		t.Fatalf("unexpected transcript %+v", transcript)
+	}
+	if _, err := InitCeremony(dir, "", ""); err == nil {
+		t.Fatalf("expected a second init in the same directory to fail")
+	}
+	keysDir := t.TempDir()
+	if _, err := FinalizeCeremony(dir, keysDir, []byte("beacon")); err == nil {
+		t.Fatalf("expected finalizing without contributions to fail")
+	}
+
+	// Two contributors, each building on the file the coordinator hands out.
+	out := t.TempDir()
+	for i, name := range []string{"alice", "bob"} {
+		transcript := mustReadCeremony(t, dir)
+		file := filepath.Join(out, name+".bin")
+		sum, err := ContributeCeremony(filepath.Join(dir, transcript.Last().File), file)
+		if err != nil {
+			t.Fatalf("ContributeCeremony error: %v", err)
+		}
+		c, err := AcceptContribution(dir, file, name)
+		if err != nil {
+			t.Fatalf("AcceptContribution(%s) error: %v", name, err)
+		}
+		if c.Index != i+1 || c.SHA256 != sum || c.Name != name {
+			t.Fatalf("unexpected contribution %+v", c)
+		}
+	}
+
+	info, err := FinalizeCeremony(dir, keysDir, []byte("drand round 1234"))
+	if err != nil {
+		t.Fatalf("FinalizeCeremony error: %v", err)
+	}
+	if info.System != ProofSystemGroth16 || info.Status != KeyStatusActive {
+		t.Fatalf("unexpected key %+v", info)
+	}
+	_, manifest, err := loadKeySet(keyVersionDir(keysDir, info.CircuitID, info.Version), false)
+	if err != nil {
+		t.Fatalf("loadKeySet error: %v", err)
+	}
+	if manifest.Ceremony != mustReadCeremony(t, dir).Contributions[2].SHA256 {
+		t.Fatalf("expected manifest to record the last contribution, got %q", manifest.Ceremony)
+	}
+	transcript, err = VerifyCeremony(dir)
+	if err != nil {
+		t.Fatalf("VerifyCeremony error: %v", err)
+	}
+	if transcript.Final == nil || transcript.Final.KeyID != info.KeyID {
+		t.Fatalf("expected the transcript to record the key, got %+v", transcript.Final)
+	}
+	if _, err := AcceptContribution(dir, filepath.Join(out, "bob.bin"), "late"); !errors.Is(err, ErrCeremonyFinalized) {
+		t.Fatalf("expected ErrCeremonyFinalized, got %v", err)
+	}
+
+	// The server loads the ceremony keys like any other version.
+	reg, err := openRegistry(keysDir)
+	if err != nil {
+		t.Fatalf("openRegistry error: %v", err)
+	}
+	proof, pi := proveWithRegistry(t, reg)
+	if proof.KeyID != info.KeyID {
+		t.Fatalf("expected proofs to use %s, got %s", info.KeyID, proof.KeyID)
+	}
+	assertVerifies(t, reg, proof, pi)
+}
+
+func testCeremonyRejects(t *testing.T, phase1File string) {
+	dir := filepath.Join(t.TempDir(), "ceremony")
+	transcript, err := InitCeremony(dir, "", phase1File)
+	if err != nil {
+		t.Fatalf("InitCeremony error: %v", err)
+	}
+	if transcript.Phase1Local {
+		t.Fatalf("expected phase 1 from %s", phase1File)
+	}
+	initial := filepath.Join(dir, phase2FileName(0))
+	out := t.TempDir()
+	first, second := filepath.Join(out, "first.bin"), filepath.Join(out, "second.bin")
+	if _, err := ContributeCeremony(initial, first); err != nil {
+		t.Fatalf("ContributeCeremony error: %v", err)
+	}
+	if _, err := ContributeCeremony(initial, second); err != nil {
+		t.Fatalf("ContributeCeremony error: %v", err)
+	}
+	if _, err := AcceptContribution(dir, initial, "replay"); err == nil {
+		t.Fatalf("expected the uncontributed initial parameters to be rejected")
+	}
+	if _, err := AcceptContribution(dir, first, "first"); err != nil {
+		t.Fatalf("AcceptContribution error: %v", err)
+	}
+	// second built on the initial parameters, not on first.
+	if _, err := AcceptContribution(dir, second, "second"); err == nil || !strings.Contains(err.Error(), "invalid contribution") {
+		t.Fatalf("expected a stale contribution to be rejected, got %v", err)
+	}
+	garbage := filepath.Join(out, "garbage.bin")
+	if err := os.WriteFile(garbage, []byte("not parameters"), 0o644); err != nil {
+		t.Fatalf("write garbage: %v", err)
+	}
+	if _, err := AcceptContribution(dir, garbage, "garbage"); err == nil {
+		t.Fatalf("expected garbage to be rejected")
+	}
+
+	// Swapping an accepted file for another breaks the transcript.
+	raw, err := os.ReadFile(second)
+	if err != nil {
+		t.Fatalf("read contribution: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, phase2FileName(1)), raw, 0o644); err != nil {
+		t.Fatalf("overwrite contribution: %v", err)
+	}
+	if _, err := VerifyCeremony(dir); err == nil || !strings.Contains(err.Error(), "integrity") {
+		t.Fatalf("expected VerifyCeremony to catch the swapped file, got %v", err)
+	}
+	if _, err := FinalizeCeremony(dir, t.TempDir(), []byte("beacon")); err == nil {
+		t.Fatalf("expected finalize to refuse a broken transcript")
+	}
+}
+
+func mustReadCeremony(t *testing.T, dir string) CeremonyTranscript {
+	t.Helper()
+	transcript, err := readCeremony(dir)
+	if err != nil {
+		t.Fatalf("readCeremony error: %v", err)
+	}
+	return transcript
+}
@@ -0,0 +1,198 @@
+package zk
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/consensys/gnark/frontend"
+
+	"noema/internal/zk/policyzk"
+)
+
+// policyGateCircuitFamily identifies the PolicyGateCircuit layout new keys
+// are generated for; each slot size is its own circuit (see
+// PolicyGateCircuitID). Bump it whenever the circuit's constraints or public
+// signals change, and keep the previous IDs in circuitSpecs so proofs made
+// with their keys still verify. v1 is the only earlier layout that was
+// released; v2 to v5 never were.
+const policyGateCircuitFamily = "noema_policy_gate_v6"
+
+// MaxPolicyConstraints is the largest number of constraints a policy can have.
+const MaxPolicyConstraints = policyzk.MaxSlots
+
+// PolicyGateCircuitID returns the circuit ID for the current layout compiled
+// with the given number of slots, e.g. "noema_policy_gate_v6_n8".
+func PolicyGateCircuitID(slots int) string {
+	return policyGateCircuitFamily + "_n" + strconv.Itoa(slots)
+}
+
+// policyGateV1CircuitID is the original circuit: six fixed constraints, an
+// unsalted commitment and no policy threshold or policy hash signals.
+const policyGateV1CircuitID = "noema_policy_gate_v1"
+
+// PolicyGatePublicSignals lists the current circuit's public signals in
+// witness order. They are the same for every slot size.
+var PolicyGatePublicSignals = []string{"commitment", "overall_pass", "max_severity", "policy_threshold", "policy_hash", "reveal_max_severity", "reveal_commitment", "evaluator_kind", "prompt_version"}
+
+// circuitSpec describes how to verify proofs for one circuit layout.
+type circuitSpec struct {
+	// slots is the compiled slot count of a current circuit. It is 0 for
+	// previous layouts, which can no longer be compiled or prove.
+	slots         int
+	publicSignals []string
+	// publicAssignment builds the public-only witness for verification.
+	publicAssignment func(pi PublicInputs) (frontend.Circuit, error)
+}
+
+func init() {
+	for _, n := range policyzk.SlotSizes {
+		circuitSpecs[PolicyGateCircuitID(n)] = circuitSpec{
+			slots:            n,
+			publicSignals:    PolicyGatePublicSignals,
+			publicAssignment: policyGatePublic,
+		}
+	}
+}
+
+var circuitSpecs = map[string]circuitSpec{
+	policyGateV1CircuitID: {
+		publicSignals:    []string{"commitment", "overall_pass", "max_severity"},
+		publicAssignment: policyGateV1Public,
+	},
+}
+
+func lookupCircuit(circuitID string) (circuitSpec, error) {
+	spec, ok := circuitSpecs[circuitID]
+	if !ok {
+		return circuitSpec{}, fmt.Errorf("unsupported circuit %q", circuitID)
+	}
+	return spec, nil
+}
+
+// isCurrentCircuit reports whether circuitID is one of the sizes new proofs
+// are made with.
+func isCurrentCircuit(circuitID string) bool {
+	spec, ok := circuitSpecs[circuitID]
+	return ok && spec.slots > 0
+}
+
+// defaultCircuitID is the smallest current circuit. It is the one set up
+// first and the one used when a request doesn't say which key it wants.
+func defaultCircuitID() string {
+	return PolicyGateCircuitID(policyzk.SlotSizes[0])
+}
+
+// circuitSlots returns the smallest slot size that fits n constraints.
+func circuitSlots(n int) (int, error) {
+	for _, size := range policyzk.SlotSizes {
+		if n <= size {
+			return size, nil
+		}
+	}
+	return 0, fmt.Errorf("policy has %d constraints; at most %d are supported", n, MaxPolicyConstraints)
+}
+
+// policyGatePublic builds the public witness for the current circuits.
+// Hidden outputs are masked to zero, matching what the prover assigned.
+func policyGatePublic(pi PublicInputs) (frontend.Circuit, error) {
+	if pi.EvaluatorKind == "" {
+		return nil, fmt.Errorf("missing evaluator kind")
+	}
+	kind, err := evaluatorKindField(pi.EvaluatorKind)
+	if err != nil {
+		return nil, err
+	}
+	promptVersion, err := promptVersionField(pi.PromptVersion)
+	if err != nil {
+		return nil, err
+	}
+	policyHash, err := parsePolicyHash(pi.PolicyHash)
+	if err != nil {
+		return nil, err
+	}
+	assignment := &policyzk.PolicyGateCircuit{
+		Commitment:        0,
+		OverallPass:       boolToInt(pi.OverallPass),
+		MaxSeverity:       0,
+		PolicyThreshold:   pi.PolicyThreshold,
+		PolicyHash:        policyHash,
+		RevealMaxSeverity: boolToInt(!pi.HideMaxSeverity),
+		RevealCommitment:  boolToInt(!pi.HideCommitment),
+		EvaluatorKind:     kind,
+		PromptVersion:     promptVersion,
+	}
+	if !pi.HideMaxSeverity {
+		assignment.MaxSeverity = pi.MaxSeverity
+	}
+	if !pi.HideCommitment {
+		commitment, err := parseCommitmentHex(pi.Commitment)
+		if err != nil {
+			return nil, err
+		}
+		assignment.Commitment = commitment
+	}
+	return assignment, nil
+}
+
+func parsePolicyHash(hexStr string) (*big.Int, error) {
+	if hexStr == "" {
+		return nil, fmt.Errorf("missing policy hash")
+	}
+	policyHash, err := parseCanonicalFieldHex(hexStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy hash")
+	}
+	return policyHash, nil
+}
+
+// requireFullDisclosure rejects public inputs that hide outputs a circuit
+// without reveal flags always exposes.
+func requireFullDisclosure(circuitID string, pi PublicInputs) error {
+	if pi.HideMaxSeverity || pi.HideCommitment {
+		return fmt.Errorf("proofs for %s must disclose max severity and commitment", circuitID)
+	}
+	return nil
+}
+
+// rejectProvenance rejects public inputs that claim evaluator provenance a
+// circuit from before it was bound can't prove.
+func rejectProvenance(circuitID string, pi PublicInputs) error {
+	if pi.EvaluatorKind != "" || pi.PromptVersion != "" {
+		return fmt.Errorf("evaluator provenance is not bound by %s", circuitID)
+	}
+	return nil
+}
+
+// policyGateV1Assignment mirrors the public signals of noema_policy_gate_v1.
+// It is only used to build public witnesses; the circuit itself is gone.
+type policyGateV1Assignment struct {
+	Commitment  frontend.Variable `gnark:",public"`
+	OverallPass frontend.Variable `gnark:",public"`
+	MaxSeverity frontend.Variable `gnark:",public"`
+}
+
+func (*policyGateV1Assignment) Define(frontend.API) error {
+	return fmt.Errorf("%s can no longer be compiled", policyGateV1CircuitID)
+}
+
+func policyGateV1Public(pi PublicInputs) (frontend.Circuit, error) {
+	if err := requireFullDisclosure(policyGateV1CircuitID, pi); err != nil {
+		return nil, err
+	}
+	if err := rejectProvenance(policyGateV1CircuitID, pi); err != nil {
+		return nil, err
+	}
+	commitment, err := parseCommitmentHex(pi.Commitment)
+	if err != nil {
+		return nil, err
+	}
+	if pi.PolicyHash != "" {
+		return nil, fmt.Errorf("policy hash is not bound by %s", policyGateV1CircuitID)
+	}
+	return &policyGateV1Assignment{
+		Commitment:  commitment,
+		OverallPass: boolToInt(pi.OverallPass),
+		MaxSeverity: pi.MaxSeverity,
+	}, nil
+}
@@ -0,0 +1,32 @@
+//go:build !unix
+
+package zk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockKeyDir takes the exclusive lock on the key directory dir, waiting for
+// other processes and goroutines to release it. Without flock the lock is a
+// file of its own; one left behind by a crash has to be removed by hand.
+func lockKeyDir(dir string) (unlock func(), err error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, lockFile)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_ = f.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("lock key directory: %w", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,318 @@
+package zk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/plonk"
+	plonk_bn254 "github.com/consensys/gnark/backend/plonk/bn254"
+	"github.com/consensys/gnark/backend/solidity"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/frontend/cs/scs"
+
+	"noema/internal/zk/policyzk"
+)
+
+const (
+	keyManifestFile  = "manifest.json"
+	r1csFile         = "policy_gate.r1cs"
+	scsFile          = "policy_gate.scs"
+	provingKeyFile   = "policy_gate.pk"
+	verifyingKeyFile = "policy_gate.vk"
+)
+
+// ErrKeysNotFound is returned when a key directory has no manifest.
+var ErrKeysNotFound = errors.New("zk keys not found")
+
+// KeyManifest describes a persisted key set and the SHA-256 of each artifact.
+// For PLONK keys R1CSSHA256 covers the sparse constraint system, and SRS
+// records the KZG SRS the keys were set up with: "local" for one generated
+// on the spot, otherwise the SHA-256 of the SRS file. Ceremony is set for
+// Groth16 keys from a phase-2 ceremony: the SHA-256 of its last
+// contribution, which chains to every earlier one.
+type KeyManifest struct {
+	KeyID              string `json:"key_id,omitempty"`
+	Version            int    `json:"version,omitempty"`
+	CircuitID          string `json:"circuit_id"`
+	System             string `json:"system"`
+	Curve              string `json:"curve"`
+	CreatedAt          string `json:"created_at"`
+	R1CSSHA256         string `json:"r1cs_sha256"`
+	ProvingKeySHA256   string `json:"proving_key_sha256"`
+	VerifyingKeySHA256 string `json:"verifying_key_sha256"`
+	VKFingerprint      string `json:"vk_fingerprint"`
+	SRS                string `json:"srs,omitempty"`
+	Ceremony           string `json:"ceremony,omitempty"`
+}
+
+// provingKey and verifyingKey are what the Groth16 and PLONK keys have in
+// common.
+type provingKey interface {
+	io.WriterTo
+	io.ReaderFrom
+}
+
+type verifyingKey interface {
+	io.WriterTo
+	io.ReaderFrom
+	solidity.VerifyingKey
+}
+
+// keySet holds the compiled circuit and its key pair for one proof system.
+type keySet struct {
+	system      string
+	circuitID   string
+	ccs         constraint.ConstraintSystem
+	pk          provingKey // nil when the keys only verify
+	vk          verifyingKey
+	fingerprint string
+	srs         string // see KeyManifest.SRS
+	ceremony    string // see KeyManifest.Ceremony
+}
+
+func newKeySet(circuitID string, ccs constraint.ConstraintSystem, pk provingKey, vk verifyingKey) (*keySet, error) {
+	var system string
+	switch vk.(type) {
+	case *groth16_bn254.VerifyingKey:
+		system = ProofSystemGroth16
+	case *plonk_bn254.VerifyingKey:
+		system = ProofSystemPlonk
+	default:
+		return nil, fmt.Errorf("unsupported verifying key type %T", vk)
+	}
+	raw, err := serializeVK(vk)
+	if err != nil {
+		return nil, err
+	}
+	return &keySet{system: system, circuitID: circuitID, ccs: ccs, pk: pk, vk: vk, fingerprint: VKFingerprint(circuitID, raw)}, nil
+}
+
+// compilePolicyGate compiles the circuit as R1CS for Groth16, or as a sparse
+// constraint system for PLONK.
+func compilePolicyGate(system string, slots int) (constraint.ConstraintSystem, error) {
+	if system == ProofSystemPlonk {
+		return frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, policyzk.NewPolicyGateCircuit(slots))
+	}
+	return frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, policyzk.NewPolicyGateCircuit(slots))
+}
+
+// setupKeySet compiles a current circuit and runs a fresh setup for it with
+// the selected backend.
+func setupKeySet(circuitID string) (*keySet, error) {
+	spec, err := lookupCircuit(circuitID)
+	if err != nil {
+		return nil, err
+	}
+	if spec.slots == 0 {
+		return nil, fmt.Errorf("%s can no longer be set up", circuitID)
+	}
+	b := currentBackend()
+	ccs, err := compilePolicyGate(b.System, spec.slots)
+	if err != nil {
+		return nil, err
+	}
+	if b.System != ProofSystemPlonk {
+		pk, vk, err := groth16.Setup(ccs)
+		if err != nil {
+			return nil, err
+		}
+		return newKeySet(circuitID, ccs, pk, vk)
+	}
+	canonical, lagrange, srs, err := kzgSRS(ccs, b.SRSFile)
+	if err != nil {
+		return nil, err
+	}
+	pk, vk, err := plonk.Setup(ccs, canonical, lagrange)
+	if err != nil {
+		return nil, err
+	}
+	ks, err := newKeySet(circuitID, ccs, pk, vk)
+	if err != nil {
+		return nil, err
+	}
+	ks.srs = srs
+	return ks, nil
+}
+
+// csFile is the file a key set's constraint system is saved in.
+func csFile(system string) string {
+	if system == ProofSystemPlonk {
+		return scsFile
+	}
+	return r1csFile
+}
+
+func saveKeySet(dir string, ks *keySet, version int) (KeyManifest, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return KeyManifest{}, err
+	}
+	manifest := KeyManifest{
+		KeyID:         FormatKeyID(ks.circuitID, version),
+		Version:       version,
+		CircuitID:     ks.circuitID,
+		System:        ks.system,
+		Curve:         ProofCurve,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+		VKFingerprint: ks.fingerprint,
+		SRS:           ks.srs,
+		Ceremony:      ks.ceremony,
+	}
+	artifacts := []struct {
+		name string
+		src  io.WriterTo
+		sum  *string
+	}{
+		{csFile(ks.system), ks.ccs, &manifest.R1CSSHA256},
+		{provingKeyFile, ks.pk, &manifest.ProvingKeySHA256},
+		{verifyingKeyFile, ks.vk, &manifest.VerifyingKeySHA256},
+	}
+	for _, a := range artifacts {
+		var buf bytes.Buffer
+		if _, err := a.src.WriteTo(&buf); err != nil {
+			return KeyManifest{}, fmt.Errorf("encode %s: %w", a.name, err)
+		}
+		if err := writeFileAtomic(filepath.Join(dir, a.name), buf.Bytes()); err != nil {
+			return KeyManifest{}, err
+		}
+		*a.sum = sha256Hex(buf.Bytes())
+	}
+	// The manifest is written last so a partial write never looks like a valid key set.
+	if err := writeJSONAtomic(filepath.Join(dir, keyManifestFile), manifest); err != nil {
+		return KeyManifest{}, err
+	}
+	return manifest, nil
+}
+
+// loadKeySet reads the key set in dir. The proving key is skipped unless
+// withPK is set, since retired keys are only ever used for verification.
+func loadKeySet(dir string, withPK bool) (*keySet, KeyManifest, error) {
+	b, err := os.ReadFile(filepath.Join(dir, keyManifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, KeyManifest{}, ErrKeysNotFound
+		}
+		return nil, KeyManifest{}, err
+	}
+	var manifest KeyManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, KeyManifest{}, fmt.Errorf("invalid key manifest: %w", err)
+	}
+	if _, err := lookupCircuit(manifest.CircuitID); err != nil {
+		return nil, KeyManifest{}, err
+	}
+	if manifest.System == "" {
+		manifest.System = ProofSystemGroth16
+	}
+	if (manifest.System != ProofSystemGroth16 && manifest.System != ProofSystemPlonk) || manifest.Curve != ProofCurve {
+		return nil, KeyManifest{}, fmt.Errorf("keys use %s/%s, expected %s or %s on %s", manifest.System, manifest.Curve, ProofSystemGroth16, ProofSystemPlonk, ProofCurve)
+	}
+
+	var (
+		ccs constraint.ConstraintSystem
+		pk  provingKey
+		vk  verifyingKey
+	)
+	if manifest.System == ProofSystemPlonk {
+		ccs, vk = plonk.NewCS(ecc.BN254), plonk.NewVerifyingKey(ecc.BN254)
+		if withPK {
+			pk = plonk.NewProvingKey(ecc.BN254)
+		}
+	} else {
+		ccs, vk = groth16.NewCS(ecc.BN254), groth16.NewVerifyingKey(ecc.BN254)
+		if withPK {
+			pk = groth16.NewProvingKey(ecc.BN254)
+		}
+	}
+	type artifact struct {
+		name string
+		dst  io.ReaderFrom
+		sum  string
+	}
+	artifacts := []artifact{
+		{csFile(manifest.System), ccs, manifest.R1CSSHA256},
+		{verifyingKeyFile, vk, manifest.VerifyingKeySHA256},
+	}
+	if withPK {
+		artifacts = append(artifacts, artifact{provingKeyFile, pk, manifest.ProvingKeySHA256})
+	}
+	for _, a := range artifacts {
+		raw, err := os.ReadFile(filepath.Join(dir, a.name))
+		if err != nil {
+			return nil, KeyManifest{}, err
+		}
+		if got := sha256Hex(raw); got != a.sum {
+			return nil, KeyManifest{}, fmt.Errorf("%s integrity check failed", a.name)
+		}
+		if _, err := a.dst.ReadFrom(bytes.NewReader(raw)); err != nil {
+			return nil, KeyManifest{}, fmt.Errorf("decode %s: %w", a.name, err)
+		}
+	}
+	// R1CS counts the constant one wire as a public variable; the sparse
+	// constraint system doesn't.
+	wantPublic := vk.NbPublicWitness() + 1
+	if manifest.System == ProofSystemPlonk {
+		wantPublic = vk.NbPublicWitness()
+	}
+	if ccs.GetNbPublicVariables() != wantPublic {
+		return nil, KeyManifest{}, fmt.Errorf("verifying key does not match circuit")
+	}
+	ks, err := newKeySet(manifest.CircuitID, ccs, pk, vk)
+	if err != nil {
+		return nil, KeyManifest{}, err
+	}
+	ks.srs, ks.ceremony = manifest.SRS, manifest.Ceremony
+	if manifest.VKFingerprint != "" && manifest.VKFingerprint != ks.fingerprint {
+		return nil, KeyManifest{}, fmt.Errorf("verifying key fingerprint mismatch")
+	}
+	return ks, manifest, nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp for %s: %w", path, err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("sync %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", path, err)
+	}
+	if err := os.Chmod(tmpName, 0o644); err != nil {
+		return fmt.Errorf("chmod %s: %w", path, err)
+	}
+	return os.Rename(tmpName, path)
+}
+
+func writeJSONAtomic(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
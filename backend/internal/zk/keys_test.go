@@ -0,0 +1,440 @@
+package zk
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"noema/internal/zk/policyzk"
+)
+
+func TestKeysPersistAcrossReload(t *testing.T) {
+	dir := t.TempDir()
+	info, err := addKeyVersion(dir, defaultCircuitID())
+	if err != nil {
+		t.Fatalf("addKeyVersion error: %v", err)
+	}
+	if info.KeyID != FormatKeyID(defaultCircuitID(), 1) || info.Status != KeyStatusActive {
+		t.Fatalf("unexpected first key %+v", info)
+	}
+
+	// Prove with one load of the keys and verify with another, as a restarted server would.
+	prover, err := openRegistry(dir)
+	if err != nil {
+		t.Fatalf("openRegistry error: %v", err)
+	}
+	verifier, err := openRegistry(dir)
+	if err != nil {
+		t.Fatalf("openRegistry error: %v", err)
+	}
+	proof, pi := proveWithRegistry(t, prover)
+	if proof.KeyID != info.KeyID || proof.VKFingerprint != info.VKFingerprint {
+		t.Fatalf("expected proof to carry key %s, got %s", info.KeyID, proof.KeyID)
+	}
+	assertVerifies(t, verifier, proof, pi)
+}
+
+func TestRetiredKeyVerifiesButRefusesToProve(t *testing.T) {
+	dir := t.TempDir()
+	first, err := addKeyVersion(dir, defaultCircuitID())
+	if err != nil {
+		t.Fatalf("addKeyVersion error: %v", err)
+	}
+	reg, err := openRegistry(dir)
+	if err != nil {
+		t.Fatalf("openRegistry error: %v", err)
+	}
+	oldProof, oldPI := proveWithRegistry(t, reg)
+
+	second, err := addKeyVersion(dir, defaultCircuitID())
+	if err != nil {
+		t.Fatalf("addKeyVersion error: %v", err)
+	}
+	if second.Version != 2 || second.VKFingerprint == first.VKFingerprint {
+		t.Fatalf("expected a fresh second key version, got %+v", second)
+	}
+	if _, err := RetireKey(dir, first.KeyID); err != nil {
+		t.Fatalf("RetireKey error: %v", err)
+	}
+	if _, err := RetireKey(dir, first.KeyID); err == nil {
+		t.Fatalf("expected error retiring an already retired key")
+	}
+	if _, err := RetireKey(dir, second.KeyID); err == nil || !strings.Contains(err.Error(), "last active") {
+		t.Fatalf("expected the last active key to stay active, got %v", err)
+	}
+
+	reg, err = openRegistry(dir)
+	if err != nil {
+		t.Fatalf("openRegistry error: %v", err)
+	}
+	if _, err := reg.forProving(PublicInputs{KeyID: first.KeyID, Witness: testWitnessInputs()}); !errors.Is(err, ErrKeyRetired) {
+		t.Fatalf("expected ErrKeyRetired, got %v", err)
+	}
+	assertVerifies(t, reg, oldProof, oldPI)
+
+	newProof, newPI := proveWithRegistry(t, reg)
+	if newProof.KeyID != second.KeyID {
+		t.Fatalf("expected new proofs to use %s, got %s", second.KeyID, newProof.KeyID)
+	}
+	assertVerifies(t, reg, newProof, newPI)
+}
+
+func TestCircuitUpgradeRetiresOldCircuitKeys(t *testing.T) {
+	dir := t.TempDir()
+	// Stand in for keys made for the previous circuit layout.
+	ks, err := setupKeySet(defaultCircuitID())
+	if err != nil {
+		t.Fatalf("setupKeySet error: %v", err)
+	}
+	old, err := newKeySet(policyGateV1CircuitID, ks.ccs, ks.pk, ks.vk)
+	if err != nil {
+		t.Fatalf("newKeySet error: %v", err)
+	}
+	manifest, err := saveKeySet(keyVersionDir(dir, policyGateV1CircuitID, 1), old, 1)
+	if err != nil {
+		t.Fatalf("saveKeySet error: %v", err)
+	}
+	oldInfo := KeyInfo{
+		KeyID:         manifest.KeyID,
+		CircuitID:     policyGateV1CircuitID,
+		System:        old.system,
+		Version:       1,
+		Status:        KeyStatusActive,
+		VKFingerprint: manifest.VKFingerprint,
+		CreatedAt:     manifest.CreatedAt,
+	}
+	if err := writeRegistry(dir, registryDoc{Keys: []KeyInfo{oldInfo}}); err != nil {
+		t.Fatalf("writeRegistry error: %v", err)
+	}
+
+	reg, err := openRegistry(dir)
+	if err != nil {
+		t.Fatalf("openRegistry error: %v", err)
+	}
+	signer, err := reg.signer(defaultCircuitID())
+	if err != nil {
+		t.Fatalf("signer error: %v", err)
+	}
+	if signer.info.CircuitID != defaultCircuitID() || signer.info.Version != 1 {
+		t.Fatalf("expected a first key for %s, got %+v", defaultCircuitID(), signer.info)
+	}
+	e := reg.byID(oldInfo.KeyID)
+	if e == nil || e.info.Status != KeyStatusRetired || e.ks.pk != nil {
+		t.Fatalf("expected old circuit key to be loaded verify-only")
+	}
+	if _, err := reg.forProving(PublicInputs{KeyID: oldInfo.KeyID, Witness: testWitnessInputs()}); !errors.Is(err, ErrKeyRetired) {
+		t.Fatalf("expected ErrKeyRetired, got %v", err)
+	}
+}
+
+func TestConcurrentKeySetupsGetTheirOwnVersions(t *testing.T) {
+	dir := t.TempDir()
+	// A setup that died before registering its key left this behind.
+	stale := keyVersionDir(dir, defaultCircuitID(), 1)
+	if err := os.MkdirAll(stale, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(stale, "partial"), []byte("x"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	results := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := addKeyVersion(dir, defaultCircuitID())
+			results <- err
+		}()
+	}
+	for range 2 {
+		if err := <-results; err != nil {
+			t.Fatalf("addKeyVersion error: %v", err)
+		}
+	}
+	keys, err := ListKeys(dir)
+	if err != nil {
+		t.Fatalf("ListKeys error: %v", err)
+	}
+	if len(keys) != 2 || keys[0].Version != 2 || keys[1].Version != 3 || keys[0].VKFingerprint == keys[1].VKFingerprint {
+		t.Fatalf("expected versions 2 and 3 with distinct keys, got %+v", keys)
+	}
+	if _, err := os.Stat(filepath.Join(stale, "partial")); err != nil {
+		t.Fatalf("expected the unregistered directory to be left alone: %v", err)
+	}
+	if _, err := openRegistry(dir); err != nil {
+		t.Fatalf("openRegistry error: %v", err)
+	}
+}
+
+func TestGenerateKeysFillsMissingSizes(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := addKeyVersion(dir, defaultCircuitID()); err != nil {
+		t.Fatalf("addKeyVersion error: %v", err)
+	}
+	created, err := GenerateKeys(dir)
+	if err != nil {
+		t.Fatalf("GenerateKeys error: %v", err)
+	}
+	if len(created) != len(policyzk.SlotSizes)-1 {
+		t.Fatalf("expected keys for the remaining sizes, got %+v", created)
+	}
+	for _, info := range created {
+		if info.CircuitID == defaultCircuitID() || !isCurrentCircuit(info.CircuitID) {
+			t.Fatalf("unexpected key %+v", info)
+		}
+	}
+	if _, err := GenerateKeys(dir); err == nil {
+		t.Fatalf("expected error when keys already exist")
+	}
+}
+
+func TestRegistrySetsUpLargerCircuitOnDemand(t *testing.T) {
+	dir := t.TempDir()
+	reg, err := openRegistry(dir)
+	if err != nil {
+		t.Fatalf("openRegistry error: %v", err)
+	}
+	witness := testWitnessInputs()
+	for i := 0; i < 4; i++ {
+		witness.ConstraintIDs = append(witness.ConstraintIDs, fmt.Sprintf("custom_%d", i))
+		witness.Enabled = append(witness.Enabled, 1)
+		witness.MaxAllowed = append(witness.MaxAllowed, 2)
+		witness.Severity = append(witness.Severity, 1)
+	}
+	commitment, err := CommitmentPoseidon(witness)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	pi := PublicInputs{MaxSeverity: 2, OverallPass: true, Commitment: commitment, Witness: witness}
+	e, err := reg.forProving(pi)
+	if err != nil {
+		t.Fatalf("forProving error: %v", err)
+	}
+	if e.info.CircuitID != PolicyGateCircuitID(16) {
+		t.Fatalf("expected the 16-slot circuit for 10 constraints, got %s", e.info.CircuitID)
+	}
+	proof, err := proveWithKey(e, pi)
+	if err != nil {
+		t.Fatalf("proveWithKey error: %v", err)
+	}
+	if proof.CircuitID != e.info.CircuitID {
+		t.Fatalf("expected proof for %s, got %s", e.info.CircuitID, proof.CircuitID)
+	}
+
+	// The new key was saved, so a restarted server verifies with it.
+	reloaded, err := openRegistry(dir)
+	if err != nil {
+		t.Fatalf("openRegistry error: %v", err)
+	}
+	decoded, err := DecodePublicInputsB64(proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("DecodePublicInputsB64 error: %v", err)
+	}
+	assertVerifies(t, reloaded, proof, decoded)
+
+	// A key for another size can't prove this policy.
+	small, err := reg.signer(defaultCircuitID())
+	if err != nil {
+		t.Fatalf("signer error: %v", err)
+	}
+	pi.KeyID = small.info.KeyID
+	if _, err := reg.forProving(pi); err == nil {
+		t.Fatalf("expected a key for another circuit size to be refused")
+	}
+}
+
+func TestLoadKeysDetectsTampering(t *testing.T) {
+	dir := t.TempDir()
+	info, err := addKeyVersion(dir, defaultCircuitID())
+	if err != nil {
+		t.Fatalf("addKeyVersion error: %v", err)
+	}
+	vkPath := filepath.Join(keyVersionDir(dir, info.CircuitID, info.Version), verifyingKeyFile)
+	raw, err := os.ReadFile(vkPath)
+	if err != nil {
+		t.Fatalf("read vk: %v", err)
+	}
+	raw[len(raw)-1] ^= 0xff
+	if err := os.WriteFile(vkPath, raw, 0o644); err != nil {
+		t.Fatalf("write vk: %v", err)
+	}
+	_, err = openRegistry(dir)
+	if err == nil || !strings.Contains(err.Error(), "integrity check failed") {
+		t.Fatalf("expected integrity error, got %v", err)
+	}
+}
+
+func TestLoadKeysMissingDir(t *testing.T) {
+	_, _, err := loadKeySet(filepath.Join(t.TempDir(), "missing"), true)
+	if err != ErrKeysNotFound {
+		t.Fatalf("expected ErrKeysNotFound, got %v", err)
+	}
+}
+
+// legacyGateCircuit has the public signals of noema_policy_gate_v1, in the
+// same order, so keys set up for it stand in for the noema_policy_gate_v1 key.
+type legacyGateCircuit struct {
+	Commitment  frontend.Variable `gnark:",public"`
+	OverallPass frontend.Variable `gnark:",public"`
+	MaxSeverity frontend.Variable `gnark:",public"`
+	Opening     frontend.Variable
+}
+
+func (c *legacyGateCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(c.Opening, c.Commitment)
+	api.AssertIsBoolean(c.OverallPass)
+	api.AssertIsLessOrEqual(c.MaxSeverity, 2)
+	return nil
+}
+
+func TestLegacyProofsVerify(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &legacyGateCircuit{})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	ks, err := newKeySet(policyGateV1CircuitID, ccs, pk, vk)
+	if err != nil {
+		t.Fatalf("newKeySet error: %v", err)
+	}
+	dir := t.TempDir()
+	manifest, err := saveKeySet(keyVersionDir(dir, policyGateV1CircuitID, 1), ks, 1)
+	if err != nil {
+		t.Fatalf("saveKeySet error: %v", err)
+	}
+	if err := writeRegistry(dir, registryDoc{Keys: []KeyInfo{{
+		KeyID:         manifest.KeyID,
+		CircuitID:     policyGateV1CircuitID,
+		System:        ks.system,
+		Version:       1,
+		Status:        KeyStatusActive,
+		VKFingerprint: manifest.VKFingerprint,
+		CreatedAt:     manifest.CreatedAt,
+	}}}); err != nil {
+		t.Fatalf("writeRegistry error: %v", err)
+	}
+
+	commitment := "0x" + strings.Repeat("0b", 32)
+	c, err := parseCommitmentHex(commitment)
+	if err != nil {
+		t.Fatalf("parseCommitmentHex error: %v", err)
+	}
+	w, err := frontend.NewWitness(&legacyGateCircuit{Commitment: c, OverallPass: 1, MaxSeverity: 2, Opening: c}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatalf("witness: %v", err)
+	}
+	proof, err := groth16.Prove(ccs, pk, w)
+	if err != nil {
+		t.Fatalf("prove: %v", err)
+	}
+	var proofRaw bytes.Buffer
+	if _, err := proof.WriteTo(&proofRaw); err != nil {
+		t.Fatalf("encode proof: %v", err)
+	}
+	proofB64 := base64.StdEncoding.EncodeToString(proofRaw.Bytes())
+
+	keysMu.Lock()
+	prev := registry
+	registry = nil
+	keysMu.Unlock()
+	t.Cleanup(func() {
+		keysMu.Lock()
+		registry = prev
+		keysMu.Unlock()
+	})
+	if err := Init(dir); err != nil {
+		t.Fatalf("Init error: %v", err)
+	}
+
+	// Public inputs as noema wrote them before keys were versioned.
+	pub := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(publicInputsPrefix + s))
+	}
+	ok, msg, err := VerifyProof(proofB64, pub("pt=1|ms=2|op=1|c="+commitment))
+	if err != nil || !ok {
+		t.Fatalf("expected the legacy proof to verify, got %v %q %v", ok, msg, err)
+	}
+	key, err := KeyForPublicInputs(pub("pt=1|ms=2|op=1|c=" + commitment))
+	if err != nil || key.KeyID != FormatKeyID(policyGateV1CircuitID, 1) {
+		t.Fatalf("expected the legacy key, got %+v %v", key, err)
+	}
+	if ok, _, _ := VerifyProof(proofB64, pub("pt=1|ms=1|op=1|c="+commitment)); ok {
+		t.Fatalf("expected the legacy proof to fail for a different max severity")
+	}
+}
+
+func TestParseKeyID(t *testing.T) {
+	circuitID, version, err := ParseKeyID("noema_policy_gate_v1.k12")
+	if err != nil || circuitID != "noema_policy_gate_v1" || version != 12 {
+		t.Fatalf("unexpected parse result %q %d %v", circuitID, version, err)
+	}
+	for _, bad := range []string{"", "noema", ".k1", "noema.k0", "noema.k01", "noema.kx", "noema|x.k1"} {
+		if _, _, err := ParseKeyID(bad); err == nil {
+			t.Fatalf("expected error for key id %q", bad)
+		}
+	}
+}
+
+func proveWithRegistry(t *testing.T, reg *keyRegistry) (Proof, PublicInputs) {
+	t.Helper()
+	witness := testWitnessInputs()
+	commitment, err := CommitmentPoseidon(witness)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	pi := PublicInputs{
+		PolicyThreshold: 0,
+		MaxSeverity:     2,
+		OverallPass:     true,
+		Commitment:      commitment,
+		Witness:         witness,
+	}
+	e, err := reg.forProving(pi)
+	if err != nil {
+		t.Fatalf("forProving error: %v", err)
+	}
+	proof, err := proveWithKey(e, pi)
+	if err != nil {
+		t.Fatalf("proveWithKey error: %v", err)
+	}
+	pub, err := base64.StdEncoding.DecodeString(proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("decode public inputs: %v", err)
+	}
+	pi, err = DecodePublicInputs(pub)
+	if err != nil {
+		t.Fatalf("DecodePublicInputs error: %v", err)
+	}
+	return proof, pi
+}
+
+func assertVerifies(t *testing.T, reg *keyRegistry, proof Proof, pi PublicInputs) {
+	t.Helper()
+	proofRaw, err := base64.StdEncoding.DecodeString(proof.ProofB64)
+	if err != nil {
+		t.Fatalf("decode proof: %v", err)
+	}
+	e, err := reg.forVerifying(pi)
+	if err != nil {
+		t.Fatalf("forVerifying error: %v", err)
+	}
+	ok, msg, err := verifyWithKey(e, proofRaw, pi)
+	if err != nil {
+		t.Fatalf("verifyWithKey error: %v", err)
+	}
+	if !ok {
+		t.Fatalf("expected proof to verify with key %s, got %q", e.info.KeyID, msg)
+	}
+}
@@ -0,0 +1,232 @@
+package zk
+
+import (
+	"fmt"
+
+	"noema/internal/sampling"
+)
+
+// CommitmentOpening is the preimage of a run's commitment: the dataset
+// digest, the policy and the severities behind it, and the salt that blinds
+// it. Handing it to an auditor lets them recompute the published commitment;
+// without the salt nobody else can.
+type CommitmentOpening struct {
+	Version       int    `json:"version"`
+	Salt          string `json:"salt,omitempty"`
+	DatasetDigest string `json:"dataset_digest"`
+	// ConstraintIDs is only part of V5 openings; V1 openings cover the six
+	// preset constraints in a fixed order.
+	ConstraintIDs []string `json:"constraint_ids,omitempty"`
+	Enabled       []uint64 `json:"enabled"`
+	MaxAllowed    []uint64 `json:"max_allowed"`
+	Severity      []uint64 `json:"severity"`
+	// Sample is part of V5 openings when the evaluator saw a sample: the
+	// items of the dataset the evaluator was given, which the commitment
+	// binds with the digest.
+	Sample *sampling.Sample `json:"sample,omitempty"`
+	// Provenance is only part of V5 openings.
+	Provenance *Provenance `json:"provenance,omitempty"`
+}
+
+// Commitment recomputes the commitment o opens, using the layout of its version.
+func (o CommitmentOpening) Commitment() (string, error) {
+	switch o.Version {
+	case CommitmentVersionV5:
+		w, err := o.Witness()
+		if err != nil {
+			return "", err
+		}
+		return CommitmentPoseidon(w)
+	case CommitmentVersionV1:
+		if o.Salt != "" || o.ConstraintIDs != nil || o.Sample != nil || o.Provenance != nil {
+			return "", fmt.Errorf("version 1 commitments bind no salt, constraint IDs, sample or provenance")
+		}
+		return CommitmentPoseidonV1(o.DatasetDigest, o.Enabled, o.MaxAllowed, o.Severity)
+	default:
+		return "", fmt.Errorf("unsupported commitment version %d", o.Version)
+	}
+}
+
+// PolicyHash recomputes the policy hash a proof over o binds. Only V5
+// openings have one: noema_policy_gate_v1 proofs bind no policy hash.
+func (o CommitmentOpening) PolicyHash() (string, error) {
+	if o.Version != CommitmentVersionV5 {
+		return "", fmt.Errorf("version %d commitments have no policy hash", o.Version)
+	}
+	w, err := o.Witness()
+	if err != nil {
+		return "", err
+	}
+	return PolicyHashPoseidon(w)
+}
+
+// Witness returns the circuit inputs a V5 opening opens. When o binds a
+// sample it checks that the sample is the one the digest and seed yield.
+func (o CommitmentOpening) Witness() (*WitnessInputs, error) {
+	if o.Version != CommitmentVersionV5 {
+		return nil, fmt.Errorf("version %d openings can't be proved", o.Version)
+	}
+	if o.Provenance == nil {
+		return nil, fmt.Errorf("version 5 openings need evaluator provenance")
+	}
+	digest := o.DatasetDigest
+	if o.Sample != nil {
+		binding, err := sampling.Binding(o.DatasetDigest, *o.Sample)
+		if err != nil {
+			return nil, err
+		}
+		digest = binding
+	}
+	return &WitnessInputs{
+		Salt:             o.Salt,
+		DatasetDigestHex: digest,
+		ConstraintIDs:    o.ConstraintIDs,
+		Enabled:          o.Enabled,
+		MaxAllowed:       o.MaxAllowed,
+		Severity:         o.Severity,
+		Provenance:       o.Provenance,
+	}, nil
+}
+
+// OpeningFromWitness returns the V5 opening of the commitment made from w.
+func OpeningFromWitness(w *WitnessInputs) CommitmentOpening {
+	return CommitmentOpening{
+		Version:       CommitmentVersionV5,
+		Salt:          w.Salt,
+		DatasetDigest: w.DatasetDigestHex,
+		ConstraintIDs: w.ConstraintIDs,
+		Enabled:       w.Enabled,
+		MaxAllowed:    w.MaxAllowed,
+		Severity:      w.Severity,
+		Provenance:    w.Provenance,
+	}
+}
+
+// SampledOpening returns the V5 opening of a commitment made from w with
+// its dataset digest bound together with the evaluator's sample s.
+// w.DatasetDigestHex must be the dataset digest itself; the returned
+// opening's Witness is what the circuit is given.
+func SampledOpening(w *WitnessInputs, s sampling.Sample) CommitmentOpening {
+	o := OpeningFromWitness(w)
+	o.Sample = &s
+	return o
+}
+
+// DatasetOpening opens only the dataset digest of a V5 commitment. Body is
+// the commitment body, whose salt keeps the policy, the severities and the
+// provenance hidden, so it can be handed to anyone who should learn which
+// dataset a proof covers and nothing else.
+type DatasetOpening struct {
+	DatasetDigest string `json:"dataset_digest"`
+	// Sample is set when the commitment binds the evaluator's sample with
+	// the digest.
+	Sample *sampling.Sample `json:"sample,omitempty"`
+	Body   string           `json:"body"`
+}
+
+// DatasetOpening returns the opening of o's dataset digest alone.
+func (o CommitmentOpening) DatasetOpening() (DatasetOpening, error) {
+	w, err := o.Witness()
+	if err != nil {
+		return DatasetOpening{}, err
+	}
+	body, err := CommitmentBody(w)
+	if err != nil {
+		return DatasetOpening{}, err
+	}
+	return DatasetOpening{DatasetDigest: o.DatasetDigest, Sample: o.Sample, Body: body}, nil
+}
+
+// Commitment recomputes the commitment d opens.
+func (d DatasetOpening) Commitment() (string, error) {
+	digest := d.DatasetDigest
+	if d.Sample != nil {
+		binding, err := sampling.Binding(d.DatasetDigest, *d.Sample)
+		if err != nil {
+			return "", err
+		}
+		digest = binding
+	}
+	return CommitmentFromBody(d.Body, digest)
+}
+
+// Check reports whether d reproduces the commitment pi discloses. It fails
+// if pi keeps its commitment private.
+func (d DatasetOpening) Check(pi PublicInputs) (bool, error) {
+	if pi.HideCommitment {
+		return false, fmt.Errorf("public inputs do not disclose a commitment")
+	}
+	want, err := parseCommitmentHex(pi.Commitment)
+	if err != nil {
+		return false, err
+	}
+	commitment, err := d.Commitment()
+	if err != nil {
+		return false, err
+	}
+	got, _ := parseFieldHex(commitment)
+	return got.Cmp(want) == 0, nil
+}
+
+// OpeningCheck is the result of checking an opening against public inputs.
+type OpeningCheck struct {
+	Commitment        string `json:"commitment"`
+	CommitmentMatches bool   `json:"commitment_matches"`
+	// PolicyHash and PolicyHashMatches are only set when the public inputs
+	// bind a policy hash.
+	PolicyHash        string `json:"policy_hash,omitempty"`
+	PolicyHashMatches *bool  `json:"policy_hash_matches,omitempty"`
+	// ProvenanceMatches is only set when the public inputs bind an
+	// evaluator kind and prompt version.
+	ProvenanceMatches *bool `json:"provenance_matches,omitempty"`
+}
+
+// Matches reports whether the opening reproduces everything the public
+// inputs bind.
+func (c OpeningCheck) Matches() bool {
+	return c.CommitmentMatches && (c.PolicyHashMatches == nil || *c.PolicyHashMatches) &&
+		(c.ProvenanceMatches == nil || *c.ProvenanceMatches)
+}
+
+// Check recomputes o's commitment and policy hash and compares them, and
+// the evaluator provenance o opens, with the ones in pi. It fails if pi keeps its commitment private, since there is
+// then nothing to open.
+func (o CommitmentOpening) Check(pi PublicInputs) (OpeningCheck, error) {
+	if pi.HideCommitment {
+		return OpeningCheck{}, fmt.Errorf("public inputs do not disclose a commitment")
+	}
+	want, err := parseCommitmentHex(pi.Commitment)
+	if err != nil {
+		return OpeningCheck{}, err
+	}
+	commitment, err := o.Commitment()
+	if err != nil {
+		return OpeningCheck{}, err
+	}
+	got, _ := parseFieldHex(commitment)
+	check := OpeningCheck{
+		Commitment:        commitment,
+		CommitmentMatches: got.Cmp(want) == 0,
+	}
+	if pi.EvaluatorKind != "" {
+		matches := o.Provenance != nil && o.Provenance.Kind == pi.EvaluatorKind &&
+			o.Provenance.PromptVersion == pi.PromptVersion
+		check.ProvenanceMatches = &matches
+	}
+	if pi.PolicyHash == "" {
+		return check, nil
+	}
+	wantHash, err := parsePolicyHash(pi.PolicyHash)
+	if err != nil {
+		return OpeningCheck{}, err
+	}
+	policyHash, err := o.PolicyHash()
+	if err != nil {
+		return OpeningCheck{}, err
+	}
+	gotHash, _ := parseFieldHex(policyHash)
+	matches := gotHash.Cmp(wantHash) == 0
+	check.PolicyHash = policyHash
+	check.PolicyHashMatches = &matches
+	return check, nil
+}
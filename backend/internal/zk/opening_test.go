@@ -0,0 +1,203 @@
+package zk
+
+import (
+	"strings"
+	"testing"
+
+	"noema/internal/sampling"
+)
+
+func TestOpeningCheckMatchesPublicInputs(t *testing.T) {
+	witness := testWitnessInputs()
+	commitment, err := CommitmentPoseidon(witness)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	policyHash, err := PolicyHashPoseidon(witness)
+	if err != nil {
+		t.Fatalf("PolicyHashPoseidon error: %v", err)
+	}
+	pi := PublicInputs{Commitment: commitment, PolicyHash: policyHash}
+
+	opening := OpeningFromWitness(witness)
+	check, err := opening.Check(pi)
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if !check.Matches() || check.Commitment != commitment || check.PolicyHash != policyHash {
+		t.Fatalf("expected opening to match, got %+v", check)
+	}
+
+	opening.Severity = append([]uint64(nil), opening.Severity...)
+	opening.Severity[0] = 0
+	check, err = opening.Check(pi)
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if check.CommitmentMatches || !*check.PolicyHashMatches || check.Matches() {
+		t.Fatalf("expected changed severity to break only the commitment, got %+v", check)
+	}
+
+	opening = OpeningFromWitness(witness)
+	opening.ConstraintIDs = append([]string(nil), opening.ConstraintIDs...)
+	opening.ConstraintIDs[0] = "custom_renamed"
+	check, err = opening.Check(pi)
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if check.CommitmentMatches || *check.PolicyHashMatches {
+		t.Fatalf("expected renamed constraint to break both, got %+v", check)
+	}
+
+	opening = OpeningFromWitness(witness)
+	provenance := *opening.Provenance
+	provenance.Model = "gemini-2.5-pro"
+	opening.Provenance = &provenance
+	check, err = opening.Check(pi)
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if check.CommitmentMatches {
+		t.Fatalf("expected a changed model to break the commitment, got %+v", check)
+	}
+
+	pi.EvaluatorKind, pi.PromptVersion = EvaluatorGemini, "noema-eval-v2"
+	opening = OpeningFromWitness(witness)
+	if check, err = opening.Check(pi); err != nil || !check.Matches() || !*check.ProvenanceMatches {
+		t.Fatalf("expected provenance to match, got %+v err=%v", check, err)
+	}
+	pi.EvaluatorKind = EvaluatorClient
+	if check, err = opening.Check(pi); err != nil || *check.ProvenanceMatches || check.Matches() {
+		t.Fatalf("expected a different evaluator kind not to match, got %+v err=%v", check, err)
+	}
+}
+
+func TestOpeningCheckRejectsHiddenCommitment(t *testing.T) {
+	opening := OpeningFromWitness(testWitnessInputs())
+	if _, err := opening.Check(PublicInputs{HideCommitment: true}); err == nil {
+		t.Fatalf("expected error when the commitment is not disclosed")
+	}
+}
+
+func TestSampledOpeningBindsSample(t *testing.T) {
+	witness := testWitnessInputs()
+	sample, err := sampling.New(witness.DatasetDigestHex, 10, 3)
+	if err != nil {
+		t.Fatalf("sampling.New error: %v", err)
+	}
+	opening := SampledOpening(witness, sample)
+	bound, err := opening.Witness()
+	if err != nil {
+		t.Fatalf("Witness error: %v", err)
+	}
+	binding, _ := sampling.Binding(witness.DatasetDigestHex, sample)
+	if bound.DatasetDigestHex != binding {
+		t.Fatalf("expected the witness to carry the sample binding")
+	}
+	commitment, err := CommitmentPoseidon(bound)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	check, err := opening.Check(PublicInputs{Commitment: commitment})
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if !check.Matches() {
+		t.Fatalf("expected sampled opening to match, got %+v", check)
+	}
+	if plain, _ := CommitmentPoseidon(witness); plain == commitment {
+		t.Fatalf("expected the sample to change the commitment")
+	}
+
+	seed := *opening.Sample
+	seed.Seed = strings.Repeat("08", sampling.SeedBytes)
+	if seed.Indices, err = sampling.Indices(witness.DatasetDigestHex, seed.Seed, 10, 3); err != nil {
+		t.Fatalf("sampling.Indices error: %v", err)
+	}
+	reseeded := SampledOpening(witness, seed)
+	if _, err := reseeded.Commitment(); err == nil {
+		t.Fatalf("expected a seed that doesn't follow from the digest to be rejected")
+	}
+}
+
+func TestDatasetOpeningReproducesCommitment(t *testing.T) {
+	witness := testWitnessInputs()
+	sample, err := sampling.New(witness.DatasetDigestHex, 10, 3)
+	if err != nil {
+		t.Fatalf("sampling.New error: %v", err)
+	}
+	for _, opening := range []CommitmentOpening{OpeningFromWitness(witness), SampledOpening(witness, sample)} {
+		commitment, err := opening.Commitment()
+		if err != nil {
+			t.Fatalf("Commitment error: %v", err)
+		}
+		d, err := opening.DatasetOpening()
+		if err != nil {
+			t.Fatalf("DatasetOpening error: %v", err)
+		}
+		if d.Body == opening.Salt || d.DatasetDigest != witness.DatasetDigestHex {
+			t.Fatalf("unexpected dataset opening %+v", d)
+		}
+		ok, err := d.Check(PublicInputs{Commitment: commitment})
+		if err != nil || !ok {
+			t.Fatalf("expected the dataset opening to reproduce %s, got %v %v", commitment, ok, err)
+		}
+
+		other := d
+		other.DatasetDigest = strings.Repeat("ab", 32)
+		other.Sample = nil
+		if ok, err := other.Check(PublicInputs{Commitment: commitment}); err != nil || ok {
+			t.Fatalf("expected another dataset digest not to match, got %v %v", ok, err)
+		}
+		if _, err := d.Check(PublicInputs{HideCommitment: true}); err == nil {
+			t.Fatalf("expected error when the commitment is not disclosed")
+		}
+	}
+}
+
+func TestV5OpeningNeedsProvenance(t *testing.T) {
+	opening := OpeningFromWitness(testWitnessInputs())
+	if opening.Version != CommitmentVersionV5 {
+		t.Fatalf("expected a version 5 opening, got %d", opening.Version)
+	}
+	opening.Provenance = nil
+	if _, err := opening.Commitment(); err == nil {
+		t.Fatalf("expected error for a version 5 opening without provenance")
+	}
+}
+
+func TestV1Openings(t *testing.T) {
+	witness := testWitnessInputs()
+	v1 := CommitmentOpening{
+		Version:       CommitmentVersionV1,
+		DatasetDigest: witness.DatasetDigestHex,
+		Enabled:       witness.Enabled,
+		MaxAllowed:    witness.MaxAllowed,
+		Severity:      witness.Severity,
+	}
+	got, err := v1.Commitment()
+	if err != nil {
+		t.Fatalf("Commitment error: %v", err)
+	}
+	if got != "0x159a270be35a47ac3d3613b731c533648ba296861cf427396225eec8de24b153" {
+		t.Fatalf("unexpected v1 commitment %s", got)
+	}
+	check, err := v1.Check(PublicInputs{Commitment: got})
+	if err != nil || !check.Matches() {
+		t.Fatalf("expected v1 opening to match, got %+v err=%v", check, err)
+	}
+
+	salted := v1
+	salted.Salt = witness.Salt
+	if _, err := salted.Commitment(); err == nil {
+		t.Fatalf("expected error for a salted v1 opening")
+	}
+	if _, err := v1.Check(PublicInputs{Commitment: got, PolicyHash: "0x" + strings.Repeat("0", 64)}); err == nil {
+		t.Fatalf("expected error checking a v1 opening against a policy hash")
+	}
+	for _, version := range []int{2, 3, 4, 9} {
+		if _, err := (CommitmentOpening{Version: version}).Commitment(); err == nil {
+			t.Fatalf("expected error for version %d", version)
+		}
+	}
+}
@@ -6,14 +6,13 @@ import (
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark/backend/groth16"
 	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/frontend/cs/r1cs"
 
 	"noema/internal/zk/policyzk"
 )
 
 func TestPolicyGateCircuit_Groth16PassFail(t *testing.T) {
-	var circuit policyzk.PolicyGateCircuit
-	r1cs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuit)
+	slots := policyzk.SlotSizes[0]
+	r1cs, err := compilePolicyGate(ProofSystemGroth16, slots)
 	if err != nil {
 		t.Fatalf("compile circuit: %v", err)
 	}
@@ -23,39 +22,26 @@ func TestPolicyGateCircuit_Groth16PassFail(t *testing.T) {
 		t.Fatalf("setup groth16: %v", err)
 	}
 
-	datasetDigestHex := "00112233445566778899aabbccddeeffffeeddccbbaa99887766554433221100"
-	enabled := [PolicyGateConstraintCount]uint64{1, 1, 1, 0, 1, 0}
-	maxAllowed := [PolicyGateConstraintCount]uint64{1, 2, 0, 1, 2, 0}
-
-	passSeverity := [PolicyGateConstraintCount]uint64{1, 2, 0, 2, 1, 2}
-	passCommitment, err := CommitmentPoseidon(datasetDigestHex, enabled, maxAllowed, passSeverity)
+	witness := testWitnessInputs()
+	witness.Salt = "0x0badc0ffee"
+	policyHashHex, err := PolicyHashPoseidon(witness)
 	if err != nil {
-		t.Fatalf("commitment pass: %v", err)
+		t.Fatalf("policy hash: %v", err)
 	}
-	passCommitmentInt, err := parseCommitmentHex(passCommitment)
+	policyHash, err := parseFieldHex(policyHashHex)
 	if err != nil {
-		t.Fatalf("parse commitment pass: %v", err)
+		t.Fatalf("parse policy hash: %v", err)
 	}
-	passOverall := 1
-	passMaxSeverity := maxSeverity(enabled, passSeverity)
+	threshold := PolicyThreshold(witness.Enabled, witness.MaxAllowed)
 
-	passLo, passHi, err := datasetDigestLimbs(datasetDigestHex)
-	if err != nil {
-		t.Fatalf("dataset limbs: %v", err)
-	}
+	passSeverity := []uint64{1, 2, 0, 2, 1, 2}
+	passAssignment := circuitAssignment(t, witness, passSeverity)
+	passAssignment.OverallPass = 1
+	passAssignment.MaxSeverity = maxSeverity(witness.Enabled, passSeverity)
+	passAssignment.PolicyThreshold = threshold
+	passAssignment.PolicyHash = policyHash
 
-	passAssignment := policyzk.PolicyGateCircuit{
-		DatasetDigestLo: passLo,
-		DatasetDigestHi: passHi,
-		Enabled:         toVarArray(enabled),
-		MaxAllowed:      toVarArray(maxAllowed),
-		Severity:        toVarArray(passSeverity),
-		Commitment:      passCommitmentInt,
-		OverallPass:     passOverall,
-		MaxSeverity:     passMaxSeverity,
-	}
-
-	passWitness, err := frontend.NewWitness(&passAssignment, ecc.BN254.ScalarField())
+	passWitness, err := frontend.NewWitness(passAssignment, ecc.BN254.ScalarField())
 	if err != nil {
 		t.Fatalf("pass witness: %v", err)
 	}
@@ -71,30 +57,14 @@ func TestPolicyGateCircuit_Groth16PassFail(t *testing.T) {
 		t.Fatalf("pass verify: %v", err)
 	}
 
-	failSeverity := [PolicyGateConstraintCount]uint64{1, 2, 1, 2, 1, 2}
-	failCommitment, err := CommitmentPoseidon(datasetDigestHex, enabled, maxAllowed, failSeverity)
-	if err != nil {
-		t.Fatalf("commitment fail: %v", err)
-	}
-	failCommitmentInt, err := parseCommitmentHex(failCommitment)
-	if err != nil {
-		t.Fatalf("parse commitment fail: %v", err)
-	}
-	failOverall := 0
-	failMaxSeverity := maxSeverity(enabled, failSeverity)
+	failSeverity := []uint64{1, 2, 1, 2, 1, 2}
+	failAssignment := circuitAssignment(t, witness, failSeverity)
+	failAssignment.OverallPass = 0
+	failAssignment.MaxSeverity = maxSeverity(witness.Enabled, failSeverity)
+	failAssignment.PolicyThreshold = threshold
+	failAssignment.PolicyHash = policyHash
 
-	failAssignment := policyzk.PolicyGateCircuit{
-		DatasetDigestLo: passLo,
-		DatasetDigestHi: passHi,
-		Enabled:         toVarArray(enabled),
-		MaxAllowed:      toVarArray(maxAllowed),
-		Severity:        toVarArray(failSeverity),
-		Commitment:      failCommitmentInt,
-		OverallPass:     failOverall,
-		MaxSeverity:     failMaxSeverity,
-	}
-
-	failWitness, err := frontend.NewWitness(&failAssignment, ecc.BN254.ScalarField())
+	failWitness, err := frontend.NewWitness(failAssignment, ecc.BN254.ScalarField())
 	if err != nil {
 		t.Fatalf("fail witness: %v", err)
 	}
@@ -110,7 +80,7 @@ func TestPolicyGateCircuit_Groth16PassFail(t *testing.T) {
 		t.Fatalf("fail verify: %v", err)
 	}
 
-	badAssignment := failAssignment
+	badAssignment := *failAssignment
 	badAssignment.OverallPass = 1
 	badWitness, err := frontend.NewWitness(&badAssignment, ecc.BN254.ScalarField())
 	if err != nil {
@@ -121,9 +91,58 @@ func TestPolicyGateCircuit_Groth16PassFail(t *testing.T) {
 	}
 }
 
-func maxSeverity(enabled, severity [PolicyGateConstraintCount]uint64) int {
+// circuitAssignment fills the private inputs and the disclosed commitment
+// for w with the given severities, padded to the circuit size.
+func circuitAssignment(t *testing.T, w *WitnessInputs, severity []uint64) *policyzk.PolicyGateCircuit {
+	t.Helper()
+	withSeverity := *w
+	withSeverity.Severity = severity
+	slots, padded, err := withSeverity.paddedSlots()
+	if err != nil {
+		t.Fatalf("pad witness: %v", err)
+	}
+	salt, err := parseSalt(w.Salt)
+	if err != nil {
+		t.Fatalf("parse salt: %v", err)
+	}
+	lo, hi, err := datasetDigestLimbs(w.DatasetDigestHex)
+	if err != nil {
+		t.Fatalf("dataset limbs: %v", err)
+	}
+	provenance, err := w.Provenance.fields()
+	if err != nil {
+		t.Fatalf("provenance: %v", err)
+	}
+	commitment, err := CommitmentPoseidon(&withSeverity)
+	if err != nil {
+		t.Fatalf("commitment: %v", err)
+	}
+	commitmentInt, err := parseCommitmentHex(commitment)
+	if err != nil {
+		t.Fatalf("parse commitment: %v", err)
+	}
+	c := policyzk.NewPolicyGateCircuit(slots)
+	c.Salt = salt
+	c.DatasetDigestLo = lo
+	c.DatasetDigestHi = hi
+	c.ConstraintID = toVars(padded[0])
+	c.Enabled = toVars(padded[1])
+	c.MaxAllowed = toVars(padded[2])
+	c.Severity = toVars(padded[3])
+	c.Commitment = commitmentInt
+	c.RevealMaxSeverity = 1
+	c.RevealCommitment = 1
+	c.EvaluatorKind = provenance[0]
+	c.PromptVersion = provenance[1]
+	c.ModelHash = provenance[2]
+	c.ResponseHashLo = provenance[3]
+	c.ResponseHashHi = provenance[4]
+	return c
+}
+
+func maxSeverity(enabled, severity []uint64) int {
 	has1 := false
-	for i := 0; i < PolicyGateConstraintCount; i++ {
+	for i := range enabled {
 		if enabled[i] == 0 {
 			continue
 		}
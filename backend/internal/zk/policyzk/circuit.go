@@ -1,47 +1,133 @@
 package policyzk
 
 import (
+	"fmt"
+
 	"github.com/AlpinYukseloglu/poseidon-gnark/circuits"
 	"github.com/consensys/gnark/frontend"
 )
 
-const N = 6
+// SlotSizes are the constraint slot counts the circuit is compiled at,
+// smallest first. A policy is padded up to the smallest size that fits it.
+var SlotSizes = []int{8, 16, 32}
+
+// MaxSlots is the largest supported number of constraints in one policy.
+const MaxSlots = 32
 
 // PolicyGateCircuit proves:
-//   - The prover knows (datasetDigest, policy config, gemini severities) that hash to Commitment
+//   - The prover knows (salt, datasetDigest, evaluator provenance, policy
+//     config, evaluator severities) that hash to Commitment
 //   - And the deterministic policy check passes:
 //     for each i: if Enabled[i] == 1 then Severity[i] <= MaxAllowed[i]
 //
+// The circuit has one slot per constraint; use NewPolicyGateCircuit to size
+// it. Each slot carries a hashed constraint identifier so any mix of preset
+// and custom constraints can be bound. Unused slots are padding: ID 0, and
+// they can't be enabled.
+//
 // Public outputs:
-// - Commitment: binds everything (dataset + policy + gemini outputs)
-// - OverallPass: 1 iff policy passes
-// - MaxSeverity (optional): max observed severity among enabled constraints
+//   - Commitment: binds everything (dataset + policy + gemini outputs);
+//     0 unless RevealCommitment is 1
+//   - OverallPass: 1 iff policy passes
+//   - MaxSeverity: max observed severity among enabled constraints;
+//     0 unless RevealMaxSeverity is 1
+//   - PolicyThreshold: strictest MaxAllowed among enabled constraints (0 if none)
+//   - PolicyHash: Poseidon(policy domain, slots, ids, enabled, maxAllowed), so a
+//     verifier can check which policy was applied without learning the severities
+//   - RevealMaxSeverity, RevealCommitment: which masked outputs are disclosed
+//   - EvaluatorKind: who produced the severities (1..EvaluatorKinds), so a
+//     verifier can refuse stub or self-reported evaluations
+//   - PromptVersion: the evaluator prompt version, packed into a field
+//     element; 0 when no prompt was used
 type PolicyGateCircuit struct {
 	// ===== Private witness =====
+	// Random blinding factor. Without it the commitment could be brute-forced
+	// from the dataset digest, since every other input is only 0..2.
+	Salt frontend.Variable
+
 	// Dataset digest split into two limbs (suggest 128-bit each) to fit cleanly in Fr.
 	// Backend must encode deterministically.
 	DatasetDigestLo frontend.Variable
 	DatasetDigestHi frontend.Variable
 
-	// Policy config
-	Enabled    [N]frontend.Variable
-	MaxAllowed [N]frontend.Variable
+	// Policy config. ConstraintID holds hashed constraint identifiers.
+	ConstraintID []frontend.Variable
+	Enabled      []frontend.Variable
+	MaxAllowed   []frontend.Variable
 
-	// Gemini outputs
-	Severity [N]frontend.Variable
+	// Evaluator provenance: the hashed model name and the raw evaluator
+	// response's SHA-256, split into limbs like the dataset digest.
+	ModelHash      frontend.Variable
+	ResponseHashLo frontend.Variable
+	ResponseHashHi frontend.Variable
+
+	// Evaluator outputs
+	Severity []frontend.Variable
 
 	// ===== Public signals =====
-	Commitment  frontend.Variable `gnark:",public"` // Poseidon(domain, datasetDigest, enabled, maxAllowed, severity)
+	Commitment  frontend.Variable `gnark:",public"` // Poseidon(domain, Poseidon(bodyDomain, slots, salt, provenance, ids, enabled, maxAllowed, severity), datasetDigest)
 	OverallPass frontend.Variable `gnark:",public"` // boolean
 
-	// Optional public signal (you can omit if you don’t want to reveal it)
+	// Masked by RevealMaxSeverity so it can stay private.
 	MaxSeverity frontend.Variable `gnark:",public"` // 0..2
+
+	PolicyThreshold frontend.Variable `gnark:",public"` // 0..2
+	PolicyHash      frontend.Variable `gnark:",public"` // Poseidon(policyDomainSep, slots, ids, enabled, maxAllowed)
+
+	// Selective disclosure flags (booleans).
+	RevealMaxSeverity frontend.Variable `gnark:",public"`
+	RevealCommitment  frontend.Variable `gnark:",public"`
+
+	// Evaluator provenance, also bound by the commitment.
+	EvaluatorKind frontend.Variable `gnark:",public"`
+	PromptVersion frontend.Variable `gnark:",public"`
+}
+
+// EvaluatorKinds is the number of evaluator kinds; EvaluatorKind is 1..EvaluatorKinds.
+const EvaluatorKinds = 3
+
+// NewPolicyGateCircuit returns a circuit with the given number of slots, for
+// compiling or as a witness assignment to fill in.
+func NewPolicyGateCircuit(slots int) *PolicyGateCircuit {
+	return &PolicyGateCircuit{
+		ConstraintID: make([]frontend.Variable, slots),
+		Enabled:      make([]frontend.Variable, slots),
+		MaxAllowed:   make([]frontend.Variable, slots),
+		Severity:     make([]frontend.Variable, slots),
+	}
 }
 
+// Domain separators for the Poseidon hashes. Version them if you change
+// ordering/inputs:
+//   - CommitmentDomainSepV1: the noema_policy_gate_v1 commitment, unsalted
+//     over six fixed slots without constraint IDs; kept so commitments
+//     issued with it can still be recomputed
+//   - CommitmentDomainSepV5: the commitment of this circuit, over the
+//     commitment body and the dataset digest
+//   - CommitmentBodyDomainSepV1: the commitment body of this circuit
+//   - PolicyHashDomainSepV2: the policy hash of this circuit
+//
+// The numbers in between belonged to layouts that were never released.
+const (
+	CommitmentDomainSepV1     = 20260208
+	CommitmentDomainSepV5     = 20260214
+	CommitmentBodyDomainSepV1 = 20260215
+	PolicyHashDomainSepV2     = 20260212
+)
+
 func (c *PolicyGateCircuit) Define(api frontend.API) error {
+	n := len(c.Enabled)
+	if n == 0 || len(c.ConstraintID) != n || len(c.MaxAllowed) != n || len(c.Severity) != n {
+		return fmt.Errorf("policy gate circuit needs the same non-zero number of slots for every input")
+	}
+
 	// --- constrain public outputs ---
 	assertBoolean(api, c.OverallPass)
 	assertIn012(api, c.MaxSeverity)
+	assertIn012(api, c.PolicyThreshold)
+	assertBoolean(api, c.RevealMaxSeverity)
+	assertBoolean(api, c.RevealCommitment)
+	assertInRange1(api, c.EvaluatorKind, EvaluatorKinds)
 
 	// --- per-constraint checks + track max severity among enabled constraints ---
 	anyFail := frontend.Variable(0)
@@ -49,12 +135,19 @@ func (c *PolicyGateCircuit) Define(api frontend.API) error {
 	anySev2 := frontend.Variable(0) // OR over enabled * (severity==2)
 	anySev1 := frontend.Variable(0) // OR over enabled * (severity==1)
 
-	for i := 0; i < N; i++ {
+	anyEnabled := frontend.Variable(0) // OR over enabled
+	anyMax0 := frontend.Variable(0)    // OR over enabled * (maxAllowed==0)
+	anyMax1 := frontend.Variable(0)    // OR over enabled * (maxAllowed==1)
+
+	for i := 0; i < n; i++ {
 		// ranges
 		assertBoolean(api, c.Enabled[i])
 		assertIn012(api, c.MaxAllowed[i])
 		assertIn012(api, c.Severity[i])
 
+		// padding slots (ID 0) can't be enabled
+		api.AssertIsEqual(api.Mul(c.Enabled[i], api.IsZero(c.ConstraintID[i])), 0)
+
 		// indicators (exact, boolean, and partition-of-unity)
 		s0, s1, s2 := indicators012(api, c.Severity[i])
 		m0, m1, m2 := indicators012(api, c.MaxAllowed[i])
@@ -83,6 +176,11 @@ func (c *PolicyGateCircuit) Define(api frontend.API) error {
 
 		anySev2 = orBool(api, anySev2, sev2Enabled)
 		anySev1 = orBool(api, anySev1, sev1Enabled)
+
+		// --- track strictest maxAllowed among enabled constraints ---
+		anyEnabled = orBool(api, anyEnabled, c.Enabled[i])
+		anyMax0 = orBool(api, anyMax0, api.Mul(c.Enabled[i], m0))
+		anyMax1 = orBool(api, anyMax1, api.Mul(c.Enabled[i], m1))
 	}
 
 	// OverallPass = 1 - anyFail
@@ -97,30 +195,47 @@ func (c *PolicyGateCircuit) Define(api frontend.API) error {
 		api.Mul(2, anySev2),
 		api.Mul(api.Sub(1, anySev2), anySev1),
 	)
-	api.AssertIsEqual(c.MaxSeverity, maxComputed)
+	// MaxSeverity is only disclosed when RevealMaxSeverity = 1.
+	api.AssertIsEqual(c.MaxSeverity, api.Mul(c.RevealMaxSeverity, maxComputed))
+
+	// PolicyThreshold = min maxAllowed over enabled constraints, 0 if none:
+	// if anyMax0 => 0
+	// else if anyMax1 => 1
+	// else if anyEnabled => 2
+	// threshold = anyEnabled * (1-anyMax0) * (2-anyMax1)
+	thresholdComputed := api.Mul(anyEnabled, api.Mul(api.Sub(1, anyMax0), api.Sub(2, anyMax1)))
+	api.AssertIsEqual(c.PolicyThreshold, thresholdComputed)
+
+	// --- policy hash ---
+	// PolicyHash = Poseidon(policyDomainSep, n, id[0..n-1], enabled[0..n-1], maxAllowed[0..n-1])
+	policyInputs := make([]frontend.Variable, 0, 2+3*n)
+	policyInputs = append(policyInputs, PolicyHashDomainSepV2, n)
+	policyInputs = append(policyInputs, c.ConstraintID...)
+	policyInputs = append(policyInputs, c.Enabled...)
+	policyInputs = append(policyInputs, c.MaxAllowed...)
+	api.AssertIsEqual(c.PolicyHash, poseidonHashChunks(api, policyInputs))
 
 	// --- commitment binding ---
-	// Commitment = Poseidon(domainSep, datasetDigestLo, datasetDigestHi,
-	//                       enabled[0..N-1], maxAllowed[0..N-1], severity[0..N-1])
+	// Body = Poseidon(bodyDomainSep, n, salt,
+	//                 evaluatorKind, promptVersion, modelHash, responseHashLo, responseHashHi,
+	//                 id[0..n-1], enabled[0..n-1], maxAllowed[0..n-1], severity[0..n-1])
+	// Commitment = Poseidon(domainSep, Body, datasetDigestLo, datasetDigestHi)
 	//
-	// Domain separation prevents cross-protocol collisions.
-	// Choose a fixed constant per circuit/version.
-	const domainSep = 20260208 // pick ANY fixed int; version it if you change ordering/inputs
-
-	inputs := make([]frontend.Variable, 0, 3+3*N)
-	inputs = append(inputs, domainSep, c.DatasetDigestLo, c.DatasetDigestHi)
-	for i := 0; i < N; i++ {
-		inputs = append(inputs, c.Enabled[i])
-	}
-	for i := 0; i < N; i++ {
-		inputs = append(inputs, c.MaxAllowed[i])
-	}
-	for i := 0; i < N; i++ {
-		inputs = append(inputs, c.Severity[i])
-	}
-
+	// Domain separation prevents cross-protocol collisions. The salted body
+	// lets the dataset digest be opened on its own: revealing Body hides
+	// the rest.
+	body := make([]frontend.Variable, 0, 8+4*n)
+	body = append(body, CommitmentBodyDomainSepV1, n, c.Salt)
+	body = append(body, c.EvaluatorKind, c.PromptVersion, c.ModelHash, c.ResponseHashLo, c.ResponseHashHi)
+	body = append(body, c.ConstraintID...)
+	body = append(body, c.Enabled...)
+	body = append(body, c.MaxAllowed...)
+	body = append(body, c.Severity...)
+	inputs := []frontend.Variable{CommitmentDomainSepV5, poseidonHashChunks(api, body), c.DatasetDigestLo, c.DatasetDigestHi}
+
+	// Commitment is only disclosed when RevealCommitment = 1.
 	commit := poseidonHashChunks(api, inputs)
-	api.AssertIsEqual(c.Commitment, commit)
+	api.AssertIsEqual(c.Commitment, api.Mul(c.RevealCommitment, commit))
 
 	return nil
 }
@@ -140,6 +255,15 @@ func assertIn012(api frontend.API, x frontend.Variable) {
 	)
 }
 
+// assertInRange1 constrains x to 1..max.
+func assertInRange1(api frontend.API, x frontend.Variable, max int) {
+	prod := frontend.Variable(1)
+	for v := 1; v <= max; v++ {
+		prod = api.Mul(prod, api.Sub(x, v))
+	}
+	api.AssertIsEqual(prod, 0)
+}
+
 // indicators012 returns (eq0, eq1, eq2) for x constrained to {0,1,2}.
 // Uses Lagrange basis polynomials (exact 0/1 in the field).
 func indicators012(api frontend.API, x frontend.Variable) (frontend.Variable, frontend.Variable, frontend.Variable) {
@@ -164,16 +288,24 @@ func indicators012(api frontend.API, x frontend.Variable) (frontend.Variable, fr
 	return eq0, eq1, eq2
 }
 
+// poseidonHashChunks hashes any number of inputs with Poseidon, which takes
+// at most 16: the first 16 are hashed, then each following chunk of up to 15
+// is hashed together with the running hash.
 func poseidonHashChunks(api frontend.API, inputs []frontend.Variable) frontend.Variable {
 	const maxInputs = 16
 	if len(inputs) <= maxInputs {
 		return circuits.Poseidon(api, inputs)
 	}
 	h := circuits.Poseidon(api, inputs[:maxInputs])
-	rest := make([]frontend.Variable, 0, 1+len(inputs[maxInputs:]))
-	rest = append(rest, h)
-	rest = append(rest, inputs[maxInputs:]...)
-	return circuits.Poseidon(api, rest)
+	for rest := inputs[maxInputs:]; len(rest) > 0; {
+		k := min(len(rest), maxInputs-1)
+		chunk := make([]frontend.Variable, 0, 1+k)
+		chunk = append(chunk, h)
+		chunk = append(chunk, rest[:k]...)
+		h = circuits.Poseidon(api, chunk)
+		rest = rest[k:]
+	}
+	return h
 }
 
 // OR for booleans: a OR b = a + b - ab
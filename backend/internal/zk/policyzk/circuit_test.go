@@ -8,21 +8,32 @@ import (
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
 	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/frontend/cs/r1cs"
 	"github.com/stretchr/testify/require"
 )
 
-func TestPolicyGateCircuit_Groth16PassFail(t *testing.T) {
-	require := require.New(t)
+// testSlots is the circuit size used by these tests; policies shorter than it
+// are padded.
+const testSlots = 8
 
-	var circuit PolicyGateCircuit
-	r1cs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuit)
-	require.NoError(err)
+// testIDs stand in for hashed constraint identifiers.
+var testIDs = []uint64{101, 102, 103, 104, 105, 106}
 
-	pk, vk, err := groth16.Setup(r1cs)
-	require.NoError(err)
+// testProvenance stands in for an evaluator kind, packed prompt version,
+// model hash and response hash limbs.
+var testProvenance = provenance{kind: 1, promptVersion: 0x7631, model: 77, responseLo: 5, responseHi: 6}
+
+type provenance struct {
+	kind, promptVersion, model, responseLo, responseHi uint64
+}
+
+func TestPolicyGateCircuit_Groth16PassFail(t *testing.T) {
+	require := require.New(t)
+	ccs, pk, vk := setupCircuit(t, testSlots)
 
+	salt := big.NewInt(0x5a17)
 	datasetLo := big.NewInt(123456789)
 	datasetHi := big.NewInt(987654321)
 
@@ -30,77 +41,321 @@ func TestPolicyGateCircuit_Groth16PassFail(t *testing.T) {
 	maxAllowed := []uint64{1, 2, 0, 1, 2, 0}
 
 	passSeverity := []uint64{1, 2, 0, 2, 1, 2}
-	passCommitment := commitmentForCase(datasetLo, datasetHi, enabled, maxAllowed, passSeverity)
-	passAssignment := PolicyGateCircuit{
-		DatasetDigestLo: datasetLo,
-		DatasetDigestHi: datasetHi,
-		Enabled:         toVarArray(enabled),
-		MaxAllowed:      toVarArray(maxAllowed),
-		Severity:        toVarArray(passSeverity),
-		Commitment:      passCommitment,
-		OverallPass:     1,
-		MaxSeverity:     2,
-	}
+	passAssignment := assignmentForCase(testSlots, salt, datasetLo, datasetHi, testIDs, enabled, maxAllowed, passSeverity)
+	passAssignment.OverallPass = 1
+	passAssignment.MaxSeverity = 2
+	passAssignment.PolicyThreshold = 0
 
-	fullPass, err := frontend.NewWitness(&passAssignment, ecc.BN254.ScalarField())
+	fullPass, err := frontend.NewWitness(passAssignment, ecc.BN254.ScalarField())
 	require.NoError(err)
-	passProof, err := groth16.Prove(r1cs, pk, fullPass)
+	passProof, err := groth16.Prove(ccs, pk, fullPass)
 	require.NoError(err)
 	passPublic, err := fullPass.Public()
 	require.NoError(err)
 	require.NoError(groth16.Verify(passProof, vk, passPublic))
 
 	failSeverity := []uint64{1, 2, 1, 2, 1, 2}
-	failCommitment := commitmentForCase(datasetLo, datasetHi, enabled, maxAllowed, failSeverity)
-	failAssignment := PolicyGateCircuit{
-		DatasetDigestLo: datasetLo,
-		DatasetDigestHi: datasetHi,
-		Enabled:         toVarArray(enabled),
-		MaxAllowed:      toVarArray(maxAllowed),
-		Severity:        toVarArray(failSeverity),
-		Commitment:      failCommitment,
-		OverallPass:     0,
-		MaxSeverity:     2,
-	}
+	failAssignment := assignmentForCase(testSlots, salt, datasetLo, datasetHi, testIDs, enabled, maxAllowed, failSeverity)
+	failAssignment.OverallPass = 0
+	failAssignment.MaxSeverity = 2
+	failAssignment.PolicyThreshold = 0
 
-	fullFail, err := frontend.NewWitness(&failAssignment, ecc.BN254.ScalarField())
+	fullFail, err := frontend.NewWitness(failAssignment, ecc.BN254.ScalarField())
 	require.NoError(err)
-	failProof, err := groth16.Prove(r1cs, pk, fullFail)
+	failProof, err := groth16.Prove(ccs, pk, fullFail)
 	require.NoError(err)
 	failPublic, err := fullFail.Public()
 	require.NoError(err)
 	require.NoError(groth16.Verify(failProof, vk, failPublic))
 
 	// Same failing inputs but incorrect OverallPass should not satisfy constraints.
-	badAssignment := failAssignment
+	badAssignment := *failAssignment
 	badAssignment.OverallPass = 1
 	fullBad, err := frontend.NewWitness(&badAssignment, ecc.BN254.ScalarField())
 	require.NoError(err)
-	_, err = groth16.Prove(r1cs, pk, fullBad)
+	_, err = groth16.Prove(ccs, pk, fullBad)
+	require.Error(err)
+
+	// The commitment must depend on the salt.
+	wrongSalt := *passAssignment
+	wrongSalt.Salt = big.NewInt(0x5a18)
+	fullWrongSalt, err := frontend.NewWitness(&wrongSalt, ecc.BN254.ScalarField())
+	require.NoError(err)
+	_, err = groth16.Prove(ccs, pk, fullWrongSalt)
 	require.Error(err)
 }
 
-func toVarArray(vals []uint64) [N]frontend.Variable {
-	var out [N]frontend.Variable
-	for i := 0; i < N; i++ {
-		out[i] = vals[i]
+func TestPolicyGateCircuit_PolicyThresholdAndHash(t *testing.T) {
+	require := require.New(t)
+	ccs, pk, _ := setupCircuit(t, testSlots)
+
+	salt := big.NewInt(42)
+	datasetLo := big.NewInt(1)
+	datasetHi := big.NewInt(2)
+	severity := []uint64{0, 0, 0, 0, 0, 0}
+
+	cases := []struct {
+		name       string
+		enabled    []uint64
+		maxAllowed []uint64
+		threshold  int
+	}{
+		{"strictest enabled wins", []uint64{1, 1, 0, 0, 0, 0}, []uint64{2, 1, 0, 0, 0, 0}, 1},
+		{"all enabled lenient", []uint64{1, 1, 1, 1, 1, 1}, []uint64{2, 2, 2, 2, 2, 2}, 2},
+		{"none enabled", []uint64{0, 0, 0, 0, 0, 0}, []uint64{0, 1, 2, 0, 1, 2}, 0},
+	}
+	for _, tc := range cases {
+		assignment := assignmentForCase(testSlots, salt, datasetLo, datasetHi, testIDs, tc.enabled, tc.maxAllowed, severity)
+		assignment.OverallPass = 1
+		assignment.MaxSeverity = 0
+		assignment.PolicyThreshold = tc.threshold
+		full, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+		require.NoError(err)
+		_, err = groth16.Prove(ccs, pk, full)
+		require.NoError(err, tc.name)
+
+		badThreshold := *assignment
+		badThreshold.PolicyThreshold = (tc.threshold + 1) % 3
+		full, err = frontend.NewWitness(&badThreshold, ecc.BN254.ScalarField())
+		require.NoError(err)
+		_, err = groth16.Prove(ccs, pk, full)
+		require.Error(err, tc.name)
+
+		badHash := *assignment
+		badHash.PolicyHash = new(big.Int).Add(policyHashForCase(testSlots, testIDs, tc.enabled, tc.maxAllowed), big.NewInt(1))
+		full, err = frontend.NewWitness(&badHash, ecc.BN254.ScalarField())
+		require.NoError(err)
+		_, err = groth16.Prove(ccs, pk, full)
+		require.Error(err, tc.name)
 	}
-	return out
 }
 
-func commitmentForCase(datasetLo, datasetHi *big.Int, enabled, maxAllowed, severity []uint64) *big.Int {
-	inputs := make([]*big.Int, 0, 3+3*N)
-	inputs = append(inputs, big.NewInt(20260208))
-	inputs = append(inputs, new(big.Int).Set(datasetLo))
-	inputs = append(inputs, new(big.Int).Set(datasetHi))
-	for i := 0; i < N; i++ {
-		inputs = append(inputs, new(big.Int).SetUint64(enabled[i]))
+func TestPolicyGateCircuit_MaskedOutputs(t *testing.T) {
+	require := require.New(t)
+	ccs, pk, vk := setupCircuit(t, testSlots)
+
+	salt := big.NewInt(7)
+	datasetLo := big.NewInt(1)
+	datasetHi := big.NewInt(2)
+	enabled := []uint64{1, 1, 0, 0, 0, 0}
+	maxAllowed := []uint64{2, 2, 0, 0, 0, 0}
+	severity := []uint64{2, 1, 0, 0, 0, 0}
+
+	hidden := assignmentForCase(testSlots, salt, datasetLo, datasetHi, testIDs, enabled, maxAllowed, severity)
+	commitment := hidden.Commitment
+	hidden.Commitment = 0
+	hidden.OverallPass = 1
+	hidden.MaxSeverity = 0
+	hidden.PolicyThreshold = 2
+	hidden.RevealMaxSeverity = 0
+	hidden.RevealCommitment = 0
+	full, err := frontend.NewWitness(hidden, ecc.BN254.ScalarField())
+	require.NoError(err)
+	proof, err := groth16.Prove(ccs, pk, full)
+	require.NoError(err)
+	public, err := full.Public()
+	require.NoError(err)
+	require.NoError(groth16.Verify(proof, vk, public))
+
+	// Hidden outputs must be zero; a prover can't leak or fake them while the flag is off.
+	leaked := *hidden
+	leaked.MaxSeverity = 2
+	full, err = frontend.NewWitness(&leaked, ecc.BN254.ScalarField())
+	require.NoError(err)
+	_, err = groth16.Prove(ccs, pk, full)
+	require.Error(err)
+
+	leaked = *hidden
+	leaked.Commitment = commitment
+	full, err = frontend.NewWitness(&leaked, ecc.BN254.ScalarField())
+	require.NoError(err)
+	_, err = groth16.Prove(ccs, pk, full)
+	require.Error(err)
+
+	// Revealing only max severity works independently of the commitment.
+	partial := *hidden
+	partial.RevealMaxSeverity = 1
+	partial.MaxSeverity = 2
+	full, err = frontend.NewWitness(&partial, ecc.BN254.ScalarField())
+	require.NoError(err)
+	_, err = groth16.Prove(ccs, pk, full)
+	require.NoError(err)
+}
+
+func TestPolicyGateCircuit_ConstraintIDsAndPadding(t *testing.T) {
+	require := require.New(t)
+	ccs, pk, _ := setupCircuit(t, testSlots)
+
+	salt := big.NewInt(9)
+	datasetLo := big.NewInt(3)
+	datasetHi := big.NewInt(4)
+	// Every slot in use, more than the six presets.
+	ids := []uint64{11, 12, 13, 14, 15, 16, 17, 18}
+	enabled := []uint64{1, 1, 1, 1, 1, 1, 1, 1}
+	maxAllowed := []uint64{2, 2, 2, 2, 2, 2, 2, 1}
+	severity := []uint64{0, 0, 0, 0, 0, 0, 0, 1}
+
+	full := assignmentForCase(testSlots, salt, datasetLo, datasetHi, ids, enabled, maxAllowed, severity)
+	full.OverallPass = 1
+	full.MaxSeverity = 1
+	full.PolicyThreshold = 1
+	w, err := frontend.NewWitness(full, ecc.BN254.ScalarField())
+	require.NoError(err)
+	_, err = groth16.Prove(ccs, pk, w)
+	require.NoError(err)
+
+	// Swapping constraint IDs changes both the policy hash and the commitment.
+	swapped := *full
+	swapped.ConstraintID = append([]frontend.Variable{}, full.ConstraintID...)
+	swapped.ConstraintID[0], swapped.ConstraintID[1] = swapped.ConstraintID[1], swapped.ConstraintID[0]
+	w, err = frontend.NewWitness(&swapped, ecc.BN254.ScalarField())
+	require.NoError(err)
+	_, err = groth16.Prove(ccs, pk, w)
+	require.Error(err)
+
+	// A padding slot can't be enabled, even with hashes computed to match.
+	paddedIDs := []uint64{21, 22}
+	paddedEnabled := []uint64{1, 0, 0, 0, 0, 0, 0, 1}
+	paddedMax := []uint64{2, 2, 0, 0, 0, 0, 0, 0}
+	paddedSeverity := make([]uint64, testSlots)
+	padded := assignmentForCase(testSlots, salt, datasetLo, datasetHi, paddedIDs, paddedEnabled, paddedMax, paddedSeverity)
+	padded.OverallPass = 1
+	padded.MaxSeverity = 0
+	padded.PolicyThreshold = 0
+	w, err = frontend.NewWitness(padded, ecc.BN254.ScalarField())
+	require.NoError(err)
+	_, err = groth16.Prove(ccs, pk, w)
+	require.Error(err)
+}
+
+func TestPolicyGateCircuit_EvaluatorProvenance(t *testing.T) {
+	require := require.New(t)
+	ccs, pk, vk := setupCircuit(t, testSlots)
+
+	salt := big.NewInt(11)
+	datasetLo := big.NewInt(1)
+	datasetHi := big.NewInt(2)
+	enabled := []uint64{1}
+	maxAllowed := []uint64{1}
+	severity := []uint64{0}
+	prove := func(a *PolicyGateCircuit) error {
+		full, err := frontend.NewWitness(a, ecc.BN254.ScalarField())
+		require.NoError(err)
+		proof, err := groth16.Prove(ccs, pk, full)
+		if err != nil {
+			return err
+		}
+		public, err := full.Public()
+		require.NoError(err)
+		return groth16.Verify(proof, vk, public)
 	}
-	for i := 0; i < N; i++ {
-		inputs = append(inputs, new(big.Int).SetUint64(maxAllowed[i]))
+	base := assignmentForCase(testSlots, salt, datasetLo, datasetHi, testIDs[:1], enabled, maxAllowed, severity)
+	base.OverallPass = 1
+	base.MaxSeverity = 0
+	base.PolicyThreshold = 1
+
+	// Every kind proves when the commitment binds it.
+	for kind := uint64(1); kind <= EvaluatorKinds; kind++ {
+		p := testProvenance
+		p.kind = kind
+		a := *base
+		a.EvaluatorKind = kind
+		a.Commitment = commitmentForCase(testSlots, salt, datasetLo, datasetHi, p, testIDs[:1], enabled, maxAllowed, severity)
+		require.NoError(prove(&a), "kind %d", kind)
+	}
+
+	// Kinds outside the enum can't prove, even with a matching commitment.
+	for _, kind := range []uint64{0, EvaluatorKinds + 1} {
+		p := testProvenance
+		p.kind = kind
+		a := *base
+		a.EvaluatorKind = kind
+		a.Commitment = commitmentForCase(testSlots, salt, datasetLo, datasetHi, p, testIDs[:1], enabled, maxAllowed, severity)
+		require.Error(prove(&a), "kind %d", kind)
 	}
-	for i := 0; i < N; i++ {
-		inputs = append(inputs, new(big.Int).SetUint64(severity[i]))
+
+	// The public kind and prompt version and the private model and response
+	// hash are all bound by the commitment.
+	for name, change := range map[string]func(a *PolicyGateCircuit){
+		"kind":           func(a *PolicyGateCircuit) { a.EvaluatorKind = 2 },
+		"prompt version": func(a *PolicyGateCircuit) { a.PromptVersion = 0x7632 },
+		"model":          func(a *PolicyGateCircuit) { a.ModelHash = 78 },
+		"response hash":  func(a *PolicyGateCircuit) { a.ResponseHashLo = 6 },
+	} {
+		a := *base
+		change(&a)
+		require.Error(prove(&a), name)
+	}
+}
+
+func TestPolicyGateCircuit_RejectsMismatchedSlots(t *testing.T) {
+	circuit := NewPolicyGateCircuit(testSlots)
+	circuit.Severity = circuit.Severity[:testSlots-1]
+	_, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, circuit)
+	require.Error(t, err)
+}
+
+func setupCircuit(t *testing.T, slots int) (constraint.ConstraintSystem, groth16.ProvingKey, groth16.VerifyingKey) {
+	t.Helper()
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, NewPolicyGateCircuit(slots))
+	require.NoError(t, err)
+	pk, vk, err := groth16.Setup(ccs)
+	require.NoError(t, err)
+	return ccs, pk, vk
+}
+
+// assignmentForCase pads the given slots with zeros and fills in the policy
+// hash and a disclosed commitment. Public outputs other than those are left
+// for the caller.
+func assignmentForCase(slots int, salt, datasetLo, datasetHi *big.Int, ids, enabled, maxAllowed, severity []uint64) *PolicyGateCircuit {
+	ids, enabled, maxAllowed, severity = pad(ids, slots), pad(enabled, slots), pad(maxAllowed, slots), pad(severity, slots)
+	c := NewPolicyGateCircuit(slots)
+	c.Salt = salt
+	c.DatasetDigestLo = datasetLo
+	c.DatasetDigestHi = datasetHi
+	for i := 0; i < slots; i++ {
+		c.ConstraintID[i] = ids[i]
+		c.Enabled[i] = enabled[i]
+		c.MaxAllowed[i] = maxAllowed[i]
+		c.Severity[i] = severity[i]
+	}
+	c.EvaluatorKind = testProvenance.kind
+	c.PromptVersion = testProvenance.promptVersion
+	c.ModelHash = testProvenance.model
+	c.ResponseHashLo = testProvenance.responseLo
+	c.ResponseHashHi = testProvenance.responseHi
+	c.Commitment = commitmentForCase(slots, salt, datasetLo, datasetHi, testProvenance, ids, enabled, maxAllowed, severity)
+	c.PolicyHash = policyHashForCase(slots, ids, enabled, maxAllowed)
+	c.RevealMaxSeverity = 1
+	c.RevealCommitment = 1
+	return c
+}
+
+func pad(vals []uint64, slots int) []uint64 {
+	out := make([]uint64, slots)
+	copy(out, vals)
+	return out
+}
+
+func commitmentForCase(slots int, salt, datasetLo, datasetHi *big.Int, p provenance, ids, enabled, maxAllowed, severity []uint64) *big.Int {
+	body := make([]*big.Int, 0, 8+4*slots)
+	body = append(body, big.NewInt(CommitmentBodyDomainSepV1), big.NewInt(int64(slots)))
+	body = append(body, new(big.Int).Set(salt))
+	for _, vals := range [][]uint64{{p.kind, p.promptVersion, p.model, p.responseLo, p.responseHi}, pad(ids, slots), pad(enabled, slots), pad(maxAllowed, slots), pad(severity, slots)} {
+		for _, v := range vals {
+			body = append(body, new(big.Int).SetUint64(v))
+		}
+	}
+	return poseidonHashChunksNative([]*big.Int{big.NewInt(CommitmentDomainSepV5), poseidonHashChunksNative(body), datasetLo, datasetHi})
+}
+
+func policyHashForCase(slots int, ids, enabled, maxAllowed []uint64) *big.Int {
+	inputs := make([]*big.Int, 0, 2+3*slots)
+	inputs = append(inputs, big.NewInt(PolicyHashDomainSepV2), big.NewInt(int64(slots)))
+	for _, vals := range [][]uint64{pad(ids, slots), pad(enabled, slots), pad(maxAllowed, slots)} {
+		for _, v := range vals {
+			inputs = append(inputs, new(big.Int).SetUint64(v))
+		}
 	}
 	return poseidonHashChunksNative(inputs)
 }
@@ -111,10 +366,13 @@ func poseidonHashChunksNative(inputs []*big.Int) *big.Int {
 		return poseidonNative(inputs)
 	}
 	h := poseidonNative(inputs[:maxInputs])
-	rest := make([]*big.Int, 0, 1+len(inputs[maxInputs:]))
-	rest = append(rest, h)
-	rest = append(rest, inputs[maxInputs:]...)
-	return poseidonNative(rest)
+	for rest := inputs[maxInputs:]; len(rest) > 0; {
+		k := min(len(rest), maxInputs-1)
+		chunk := append([]*big.Int{h}, rest[:k]...)
+		h = poseidonNative(chunk)
+		rest = rest[k:]
+	}
+	return h
 }
 
 func poseidonNative(inputs []*big.Int) *big.Int {
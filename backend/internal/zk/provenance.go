@@ -0,0 +1,164 @@
+package zk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"noema/internal/zk/policyzk"
+)
+
+// Evaluator kinds, as carried by the evaluator_kind public signal. Gemini
+// severities come from the model; stub severities are a fixed fallback
+// used when no model was reachable; client severities were supplied by the
+// caller and are only self-reported.
+const (
+	EvaluatorGemini = "gemini"
+	EvaluatorStub   = "stub"
+	EvaluatorClient = "client"
+)
+
+// evaluatorKinds maps evaluator_kind signal values to kinds. 0 is not a
+// kind; the circuit rejects it.
+var evaluatorKinds = []string{"", EvaluatorGemini, EvaluatorStub, EvaluatorClient}
+
+func init() {
+	if len(evaluatorKinds)-1 != policyzk.EvaluatorKinds {
+		panic("zk: evaluator kinds out of sync with the circuit")
+	}
+}
+
+// promptVersionBytes is the longest prompt version that packs into one
+// field element.
+const promptVersionBytes = 31
+
+// modelDomain prefixes model names before hashing.
+const modelDomain = "noema_model_v1|"
+
+// Provenance records which evaluator produced a run's severities. It is
+// bound by V5 commitments; the kind and prompt version are also public
+// signals of the current circuits.
+type Provenance struct {
+	Kind string `json:"evaluator_kind"`
+	// Model and PromptVersion are empty for evaluators that don't use them.
+	Model         string `json:"model,omitempty"`
+	PromptVersion string `json:"prompt_version,omitempty"`
+	// ResponseHash is the hex SHA-256 of the raw evaluator response.
+	ResponseHash string `json:"response_hash"`
+}
+
+// ResponseHash returns the hex SHA-256 of a raw evaluator response, for
+// Provenance.ResponseHash.
+func ResponseHash(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// fields returns p as the circuit binds it, in commitment order: kind,
+// prompt version, model hash, response hash lo, response hash hi.
+func (p *Provenance) fields() ([]*big.Int, error) {
+	if p == nil {
+		return nil, fmt.Errorf("missing evaluator provenance")
+	}
+	kind, err := evaluatorKindField(p.Kind)
+	if err != nil {
+		return nil, err
+	}
+	promptVersion, err := promptVersionField(p.PromptVersion)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(p.ResponseHash)
+	if err != nil || len(raw) != sha256.Size {
+		return nil, fmt.Errorf("response hash must be 32 hex encoded bytes")
+	}
+	lo, hi, err := datasetDigestLimbs(p.ResponseHash)
+	if err != nil {
+		return nil, err
+	}
+	return []*big.Int{kind, promptVersion, ModelHashField(p.Model), lo, hi}, nil
+}
+
+// ModelHashField returns the field element a model name is bound as: the
+// first 31 bytes of SHA-256("noema_model_v1|" || model), or 0 when there
+// was no model.
+func ModelHashField(model string) *big.Int {
+	if model == "" {
+		return new(big.Int)
+	}
+	sum := sha256.Sum256([]byte(modelDomain + model))
+	return new(big.Int).SetBytes(sum[:31])
+}
+
+func evaluatorKindField(kind string) (*big.Int, error) {
+	i := slices.Index(evaluatorKinds, kind)
+	if i <= 0 {
+		return nil, fmt.Errorf("unknown evaluator kind %q", kind)
+	}
+	return big.NewInt(int64(i)), nil
+}
+
+func evaluatorKindFromField(v *big.Int) (string, error) {
+	if !v.IsInt64() || v.Int64() < 1 || v.Int64() >= int64(len(evaluatorKinds)) {
+		return "", fmt.Errorf("evaluator_kind must be 1..%d", len(evaluatorKinds)-1)
+	}
+	return evaluatorKinds[v.Int64()], nil
+}
+
+// promptVersionField packs a prompt version into a field element as its
+// big-endian bytes, so it can be read back from the public signal. The
+// empty version packs to 0.
+func promptVersionField(version string) (*big.Int, error) {
+	if err := validatePromptVersion(version); err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes([]byte(version)), nil
+}
+
+func promptVersionFromField(v *big.Int) (string, error) {
+	if v.BitLen() > 8*promptVersionBytes {
+		return "", fmt.Errorf("prompt_version is not a packed prompt version")
+	}
+	version := string(v.Bytes())
+	if err := validatePromptVersion(version); err != nil {
+		return "", fmt.Errorf("prompt_version is not a packed prompt version")
+	}
+	return version, nil
+}
+
+// validatePromptVersion keeps prompt versions short enough to pack and free
+// of the separators of the public inputs encoding.
+func validatePromptVersion(version string) error {
+	if len(version) > promptVersionBytes {
+		return fmt.Errorf("prompt version must be at most %d bytes", promptVersionBytes)
+	}
+	for _, r := range version {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			return fmt.Errorf("prompt version may only contain letters, digits, '.', '_' and '-'")
+		}
+	}
+	return nil
+}
+
+// CheckEvaluator rejects public inputs whose evaluator kind is not one of
+// accepted. An empty accepted list accepts anything, including proofs from
+// circuits that predate evaluator provenance.
+func (pi PublicInputs) CheckEvaluator(accepted []string) error {
+	if len(accepted) == 0 {
+		return nil
+	}
+	if pi.EvaluatorKind == "" {
+		return fmt.Errorf("proof does not bind an evaluator kind")
+	}
+	if !slices.Contains(accepted, pi.EvaluatorKind) {
+		return fmt.Errorf("evaluator kind %q is not accepted", pi.EvaluatorKind)
+	}
+	return nil
+}
+
+// ValidEvaluatorKind reports whether kind is one of the evaluator kinds.
+func ValidEvaluatorKind(kind string) bool {
+	return slices.Index(evaluatorKinds, kind) > 0
+}
@@ -0,0 +1,107 @@
+package zk
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+)
+
+// RecursionInput is a verified Groth16 proof together with everything an
+// outer circuit needs to verify it again in-circuit.
+type RecursionInput struct {
+	Key    KeyInfo
+	Inputs PublicInputs
+	// Signals names the public witness entries in circuit order.
+	Signals      []string
+	CS           constraint.ConstraintSystem
+	VerifyingKey groth16.VerifyingKey
+	Proof        groth16.Proof
+	Public       witness.Witness
+}
+
+// ForRecursion verifies a proof like VerifyProof and returns it with its key
+// and public witness. Only Groth16 proofs can be verified recursively. A
+// proof that is rejected returns the VerifyProof message and a nil error.
+func ForRecursion(proofB64, publicInputsB64 string) (RecursionInput, string, error) {
+	if proofB64 == "" || publicInputsB64 == "" {
+		return RecursionInput{}, "missing proof or public inputs", fmt.Errorf("missing proof or public inputs")
+	}
+	proofRaw, err := base64.StdEncoding.DecodeString(proofB64)
+	if err != nil {
+		return RecursionInput{}, "invalid proof encoding", fmt.Errorf("invalid proof encoding")
+	}
+	pi, err := DecodePublicInputsB64(publicInputsB64)
+	if err != nil {
+		return RecursionInput{}, "invalid public inputs format", nil
+	}
+	reg, err := initGroth16()
+	if err != nil {
+		return RecursionInput{}, "verifier init failed", err
+	}
+	e, err := reg.forVerifying(pi)
+	if errors.Is(err, ErrUnknownKey) {
+		return RecursionInput{}, "unknown verifying key", nil
+	}
+	if err != nil {
+		return RecursionInput{}, "verifier init failed", err
+	}
+	if e.ks.system != ProofSystemGroth16 {
+		return RecursionInput{}, "recursion: " + ErrGroth16Only.Error(), nil
+	}
+	ok, msg, err := verifyWithKey(e, proofRaw, pi)
+	if err != nil || !ok {
+		return RecursionInput{}, msg, err
+	}
+
+	spec, err := lookupCircuit(e.ks.circuitID)
+	if err != nil {
+		return RecursionInput{}, "verifier init failed", err
+	}
+	proof := groth16.NewProof(ecc.BN254)
+	if _, err := proof.ReadFrom(bytes.NewReader(proofRaw)); err != nil {
+		return RecursionInput{}, "invalid proof encoding", err
+	}
+	publicWitness, err := publicWitnessFor(e, pi)
+	if err != nil {
+		return RecursionInput{}, "invalid public witness", err
+	}
+	return RecursionInput{
+		Key:          e.info,
+		Inputs:       pi,
+		Signals:      spec.publicSignals,
+		CS:           e.ks.ccs,
+		VerifyingKey: e.ks.vk.(groth16.VerifyingKey),
+		Proof:        proof,
+		Public:       publicWitness,
+	}, "", nil
+}
+
+// RecursionKey returns the Groth16 key keyID, or the key new proofs are made
+// with when keyID is empty, with what an outer circuit needs to verify its
+// proofs. Inputs, Proof and Public are left empty: it is for setting up an
+// outer circuit before any proof exists.
+func RecursionKey(keyID string) (RecursionInput, error) {
+	e, err := exportKeyEntry(keyID)
+	if err != nil {
+		return RecursionInput{}, err
+	}
+	if e.ks.system != ProofSystemGroth16 {
+		return RecursionInput{}, fmt.Errorf("recursion: %w", ErrGroth16Only)
+	}
+	spec, err := lookupCircuit(e.ks.circuitID)
+	if err != nil {
+		return RecursionInput{}, err
+	}
+	return RecursionInput{
+		Key:          e.info,
+		Signals:      spec.publicSignals,
+		CS:           e.ks.ccs,
+		VerifyingKey: e.ks.vk.(groth16.VerifyingKey),
+	}, nil
+}
@@ -0,0 +1,572 @@
+package zk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"noema/internal/zk/policyzk"
+)
+
+// Key registry layout under the key directory:
+//
+//	registry.json                 list of key versions and their status
+//	registry.lock                 held while the registry or key sets change
+//	<circuit id>/v<version>/      one key set per version (see saveKeySet)
+//
+// Proving uses the newest active version for the circuit size that fits the
+// policy (see PolicyGateCircuitID) and the selected proof system (see
+// SetBackend). Versions are numbered per circuit across proof systems. The smallest size gets its first key on
+// first start; larger sizes get theirs the first time a policy needs them,
+// or ahead of time with GenerateKeys. Retired versions, and keys for older
+// circuit layouts, stay in the registry so proofs issued with them keep
+// verifying, but they never prove.
+const (
+	registryFile = "registry.json"
+	lockFile     = "registry.lock"
+)
+
+// KeyStatus is the lifecycle state of a key version.
+type KeyStatus string
+
+const (
+	KeyStatusActive  KeyStatus = "active"
+	KeyStatusRetired KeyStatus = "retired"
+)
+
+var (
+	// ErrUnknownKey is returned when a key ID is not in the registry.
+	ErrUnknownKey = errors.New("unknown verifying key")
+	// ErrKeyRetired is returned when proving is requested with a retired key.
+	ErrKeyRetired = errors.New("key is retired and can only be used for verification")
+	// ErrGroth16Only is returned by exports that only exist for Groth16 keys.
+	ErrGroth16Only = errors.New("only available for groth16 keys")
+)
+
+// KeyInfo describes one registered key version.
+type KeyInfo struct {
+	KeyID         string    `json:"key_id"`
+	CircuitID     string    `json:"circuit_id"`
+	System        string    `json:"system"`
+	Version       int       `json:"version"`
+	Status        KeyStatus `json:"status"`
+	VKFingerprint string    `json:"vk_fingerprint"`
+	CreatedAt     string    `json:"created_at"`
+	RetiredAt     string    `json:"retired_at,omitempty"`
+}
+
+type registryDoc struct {
+	Keys []KeyInfo `json:"keys"`
+}
+
+type keyEntry struct {
+	info KeyInfo
+	ks   *keySet
+}
+
+// keyRegistry is the in-memory view of the registry with loaded key sets.
+type keyRegistry struct {
+	// dir is where keys set up on demand are saved; empty keeps them in memory.
+	dir string
+
+	mu      sync.Mutex // guards entries
+	entries []*keyEntry
+
+	// setupMu serializes on-demand key setup, which takes seconds.
+	setupMu sync.Mutex
+}
+
+// FormatKeyID returns the key ID for a circuit and version, e.g. "noema_policy_gate_v1.k2".
+func FormatKeyID(circuitID string, version int) string {
+	return circuitID + ".k" + strconv.Itoa(version)
+}
+
+// ParseKeyID splits a key ID into circuit ID and version.
+func ParseKeyID(keyID string) (string, int, error) {
+	i := strings.LastIndex(keyID, ".k")
+	if i <= 0 {
+		return "", 0, fmt.Errorf("invalid key id")
+	}
+	version, err := strconv.Atoi(keyID[i+2:])
+	if err != nil || version < 1 {
+		return "", 0, fmt.Errorf("invalid key id")
+	}
+	if FormatKeyID(keyID[:i], version) != keyID {
+		return "", 0, fmt.Errorf("invalid key id")
+	}
+	for _, r := range keyID[:i] {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return "", 0, fmt.Errorf("invalid key id")
+		}
+	}
+	return keyID[:i], version, nil
+}
+
+// ListKeys returns the key versions registered in dir, oldest first.
+func ListKeys(dir string) ([]KeyInfo, error) {
+	doc, err := readRegistry(dir)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Keys, nil
+}
+
+// GenerateKeys creates the first key version of the selected proof system
+// for every circuit size in dir that has none yet. It refuses to run when all sizes already have keys; use
+// AddKeyVersion to rotate.
+func GenerateKeys(dir string) ([]KeyInfo, error) {
+	doc, err := readRegistry(dir)
+	if err != nil {
+		return nil, err
+	}
+	system := currentBackend().System
+	has := make(map[string]bool)
+	for _, k := range doc.Keys {
+		if k.System == system {
+			has[k.CircuitID] = true
+		}
+	}
+	var out []KeyInfo
+	for _, n := range policyzk.SlotSizes {
+		circuitID := PolicyGateCircuitID(n)
+		if has[circuitID] {
+			continue
+		}
+		info, err := addKeyVersion(dir, circuitID)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, info)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("keys already exist in %s; use `noema keys add` to rotate", dir)
+	}
+	return out, nil
+}
+
+// AddKeyVersion runs a fresh setup for every circuit size and registers each
+// as the newest active version of its circuit. Older versions are left
+// untouched; keys for older circuit layouts are retired since they can no
+// longer prove.
+func AddKeyVersion(dir string) ([]KeyInfo, error) {
+	out := make([]KeyInfo, 0, len(policyzk.SlotSizes))
+	for _, n := range policyzk.SlotSizes {
+		info, err := addKeyVersion(dir, PolicyGateCircuitID(n))
+		if err != nil {
+			return out, err
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+// addKeyVersion sets up a key set for circuitID and registers it as the
+// circuit's next version. It holds the key directory lock from reading the
+// registry to writing it back, so a setup running at the same time in
+// another process waits and gets the version after.
+func addKeyVersion(dir, circuitID string) (KeyInfo, error) {
+	unlock, err := lockKeyDir(dir)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	defer unlock()
+	if _, err := readRegistry(dir); err != nil {
+		return KeyInfo{}, err
+	}
+	ks, err := setupKeySet(circuitID)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	return registerKeySet(dir, ks)
+}
+
+// registerKeySet saves ks in dir as the next version of its circuit and
+// makes it the newest active one. Callers hold the key directory lock.
+func registerKeySet(dir string, ks *keySet) (KeyInfo, error) {
+	doc, err := readRegistry(dir)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	circuitID := ks.circuitID
+	version := 1
+	for _, k := range doc.Keys {
+		if k.CircuitID == circuitID && k.Version >= version {
+			version = k.Version + 1
+		}
+	}
+	versionDir, version, err := newVersionDir(dir, circuitID, version)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	manifest, err := saveKeySet(versionDir, ks, version)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	info := KeyInfo{
+		KeyID:         manifest.KeyID,
+		CircuitID:     manifest.CircuitID,
+		System:        manifest.System,
+		Version:       version,
+		Status:        KeyStatusActive,
+		VKFingerprint: manifest.VKFingerprint,
+		CreatedAt:     manifest.CreatedAt,
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for i := range doc.Keys {
+		if !isCurrentCircuit(doc.Keys[i].CircuitID) && doc.Keys[i].Status == KeyStatusActive {
+			doc.Keys[i].Status = KeyStatusRetired
+			doc.Keys[i].RetiredAt = now
+		}
+	}
+	doc.Keys = append(doc.Keys, info)
+	if err := writeRegistry(dir, doc); err != nil {
+		return KeyInfo{}, err
+	}
+	return info, nil
+}
+
+// newVersionDir creates the directory of circuitID's key version version,
+// or of the first version after it whose directory doesn't exist yet. A
+// directory the registry doesn't list was left by a setup that didn't
+// finish; it is skipped, never overwritten.
+func newVersionDir(dir, circuitID string, version int) (string, int, error) {
+	if err := os.MkdirAll(filepath.Join(dir, circuitID), 0o755); err != nil {
+		return "", 0, err
+	}
+	for ; ; version++ {
+		path := keyVersionDir(dir, circuitID, version)
+		err := os.Mkdir(path, 0o755)
+		if err == nil {
+			return path, version, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", 0, err
+		}
+	}
+}
+
+// RetireKey marks a key version as verify-only. A running server picks the
+// change up on its next restart. The last active key of a current circuit
+// and proof system can't be retired: a server using that system would have
+// nothing to prove with, and would refuse to start. Add a version first.
+func RetireKey(dir, keyID string) (KeyInfo, error) {
+	unlock, err := lockKeyDir(dir)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	defer unlock()
+	doc, err := readRegistry(dir)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	for i := range doc.Keys {
+		if doc.Keys[i].KeyID != keyID {
+			continue
+		}
+		if doc.Keys[i].Status == KeyStatusRetired {
+			return KeyInfo{}, fmt.Errorf("key %s is already retired", keyID)
+		}
+		if k := doc.Keys[i]; isCurrentCircuit(k.CircuitID) && !hasOtherActiveKey(doc, k) {
+			return KeyInfo{}, fmt.Errorf("key %s is the last active %s key for %s; run noema keys add before retiring it", keyID, k.System, k.CircuitID)
+		}
+		doc.Keys[i].Status = KeyStatusRetired
+		doc.Keys[i].RetiredAt = time.Now().UTC().Format(time.RFC3339)
+		if err := writeRegistry(dir, doc); err != nil {
+			return KeyInfo{}, err
+		}
+		return doc.Keys[i], nil
+	}
+	return KeyInfo{}, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+}
+
+func hasOtherActiveKey(doc registryDoc, key KeyInfo) bool {
+	for _, k := range doc.Keys {
+		if k.KeyID != key.KeyID && k.CircuitID == key.CircuitID && k.System == key.System && k.Status == KeyStatusActive {
+			return true
+		}
+	}
+	return false
+}
+
+// openRegistry loads every registered key set in dir, creating the first key
+// version for the smallest circuit size when there is none yet (first start,
+// a circuit upgrade, or a switch of proof system).
+func openRegistry(dir string) (*keyRegistry, error) {
+	doc, err := readRegistry(dir)
+	if err != nil {
+		return nil, err
+	}
+	system := currentBackend().System
+	hasDefault := false
+	for _, k := range doc.Keys {
+		if k.CircuitID == defaultCircuitID() && k.System == system {
+			hasDefault = true
+		}
+	}
+	if !hasDefault {
+		if _, err := addKeyVersion(dir, defaultCircuitID()); err != nil {
+			return nil, err
+		}
+		if doc, err = readRegistry(dir); err != nil {
+			return nil, err
+		}
+	}
+	reg := &keyRegistry{dir: dir}
+	for _, info := range doc.Keys {
+		e, err := loadKeyEntry(dir, info)
+		if err != nil {
+			return nil, err
+		}
+		reg.entries = append(reg.entries, e)
+	}
+	if _, err := reg.signer(defaultCircuitID()); err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+func loadKeyEntry(dir string, info KeyInfo) (*keyEntry, error) {
+	if _, err := lookupCircuit(info.CircuitID); err != nil {
+		return nil, fmt.Errorf("key %s: %w", info.KeyID, err)
+	}
+	canProve := isCurrentCircuit(info.CircuitID) && info.Status == KeyStatusActive
+	ks, manifest, err := loadKeySet(keyVersionDir(dir, info.CircuitID, info.Version), canProve)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", info.KeyID, err)
+	}
+	if manifest.KeyID != info.KeyID || ks.system != info.System || ks.fingerprint != info.VKFingerprint {
+		return nil, fmt.Errorf("key %s: manifest does not match registry", info.KeyID)
+	}
+	return &keyEntry{info: info, ks: ks}, nil
+}
+
+// ephemeralRegistry keeps its keys in memory only.
+func ephemeralRegistry() (*keyRegistry, error) {
+	reg := &keyRegistry{}
+	if _, err := reg.signer(defaultCircuitID()); err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+// signer returns the newest active key version of the selected proof system
+// for a current circuit. A circuit that has never had a key of that system
+// gets its first version set up here.
+func (r *keyRegistry) signer(circuitID string) (*keyEntry, error) {
+	system := currentBackend().System
+	if e := r.newestActive(circuitID, system); e != nil {
+		return e, nil
+	}
+	if !isCurrentCircuit(circuitID) || r.hasKeys(circuitID, system) {
+		// Every version was retired; rotating is an operator decision.
+		return nil, fmt.Errorf("no active %s key for circuit %s", system, circuitID)
+	}
+	r.setupMu.Lock()
+	defer r.setupMu.Unlock()
+	if e := r.newestActive(circuitID, system); e != nil {
+		return e, nil
+	}
+	e, err := r.setupFirstKey(circuitID)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.entries = append(r.entries, e)
+	r.mu.Unlock()
+	return e, nil
+}
+
+func (r *keyRegistry) setupFirstKey(circuitID string) (*keyEntry, error) {
+	if r.dir != "" {
+		info, err := addKeyVersion(r.dir, circuitID)
+		if err != nil {
+			return nil, err
+		}
+		return loadKeyEntry(r.dir, info)
+	}
+	ks, err := setupKeySet(circuitID)
+	if err != nil {
+		return nil, err
+	}
+	info := KeyInfo{
+		KeyID:         FormatKeyID(circuitID, 1),
+		CircuitID:     circuitID,
+		System:        ks.system,
+		Version:       1,
+		Status:        KeyStatusActive,
+		VKFingerprint: ks.fingerprint,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+	}
+	return &keyEntry{info: info, ks: ks}, nil
+}
+
+func (r *keyRegistry) newestActive(circuitID, system string) *keyEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var best *keyEntry
+	for _, e := range r.entries {
+		if e.info.CircuitID == circuitID && e.info.System == system && e.info.Status == KeyStatusActive && (best == nil || e.info.Version > best.info.Version) {
+			best = e
+		}
+	}
+	return best
+}
+
+func (r *keyRegistry) hasKeys(circuitID, system string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.entries {
+		if e.info.CircuitID == circuitID && e.info.System == system {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *keyRegistry) byID(keyID string) *keyEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.entries {
+		if e.info.KeyID == keyID {
+			return e
+		}
+	}
+	return nil
+}
+
+func (r *keyRegistry) byFingerprint(fingerprint string) *keyEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.entries {
+		if e.info.VKFingerprint == fingerprint {
+			return e
+		}
+	}
+	return nil
+}
+
+// forProving picks the key a proof should be made with: the one named in
+// pi.KeyID, or the newest active key for the circuit size that fits the
+// witness.
+func (r *keyRegistry) forProving(pi PublicInputs) (*keyEntry, error) {
+	if pi.Witness == nil {
+		return nil, fmt.Errorf("missing witness inputs")
+	}
+	slots, err := pi.Witness.slots()
+	if err != nil {
+		return nil, err
+	}
+	circuitID := PolicyGateCircuitID(slots)
+	if pi.KeyID == "" {
+		return r.signer(circuitID)
+	}
+	e := r.byID(pi.KeyID)
+	if e == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, pi.KeyID)
+	}
+	if e.info.Status != KeyStatusActive || !isCurrentCircuit(e.info.CircuitID) || e.ks.pk == nil {
+		return nil, fmt.Errorf("%s: %w", pi.KeyID, ErrKeyRetired)
+	}
+	if e.info.CircuitID != circuitID {
+		return nil, fmt.Errorf("key %s is for %s; this policy needs %s", pi.KeyID, e.info.CircuitID, circuitID)
+	}
+	return e, nil
+}
+
+// forVerifying picks the key a proof claims to be made with. Public inputs
+// carrying neither a key ID nor a fingerprint predate the registry: they
+// were proved with the single noema_policy_gate_v1 key set, which is
+// registered as its version 1.
+func (r *keyRegistry) forVerifying(pi PublicInputs) (*keyEntry, error) {
+	switch {
+	case pi.KeyID != "":
+		e := r.byID(pi.KeyID)
+		if e == nil {
+			return nil, ErrUnknownKey
+		}
+		return e, nil
+	case pi.VKFingerprint != "":
+		e := r.byFingerprint(pi.VKFingerprint)
+		if e == nil {
+			return nil, ErrUnknownKey
+		}
+		return e, nil
+	default:
+		e := r.byID(FormatKeyID(policyGateV1CircuitID, 1))
+		if e == nil {
+			return nil, fmt.Errorf("%w: public inputs name no key and there is no %s key", ErrUnknownKey, policyGateV1CircuitID)
+		}
+		return e, nil
+	}
+}
+
+func (r *keyRegistry) list() []KeyInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]KeyInfo, 0, len(r.entries))
+	for _, e := range r.entries {
+		out = append(out, e.info)
+	}
+	return out
+}
+
+func keyVersionDir(dir, circuitID string, version int) string {
+	return filepath.Join(dir, circuitID, "v"+strconv.Itoa(version))
+}
+
+func readRegistry(dir string) (registryDoc, error) {
+	b, err := os.ReadFile(filepath.Join(dir, registryFile))
+	if os.IsNotExist(err) {
+		return registryDoc{}, nil
+	}
+	if err != nil {
+		return registryDoc{}, err
+	}
+	var doc registryDoc
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return registryDoc{}, fmt.Errorf("invalid key registry: %w", err)
+	}
+	seen := make(map[string]bool, len(doc.Keys))
+	for i, k := range doc.Keys {
+		circuitID, version, err := ParseKeyID(k.KeyID)
+		if err != nil || circuitID != k.CircuitID || version != k.Version {
+			return registryDoc{}, fmt.Errorf("invalid key registry entry %q", k.KeyID)
+		}
+		if k.Status != KeyStatusActive && k.Status != KeyStatusRetired {
+			return registryDoc{}, fmt.Errorf("key %s has invalid status %q", k.KeyID, k.Status)
+		}
+		if doc.Keys[i].System == "" {
+			// Registries written before PLONK support only had Groth16 keys.
+			doc.Keys[i].System = ProofSystemGroth16
+		}
+		k.System = doc.Keys[i].System
+		if k.System != ProofSystemGroth16 && k.System != ProofSystemPlonk {
+			return registryDoc{}, fmt.Errorf("key %s has unsupported proof system %q", k.KeyID, k.System)
+		}
+		if seen[k.KeyID] {
+			return registryDoc{}, fmt.Errorf("duplicate key %s in registry", k.KeyID)
+		}
+		seen[k.KeyID] = true
+	}
+	sort.SliceStable(doc.Keys, func(i, j int) bool {
+		if doc.Keys[i].CircuitID != doc.Keys[j].CircuitID {
+			return doc.Keys[i].CircuitID < doc.Keys[j].CircuitID
+		}
+		return doc.Keys[i].Version < doc.Keys[j].Version
+	})
+	return doc, nil
+}
+
+func writeRegistry(dir string, doc registryDoc) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return writeJSONAtomic(filepath.Join(dir, registryFile), doc)
+}
@@ -0,0 +1,359 @@
+package zk
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	bn254 "github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+)
+
+// snarkjs names BN254 "bn128".
+const snarkJSCurve = "bn128"
+
+// SnarkJSProof is a proof in snarkjs proof.json form. Points are projective
+// decimal coordinates with z = 1. KeyID and VKFingerprint are Noema
+// additions that snarkjs ignores; they let VerifyProof pick the right key
+// when the public signals alone can't.
+type SnarkJSProof struct {
+	PiA           [3]string    `json:"pi_a"`
+	PiB           [3][2]string `json:"pi_b"`
+	PiC           [3]string    `json:"pi_c"`
+	Protocol      string       `json:"protocol"`
+	Curve         string       `json:"curve"`
+	KeyID         string       `json:"key_id,omitempty"`
+	VKFingerprint string       `json:"vk_fingerprint,omitempty"`
+}
+
+// SnarkJSVerifyingKey is a verifying key in snarkjs verification_key.json form.
+type SnarkJSVerifyingKey struct {
+	Protocol string       `json:"protocol"`
+	Curve    string       `json:"curve"`
+	NPublic  int          `json:"nPublic"`
+	Alpha1   [3]string    `json:"vk_alpha_1"`
+	Beta2    [3][2]string `json:"vk_beta_2"`
+	Gamma2   [3][2]string `json:"vk_gamma_2"`
+	Delta2   [3][2]string `json:"vk_delta_2"`
+	IC       [][3]string  `json:"IC"`
+}
+
+// SnarkJSProofB64 converts a gnark binary proof to snarkjs form. Like the
+// other snarkjs exports it is only available for Groth16 keys.
+func SnarkJSProofB64(proofB64, publicInputsB64 string) (SnarkJSProof, error) {
+	pi, err := DecodePublicInputsB64(publicInputsB64)
+	if err != nil {
+		return SnarkJSProof{}, err
+	}
+	if _, err := snarkJSKeyEntry(pi); err != nil {
+		return SnarkJSProof{}, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(proofB64)
+	if err != nil {
+		return SnarkJSProof{}, fmt.Errorf("invalid proof encoding")
+	}
+	var proof groth16_bn254.Proof
+	if _, err := proof.ReadFrom(bytes.NewReader(raw)); err != nil {
+		return SnarkJSProof{}, fmt.Errorf("invalid proof encoding")
+	}
+	if len(proof.Commitments) > 0 {
+		return SnarkJSProof{}, fmt.Errorf("proofs with commitments are not supported")
+	}
+	return SnarkJSProof{
+		PiA:           snarkJSG1(proof.Ar),
+		PiB:           snarkJSG2(proof.Bs),
+		PiC:           snarkJSG1(proof.Krs),
+		Protocol:      ProofSystemGroth16,
+		Curve:         snarkJSCurve,
+		KeyID:         pi.KeyID,
+		VKFingerprint: pi.VKFingerprint,
+	}, nil
+}
+
+// SnarkJSPublicSignals returns the public signals of publicInputsB64 in
+// snarkjs public.json form: decimal field elements in circuit order, as
+// listed by the key's public_signals.
+func SnarkJSPublicSignals(publicInputsB64 string) ([]string, error) {
+	pi, err := DecodePublicInputsB64(publicInputsB64)
+	if err != nil {
+		return nil, err
+	}
+	e, err := snarkJSKeyEntry(pi)
+	if err != nil {
+		return nil, err
+	}
+	vec, err := publicSignalVector(e, pi)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, len(vec))
+	for i := range vec {
+		out[i] = vec[i].String()
+	}
+	return out, nil
+}
+
+// SnarkJSVerifyingKeyFor returns keyID's verifying key in snarkjs form, or
+// the default key's when keyID is empty.
+func SnarkJSVerifyingKeyFor(keyID string) (SnarkJSVerifyingKey, error) {
+	e, err := exportKeyEntry(keyID)
+	if err != nil {
+		return SnarkJSVerifyingKey{}, err
+	}
+	if e.ks.system != ProofSystemGroth16 {
+		return SnarkJSVerifyingKey{}, fmt.Errorf("snarkjs export: %w", ErrGroth16Only)
+	}
+	vk, ok := e.ks.vk.(*groth16_bn254.VerifyingKey)
+	if !ok {
+		return SnarkJSVerifyingKey{}, fmt.Errorf("unsupported verifying key type %T", e.ks.vk)
+	}
+	if len(vk.PublicAndCommitmentCommitted) > 0 {
+		return SnarkJSVerifyingKey{}, fmt.Errorf("keys with commitments are not supported")
+	}
+	out := SnarkJSVerifyingKey{
+		Protocol: ProofSystemGroth16,
+		Curve:    snarkJSCurve,
+		NPublic:  len(vk.G1.K) - 1,
+		Alpha1:   snarkJSG1(vk.G1.Alpha),
+		Beta2:    snarkJSG2(vk.G2.Beta),
+		Gamma2:   snarkJSG2(vk.G2.Gamma),
+		Delta2:   snarkJSG2(vk.G2.Delta),
+		IC:       make([][3]string, len(vk.G1.K)),
+	}
+	for i, p := range vk.G1.K {
+		out.IC[i] = snarkJSG1(p)
+	}
+	return out, nil
+}
+
+// snarkJSKeyEntry returns the key that verifies pi, which must be a Groth16
+// key: snarkjs has its own PLONK format, which gnark's proofs don't map to.
+func snarkJSKeyEntry(pi PublicInputs) (*keyEntry, error) {
+	reg, err := initGroth16()
+	if err != nil {
+		return nil, err
+	}
+	e, err := reg.forVerifying(pi)
+	if err != nil {
+		return nil, err
+	}
+	if e.ks.system != ProofSystemGroth16 {
+		return nil, fmt.Errorf("snarkjs export: %w", ErrGroth16Only)
+	}
+	return e, nil
+}
+
+// isSnarkJS reports whether an encoded proof or public inputs argument is
+// snarkjs JSON rather than base64.
+func isSnarkJS(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[")
+}
+
+// parseSnarkJSProof converts a snarkjs proof.json to gnark's binary encoding.
+func parseSnarkJSProof(s string) ([]byte, SnarkJSProof, error) {
+	var p SnarkJSProof
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		return nil, SnarkJSProof{}, fmt.Errorf("invalid proof encoding")
+	}
+	if p.Protocol != ProofSystemGroth16 || p.Curve != snarkJSCurve {
+		return nil, SnarkJSProof{}, fmt.Errorf("proof must be %s on %s", ProofSystemGroth16, snarkJSCurve)
+	}
+	var proof groth16_bn254.Proof
+	var err error
+	if proof.Ar, err = parseSnarkJSG1(p.PiA); err != nil {
+		return nil, SnarkJSProof{}, err
+	}
+	if proof.Bs, err = parseSnarkJSG2(p.PiB); err != nil {
+		return nil, SnarkJSProof{}, err
+	}
+	if proof.Krs, err = parseSnarkJSG1(p.PiC); err != nil {
+		return nil, SnarkJSProof{}, err
+	}
+	var buf bytes.Buffer
+	if _, err := proof.WriteTo(&buf); err != nil {
+		return nil, SnarkJSProof{}, err
+	}
+	return buf.Bytes(), p, nil
+}
+
+// parseSnarkJSPublicSignals maps a snarkjs public.json back to PublicInputs.
+// The layout is told apart by the number of signals: nine for the current
+// circuits, three for noema_policy_gate_v1. The key ID and fingerprint
+// aren't signals and are left empty.
+func parseSnarkJSPublicSignals(s string) (PublicInputs, error) {
+	var signals []string
+	if err := json.Unmarshal([]byte(s), &signals); err != nil {
+		return PublicInputs{}, fmt.Errorf("invalid public signals")
+	}
+	vals := make([]*big.Int, len(signals))
+	for i, sig := range signals {
+		v, ok := new(big.Int).SetString(sig, 10)
+		if !ok || v.Sign() < 0 || v.Cmp(fr.Modulus()) >= 0 {
+			return PublicInputs{}, fmt.Errorf("public signal %d is not a field element", i)
+		}
+		vals[i] = v
+	}
+	small := func(v *big.Int, max int64, name string) (int, error) {
+		if !v.IsInt64() || v.Int64() > max {
+			return 0, fmt.Errorf("%s must be 0..%d", name, max)
+		}
+		return int(v.Int64()), nil
+	}
+
+	switch len(vals) {
+	case len(PolicyGatePublicSignals), 3:
+	default:
+		return PublicInputs{}, fmt.Errorf("unexpected number of public signals %d", len(vals))
+	}
+	var pi PublicInputs
+	pass, err := small(vals[1], 1, "overall_pass")
+	if err != nil {
+		return PublicInputs{}, err
+	}
+	pi.OverallPass = pass == 1
+	if pi.MaxSeverity, err = small(vals[2], 2, "max_severity"); err != nil {
+		return PublicInputs{}, err
+	}
+	pi.Commitment = fieldHex(vals[0])
+	if len(vals) == len(PolicyGatePublicSignals) {
+		if pi.PolicyThreshold, err = small(vals[3], 2, "policy_threshold"); err != nil {
+			return PublicInputs{}, err
+		}
+		pi.PolicyHash = fieldHex(vals[4])
+		revealMS, err := small(vals[5], 1, "reveal_max_severity")
+		if err != nil {
+			return PublicInputs{}, err
+		}
+		revealC, err := small(vals[6], 1, "reveal_commitment")
+		if err != nil {
+			return PublicInputs{}, err
+		}
+		// Hidden outputs are zero in the circuit; anything else can't verify.
+		if revealMS == 0 {
+			if pi.MaxSeverity != 0 {
+				return PublicInputs{}, fmt.Errorf("hidden max_severity must be 0")
+			}
+			pi.HideMaxSeverity = true
+		}
+		if revealC == 0 {
+			if vals[0].Sign() != 0 {
+				return PublicInputs{}, fmt.Errorf("hidden commitment must be 0")
+			}
+			pi.HideCommitment = true
+			pi.Commitment = ""
+		}
+		if pi.EvaluatorKind, err = evaluatorKindFromField(vals[7]); err != nil {
+			return PublicInputs{}, err
+		}
+		if pi.PromptVersion, err = promptVersionFromField(vals[8]); err != nil {
+			return PublicInputs{}, err
+		}
+	}
+	return pi, nil
+}
+
+func snarkJSG1(p bn254.G1Affine) [3]string {
+	return [3]string{p.X.String(), p.Y.String(), "1"}
+}
+
+func snarkJSG2(p bn254.G2Affine) [3][2]string {
+	return [3][2]string{
+		{p.X.A0.String(), p.X.A1.String()},
+		{p.Y.A0.String(), p.Y.A1.String()},
+		{"1", "0"},
+	}
+}
+
+func parseSnarkJSG1(c [3]string) (bn254.G1Affine, error) {
+	var p bn254.G1Affine
+	if c[2] != "1" {
+		return p, fmt.Errorf("proof points must be affine (z = 1)")
+	}
+	if _, err := p.X.SetString(c[0]); err != nil {
+		return p, fmt.Errorf("invalid proof point")
+	}
+	if _, err := p.Y.SetString(c[1]); err != nil {
+		return p, fmt.Errorf("invalid proof point")
+	}
+	if !p.IsOnCurve() || !p.IsInSubGroup() {
+		return p, fmt.Errorf("invalid proof point")
+	}
+	return p, nil
+}
+
+func parseSnarkJSG2(c [3][2]string) (bn254.G2Affine, error) {
+	var p bn254.G2Affine
+	if c[2] != [2]string{"1", "0"} {
+		return p, fmt.Errorf("proof points must be affine (z = 1)")
+	}
+	for _, f := range []struct {
+		dst *bn254.E2
+		src [2]string
+	}{{&p.X, c[0]}, {&p.Y, c[1]}} {
+		if _, err := f.dst.A0.SetString(f.src[0]); err != nil {
+			return p, fmt.Errorf("invalid proof point")
+		}
+		if _, err := f.dst.A1.SetString(f.src[1]); err != nil {
+			return p, fmt.Errorf("invalid proof point")
+		}
+	}
+	if !p.IsOnCurve() || !p.IsInSubGroup() {
+		return p, fmt.Errorf("invalid proof point")
+	}
+	return p, nil
+}
+
+// defaultSnarkJSKey names the key of public inputs parsed from snarkjs
+// signals that no proof.json named a key for. Key-less public inputs verify
+// with the legacy v1 key, which can't have proved signals of a later layout,
+// so those get the newest active key of the default circuit instead.
+func defaultSnarkJSKey(pi *PublicInputs) error {
+	if pi.KeyID != "" || pi.VKFingerprint != "" || pi.PolicyHash == "" {
+		return nil
+	}
+	reg, err := initGroth16()
+	if err != nil {
+		return err
+	}
+	if e := reg.newestActive(defaultCircuitID(), ProofSystemGroth16); e != nil {
+		pi.KeyID = e.info.KeyID
+	}
+	return nil
+}
+
+// BinaryEncoding converts a proof and public inputs given in either encoding
+// VerifyProof accepts to the base64 encoding of Proof. Arguments already in
+// that encoding are returned unchanged. snarkjs public signals take their key
+// from a snarkjs proof, or else from the newest active key of the default
+// circuit.
+func BinaryEncoding(proof, publicInputs string) (string, string, error) {
+	var keyHint SnarkJSProof
+	if isSnarkJS(proof) {
+		raw, p, err := parseSnarkJSProof(proof)
+		if err != nil {
+			return "", "", err
+		}
+		proof, keyHint = base64.StdEncoding.EncodeToString(raw), p
+	}
+	if isSnarkJS(publicInputs) {
+		pi, err := parseSnarkJSPublicSignals(publicInputs)
+		if err != nil {
+			return "", "", err
+		}
+		pi.KeyID, pi.VKFingerprint = keyHint.KeyID, keyHint.VKFingerprint
+		if err := defaultSnarkJSKey(&pi); err != nil {
+			return "", "", err
+		}
+		raw, err := EncodePublicInputs(pi)
+		if err != nil {
+			return "", "", err
+		}
+		publicInputs = base64.StdEncoding.EncodeToString(raw)
+	}
+	return proof, publicInputs, nil
+}
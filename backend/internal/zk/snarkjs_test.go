@@ -0,0 +1,153 @@
+package zk
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// snarkJSFiles returns proof as snarkjs would write proof.json and public.json.
+func snarkJSFiles(t *testing.T, proof Proof) (string, string) {
+	t.Helper()
+	p, err := SnarkJSProofB64(proof.ProofB64, proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("SnarkJSProofB64 error: %v", err)
+	}
+	signals, err := SnarkJSPublicSignals(proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("SnarkJSPublicSignals error: %v", err)
+	}
+	proofJSON, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("marshal proof: %v", err)
+	}
+	publicJSON, err := json.Marshal(signals)
+	if err != nil {
+		t.Fatalf("marshal public signals: %v", err)
+	}
+	return string(proofJSON), string(publicJSON)
+}
+
+func TestSnarkJSRoundTripsBinaryEncoding(t *testing.T) {
+	skipUnlessGroth16(t)
+	for _, hide := range []bool{false, true} {
+		witness := testWitnessInputs()
+		commitment, err := CommitmentPoseidon(witness)
+		if err != nil {
+			t.Fatalf("CommitmentPoseidon error: %v", err)
+		}
+		proof, err := GenerateProof(PublicInputs{
+			PolicyThreshold: 0,
+			MaxSeverity:     2,
+			OverallPass:     true,
+			Commitment:      commitment,
+			HideMaxSeverity: hide,
+			HideCommitment:  hide,
+			Witness:         witness,
+		})
+		if err != nil {
+			t.Fatalf("GenerateProof error: %v", err)
+		}
+		proofJSON, publicJSON := snarkJSFiles(t, proof)
+
+		gotProof, gotInputs, err := BinaryEncoding(proofJSON, publicJSON)
+		if err != nil {
+			t.Fatalf("hide=%v: BinaryEncoding error: %v", hide, err)
+		}
+		if gotProof != proof.ProofB64 {
+			t.Fatalf("hide=%v: proof does not round-trip", hide)
+		}
+		if gotInputs != proof.PublicInputsB64 {
+			t.Fatalf("hide=%v: public inputs do not round-trip", hide)
+		}
+
+		for _, args := range [][2]string{
+			{proofJSON, publicJSON},
+			{proofJSON, proof.PublicInputsB64},
+			{proof.ProofB64, publicJSON},
+		} {
+			ok, msg, err := VerifyProof(args[0], args[1])
+			if err != nil || !ok {
+				t.Fatalf("hide=%v: expected verification, got ok=%v msg=%q err=%v", hide, ok, msg, err)
+			}
+		}
+	}
+}
+
+func TestSnarkJSVerifyingKeyMatchesExport(t *testing.T) {
+	skipUnlessGroth16(t)
+	vk, err := ExportVerifyingKey("")
+	if err != nil {
+		t.Fatalf("ExportVerifyingKey error: %v", err)
+	}
+	sj, err := SnarkJSVerifyingKeyFor("")
+	if err != nil {
+		t.Fatalf("SnarkJSVerifyingKeyFor error: %v", err)
+	}
+	if sj.Protocol != "groth16" || sj.Curve != "bn128" {
+		t.Fatalf("unexpected protocol/curve %s/%s", sj.Protocol, sj.Curve)
+	}
+	if sj.NPublic != len(vk.PublicSignals) || len(sj.IC) != len(vk.K) {
+		t.Fatalf("expected %d public signals, got nPublic=%d IC=%d", len(vk.PublicSignals), sj.NPublic, len(sj.IC))
+	}
+	if _, err := SnarkJSVerifyingKeyFor("noema_policy_gate_v6_n8.k99"); err != ErrUnknownKey {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestSnarkJSRejectsTamperedAndMalformedInput(t *testing.T) {
+	skipUnlessGroth16(t)
+	proof := generateTestProof(t)
+	proofJSON, publicJSON := snarkJSFiles(t, proof)
+
+	var signals []string
+	if err := json.Unmarshal([]byte(publicJSON), &signals); err != nil {
+		t.Fatalf("unmarshal public signals: %v", err)
+	}
+	signals[1] = "0" // claim the policy failed
+	tampered, _ := json.Marshal(signals)
+	ok, _, err := VerifyProof(proofJSON, string(tampered))
+	if err != nil || ok {
+		t.Fatalf("expected tampered signals to fail, got ok=%v err=%v", ok, err)
+	}
+
+	var p SnarkJSProof
+	if err := json.Unmarshal([]byte(proofJSON), &p); err != nil {
+		t.Fatalf("unmarshal proof: %v", err)
+	}
+	p.PiA[1] = p.PiC[1] // off the curve
+	offCurve, _ := json.Marshal(p)
+	withSignal := func(i int, v string) string {
+		s := append([]string(nil), signals...)
+		s[i] = v
+		out, _ := json.Marshal(s)
+		return string(out)
+	}
+
+	cases := map[string][2]string{
+		"truncated proof":  {proofJSON[:len(proofJSON)/2], publicJSON},
+		"point off curve":  {string(offCurve), publicJSON},
+		"wrong protocol":   {strings.Replace(proofJSON, `"groth16"`, `"plonk"`, 1), publicJSON},
+		"too few signals":  {proofJSON, `["1","2"]`},
+		"not a number":     {proofJSON, strings.Replace(publicJSON, `"1"`, `"one"`, 1)},
+		"hidden but set":   {proofJSON, withSignal(5, "0")},
+		"non-field signal": {proofJSON, strings.Replace(publicJSON, `["`, `["-`, 1)},
+		"unknown kind":     {proofJSON, withSignal(7, "4")},
+		"unpacked prompt":  {proofJSON, withSignal(8, "124")},
+	}
+	for name, args := range cases {
+		if _, _, err := BinaryEncoding(args[0], args[1]); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+		if ok, _, _ := VerifyProof(args[0], args[1]); ok {
+			t.Fatalf("%s: expected verification to fail", name)
+		}
+	}
+}
+
+func skipUnlessGroth16(t *testing.T) {
+	t.Helper()
+	if currentBackend().System != ProofSystemGroth16 {
+		t.Skip("groth16 only")
+	}
+}
@@ -0,0 +1,169 @@
+package zk
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"golang.org/x/crypto/sha3"
+)
+
+// SolidityVerifier is the Solidity verifier contract gnark generates for one
+// verifying key. For Groth16 keys its verifyProof reverts unless the proof
+// is valid; PLONK keys get gnark's PlonkVerifier, whose Verify returns
+// whether it is.
+type SolidityVerifier struct {
+	KeyID       string
+	CircuitID   string
+	Fingerprint string
+	Source      []byte
+}
+
+// ExportSolidity returns the verifier contract for keyID, or for the key new
+// proofs are made with when keyID is empty.
+func ExportSolidity(keyID string) (SolidityVerifier, error) {
+	e, err := exportKeyEntry(keyID)
+	if err != nil {
+		return SolidityVerifier{}, err
+	}
+	var buf bytes.Buffer
+	if err := e.ks.vk.ExportSolidity(&buf); err != nil {
+		return SolidityVerifier{}, fmt.Errorf("export solidity verifier: %w", err)
+	}
+	return SolidityVerifier{
+		KeyID:       e.info.KeyID,
+		CircuitID:   e.ks.circuitID,
+		Fingerprint: e.ks.fingerprint,
+		Source:      buf.Bytes(),
+	}, nil
+}
+
+// Calldata is a proof laid out for the exported contract's
+// verifyProof(uint256[8] proof, uint256[n] input): the proof points A, B, C
+// in EIP-197 order and the public signals in circuit order.
+type Calldata struct {
+	KeyID string
+	Proof [8]*big.Int
+	Input []*big.Int
+}
+
+// Signature is the Solidity signature of the verifyProof call.
+func (c Calldata) Signature() string {
+	return "verifyProof(uint256[8],uint256[" + strconv.Itoa(len(c.Input)) + "])"
+}
+
+// ABI returns the ABI-encoded verifyProof call: the 4-byte selector followed
+// by each word as a 32-byte big-endian integer. Both arguments are static
+// arrays, so there are no offsets.
+func (c Calldata) ABI() []byte {
+	selector := sha3.NewLegacyKeccak256()
+	selector.Write([]byte(c.Signature()))
+	out := selector.Sum(nil)[:4]
+	for _, w := range c.words() {
+		out = append(out, w.FillBytes(make([]byte, 32))...)
+	}
+	return out
+}
+
+// ABIHex returns ABI as 0x hex, ready for eth_call.
+func (c Calldata) ABIHex() string {
+	return "0x" + hex.EncodeToString(c.ABI())
+}
+
+func (c Calldata) words() []*big.Int {
+	return append(append([]*big.Int(nil), c.Proof[:]...), c.Input...)
+}
+
+// EncodeCalldata lays out a proof and its public inputs for the verifier
+// contract of the key that verifies them. Only Groth16 proofs are supported.
+func EncodeCalldata(proofB64, publicInputsB64 string) (Calldata, error) {
+	proofRaw, err := base64.StdEncoding.DecodeString(proofB64)
+	if err != nil {
+		return Calldata{}, fmt.Errorf("invalid proof encoding")
+	}
+	pi, err := DecodePublicInputsB64(publicInputsB64)
+	if err != nil {
+		return Calldata{}, err
+	}
+	reg, err := initGroth16()
+	if err != nil {
+		return Calldata{}, err
+	}
+	e, err := reg.forVerifying(pi)
+	if err != nil {
+		return Calldata{}, err
+	}
+	if e.ks.system != ProofSystemGroth16 {
+		return Calldata{}, fmt.Errorf("calldata: %w", ErrGroth16Only)
+	}
+
+	proof := groth16.NewProof(ecc.BN254)
+	if _, err := proof.ReadFrom(bytes.NewReader(proofRaw)); err != nil {
+		return Calldata{}, fmt.Errorf("invalid proof encoding")
+	}
+	bnProof, ok := proof.(*groth16_bn254.Proof)
+	if !ok {
+		return Calldata{}, fmt.Errorf("unsupported proof type %T", proof)
+	}
+	if len(bnProof.Commitments) > 0 {
+		return Calldata{}, fmt.Errorf("proofs with commitments are not supported")
+	}
+	raw := bnProof.MarshalSolidity()
+	if len(raw) != 8*fr.Bytes {
+		return Calldata{}, fmt.Errorf("unexpected solidity proof length %d", len(raw))
+	}
+	out := Calldata{KeyID: e.info.KeyID}
+	for i := range out.Proof {
+		out.Proof[i] = new(big.Int).SetBytes(raw[i*fr.Bytes : (i+1)*fr.Bytes])
+	}
+
+	vec, err := publicSignalVector(e, pi)
+	if err != nil {
+		return Calldata{}, err
+	}
+	out.Input = make([]*big.Int, len(vec))
+	for i := range vec {
+		out.Input[i] = vec[i].BigInt(new(big.Int))
+	}
+	return out, nil
+}
+
+// publicSignalVector returns the public witness e's circuit assigns for pi,
+// in circuit order.
+func publicSignalVector(e *keyEntry, pi PublicInputs) (fr.Vector, error) {
+	publicWitness, err := publicWitnessFor(e, pi)
+	if err != nil {
+		return nil, err
+	}
+	vec, ok := publicWitness.Vector().(fr.Vector)
+	if !ok {
+		return nil, fmt.Errorf("unexpected public witness type %T", publicWitness.Vector())
+	}
+	return vec, nil
+}
+
+// publicWitnessFor builds the public-only witness e's circuit assigns for pi.
+func publicWitnessFor(e *keyEntry, pi PublicInputs) (witness.Witness, error) {
+	spec, err := lookupCircuit(e.ks.circuitID)
+	if err != nil {
+		return nil, err
+	}
+	assignment, err := spec.publicAssignment(pi)
+	if err != nil {
+		return nil, err
+	}
+	publicWitness, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		return nil, fmt.Errorf("invalid public witness: %w", err)
+	}
+	return publicWitness, nil
+}
@@ -0,0 +1,139 @@
+package zk
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	"golang.org/x/crypto/sha3"
+)
+
+func TestExportSolidityMatchesPublicSignals(t *testing.T) {
+	v, err := ExportSolidity("")
+	if err != nil {
+		t.Fatalf("ExportSolidity error: %v", err)
+	}
+	src := string(v.Source)
+	if currentBackend().System == ProofSystemPlonk {
+		if !strings.Contains(src, "contract PlonkVerifier") {
+			t.Fatalf("expected a PlonkVerifier contract")
+		}
+	} else {
+		if !strings.Contains(src, "contract Verifier") {
+			t.Fatalf("expected a Verifier contract")
+		}
+		want := "uint256[" + strconv.Itoa(len(PolicyGatePublicSignals)) + "] calldata input"
+		if !strings.Contains(src, want) {
+			t.Fatalf("expected verifyProof to take %q", want)
+		}
+	}
+	if v.CircuitID != defaultCircuitID() || v.KeyID == "" || v.Fingerprint == "" {
+		t.Fatalf("unexpected verifier metadata %+v", v)
+	}
+	if _, err := ExportSolidity("noema_policy_gate_v6_n8.k99"); err != ErrUnknownKey {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestCalldataVerifiesWithGnark(t *testing.T) {
+	if currentBackend().System != ProofSystemGroth16 {
+		t.Skip("calldata encoding is groth16 only")
+	}
+	witnessIn := testWitnessInputs()
+	commitment, err := CommitmentPoseidon(witnessIn)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	proof, err := GenerateProof(PublicInputs{
+		PolicyThreshold: 0,
+		MaxSeverity:     2,
+		OverallPass:     true,
+		Commitment:      commitment,
+		HideMaxSeverity: true,
+		Witness:         witnessIn,
+	})
+	if err != nil {
+		t.Fatalf("GenerateProof error: %v", err)
+	}
+	cd, err := EncodeCalldata(proof.ProofB64, proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("EncodeCalldata error: %v", err)
+	}
+	if len(cd.Input) != len(PolicyGatePublicSignals) {
+		t.Fatalf("expected %d inputs, got %d", len(PolicyGatePublicSignals), len(cd.Input))
+	}
+	if cd.KeyID != proof.KeyID {
+		t.Fatalf("expected calldata for key %s, got %s", proof.KeyID, cd.KeyID)
+	}
+
+	// Decode the ABI call the way the contract reads it and check it with
+	// gnark's verifier.
+	raw := cd.ABI()
+	selector := sha3.NewLegacyKeccak256()
+	selector.Write([]byte("verifyProof(uint256[8],uint256[" + strconv.Itoa(len(PolicyGatePublicSignals)) + "])"))
+	if !bytes.Equal(raw[:4], selector.Sum(nil)[:4]) {
+		t.Fatalf("unexpected selector %x", raw[:4])
+	}
+	words := raw[4:]
+	if len(words) != 32*(8+len(cd.Input)) {
+		t.Fatalf("unexpected calldata length %d", len(raw))
+	}
+	if cd.ABIHex() != "0x"+hex.EncodeToString(raw) {
+		t.Fatalf("ABIHex does not match ABI")
+	}
+
+	var decoded groth16_bn254.Proof
+	if _, err := decoded.Ar.SetBytes(words[0:64]); err != nil {
+		t.Fatalf("decode A: %v", err)
+	}
+	if _, err := decoded.Bs.SetBytes(words[64:192]); err != nil {
+		t.Fatalf("decode B: %v", err)
+	}
+	if _, err := decoded.Krs.SetBytes(words[192:256]); err != nil {
+		t.Fatalf("decode C: %v", err)
+	}
+	values := make(chan any, len(cd.Input))
+	for i := range cd.Input {
+		var e fr.Element
+		e.SetBytes(words[256+32*i : 256+32*(i+1)])
+		values <- e
+	}
+	close(values)
+	publicWitness, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatalf("witness.New error: %v", err)
+	}
+	if err := publicWitness.Fill(len(cd.Input), 0, values); err != nil {
+		t.Fatalf("Fill error: %v", err)
+	}
+
+	reg, err := initGroth16()
+	if err != nil {
+		t.Fatalf("initGroth16 error: %v", err)
+	}
+	e := reg.byID(cd.KeyID)
+	if e == nil {
+		t.Fatalf("unknown key %s", cd.KeyID)
+	}
+	if err := groth16.Verify(&decoded, e.ks.vk.(groth16.VerifyingKey), publicWitness); err != nil {
+		t.Fatalf("gnark rejected the calldata: %v", err)
+	}
+
+	// A flipped public signal must not verify.
+	cd.Input[1] = new(big.Int).Xor(cd.Input[1], big.NewInt(1))
+	var flipped fr.Element
+	flipped.SetBigInt(cd.Input[1])
+	vec := publicWitness.Vector().(fr.Vector)
+	vec[1] = flipped
+	if err := groth16.Verify(&decoded, e.ks.vk.(groth16.VerifyingKey), publicWitness); err == nil {
+		t.Fatalf("expected tampered calldata to fail")
+	}
+}
@@ -0,0 +1,134 @@
+package zk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	bn254 "github.com/consensys/gnark-crypto/ecc/bn254"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+)
+
+// VerifyingKeyExport is the verifying key in both gnark binary and JSON-friendly form.
+type VerifyingKeyExport struct {
+	KeyID         string    `json:"key_id"`
+	KeyStatus     KeyStatus `json:"key_status"`
+	CircuitID     string    `json:"circuit_id"`
+	System        string    `json:"system"`
+	Curve         string    `json:"curve"`
+	Fingerprint   string    `json:"fingerprint"`
+	PublicSignals []string  `json:"public_signals"`
+	Raw           []byte    `json:"-"`
+	// The curve points are only exported for Groth16 keys; PLONK keys are
+	// only available in gnark's binary encoding.
+	*Groth16Points
+}
+
+// Groth16Points are the curve points of a Groth16 verifying key.
+type Groth16Points struct {
+	AlphaG1 G1JSON   `json:"alpha_g1"`
+	BetaG2  G2JSON   `json:"beta_g2"`
+	GammaG2 G2JSON   `json:"gamma_g2"`
+	DeltaG2 G2JSON   `json:"delta_g2"`
+	K       []G1JSON `json:"k_g1"`
+}
+
+// G1JSON is an affine G1 point as decimal [x, y].
+type G1JSON [2]string
+
+// G2JSON is an affine G2 point as decimal [[x.a0, x.a1], [y.a0, y.a1]].
+type G2JSON [2][2]string
+
+// VKFingerprint hashes the circuit ID together with the serialized verifying key.
+// Format: hex(SHA-256(circuitID || 0x00 || gnark binary VK)).
+func VKFingerprint(circuitID string, vkRaw []byte) string {
+	h := sha256.New()
+	h.Write([]byte(circuitID))
+	h.Write([]byte{0})
+	h.Write(vkRaw)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ExportVerifyingKey returns the verifying key for keyID, or the key new
+// proofs are made with when keyID is empty.
+func ExportVerifyingKey(keyID string) (VerifyingKeyExport, error) {
+	e, err := exportKeyEntry(keyID)
+	if err != nil {
+		return VerifyingKeyExport{}, err
+	}
+	return exportVerifyingKey(e)
+}
+
+// exportKeyEntry looks up keyID, or the default circuit's signing key when
+// keyID is empty.
+func exportKeyEntry(keyID string) (*keyEntry, error) {
+	reg, err := initGroth16()
+	if err != nil {
+		return nil, err
+	}
+	if keyID == "" {
+		return reg.signer(defaultCircuitID())
+	}
+	e := reg.byID(keyID)
+	if e == nil {
+		return nil, ErrUnknownKey
+	}
+	return e, nil
+}
+
+func exportVerifyingKey(e *keyEntry) (VerifyingKeyExport, error) {
+	ks := e.ks
+	raw, err := serializeVK(ks.vk)
+	if err != nil {
+		return VerifyingKeyExport{}, err
+	}
+	spec, err := lookupCircuit(ks.circuitID)
+	if err != nil {
+		return VerifyingKeyExport{}, err
+	}
+	out := VerifyingKeyExport{
+		KeyID:         e.info.KeyID,
+		KeyStatus:     e.info.Status,
+		CircuitID:     ks.circuitID,
+		System:        ks.system,
+		Curve:         ProofCurve,
+		Fingerprint:   ks.fingerprint,
+		PublicSignals: spec.publicSignals,
+		Raw:           raw,
+	}
+	vk, ok := ks.vk.(*groth16_bn254.VerifyingKey)
+	if !ok {
+		return out, nil
+	}
+	out.Groth16Points = &Groth16Points{
+		AlphaG1: g1JSON(vk.G1.Alpha),
+		BetaG2:  g2JSON(vk.G2.Beta),
+		GammaG2: g2JSON(vk.G2.Gamma),
+		DeltaG2: g2JSON(vk.G2.Delta),
+		K:       make([]G1JSON, 0, len(vk.G1.K)),
+	}
+	for _, p := range vk.G1.K {
+		out.K = append(out.K, g1JSON(p))
+	}
+	return out, nil
+}
+
+func serializeVK(vk io.WriterTo) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := vk.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func g1JSON(p bn254.G1Affine) G1JSON {
+	return G1JSON{p.X.String(), p.Y.String()}
+}
+
+func g2JSON(p bn254.G2Affine) G2JSON {
+	return G2JSON{
+		{p.X.A0.String(), p.X.A1.String()},
+		{p.Y.A0.String(), p.Y.A1.String()},
+	}
+}
@@ -2,10 +2,13 @@ package zk
 
 import (
 	"bytes"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"strconv"
 	"strings"
@@ -15,29 +18,36 @@ import (
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
 	"github.com/consensys/gnark/backend/groth16"
-	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/backend/plonk"
 	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/frontend/cs/r1cs"
 
 	"noema/internal/zk/policyzk"
 )
 
 const (
-	ProofSystem = "groth16"
+	// ProofSystemGroth16 and ProofSystemPlonk are the supported proof
+	// systems; see SetBackend.
+	ProofSystemGroth16 = "groth16"
+	ProofSystemPlonk   = "plonk"
+	// ProofSystem is the default proof system.
+	ProofSystem = ProofSystemGroth16
 	ProofCurve  = "bn254"
 
 	publicInputsPrefix = "noema_public_inputs_v1|"
-	policyGateDomainSep = 20260208
 )
 
-// PolicyGateConstraintCount is the fixed N for the PolicyGateCircuit.
-const PolicyGateConstraintCount = policyzk.N
-
 // PublicInputs define the public inputs for policy aggregation.
 // Format (UTF-8 bytes):
-// noema_public_inputs_v1|pt=<int>|ms=<int>|op=<0|1>|c=<hex commitment>
+// noema_public_inputs_v1|pt=<int>[|ms=<int>]|op=<0|1>[|c=<hex commitment>][|ph=<hex policy hash>][|ek=<evaluator kind>[|pv=<prompt version>]][|k=<key id>][|vk=<hex fingerprint>]
 //
-// Commitment is a hex string with 0x prefix.
+// Commitment and policy hash are hex strings with 0x prefix. The policy hash
+// is required by the current circuits; noema_policy_gate_v1 proofs omit it.
+// ms and c are omitted when the proof keeps them private (HideMaxSeverity,
+// HideCommitment), which v1 proofs can't.
+// ek and pv are the evaluator kind and prompt version, which the current
+// circuits bind; pv is omitted when the evaluator used no prompt.
+// The k and vk fields name the key version and verifying key the proof was
+// made against; proofs issued before they existed omit them.
 // Thresholds and severities are 0..2.
 // Overall pass is 0 or 1.
 //
@@ -47,71 +57,294 @@ type PublicInputs struct {
 	MaxSeverity     int
 	OverallPass     bool
 	Commitment      string
+	PolicyHash      string
+	EvaluatorKind   string
+	PromptVersion   string
+	KeyID           string
+	VKFingerprint   string
+
+	// Selective disclosure. Hidden outputs are masked to zero in the circuit
+	// and left out of the encoding. When proving, Commitment must still be
+	// set so it can be checked against the witness.
+	HideMaxSeverity bool
+	HideCommitment  bool
 
 	// Witness is required for proof generation.
 	Witness *WitnessInputs
 }
 
+// DisclosedOutputs are the public outputs a proof discloses. Hidden outputs
+// are omitted; Disclosed lists the public signals that carry a value.
+type DisclosedOutputs struct {
+	OverallPass     bool     `json:"overall_pass"`
+	MaxSeverity     *int     `json:"max_severity,omitempty"`
+	PolicyThreshold int      `json:"policy_threshold"`
+	PolicyHash      string   `json:"policy_hash,omitempty"`
+	Commitment      string   `json:"commitment,omitempty"`
+	EvaluatorKind   string   `json:"evaluator_kind,omitempty"`
+	PromptVersion   string   `json:"prompt_version,omitempty"`
+	Disclosed       []string `json:"disclosed"`
+}
+
+// Outputs returns what pi discloses.
+func (pi PublicInputs) Outputs() DisclosedOutputs {
+	out := DisclosedOutputs{
+		OverallPass:     pi.OverallPass,
+		PolicyThreshold: pi.PolicyThreshold,
+		PolicyHash:      pi.PolicyHash,
+		EvaluatorKind:   pi.EvaluatorKind,
+		PromptVersion:   pi.PromptVersion,
+	}
+	if !pi.HideCommitment {
+		out.Commitment = pi.Commitment
+		out.Disclosed = append(out.Disclosed, "commitment")
+	}
+	out.Disclosed = append(out.Disclosed, "overall_pass")
+	if !pi.HideMaxSeverity {
+		ms := pi.MaxSeverity
+		out.MaxSeverity = &ms
+		out.Disclosed = append(out.Disclosed, "max_severity")
+	}
+	out.Disclosed = append(out.Disclosed, "policy_threshold")
+	if pi.PolicyHash != "" {
+		out.Disclosed = append(out.Disclosed, "policy_hash")
+	}
+	if pi.EvaluatorKind != "" {
+		out.Disclosed = append(out.Disclosed, "evaluator_kind", "prompt_version")
+	}
+	return out
+}
+
 // WitnessInputs carries the private inputs for the PolicyGateCircuit.
 type WitnessInputs struct {
+	// Salt is the secret blinding factor (0x hex field element, see
+	// NewCommitmentSalt). It must be kept to open the commitment later.
+	Salt             string
 	DatasetDigestHex string
-	Enabled          [PolicyGateConstraintCount]uint64
-	MaxAllowed       [PolicyGateConstraintCount]uint64
-	Severity         [PolicyGateConstraintCount]uint64
+
+	// One entry per constraint, in policy order. They are padded to the
+	// smallest circuit size that fits, at most MaxPolicyConstraints.
+	ConstraintIDs []string
+	Enabled       []uint64
+	MaxAllowed    []uint64
+	Severity      []uint64
+
+	// Provenance is the evaluator the severities came from. The current
+	// circuits require it.
+	Provenance *Provenance
+}
+
+// slots validates the per-constraint inputs and returns the circuit size
+// they are proven with.
+func (w *WitnessInputs) slots() (int, error) {
+	n := len(w.ConstraintIDs)
+	if len(w.Enabled) != n || len(w.MaxAllowed) != n || len(w.Severity) != n {
+		return 0, fmt.Errorf("witness inputs must have one entry per constraint")
+	}
+	seen := make(map[string]bool, n)
+	for i, id := range w.ConstraintIDs {
+		if id == "" {
+			return 0, fmt.Errorf("constraint id must be non-empty")
+		}
+		if seen[id] {
+			return 0, fmt.Errorf("duplicate constraint id: %s", id)
+		}
+		seen[id] = true
+		if w.Enabled[i] > 1 || w.MaxAllowed[i] > 2 || w.Severity[i] > 2 {
+			return 0, fmt.Errorf("constraint %s: enabled must be 0..1, max allowed and severity 0..2", id)
+		}
+	}
+	return circuitSlots(n)
+}
+
+// paddedSlots lays the per-constraint inputs out in circuit slots as field
+// elements, in hash order: ids, enabled, maxAllowed, severity.
+func (w *WitnessInputs) paddedSlots() (int, [4][]*big.Int, error) {
+	var out [4][]*big.Int
+	slots, err := w.slots()
+	if err != nil {
+		return 0, out, err
+	}
+	for k := range out {
+		out[k] = make([]*big.Int, slots)
+		for i := range out[k] {
+			out[k][i] = new(big.Int)
+		}
+	}
+	for i, id := range w.ConstraintIDs {
+		out[0][i] = constraintIDField(id)
+		out[1][i].SetUint64(w.Enabled[i])
+		out[2][i].SetUint64(w.MaxAllowed[i])
+		out[3][i].SetUint64(w.Severity[i])
+	}
+	return slots, out, nil
 }
 
 // Proof bundles the base64-encoded proof and public inputs.
 type Proof struct {
 	System          string
 	Curve           string
+	CircuitID       string
+	KeyID           string
+	VKFingerprint   string
 	ProofB64        string
 	PublicInputsB64 string
 }
 
 var (
-	initOnce  sync.Once
-	initErr   error
-	cachedR1CS constraint.ConstraintSystem
-	cachedPK  groth16.ProvingKey
-	cachedVK  groth16.VerifyingKey
+	keysMu   sync.Mutex
+	registry *keyRegistry
 )
 
-func initGroth16() error {
-	initOnce.Do(func() {
-		var circuit policyzk.PolicyGateCircuit
-		cachedR1CS, initErr = frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuit)
-		if initErr != nil {
-			return
-		}
-		cachedPK, cachedVK, initErr = groth16.Setup(cachedR1CS)
-	})
-	return initErr
+// Init makes the Groth16 key registry available for proving and verification.
+// Keys are loaded from dir when present; otherwise a first key version is
+// generated and persisted there so proofs keep verifying across restarts. An
+// empty dir keeps a single key in memory only, which is only suitable for tests.
+func Init(dir string) error {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	if registry != nil {
+		return nil
+	}
+	var (
+		reg *keyRegistry
+		err error
+	)
+	if dir == "" {
+		reg, err = ephemeralRegistry()
+	} else {
+		reg, err = openRegistry(dir)
+	}
+	if err != nil {
+		return err
+	}
+	registry = reg
+	return nil
 }
 
+func initGroth16() (*keyRegistry, error) {
+	if err := Init(""); err != nil {
+		return nil, err
+	}
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	return registry, nil
+}
+
+// Keys lists the loaded key versions.
+func Keys() ([]KeyInfo, error) {
+	reg, err := initGroth16()
+	if err != nil {
+		return nil, err
+	}
+	return reg.list(), nil
+}
+
+// KeyForPublicInputs reports which registered key verifies proofs over the
+// given public inputs.
+func KeyForPublicInputs(publicInputsB64 string) (KeyInfo, error) {
+	pi, err := DecodePublicInputsB64(publicInputsB64)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	reg, err := initGroth16()
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	e, err := reg.forVerifying(pi)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	return e.info, nil
+}
+
+// GenerateProof proves with the key named in pi.KeyID, or the newest active
+// key when it is empty. Retired keys are refused.
 func GenerateProof(pi PublicInputs) (Proof, error) {
-	pub, err := EncodePublicInputs(pi)
+	reg, err := initGroth16()
+	if err != nil {
+		return Proof{}, err
+	}
+	e, err := reg.forProving(pi)
 	if err != nil {
 		return Proof{}, err
 	}
+	return proveWithKey(e, pi)
+}
+
+func proveWithKey(e *keyEntry, pi PublicInputs) (Proof, error) {
+	ks := e.ks
+	if ks.pk == nil {
+		return Proof{}, fmt.Errorf("%s: %w", e.info.KeyID, ErrKeyRetired)
+	}
+	if pi.KeyID == "" {
+		pi.KeyID = e.info.KeyID
+	} else if pi.KeyID != e.info.KeyID {
+		return Proof{}, fmt.Errorf("key id mismatch")
+	}
+	if pi.VKFingerprint == "" {
+		pi.VKFingerprint = ks.fingerprint
+	} else if pi.VKFingerprint != ks.fingerprint {
+		return Proof{}, fmt.Errorf("verifying key fingerprint mismatch")
+	}
 	if pi.Witness == nil {
 		return Proof{}, fmt.Errorf("missing witness inputs")
 	}
-	if err := initGroth16(); err != nil {
+	slots, padded, err := pi.Witness.paddedSlots()
+	if err != nil {
 		return Proof{}, err
 	}
+	if PolicyGateCircuitID(slots) != ks.circuitID {
+		return Proof{}, fmt.Errorf("key %s can't prove a policy with %d constraints", e.info.KeyID, len(pi.Witness.ConstraintIDs))
+	}
 
 	commitmentInt, err := parseCommitmentHex(pi.Commitment)
 	if err != nil {
 		return Proof{}, err
 	}
 
-	computedCommitment, err := CommitmentPoseidon(pi.Witness.DatasetDigestHex, pi.Witness.Enabled, pi.Witness.MaxAllowed, pi.Witness.Severity)
+	salt, err := parseSalt(pi.Witness.Salt)
+	if err != nil {
+		return Proof{}, err
+	}
+	computedCommitment, err := CommitmentPoseidon(pi.Witness)
 	if err != nil {
 		return Proof{}, err
 	}
 	if !strings.EqualFold(computedCommitment, pi.Commitment) {
 		return Proof{}, fmt.Errorf("commitment does not match witness inputs")
 	}
+	provenance, err := pi.Witness.Provenance.fields()
+	if err != nil {
+		return Proof{}, err
+	}
+	if pi.EvaluatorKind == "" && pi.PromptVersion == "" {
+		pi.EvaluatorKind = pi.Witness.Provenance.Kind
+		pi.PromptVersion = pi.Witness.Provenance.PromptVersion
+	} else if pi.EvaluatorKind != pi.Witness.Provenance.Kind || pi.PromptVersion != pi.Witness.Provenance.PromptVersion {
+		return Proof{}, fmt.Errorf("evaluator provenance does not match witness inputs")
+	}
+	if pi.PolicyThreshold != PolicyThreshold(pi.Witness.Enabled, pi.Witness.MaxAllowed) {
+		return Proof{}, fmt.Errorf("policy threshold does not match witness inputs")
+	}
+	policyHash, err := PolicyHashPoseidon(pi.Witness)
+	if err != nil {
+		return Proof{}, err
+	}
+	if pi.PolicyHash == "" {
+		pi.PolicyHash = policyHash
+	} else if !strings.EqualFold(policyHash, pi.PolicyHash) {
+		return Proof{}, fmt.Errorf("policy hash does not match witness inputs")
+	}
+	policyHashInt, err := parseFieldHex(policyHash)
+	if err != nil {
+		return Proof{}, err
+	}
+
+	pub, err := EncodePublicInputs(pi)
+	if err != nil {
+		return Proof{}, err
+	}
 
 	datasetLo, datasetHi, err := datasetDigestLimbs(pi.Witness.DatasetDigestHex)
 	if err != nil {
@@ -119,14 +352,35 @@ func GenerateProof(pi PublicInputs) (Proof, error) {
 	}
 
 	assignment := policyzk.PolicyGateCircuit{
+		Salt:            salt,
 		DatasetDigestLo: datasetLo,
 		DatasetDigestHi: datasetHi,
-		Enabled:         toVarArray(pi.Witness.Enabled),
-		MaxAllowed:      toVarArray(pi.Witness.MaxAllowed),
-		Severity:        toVarArray(pi.Witness.Severity),
+		ConstraintID:    toVars(padded[0]),
+		Enabled:         toVars(padded[1]),
+		MaxAllowed:      toVars(padded[2]),
+		Severity:        toVars(padded[3]),
 		Commitment:      commitmentInt,
 		OverallPass:     boolToInt(pi.OverallPass),
 		MaxSeverity:     pi.MaxSeverity,
+		PolicyThreshold: pi.PolicyThreshold,
+		PolicyHash:      policyHashInt,
+
+		RevealMaxSeverity: 1,
+		RevealCommitment:  1,
+
+		EvaluatorKind:  provenance[0],
+		PromptVersion:  provenance[1],
+		ModelHash:      provenance[2],
+		ResponseHashLo: provenance[3],
+		ResponseHashHi: provenance[4],
+	}
+	if pi.HideMaxSeverity {
+		assignment.MaxSeverity = 0
+		assignment.RevealMaxSeverity = 0
+	}
+	if pi.HideCommitment {
+		assignment.Commitment = 0
+		assignment.RevealCommitment = 0
 	}
 
 	fullWitness, err := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
@@ -134,7 +388,13 @@ func GenerateProof(pi PublicInputs) (Proof, error) {
 		return Proof{}, err
 	}
 
-	proof, err := groth16.Prove(cachedR1CS, cachedPK, fullWitness)
+	var proof io.WriterTo
+	switch ks.system {
+	case ProofSystemPlonk:
+		proof, err = plonk.Prove(ks.ccs, ks.pk.(plonk.ProvingKey), fullWitness)
+	default:
+		proof, err = groth16.Prove(ks.ccs, ks.pk.(groth16.ProvingKey), fullWitness)
+	}
 	if err != nil {
 		return Proof{}, err
 	}
@@ -145,54 +405,110 @@ func GenerateProof(pi PublicInputs) (Proof, error) {
 	}
 
 	return Proof{
-		System:          ProofSystem,
+		System:          ks.system,
 		Curve:           ProofCurve,
+		CircuitID:       ks.circuitID,
+		KeyID:           e.info.KeyID,
+		VKFingerprint:   ks.fingerprint,
 		ProofB64:        base64.StdEncoding.EncodeToString(proofBuf.Bytes()),
 		PublicInputsB64: base64.StdEncoding.EncodeToString(pub),
 	}, nil
 }
 
+// VerifyProof verifies a proof against its public inputs. Each may be given
+// in the base64 encoding of Proof or as snarkjs JSON (proof.json and
+// public.json); a snarkjs proof's key_id and vk_fingerprint select the key
+// when the public inputs don't. The key decides the proof system the proof
+// is checked with, so Groth16 and PLONK proofs verify side by side.
 func VerifyProof(proofB64, publicInputsB64 string) (bool, string, error) {
 	if proofB64 == "" || publicInputsB64 == "" {
 		return false, "missing proof or public inputs", fmt.Errorf("missing proof or public inputs")
 	}
-	proofRaw, err := base64.StdEncoding.DecodeString(proofB64)
-	if err != nil {
+	var (
+		proofRaw []byte
+		keyHint  SnarkJSProof
+		err      error
+	)
+	if isSnarkJS(proofB64) {
+		if proofRaw, keyHint, err = parseSnarkJSProof(proofB64); err != nil {
+			return false, "invalid proof encoding", err
+		}
+	} else if proofRaw, err = base64.StdEncoding.DecodeString(proofB64); err != nil {
 		return false, "invalid proof encoding", fmt.Errorf("invalid proof encoding")
 	}
-	pubRaw, err := base64.StdEncoding.DecodeString(publicInputsB64)
-	if err != nil {
-		return false, "invalid public inputs encoding", fmt.Errorf("invalid public inputs encoding")
+	var pi PublicInputs
+	if isSnarkJS(publicInputsB64) {
+		if pi, err = parseSnarkJSPublicSignals(publicInputsB64); err != nil {
+			return false, "invalid public inputs format", nil
+		}
+	} else {
+		pubRaw, err := base64.StdEncoding.DecodeString(publicInputsB64)
+		if err != nil {
+			return false, "invalid public inputs encoding", fmt.Errorf("invalid public inputs encoding")
+		}
+		if pi, err = DecodePublicInputs(pubRaw); err != nil {
+			return false, "invalid public inputs format", nil
+		}
+	}
+	if pi.KeyID == "" && pi.VKFingerprint == "" {
+		pi.KeyID, pi.VKFingerprint = keyHint.KeyID, keyHint.VKFingerprint
+	}
+	if isSnarkJS(publicInputsB64) {
+		if err := defaultSnarkJSKey(&pi); err != nil {
+			return false, "verifier init failed", err
+		}
 	}
-	pi, err := DecodePublicInputs(pubRaw)
+	reg, err := initGroth16()
 	if err != nil {
-		return false, "invalid public inputs format", nil
+		return false, "verifier init failed", err
+	}
+	e, err := reg.forVerifying(pi)
+	if errors.Is(err, ErrUnknownKey) {
+		return false, "unknown verifying key", nil
 	}
-	if err := initGroth16(); err != nil {
+	if err != nil {
 		return false, "verifier init failed", err
 	}
+	return verifyWithKey(e, proofRaw, pi)
+}
 
-	commitmentInt, err := parseCommitmentHex(pi.Commitment)
+// verifyWithKey verifies with any registered key, including retired ones.
+func verifyWithKey(e *keyEntry, proofRaw []byte, pi PublicInputs) (bool, string, error) {
+	ks := e.ks
+	if pi.KeyID != "" && pi.KeyID != e.info.KeyID {
+		return false, "verifying key mismatch", nil
+	}
+	if pi.VKFingerprint != "" && pi.VKFingerprint != ks.fingerprint {
+		return false, "verifying key mismatch", nil
+	}
+	spec, err := lookupCircuit(ks.circuitID)
 	if err != nil {
-		return false, "invalid commitment", err
+		return false, "verifier init failed", err
 	}
-
-	assignment := policyzk.PolicyGateCircuit{
-		Commitment:  commitmentInt,
-		OverallPass: boolToInt(pi.OverallPass),
-		MaxSeverity: pi.MaxSeverity,
+	assignment, err := spec.publicAssignment(pi)
+	if err != nil {
+		return false, err.Error(), nil
 	}
-	publicWitness, err := frontend.NewWitness(&assignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	publicWitness, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
 	if err != nil {
 		return false, "invalid public witness", err
 	}
 
-	proof := groth16.NewProof(ecc.BN254)
-	if _, err := proof.ReadFrom(bytes.NewReader(proofRaw)); err != nil {
-		return false, "invalid proof encoding", err
+	switch ks.system {
+	case ProofSystemPlonk:
+		proof := plonk.NewProof(ecc.BN254)
+		if _, err := proof.ReadFrom(bytes.NewReader(proofRaw)); err != nil {
+			return false, "invalid proof encoding", err
+		}
+		err = plonk.Verify(proof, ks.vk.(plonk.VerifyingKey), publicWitness)
+	default:
+		proof := groth16.NewProof(ecc.BN254)
+		if _, err := proof.ReadFrom(bytes.NewReader(proofRaw)); err != nil {
+			return false, "invalid proof encoding", err
+		}
+		err = groth16.Verify(proof, ks.vk.(groth16.VerifyingKey), publicWitness)
 	}
-
-	if err := groth16.Verify(proof, cachedVK, publicWitness); err != nil {
+	if err != nil {
 		return false, "invalid proof", nil
 	}
 	return true, "verified", nil
@@ -202,20 +518,72 @@ func EncodePublicInputs(pi PublicInputs) ([]byte, error) {
 	if pi.PolicyThreshold < 0 || pi.PolicyThreshold > 2 {
 		return nil, fmt.Errorf("policy threshold must be 0..2")
 	}
-	if pi.MaxSeverity < 0 || pi.MaxSeverity > 2 {
+	if !pi.HideMaxSeverity && (pi.MaxSeverity < 0 || pi.MaxSeverity > 2) {
 		return nil, fmt.Errorf("max severity must be 0..2")
 	}
-	if pi.Commitment == "" {
+	if !pi.HideCommitment && pi.Commitment == "" {
 		return nil, fmt.Errorf("commitment required")
 	}
 	op := 0
 	if pi.OverallPass {
 		op = 1
 	}
-	payload := fmt.Sprintf("%spt=%d|ms=%d|op=%d|c=%s", publicInputsPrefix, pi.PolicyThreshold, pi.MaxSeverity, op, pi.Commitment)
+	payload := fmt.Sprintf("%spt=%d", publicInputsPrefix, pi.PolicyThreshold)
+	if !pi.HideMaxSeverity {
+		payload += fmt.Sprintf("|ms=%d", pi.MaxSeverity)
+	}
+	payload += fmt.Sprintf("|op=%d", op)
+	if !pi.HideCommitment {
+		if _, err := parseCommitmentHex(pi.Commitment); err != nil {
+			return nil, err
+		}
+		payload += "|c=" + pi.Commitment
+	}
+	if pi.PolicyHash != "" {
+		if _, err := parseCanonicalFieldHex(pi.PolicyHash); err != nil {
+			return nil, fmt.Errorf("policy hash %v", err)
+		}
+		payload += "|ph=" + pi.PolicyHash
+	}
+	if pi.EvaluatorKind != "" {
+		if !ValidEvaluatorKind(pi.EvaluatorKind) {
+			return nil, fmt.Errorf("unknown evaluator kind %q", pi.EvaluatorKind)
+		}
+		payload += "|ek=" + pi.EvaluatorKind
+	}
+	if pi.PromptVersion != "" {
+		if pi.EvaluatorKind == "" {
+			return nil, fmt.Errorf("prompt version requires an evaluator kind")
+		}
+		if err := validatePromptVersion(pi.PromptVersion); err != nil {
+			return nil, err
+		}
+		payload += "|pv=" + pi.PromptVersion
+	}
+	if pi.KeyID != "" {
+		if _, _, err := ParseKeyID(pi.KeyID); err != nil {
+			return nil, err
+		}
+		payload += "|k=" + pi.KeyID
+	}
+	if pi.VKFingerprint != "" {
+		if !isFingerprintHex(pi.VKFingerprint) {
+			return nil, fmt.Errorf("vk fingerprint must be 64 lowercase hex characters")
+		}
+		payload += "|vk=" + pi.VKFingerprint
+	}
 	return []byte(payload), nil
 }
 
+// DecodePublicInputsB64 decodes base64-encoded public inputs, as carried in Proof.
+func DecodePublicInputsB64(publicInputsB64 string) (PublicInputs, error) {
+	pubRaw, err := base64.StdEncoding.DecodeString(publicInputsB64)
+	if err != nil {
+		return PublicInputs{}, fmt.Errorf("invalid public inputs encoding")
+	}
+	return DecodePublicInputs(pubRaw)
+}
+
 func DecodePublicInputs(pub []byte) (PublicInputs, error) {
 	s := string(pub)
 	if !strings.HasPrefix(s, publicInputsPrefix) {
@@ -227,6 +595,11 @@ func DecodePublicInputs(pub []byte) (PublicInputs, error) {
 	seenMS := false
 	seenOP := false
 	seenC := false
+	seenPH := false
+	seenEK := false
+	seenPV := false
+	seenK := false
+	seenVK := false
 	for _, f := range fields {
 		kv := strings.SplitN(f, "=", 2)
 		if len(kv) != 2 {
@@ -276,24 +649,82 @@ func DecodePublicInputs(pub []byte) (PublicInputs, error) {
 			if seenC {
 				return PublicInputs{}, fmt.Errorf("duplicate commitment")
 			}
+			out.Commitment = kv[1]
+			seenC = true
+		case "ph":
+			if seenPH {
+				return PublicInputs{}, fmt.Errorf("duplicate policy hash")
+			}
+			if _, err := parseCanonicalFieldHex(kv[1]); err != nil {
+				return PublicInputs{}, fmt.Errorf("policy hash %v", err)
+			}
+			out.PolicyHash = kv[1]
+			seenPH = true
+		case "ek":
+			if seenEK {
+				return PublicInputs{}, fmt.Errorf("duplicate evaluator kind")
+			}
+			if !ValidEvaluatorKind(kv[1]) {
+				return PublicInputs{}, fmt.Errorf("unknown evaluator kind %q", kv[1])
+			}
+			out.EvaluatorKind = kv[1]
+			seenEK = true
+		case "pv":
+			if seenPV {
+				return PublicInputs{}, fmt.Errorf("duplicate prompt version")
+			}
 			if kv[1] == "" {
-				return PublicInputs{}, fmt.Errorf("commitment required")
+				return PublicInputs{}, fmt.Errorf("prompt version must be non-empty when present")
 			}
-			if !strings.HasPrefix(kv[1], "0x") {
-				return PublicInputs{}, fmt.Errorf("commitment must have 0x prefix")
+			if err := validatePromptVersion(kv[1]); err != nil {
+				return PublicInputs{}, err
 			}
-			if _, err := hex.DecodeString(strings.TrimPrefix(kv[1], "0x")); err != nil {
-				return PublicInputs{}, fmt.Errorf("commitment must be hex")
+			out.PromptVersion = kv[1]
+			seenPV = true
+		case "k":
+			if seenK {
+				return PublicInputs{}, fmt.Errorf("duplicate key id")
 			}
-			out.Commitment = kv[1]
-			seenC = true
+			if _, _, err := ParseKeyID(kv[1]); err != nil {
+				return PublicInputs{}, err
+			}
+			out.KeyID = kv[1]
+			seenK = true
+		case "vk":
+			if seenVK {
+				return PublicInputs{}, fmt.Errorf("duplicate vk fingerprint")
+			}
+			if !isFingerprintHex(kv[1]) {
+				return PublicInputs{}, fmt.Errorf("vk fingerprint must be 64 lowercase hex characters")
+			}
+			out.VKFingerprint = kv[1]
+			seenVK = true
 		default:
 			return PublicInputs{}, fmt.Errorf("unknown public inputs field")
 		}
 	}
-	if !seenPT || !seenMS || !seenOP || !seenC {
+	if !seenPT || !seenOP {
 		return PublicInputs{}, fmt.Errorf("missing public inputs field")
 	}
+	if seenPV && !seenEK {
+		return PublicInputs{}, fmt.Errorf("prompt version requires an evaluator kind")
+	}
+	if seenC {
+		c, err := parseCommitmentHex(out.Commitment)
+		if err != nil && !seenK && !seenPH && !seenEK {
+			// Inputs with none of the fields added since noema_policy_gate_v1
+			// predate canonical field hex, and wrote commitments unpadded.
+			if legacy, ok := parseLegacyCommitmentHex(out.Commitment); ok {
+				c, err = legacy, nil
+			}
+		}
+		if err != nil {
+			return PublicInputs{}, err
+		}
+		out.Commitment = fieldHex(c)
+	}
+	out.HideMaxSeverity = !seenMS
+	out.HideCommitment = !seenC
 	return out, nil
 }
 
@@ -308,6 +739,18 @@ func CommitmentSHA256(parts ...[]byte) string {
 	return "0x" + hex.EncodeToString(h.Sum(nil))
 }
 
+func isFingerprintHex(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
 func boolToInt(v bool) int {
 	if v {
 		return 1
@@ -315,21 +758,102 @@ func boolToInt(v bool) int {
 	return 0
 }
 
+// ParseCommitment parses a commitment in the canonical form public inputs
+// carry it in: 0x followed by 64 lowercase hex digits, below the BN254
+// scalar field modulus.
+func ParseCommitment(commitment string) (*big.Int, error) {
+	return parseCommitmentHex(commitment)
+}
+
 func parseCommitmentHex(commitment string) (*big.Int, error) {
-	if !strings.HasPrefix(commitment, "0x") {
-		return nil, fmt.Errorf("commitment must have 0x prefix")
-	}
-	hexStr := strings.TrimPrefix(commitment, "0x")
-	if hexStr == "" {
+	if commitment == "" {
 		return nil, fmt.Errorf("commitment required")
 	}
+	c, err := parseCanonicalFieldHex(commitment)
+	if err != nil {
+		return nil, fmt.Errorf("commitment %v", err)
+	}
+	return c, nil
+}
+
+// parseLegacyCommitmentHex parses a commitment as noema_policy_gate_v1
+// public inputs wrote them: lowercase hex without leading zeros, padded to an even
+// number of digits. Only that spelling of a value is accepted.
+func parseLegacyCommitmentHex(s string) (*big.Int, bool) {
+	hexStr, ok := strings.CutPrefix(s, "0x")
+	if !ok || hexStr == "" || len(hexStr) > 64 {
+		return nil, false
+	}
+	v, ok := new(big.Int).SetString(hexStr, 16)
+	if !ok || v.Cmp(fr.Modulus()) >= 0 {
+		return nil, false
+	}
+	want := v.Text(16)
+	if len(want)%2 == 1 {
+		want = "0" + want
+	}
+	if hexStr != want {
+		return nil, false
+	}
+	return v, true
+}
+
+// parseCanonicalFieldHex parses a field element written as fieldHex writes
+// it. Public inputs only accept this form: any other spelling of a value,
+// shorter, padded, upper case or not reduced modulo the field, would let
+// different public inputs verify for the same proof.
+func parseCanonicalFieldHex(s string) (*big.Int, error) {
+	hexStr, ok := strings.CutPrefix(s, "0x")
+	if !ok || len(hexStr) != 64 {
+		return nil, fmt.Errorf("must be 0x followed by 64 hex digits")
+	}
+	if strings.ToLower(hexStr) != hexStr {
+		return nil, fmt.Errorf("must be lowercase hex")
+	}
+	b, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, fmt.Errorf("must be hex")
+	}
+	v := new(big.Int).SetBytes(b)
+	if v.Cmp(fr.Modulus()) >= 0 {
+		return nil, fmt.Errorf("must be below the BN254 scalar field modulus")
+	}
+	return v, nil
+}
+
+// parseFieldHex parses a 0x-prefixed hex field element.
+func parseFieldHex(s string) (*big.Int, error) {
+	hexStr, ok := strings.CutPrefix(s, "0x")
+	if !ok || hexStr == "" {
+		return nil, fmt.Errorf("must be 0x-prefixed hex")
+	}
 	b, err := hex.DecodeString(hexStr)
 	if err != nil {
-		return nil, fmt.Errorf("commitment must be hex")
+		return nil, fmt.Errorf("must be hex")
 	}
 	return new(big.Int).SetBytes(b), nil
 }
 
+func parseSalt(saltHex string) (*big.Int, error) {
+	if saltHex == "" {
+		return nil, fmt.Errorf("missing commitment salt")
+	}
+	salt, err := parseFieldHex(saltHex)
+	if err != nil {
+		return nil, fmt.Errorf("commitment salt %v", err)
+	}
+	if salt.Cmp(fr.Modulus()) >= 0 {
+		return nil, fmt.Errorf("commitment salt out of range")
+	}
+	return salt, nil
+}
+
+// fieldHex formats a field element as 0x followed by exactly 64 lowercase
+// hex digits, the canonical form parseCanonicalFieldHex accepts.
+func fieldHex(v *big.Int) string {
+	return fmt.Sprintf("0x%064x", v)
+}
+
 func datasetDigestLimbs(digestHex string) (*big.Int, *big.Int, error) {
 	b, err := hex.DecodeString(digestHex)
 	if err != nil {
@@ -343,52 +867,180 @@ func datasetDigestLimbs(digestHex string) (*big.Int, *big.Int, error) {
 	return lo, hi, nil
 }
 
-func toVarArray(vals [PolicyGateConstraintCount]uint64) [PolicyGateConstraintCount]frontend.Variable {
-	var out [PolicyGateConstraintCount]frontend.Variable
-	for i := 0; i < PolicyGateConstraintCount; i++ {
-		out[i] = vals[i]
+func toVars(vals []*big.Int) []frontend.Variable {
+	out := make([]frontend.Variable, len(vals))
+	for i, v := range vals {
+		out[i] = v
 	}
 	return out
 }
 
-// CommitmentPoseidon computes the PolicyGateCircuit commitment.
-func CommitmentPoseidon(datasetDigestHex string, enabled, maxAllowed, severity [PolicyGateConstraintCount]uint64) (string, error) {
+// Commitment layout versions. V1 commitments are unsalted, cover six fixed
+// constraints without IDs and were issued by noema_policy_gate_v1 keys; they
+// are only recomputed, never produced. V5 commitments bind a salted body,
+// over the constraint IDs and the evaluator provenance, with the dataset
+// digest; when the evaluator saw a sample of the dataset they bind
+// sampling.Binding of the dataset digest and the sample in the digest's
+// place. Versions 2 to 4 were never released.
+const (
+	CommitmentVersionV1 = 1
+	CommitmentVersionV5 = 5
+)
+
+// legacyConstraintCount is the fixed number of constraints covered by V1
+// commitments, in the order of the six preset constraints.
+const legacyConstraintCount = 6
+
+// constraintIDDomain prefixes constraint IDs before hashing.
+const constraintIDDomain = "noema_constraint_id_v1|"
+
+// ConstraintIDHash returns the field element a constraint ID is bound as in
+// the circuit, as 0x hex: the first 31 bytes of
+// SHA-256("noema_constraint_id_v1|" || id).
+func ConstraintIDHash(id string) string {
+	return fieldHex(constraintIDField(id))
+}
+
+func constraintIDField(id string) *big.Int {
+	sum := sha256.Sum256([]byte(constraintIDDomain + id))
+	return new(big.Int).SetBytes(sum[:31])
+}
+
+// commitmentSaltBytes keeps salts below the BN254 scalar field modulus.
+const commitmentSaltBytes = 31
+
+// NewCommitmentSalt returns a fresh random blinding factor as 0x hex.
+func NewCommitmentSalt() (string, error) {
+	b := make([]byte, commitmentSaltBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate commitment salt: %w", err)
+	}
+	return "0x" + hex.EncodeToString(b), nil
+}
+
+// CommitmentPoseidon computes the PolicyGateCircuit commitment (V5):
+// Poseidon(domainV5, body, datasetDigest) over the CommitmentBody of w.
+// w must carry its Provenance.
+func CommitmentPoseidon(w *WitnessInputs) (string, error) {
+	body, err := CommitmentBody(w)
+	if err != nil {
+		return "", err
+	}
+	return CommitmentFromBody(body, w.DatasetDigestHex)
+}
+
+// CommitmentBody computes the salted hash a V5 commitment binds next to
+// the dataset digest, as 0x hex:
+// Poseidon(bodyDomainV1, slots, salt, provenance, ids, enabled, maxAllowed, severity)
+// with every per-constraint input padded to the circuit size. It hides
+// everything it covers, so it can be revealed to open the dataset digest
+// alone.
+func CommitmentBody(w *WitnessInputs) (string, error) {
+	provenance, err := w.Provenance.fields()
+	if err != nil {
+		return "", err
+	}
+	salt, err := parseSalt(w.Salt)
+	if err != nil {
+		return "", err
+	}
+	slots, padded, err := w.paddedSlots()
+	if err != nil {
+		return "", err
+	}
+	inputs := make([]*big.Int, 0, 3+len(provenance)+4*slots)
+	inputs = append(inputs, big.NewInt(policyzk.CommitmentBodyDomainSepV1), big.NewInt(int64(slots)), salt)
+	inputs = append(inputs, provenance...)
+	for _, vals := range padded {
+		inputs = append(inputs, vals...)
+	}
+	return fieldHex(poseidonHashChunksNative(inputs)), nil
+}
+
+// CommitmentFromBody computes the V5 commitment over a commitment body and
+// the dataset digest it was bound with.
+func CommitmentFromBody(body, datasetDigestHex string) (string, error) {
+	b, err := parseCanonicalFieldHex(body)
+	if err != nil {
+		return "", fmt.Errorf("commitment body: %w", err)
+	}
+	lo, hi, err := datasetDigestLimbs(datasetDigestHex)
+	if err != nil {
+		return "", err
+	}
+	return fieldHex(poseidonHashChunksNative([]*big.Int{big.NewInt(policyzk.CommitmentDomainSepV5), b, lo, hi})), nil
+}
+
+// CommitmentPoseidonV1 computes the unsalted v1 commitment, for checking
+// commitments issued before salting was introduced.
+func CommitmentPoseidonV1(datasetDigestHex string, enabled, maxAllowed, severity []uint64) (string, error) {
+	if len(enabled) != legacyConstraintCount || len(maxAllowed) != legacyConstraintCount || len(severity) != legacyConstraintCount {
+		return "", fmt.Errorf("legacy commitments cover exactly %d constraints", legacyConstraintCount)
+	}
 	lo, hi, err := datasetDigestLimbs(datasetDigestHex)
 	if err != nil {
 		return "", err
 	}
 
-	inputs := make([]*big.Int, 0, 3+3*PolicyGateConstraintCount)
-	inputs = append(inputs, big.NewInt(policyGateDomainSep))
-	inputs = append(inputs, lo, hi)
-	for i := 0; i < PolicyGateConstraintCount; i++ {
-		inputs = append(inputs, new(big.Int).SetUint64(enabled[i]))
+	inputs := make([]*big.Int, 0, 3+3*legacyConstraintCount)
+	inputs = append(inputs, big.NewInt(policyzk.CommitmentDomainSepV1), lo, hi)
+	for _, vals := range [][]uint64{enabled, maxAllowed, severity} {
+		for _, v := range vals {
+			inputs = append(inputs, new(big.Int).SetUint64(v))
+		}
 	}
-	for i := 0; i < PolicyGateConstraintCount; i++ {
-		inputs = append(inputs, new(big.Int).SetUint64(maxAllowed[i]))
+
+	return fieldHex(poseidonHashChunksNative(inputs)), nil
+}
+
+// PolicyHashPoseidon computes the PolicyGateCircuit policy hash over the
+// constraint IDs, enabled flags and max_allowed values:
+// Poseidon(policyDomainV2, slots, ids, enabled, maxAllowed), padded like the
+// commitment. Severities and salt are ignored.
+func PolicyHashPoseidon(w *WitnessInputs) (string, error) {
+	slots, padded, err := w.paddedSlots()
+	if err != nil {
+		return "", err
 	}
-	for i := 0; i < PolicyGateConstraintCount; i++ {
-		inputs = append(inputs, new(big.Int).SetUint64(severity[i]))
+	inputs := make([]*big.Int, 0, 2+3*slots)
+	inputs = append(inputs, big.NewInt(policyzk.PolicyHashDomainSepV2), big.NewInt(int64(slots)))
+	for _, vals := range padded[:3] {
+		inputs = append(inputs, vals...)
 	}
+	return fieldHex(poseidonHashChunksNative(inputs)), nil
+}
 
-	hash := poseidonHashChunksNative(inputs)
-	hexStr := hash.Text(16)
-	if len(hexStr)%2 == 1 {
-		hexStr = "0" + hexStr
+// PolicyThreshold is the strictest max_allowed among enabled constraints, or
+// 0 when none are enabled. It matches the circuit's PolicyThreshold signal.
+func PolicyThreshold(enabled, maxAllowed []uint64) int {
+	threshold := -1
+	for i := 0; i < len(enabled) && i < len(maxAllowed); i++ {
+		if enabled[i] == 1 && (threshold < 0 || int(maxAllowed[i]) < threshold) {
+			threshold = int(maxAllowed[i])
+		}
+	}
+	if threshold < 0 {
+		return 0
 	}
-	return "0x" + hexStr, nil
+	return threshold
 }
 
+// poseidonHashChunksNative matches the circuit's poseidonHashChunks.
 func poseidonHashChunksNative(inputs []*big.Int) *big.Int {
 	const maxInputs = 16
 	if len(inputs) <= maxInputs {
 		return poseidonNative(inputs)
 	}
 	h := poseidonNative(inputs[:maxInputs])
-	rest := make([]*big.Int, 0, 1+len(inputs[maxInputs:]))
-	rest = append(rest, h)
-	rest = append(rest, inputs[maxInputs:]...)
-	return poseidonNative(rest)
+	for rest := inputs[maxInputs:]; len(rest) > 0; {
+		k := min(len(rest), maxInputs-1)
+		chunk := make([]*big.Int, 0, 1+k)
+		chunk = append(chunk, h)
+		chunk = append(chunk, rest[:k]...)
+		h = poseidonNative(chunk)
+		rest = rest[k:]
+	}
+	return h
 }
 
 func poseidonNative(inputs []*big.Int) *big.Int {
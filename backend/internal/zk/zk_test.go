@@ -2,13 +2,16 @@ package zk
 
 import (
 	"encoding/base64"
+	"math/big"
 	"strings"
 	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
 )
 
 func TestProofRoundTrip(t *testing.T) {
 	witness := testWitnessInputs()
-	commitment, err := CommitmentPoseidon(witness.DatasetDigestHex, witness.Enabled, witness.MaxAllowed, witness.Severity)
+	commitment, err := CommitmentPoseidon(witness)
 	if err != nil {
 		t.Fatalf("CommitmentPoseidon error: %v", err)
 	}
@@ -34,7 +37,7 @@ func TestProofRoundTrip(t *testing.T) {
 
 func TestProofMismatch(t *testing.T) {
 	witness := testWitnessInputs()
-	commitment, err := CommitmentPoseidon(witness.DatasetDigestHex, witness.Enabled, witness.MaxAllowed, witness.Severity)
+	commitment, err := CommitmentPoseidon(witness)
 	if err != nil {
 		t.Fatalf("CommitmentPoseidon error: %v", err)
 	}
@@ -50,16 +53,8 @@ func TestProofMismatch(t *testing.T) {
 		t.Fatalf("GenerateProof error: %v", err)
 	}
 
-	badPub, err := EncodePublicInputs(PublicInputs{
-		PolicyThreshold: 0,
-		MaxSeverity:     2,
-		OverallPass:     false,
-		Commitment:      commitment,
-	})
-	if err != nil {
-		t.Fatalf("EncodePublicInputs error: %v", err)
-	}
-	ok, _, err := VerifyProof(proof.ProofB64, base64.StdEncoding.EncodeToString(badPub))
+	badPub := tamperPublicInputs(t, proof, func(pi *PublicInputs) { pi.OverallPass = false })
+	ok, _, err := VerifyProof(proof.ProofB64, badPub)
 	if err != nil {
 		t.Fatalf("VerifyProof error: %v", err)
 	}
@@ -70,10 +65,25 @@ func TestProofMismatch(t *testing.T) {
 
 func testWitnessInputs() *WitnessInputs {
 	return &WitnessInputs{
+		Salt:             "0x0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcd",
 		DatasetDigestHex: "00112233445566778899aabbccddeeffffeeddccbbaa99887766554433221100",
-		Enabled:          [PolicyGateConstraintCount]uint64{1, 1, 1, 0, 1, 0},
-		MaxAllowed:       [PolicyGateConstraintCount]uint64{1, 2, 0, 1, 2, 0},
-		Severity:         [PolicyGateConstraintCount]uint64{1, 2, 0, 2, 1, 2},
+		ConstraintIDs: []string{
+			"pii_exposure_risk",
+			"regulated_sensitive_data_presence",
+			"data_provenance_or_consent_violation_risk",
+			"safety_critical_advisory_presence",
+			"harm_enabling_content_risk",
+			"dataset_intended_use_mismatch",
+		},
+		Enabled:    []uint64{1, 1, 1, 0, 1, 0},
+		MaxAllowed: []uint64{1, 2, 0, 1, 2, 0},
+		Severity:   []uint64{1, 2, 0, 2, 1, 2},
+		Provenance: &Provenance{
+			Kind:          EvaluatorGemini,
+			Model:         "gemini-2.5-flash",
+			PromptVersion: "noema-eval-v2",
+			ResponseHash:  ResponseHash([]byte(`{"severities":{}}`)),
+		},
 	}
 }
 
@@ -82,7 +92,7 @@ func TestEncodePublicInputsValidation(t *testing.T) {
 		PolicyThreshold: 3,
 		MaxSeverity:     0,
 		OverallPass:     true,
-		Commitment:      "0xabc",
+		Commitment:      testFieldHex(0xabc),
 	})
 	if err == nil {
 		t.Fatalf("expected validation error for policy threshold")
@@ -92,7 +102,7 @@ func TestEncodePublicInputsValidation(t *testing.T) {
 		PolicyThreshold: 1,
 		MaxSeverity:     3,
 		OverallPass:     true,
-		Commitment:      "0xabc",
+		Commitment:      testFieldHex(0xabc),
 	})
 	if err == nil {
 		t.Fatalf("expected validation error for max severity")
@@ -115,20 +125,194 @@ func TestDecodePublicInputsValidation(t *testing.T) {
 		t.Fatalf("expected validation error for commitment format")
 	}
 
-	_, err = DecodePublicInputs([]byte("noema_public_inputs_v1|pt=3|ms=1|op=1|c=0xabc123"))
+	_, err = DecodePublicInputs([]byte("noema_public_inputs_v1|pt=3|ms=1|op=1|c=" + testFieldHex(0xabc123)))
 	if err == nil {
 		t.Fatalf("expected validation error for policy threshold range")
 	}
 
-	_, err = DecodePublicInputs([]byte("noema_public_inputs_v1|pt=1|ms=1|c=0xabc123"))
+	_, err = DecodePublicInputs([]byte("noema_public_inputs_v1|pt=1|ms=1|c=" + testFieldHex(0xabc123)))
 	if err == nil {
 		t.Fatalf("expected validation error for missing fields")
 	}
 
-	_, err = DecodePublicInputs([]byte("noema_public_inputs_v1|pt=1|pt=2|ms=1|op=1|c=0xabc123"))
+	_, err = DecodePublicInputs([]byte("noema_public_inputs_v1|pt=1|pt=2|ms=1|op=1|c=" + testFieldHex(0xabc123)))
 	if err == nil {
 		t.Fatalf("expected validation error for duplicate fields")
 	}
+
+	for _, fields := range []string{"ek=oracle", "pv=noema-eval-v2", "ek=gemini|pv=", "ek=gemini|pv=a=b"} {
+		_, err = DecodePublicInputs([]byte("noema_public_inputs_v1|pt=1|ms=1|op=1|c=" + testFieldHex(0xabc123) + "|" + fields))
+		if err == nil {
+			t.Fatalf("expected validation error for %s", fields)
+		}
+	}
+}
+
+func TestPublicInputsRejectNonCanonicalFieldHex(t *testing.T) {
+	canonical := testFieldHex(0xabc123)
+	aboveModulus := new(big.Int).Add(fr.Modulus(), big.NewInt(0xabc123))
+	bad := map[string]string{
+		"short":         "0xabc123",
+		"leading zeros": "0x00" + canonical[2:],
+		"upper case":    "0x" + strings.ToUpper(canonical[2:]),
+		"no prefix":     "00" + canonical[2:],
+		"modulus":       fieldHex(fr.Modulus()),
+		"above modulus": fieldHex(aboveModulus),
+		"not hex":       "0x" + strings.Repeat("zz", 32),
+	}
+	decode := func(c, ph string) error {
+		_, err := DecodePublicInputs([]byte("noema_public_inputs_v1|pt=1|ms=1|op=1|c=" + c + "|ph=" + ph))
+		return err
+	}
+	if err := decode(canonical, testFieldHex(2)); err != nil {
+		t.Fatalf("DecodePublicInputs error: %v", err)
+	}
+	for name, v := range bad {
+		if err := decode(v, testFieldHex(2)); err == nil {
+			t.Fatalf("%s: expected commitment %s to be rejected", name, v)
+		}
+		if err := decode(canonical, v); err == nil {
+			t.Fatalf("%s: expected policy hash %s to be rejected", name, v)
+		}
+		if _, err := EncodePublicInputs(PublicInputs{PolicyThreshold: 1, OverallPass: true, Commitment: v}); err == nil {
+			t.Fatalf("%s: expected encoding commitment %s to be rejected", name, v)
+		}
+		if _, err := EncodePublicInputs(PublicInputs{PolicyThreshold: 1, OverallPass: true, Commitment: canonical, PolicyHash: v}); err == nil {
+			t.Fatalf("%s: expected encoding policy hash %s to be rejected", name, v)
+		}
+	}
+}
+
+func TestLegacyPublicInputsAcceptShortCommitment(t *testing.T) {
+	decode := func(c string) (PublicInputs, error) {
+		return DecodePublicInputs([]byte("noema_public_inputs_v1|pt=1|ms=1|op=1|c=" + c))
+	}
+	for _, c := range []string{"0xabc123", "0x0abc12", testFieldHex(0xabc123)} {
+		pi, err := decode(c)
+		if err != nil {
+			t.Fatalf("DecodePublicInputs(%s) error: %v", c, err)
+		}
+		if _, err := parseCanonicalFieldHex(pi.Commitment); err != nil {
+			t.Fatalf("expected %s to be padded to canonical, got %s", c, pi.Commitment)
+		}
+	}
+	// Only the spelling the v1 encoder wrote is accepted.
+	for _, c := range []string{"0xabc12", "0x00abc123", "0xABC123", "0x", "0x" + fr.Modulus().Text(16)} {
+		if _, err := decode(c); err == nil {
+			t.Fatalf("expected legacy commitment %s to be rejected", c)
+		}
+	}
+	// Inputs with newer fields keep the strict check.
+	if _, err := DecodePublicInputs([]byte("noema_public_inputs_v1|pt=1|ms=1|op=1|c=0xabc123|k=noema_policy_gate_v6_n8.k1")); err == nil {
+		t.Fatalf("expected a short commitment with a key ID to be rejected")
+	}
+}
+
+// testFieldHex returns n in the canonical public-input encoding.
+func testFieldHex(n int64) string {
+	return fieldHex(big.NewInt(n))
+}
+
+func TestPublicInputsRoundTripProvenance(t *testing.T) {
+	pi := PublicInputs{
+		PolicyThreshold: 1,
+		MaxSeverity:     1,
+		OverallPass:     true,
+		Commitment:      testFieldHex(1),
+		PolicyHash:      testFieldHex(2),
+		EvaluatorKind:   EvaluatorGemini,
+		PromptVersion:   "noema-eval-v2",
+	}
+	raw, err := EncodePublicInputs(pi)
+	if err != nil {
+		t.Fatalf("EncodePublicInputs error: %v", err)
+	}
+	if !strings.Contains(string(raw), "|ph="+testFieldHex(2)+"|ek=gemini|pv=noema-eval-v2") {
+		t.Fatalf("unexpected encoding %s", raw)
+	}
+	got, err := DecodePublicInputs(raw)
+	if err != nil {
+		t.Fatalf("DecodePublicInputs error: %v", err)
+	}
+	if got.EvaluatorKind != pi.EvaluatorKind || got.PromptVersion != pi.PromptVersion {
+		t.Fatalf("expected provenance after decode, got %+v", got)
+	}
+	out := got.Outputs()
+	if out.EvaluatorKind != EvaluatorGemini || !strings.HasSuffix(strings.Join(out.Disclosed, ","), "evaluator_kind,prompt_version") {
+		t.Fatalf("expected provenance to be disclosed, got %+v", out)
+	}
+
+	if _, err := EncodePublicInputs(PublicInputs{Commitment: testFieldHex(1), PromptVersion: "v1"}); err == nil {
+		t.Fatalf("expected a prompt version without evaluator kind to be rejected")
+	}
+	if _, err := EncodePublicInputs(PublicInputs{Commitment: testFieldHex(1), EvaluatorKind: EvaluatorStub, PromptVersion: strings.Repeat("v", 32)}); err == nil {
+		t.Fatalf("expected an overlong prompt version to be rejected")
+	}
+}
+
+func TestCheckEvaluator(t *testing.T) {
+	gemini := PublicInputs{EvaluatorKind: EvaluatorGemini}
+	if err := gemini.CheckEvaluator([]string{EvaluatorGemini}); err != nil {
+		t.Fatalf("expected gemini to be accepted, got %v", err)
+	}
+	if err := (PublicInputs{EvaluatorKind: EvaluatorStub}).CheckEvaluator([]string{EvaluatorGemini}); err == nil {
+		t.Fatalf("expected stub to be rejected")
+	}
+	if err := (PublicInputs{}).CheckEvaluator([]string{EvaluatorGemini}); err == nil {
+		t.Fatalf("expected proofs without provenance to be rejected")
+	}
+	if err := (PublicInputs{}).CheckEvaluator(nil); err != nil {
+		t.Fatalf("expected no requirement to accept anything, got %v", err)
+	}
+}
+
+func TestProofBindsEvaluatorProvenance(t *testing.T) {
+	proof := generateTestProof(t)
+	pi, err := DecodePublicInputsB64(proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("DecodePublicInputsB64 error: %v", err)
+	}
+	if pi.EvaluatorKind != EvaluatorGemini || pi.PromptVersion != "noema-eval-v2" {
+		t.Fatalf("expected the witness provenance in the public inputs, got %+v", pi)
+	}
+	for name, mutate := range map[string]func(*PublicInputs){
+		"kind":           func(pi *PublicInputs) { pi.EvaluatorKind = EvaluatorClient },
+		"prompt version": func(pi *PublicInputs) { pi.PromptVersion = "noema-eval-v3" },
+	} {
+		ok, _, err := VerifyProof(proof.ProofB64, tamperPublicInputs(t, proof, mutate))
+		if err != nil {
+			t.Fatalf("%s: VerifyProof error: %v", name, err)
+		}
+		if ok {
+			t.Fatalf("%s: expected verification to fail", name)
+		}
+	}
+	ok, msg, err := VerifyProof(proof.ProofB64, tamperPublicInputs(t, proof, func(pi *PublicInputs) {
+		pi.EvaluatorKind, pi.PromptVersion = "", ""
+	}))
+	if err != nil || ok || msg != "missing evaluator kind" {
+		t.Fatalf("expected missing evaluator kind, got ok=%v msg=%q err=%v", ok, msg, err)
+	}
+
+	witness := testWitnessInputs()
+	commitment, err := CommitmentPoseidon(witness)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	_, err = GenerateProof(PublicInputs{
+		MaxSeverity:   2,
+		OverallPass:   true,
+		Commitment:    commitment,
+		EvaluatorKind: EvaluatorStub,
+		Witness:       witness,
+	})
+	if err == nil || !strings.Contains(err.Error(), "provenance") {
+		t.Fatalf("expected provenance mismatch error, got %v", err)
+	}
+	witness.Provenance = nil
+	if _, err := CommitmentPoseidon(witness); err == nil {
+		t.Fatalf("expected error for a witness without provenance")
+	}
 }
 
 // --- NEW TESTS ---
@@ -140,7 +324,7 @@ func TestCannotClaimPassWhenWitnessFailsPolicy(t *testing.T) {
 	witness.MaxAllowed[0] = 0
 	witness.Severity[0] = 2 // 2 > 0 => fail when enabled
 
-	commitment, err := CommitmentPoseidon(witness.DatasetDigestHex, witness.Enabled, witness.MaxAllowed, witness.Severity)
+	commitment, err := CommitmentPoseidon(witness)
 	if err != nil {
 		t.Fatalf("CommitmentPoseidon error: %v", err)
 	}
@@ -176,7 +360,7 @@ func TestFailingWitnessCanProveWithOverallPassFalse(t *testing.T) {
 	witness.MaxAllowed[0] = 0
 	witness.Severity[0] = 2 // 2 > 0 => fail
 
-	commitment, err := CommitmentPoseidon(witness.DatasetDigestHex, witness.Enabled, witness.MaxAllowed, witness.Severity)
+	commitment, err := CommitmentPoseidon(witness)
 	if err != nil {
 		t.Fatalf("CommitmentPoseidon error: %v", err)
 	}
@@ -204,7 +388,7 @@ func TestFailingWitnessCanProveWithOverallPassFalse(t *testing.T) {
 
 func TestCommitmentMismatchFailsVerification(t *testing.T) {
 	witness := testWitnessInputs()
-	commitment, err := CommitmentPoseidon(witness.DatasetDigestHex, witness.Enabled, witness.MaxAllowed, witness.Severity)
+	commitment, err := CommitmentPoseidon(witness)
 	if err != nil {
 		t.Fatalf("CommitmentPoseidon error: %v", err)
 	}
@@ -224,17 +408,9 @@ func TestCommitmentMismatchFailsVerification(t *testing.T) {
 	// Flip one hex nibble of the commitment in the PUBLIC INPUTS.
 	badCommit := flipHexNibble(commitment)
 
-	badPub, err := EncodePublicInputs(PublicInputs{
-		PolicyThreshold: 0,
-		MaxSeverity:     2,
-		OverallPass:     true,
-		Commitment:      badCommit,
-	})
-	if err != nil {
-		t.Fatalf("EncodePublicInputs error: %v", err)
-	}
+	badPub := tamperPublicInputs(t, proof, func(pi *PublicInputs) { pi.Commitment = badCommit })
 
-	ok, _, err := VerifyProof(proof.ProofB64, base64.StdEncoding.EncodeToString(badPub))
+	ok, _, err := VerifyProof(proof.ProofB64, badPub)
 	if err != nil {
 		t.Fatalf("VerifyProof error: %v", err)
 	}
@@ -245,7 +421,7 @@ func TestCommitmentMismatchFailsVerification(t *testing.T) {
 
 func TestMaxSeverityMismatchFailsVerification(t *testing.T) {
 	witness := testWitnessInputs()
-	commitment, err := CommitmentPoseidon(witness.DatasetDigestHex, witness.Enabled, witness.MaxAllowed, witness.Severity)
+	commitment, err := CommitmentPoseidon(witness)
 	if err != nil {
 		t.Fatalf("CommitmentPoseidon error: %v", err)
 	}
@@ -263,27 +439,151 @@ func TestMaxSeverityMismatchFailsVerification(t *testing.T) {
 	}
 
 	// Wrong MaxSeverity (should be 2 for the test witness; try 1).
-	badPub, err := EncodePublicInputs(PublicInputs{
-		PolicyThreshold: 0,
-		MaxSeverity:     1, // <- wrong
-		OverallPass:     true,
-		Commitment:      commitment,
-	})
+	badPub := tamperPublicInputs(t, proof, func(pi *PublicInputs) { pi.MaxSeverity = 1 }) // <- wrong
+
+	ok, _, err := VerifyProof(proof.ProofB64, badPub)
 	if err != nil {
-		t.Fatalf("EncodePublicInputs error: %v", err)
+		t.Fatalf("VerifyProof error: %v", err)
+	}
+	if ok {
+		t.Fatalf("expected proof to fail when MaxSeverity is changed (MaxSeverity may not be properly constrained/bound)")
+	}
+}
+
+func TestPolicyThresholdMismatchFailsVerification(t *testing.T) {
+	proof := generateTestProof(t)
+	// The test witness's strictest enabled max_allowed is 0; claim a laxer policy.
+	for _, pt := range []int{1, 2} {
+		badPub := tamperPublicInputs(t, proof, func(pi *PublicInputs) { pi.PolicyThreshold = pt })
+		ok, _, err := VerifyProof(proof.ProofB64, badPub)
+		if err != nil {
+			t.Fatalf("VerifyProof error: %v", err)
+		}
+		if ok {
+			t.Fatalf("expected proof to fail when PolicyThreshold is changed to %d", pt)
+		}
+	}
+}
+
+func TestPolicyHashMismatchFailsVerification(t *testing.T) {
+	proof := generateTestProof(t)
+	witness := testWitnessInputs()
+	witness.MaxAllowed[2] = 2
+	otherPolicy, err := PolicyHashPoseidon(witness)
+	if err != nil {
+		t.Fatalf("PolicyHashPoseidon error: %v", err)
 	}
 
-	ok, _, err := VerifyProof(proof.ProofB64, base64.StdEncoding.EncodeToString(badPub))
+	badPub := tamperPublicInputs(t, proof, func(pi *PublicInputs) { pi.PolicyHash = otherPolicy })
+	ok, _, err := VerifyProof(proof.ProofB64, badPub)
 	if err != nil {
 		t.Fatalf("VerifyProof error: %v", err)
 	}
 	if ok {
-		t.Fatalf("expected proof to fail when MaxSeverity is changed (MaxSeverity may not be properly constrained/bound)")
+		t.Fatalf("expected proof to fail when PolicyHash is changed")
+	}
+
+	noHash := tamperPublicInputs(t, proof, func(pi *PublicInputs) { pi.PolicyHash = "" })
+	ok, msg, err := VerifyProof(proof.ProofB64, noHash)
+	if err != nil {
+		t.Fatalf("VerifyProof error: %v", err)
+	}
+	if ok || msg != "missing policy hash" {
+		t.Fatalf("expected missing policy hash, got ok=%v msg=%q", ok, msg)
+	}
+}
+
+func TestGenerateProofBindsPolicy(t *testing.T) {
+	witness := testWitnessInputs()
+	proof := generateTestProof(t)
+	pub, err := base64.StdEncoding.DecodeString(proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("decode public inputs: %v", err)
+	}
+	pi, err := DecodePublicInputs(pub)
+	if err != nil {
+		t.Fatalf("DecodePublicInputs error: %v", err)
+	}
+	if policyHash, err := PolicyHashPoseidon(witness); err != nil || pi.PolicyHash != policyHash {
+		t.Fatalf("expected public inputs to carry the policy hash")
+	}
+
+	commitment, err := CommitmentPoseidon(witness)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	_, err = GenerateProof(PublicInputs{
+		PolicyThreshold: 1,
+		MaxSeverity:     2,
+		OverallPass:     true,
+		Commitment:      commitment,
+		Witness:         witness,
+	})
+	if err == nil || !strings.Contains(err.Error(), "policy threshold") {
+		t.Fatalf("expected policy threshold error, got %v", err)
+	}
+}
+
+func TestPolicyThreshold(t *testing.T) {
+	cases := []struct {
+		enabled    []uint64
+		maxAllowed []uint64
+		want       int
+	}{
+		{[]uint64{1, 1, 1, 0, 1, 0}, []uint64{1, 2, 0, 1, 2, 0}, 0},
+		{[]uint64{1, 1, 0, 0, 0, 0}, []uint64{2, 1, 0, 0, 0, 0}, 1},
+		{[]uint64{0, 0, 0, 0, 0, 1}, []uint64{0, 0, 0, 0, 0, 2}, 2},
+		{[]uint64{}, []uint64{0, 1, 2, 0, 1, 2}, 0},
+	}
+	for _, tc := range cases {
+		if got := PolicyThreshold(tc.enabled, tc.maxAllowed); got != tc.want {
+			t.Fatalf("PolicyThreshold(%v, %v) = %d, want %d", tc.enabled, tc.maxAllowed, got, tc.want)
+		}
 	}
 }
 
 // --- helpers ---
 
+func generateTestProof(t *testing.T) Proof {
+	t.Helper()
+	witness := testWitnessInputs()
+	commitment, err := CommitmentPoseidon(witness)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	proof, err := GenerateProof(PublicInputs{
+		PolicyThreshold: 0,
+		MaxSeverity:     2,
+		OverallPass:     true,
+		Commitment:      commitment,
+		Witness:         witness,
+	})
+	if err != nil {
+		t.Fatalf("GenerateProof error: %v", err)
+	}
+	return proof
+}
+
+// tamperPublicInputs decodes the proof's public inputs, applies mutate and
+// re-encodes them, so only the mutated field differs.
+func tamperPublicInputs(t *testing.T, proof Proof, mutate func(*PublicInputs)) string {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(proof.PublicInputsB64)
+	if err != nil {
+		t.Fatalf("decode public inputs: %v", err)
+	}
+	pi, err := DecodePublicInputs(raw)
+	if err != nil {
+		t.Fatalf("DecodePublicInputs error: %v", err)
+	}
+	mutate(&pi)
+	pub, err := EncodePublicInputs(pi)
+	if err != nil {
+		t.Fatalf("EncodePublicInputs error: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(pub)
+}
+
 // flipHexNibble flips the last hex nibble of a 0x-prefixed hex string.
 // This is enough to guarantee a different value while keeping formatting valid.
 func flipHexNibble(hexStr string) string {
@@ -306,3 +606,221 @@ func flipHexNibble(hexStr string) string {
 	out := s[:len(s)-1] + string(flipped)
 	return "0x" + out
 }
+
+func TestPublicInputsVKFingerprintRoundTrip(t *testing.T) {
+	fp := strings.Repeat("ab", 32)
+	pub, err := EncodePublicInputs(PublicInputs{
+		PolicyThreshold: 1,
+		MaxSeverity:     1,
+		OverallPass:     true,
+		Commitment:      testFieldHex(0xabc123),
+		VKFingerprint:   fp,
+	})
+	if err != nil {
+		t.Fatalf("EncodePublicInputs error: %v", err)
+	}
+	pi, err := DecodePublicInputs(pub)
+	if err != nil {
+		t.Fatalf("DecodePublicInputs error: %v", err)
+	}
+	if pi.VKFingerprint != fp {
+		t.Fatalf("expected vk fingerprint %s, got %s", fp, pi.VKFingerprint)
+	}
+
+	_, err = DecodePublicInputs([]byte("noema_public_inputs_v1|pt=1|ms=1|op=1|c=" + testFieldHex(0xabc123) + "|vk=XYZ"))
+	if err == nil {
+		t.Fatalf("expected validation error for vk fingerprint format")
+	}
+}
+
+func TestVerifyProofRejectsOtherVerifyingKey(t *testing.T) {
+	witness := testWitnessInputs()
+	commitment, err := CommitmentPoseidon(witness)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	proof, err := GenerateProof(PublicInputs{
+		PolicyThreshold: 0,
+		MaxSeverity:     2,
+		OverallPass:     true,
+		Commitment:      commitment,
+		Witness:         witness,
+	})
+	if err != nil {
+		t.Fatalf("GenerateProof error: %v", err)
+	}
+	if proof.VKFingerprint == "" || proof.CircuitID != defaultCircuitID() || proof.KeyID == "" {
+		t.Fatalf("expected proof to carry circuit id, key id and vk fingerprint")
+	}
+
+	cases := []struct {
+		keyID string
+		want  string
+	}{
+		{"", "unknown verifying key"},
+		{proof.KeyID, "verifying key mismatch"},
+		{FormatKeyID(defaultCircuitID(), 99), "unknown verifying key"},
+	}
+	for _, tc := range cases {
+		badPub, err := EncodePublicInputs(PublicInputs{
+			PolicyThreshold: 0,
+			MaxSeverity:     2,
+			OverallPass:     true,
+			Commitment:      commitment,
+			KeyID:           tc.keyID,
+			VKFingerprint:   strings.Repeat("0", 64),
+		})
+		if err != nil {
+			t.Fatalf("EncodePublicInputs error: %v", err)
+		}
+		ok, msg, err := VerifyProof(proof.ProofB64, base64.StdEncoding.EncodeToString(badPub))
+		if err != nil {
+			t.Fatalf("VerifyProof error: %v", err)
+		}
+		if ok || msg != tc.want {
+			t.Fatalf("key %q: expected %q, got ok=%v msg=%q", tc.keyID, tc.want, ok, msg)
+		}
+	}
+}
+
+func TestCommitmentSaltBlindsCommitment(t *testing.T) {
+	witness := testWitnessInputs()
+	a, err := NewCommitmentSalt()
+	if err != nil {
+		t.Fatalf("NewCommitmentSalt error: %v", err)
+	}
+	b, err := NewCommitmentSalt()
+	if err != nil {
+		t.Fatalf("NewCommitmentSalt error: %v", err)
+	}
+	if a == b || len(a) != 2+2*commitmentSaltBytes {
+		t.Fatalf("expected distinct %d-byte salts, got %s and %s", commitmentSaltBytes, a, b)
+	}
+	withSalt := func(salt string) *WitnessInputs {
+		w := *witness
+		w.Salt = salt
+		return &w
+	}
+	ca, err := CommitmentPoseidon(withSalt(a))
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	cb, err := CommitmentPoseidon(withSalt(b))
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	if ca == cb {
+		t.Fatalf("expected different salts to give different commitments")
+	}
+
+	if _, err := CommitmentPoseidon(withSalt("")); err == nil {
+		t.Fatalf("expected error for missing salt")
+	}
+	tooBig := "0x" + strings.Repeat("ff", 32)
+	if _, err := CommitmentPoseidon(withSalt(tooBig)); err == nil {
+		t.Fatalf("expected error for salt outside the field")
+	}
+}
+
+func TestCommitmentPoseidonV1Unchanged(t *testing.T) {
+	// Pinned from the unsalted commitment issued before salting existed.
+	const want = "0x159a270be35a47ac3d3613b731c533648ba296861cf427396225eec8de24b153"
+	witness := testWitnessInputs()
+	got, err := CommitmentPoseidonV1(witness.DatasetDigestHex, witness.Enabled, witness.MaxAllowed, witness.Severity)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidonV1 error: %v", err)
+	}
+	if got != want {
+		t.Fatalf("v1 commitment changed: got %s, want %s", got, want)
+	}
+}
+
+func TestGenerateProofRequiresSalt(t *testing.T) {
+	witness := testWitnessInputs()
+	commitment, err := CommitmentPoseidonV1(witness.DatasetDigestHex, witness.Enabled, witness.MaxAllowed, witness.Severity)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidonV1 error: %v", err)
+	}
+	witness.Salt = ""
+	_, err = GenerateProof(PublicInputs{
+		PolicyThreshold: 0,
+		MaxSeverity:     2,
+		OverallPass:     true,
+		Commitment:      commitment,
+		Witness:         witness,
+	})
+	if err == nil || !strings.Contains(err.Error(), "salt") {
+		t.Fatalf("expected missing salt error, got %v", err)
+	}
+}
+
+func TestPublicInputsRoundTripHiddenOutputs(t *testing.T) {
+	pi := PublicInputs{
+		PolicyThreshold: 1,
+		MaxSeverity:     2,
+		OverallPass:     true,
+		Commitment:      testFieldHex(1),
+		PolicyHash:      testFieldHex(2),
+		HideMaxSeverity: true,
+		HideCommitment:  true,
+	}
+	raw, err := EncodePublicInputs(pi)
+	if err != nil {
+		t.Fatalf("EncodePublicInputs error: %v", err)
+	}
+	if strings.Contains(string(raw), "|ms=") || strings.Contains(string(raw), "|c=") {
+		t.Fatalf("expected hidden fields to be omitted, got %s", raw)
+	}
+	got, err := DecodePublicInputs(raw)
+	if err != nil {
+		t.Fatalf("DecodePublicInputs error: %v", err)
+	}
+	if !got.HideMaxSeverity || !got.HideCommitment || got.MaxSeverity != 0 || got.Commitment != "" {
+		t.Fatalf("expected hidden outputs after decode, got %+v", got)
+	}
+	out := got.Outputs()
+	if out.MaxSeverity != nil || out.Commitment != "" {
+		t.Fatalf("expected hidden outputs to stay undisclosed, got %+v", out)
+	}
+	want := []string{"overall_pass", "policy_threshold", "policy_hash"}
+	if strings.Join(out.Disclosed, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected disclosed %v, got %v", want, out.Disclosed)
+	}
+}
+
+func TestHiddenOutputsProofVerifies(t *testing.T) {
+	witness := testWitnessInputs()
+	commitment, err := CommitmentPoseidon(witness)
+	if err != nil {
+		t.Fatalf("CommitmentPoseidon error: %v", err)
+	}
+	proof, err := GenerateProof(PublicInputs{
+		PolicyThreshold: 0,
+		MaxSeverity:     2,
+		OverallPass:     true,
+		Commitment:      commitment,
+		HideMaxSeverity: true,
+		Witness:         witness,
+	})
+	if err != nil {
+		t.Fatalf("GenerateProof error: %v", err)
+	}
+	ok, msg, err := VerifyProof(proof.ProofB64, proof.PublicInputsB64)
+	if err != nil || !ok {
+		t.Fatalf("expected proof with hidden max severity to verify, got ok=%v msg=%q err=%v", ok, msg, err)
+	}
+
+	// Claiming a value for a hidden output, or hiding a disclosed one, must fail.
+	for name, mutate := range map[string]func(*PublicInputs){
+		"reveal max severity": func(pi *PublicInputs) { pi.HideMaxSeverity = false },
+		"hide commitment":     func(pi *PublicInputs) { pi.HideCommitment = true },
+	} {
+		ok, _, err := VerifyProof(proof.ProofB64, tamperPublicInputs(t, proof, mutate))
+		if err != nil {
+			t.Fatalf("%s: VerifyProof error: %v", name, err)
+		}
+		if ok {
+			t.Fatalf("%s: expected verification to fail", name)
+		}
+	}
+}
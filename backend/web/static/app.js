@@ -55,12 +55,8 @@
     }, 1200);
   }
 
-  function loadRecentRuns() {
+  function renderRuns(runs) {
     try {
-      var raw = localStorage.getItem(STORAGE_KEY);
-      var runs = raw ? JSON.parse(raw) : [];
-      if (!Array.isArray(runs)) runs = [];
-      runs = runs.filter(function(r) { return r && r.run_id; });
       if (runs.length === 0) {
         listEl.innerHTML = '';
         listEl.appendChild(emptyEl);
@@ -130,6 +126,38 @@
     }
   }
 
+  function storedRuns() {
+    try {
+      var raw = localStorage.getItem(STORAGE_KEY);
+      var runs = raw ? JSON.parse(raw) : [];
+      return Array.isArray(runs) ? runs.filter(function(r) { return r && r.run_id; }) : [];
+    } catch (e) {
+      return [];
+    }
+  }
+
+  // The server lists every run it keeps; runs saved in this browser are the
+  // fallback when it can't be reached.
+  function loadRecentRuns() {
+    if (!window.fetch) {
+      renderRuns(storedRuns());
+      return;
+    }
+    fetch('/api/runs?limit=10', { credentials: 'same-origin' })
+      .then(function(res) {
+        if (!res.ok) throw new Error('HTTP ' + res.status);
+        return res.json();
+      })
+      .then(function(list) {
+        renderRuns((list.runs || []).map(function(r) {
+          return { run_id: r.run_id, status: r.status, name: r.evaluation_name, ts: r.ts * 1000 };
+        }));
+      })
+      .catch(function() {
+        renderRuns(storedRuns());
+      });
+  }
+
   document.querySelectorAll('.demo-btn').forEach(function(btn) {
     btn.addEventListener('click', function() {
       var demo = this.getAttribute('data-demo');
@@ -111,7 +111,13 @@
       })
       .then(function(resp) {
         var ok = !!resp.verified;
-        setIndicator(row, ok ? 'ok' : 'fail', ok ? 'Verified' : 'Failed');
+        var label = ok ? 'Verified' : 'Failed';
+        if (ok && resp.key_status === 'retired') label += ' (retired key)';
+        if (!ok && resp.message) label += ': ' + resp.message;
+        if (ok && resp.disclosed && Array.isArray(resp.disclosed.disclosed)) {
+          label += ' · discloses ' + resp.disclosed.disclosed.join(', ');
+        }
+        setIndicator(row, ok ? 'ok' : 'fail', label);
         if (verifyBtn) {
           verifyBtn.textContent = ok ? 'Verified' : (silent ? 'Verify' : 'Verify again');
           verifyBtn.disabled = ok;
@@ -341,5 +347,51 @@
     clearBtn.addEventListener('click', clearHistory);
   }
 
+  var bundleInput = document.getElementById('verify-bundle-file');
+  var bundleResultEl = document.getElementById('verify-bundle-result');
+
+  function verifyBundleFile() {
+    var file = bundleInput.files && bundleInput.files[0];
+    if (!file) return;
+    var form = new FormData();
+    form.append('bundle', file);
+    bundleInput.disabled = true;
+    bundleResultEl.textContent = 'Verifying ' + file.name + '…';
+
+    fetch('/api/verify/bundle', { method: 'POST', body: form })
+      .then(function(res) {
+        if (!res.ok) return res.json().then(function(j) { throw new Error(j.error || res.statusText); });
+        return res.json();
+      })
+      .then(function(resp) {
+        var parts = [resp.verified ? 'Verified' : 'Failed'];
+        if (!resp.verified && resp.message) parts[0] += ': ' + resp.message;
+        if (resp.run_id) parts.push(resp.run_id);
+        if (resp.run && resp.run.status) parts.push(resp.run.status);
+        if (resp.verified && resp.key_status === 'retired') parts.push('retired key');
+        if (resp.signed) {
+          parts.push(resp.signature_valid ? 'signed by ' + resp.issuer_key_id : 'signature not valid: ' + resp.signature_message);
+        }
+        if (resp.disclosed && Array.isArray(resp.disclosed.disclosed)) {
+          parts.push('discloses ' + resp.disclosed.disclosed.join(', '));
+        }
+        if (Array.isArray(resp.unauthenticated) && resp.unauthenticated.length) {
+          parts.push('unchecked: ' + resp.unauthenticated.join(', '));
+        }
+        bundleResultEl.textContent = parts.join(' · ');
+      })
+      .catch(function(err) {
+        bundleResultEl.textContent = 'Failed: ' + (err && err.message ? err.message : 'request failed');
+      })
+      .finally(function() {
+        bundleInput.disabled = false;
+        bundleInput.value = '';
+      });
+  }
+
+  if (bundleInput && bundleResultEl) {
+    bundleInput.addEventListener('change', verifyBundleFile);
+  }
+
   render();
 })();
@@ -352,6 +352,13 @@
       });
     });
 
+    var revealMax = document.getElementById('reveal-max-severity');
+    var revealCommitment = document.getElementById('reveal-commitment');
+    config.reveal = {
+      max_severity: !!(revealMax && revealMax.checked),
+      commitment: !!(revealCommitment && revealCommitment.checked)
+    };
+
     return config;
   }
 
@@ -463,6 +470,87 @@
     addCustomConstraintRow();
   });
 
+  var STAGE_LABELS = {
+    queued: 'Waiting for a free worker…',
+    evaluating: 'Evaluating dataset…',
+    proving: 'Generating proof…',
+    done: 'Done. Opening results…',
+    failed: 'Evaluation failed.'
+  };
+
+  function resetProgress() {
+    document.getElementById('running-stage').textContent = 'Running evaluation…';
+    document.getElementById('running-steps').innerHTML = '';
+    var output = document.getElementById('running-output');
+    output.textContent = '';
+    output.hidden = true;
+  }
+
+  function showStage(stage) {
+    document.getElementById('running-stage').textContent = STAGE_LABELS[stage] || 'Running evaluation…';
+  }
+
+  function addProgressStep(text) {
+    var li = document.createElement('li');
+    li.textContent = text;
+    document.getElementById('running-steps').appendChild(li);
+  }
+
+  // pollJob resolves with the evaluate response once the job is done.
+  function pollJob(jobId) {
+    return fetch('/api/jobs/' + encodeURIComponent(jobId), { credentials: 'same-origin' })
+      .then(function(res) {
+        if (!res.ok) return res.json().then(function(j) { throw new Error(j.error || res.statusText); });
+        return res.json();
+      })
+      .then(function(job) {
+        showStage(job.stage);
+        if (job.stage === 'done') return job.result;
+        if (job.stage === 'failed') throw new Error(job.error || 'Evaluation failed.');
+        return new Promise(function(resolve) { setTimeout(resolve, 2000); })
+          .then(function() { return pollJob(jobId); });
+      });
+  }
+
+  // followJob shows the job's progress from its event stream and resolves
+  // with the evaluate response once it is done. If the stream drops, it
+  // polls the job instead.
+  function followJob(jobId) {
+    if (!window.EventSource) return pollJob(jobId);
+    return new Promise(function(resolve, reject) {
+      var output = document.getElementById('running-output');
+      var source = new EventSource('/api/jobs/' + encodeURIComponent(jobId) + '/events');
+      var finished = false;
+      source.addEventListener('stage', function(e) {
+        showStage(JSON.parse(e.data).stage);
+      });
+      source.addEventListener('cache', function(e) {
+        addProgressStep(JSON.parse(e.data).cache === 'hit' ? 'Reused a cached evaluation' : 'Asking Gemini…');
+      });
+      source.addEventListener('gemini_chunk', function(e) {
+        output.hidden = false;
+        output.textContent += JSON.parse(e.data).text;
+        output.scrollTop = output.scrollHeight;
+      });
+      source.addEventListener('proof', function(e) {
+        addProgressStep(JSON.parse(e.data).proof === 'started' ? 'Generating the proof' : 'Proof generated and verified');
+      });
+      source.addEventListener('result', function(e) {
+        finished = true;
+        source.close();
+        var job = JSON.parse(e.data);
+        showStage(job.stage);
+        if (job.stage === 'done' && job.result) resolve(job.result);
+        else reject(new Error(job.error || 'Evaluation failed.'));
+      });
+      source.onerror = function() {
+        if (finished) return;
+        source.close();
+        pollJob(jobId).then(resolve, reject);
+      };
+    });
+  }
+
   document.getElementById('eval-form').addEventListener('submit', function(e) {
     e.preventDefault();
     var datasetFile = getDatasetFile();
@@ -489,6 +577,7 @@
     }
 
     document.getElementById('submit-error').style.display = 'none';
+    resetProgress();
     document.getElementById('running-state').style.display = 'block';
     var runBtn = document.getElementById('run-eval-btn');
     if (runBtn) runBtn.disabled = true;
@@ -499,6 +588,10 @@
     formData.append('policy_config', JSON.stringify(policyConfig));
     formData.append('dataset_id', datasetFile && datasetFile.name ? datasetFile.name : '');
     formData.append('dataset', datasetFile);
+    var merkle = document.getElementById('dataset-merkle');
+    if (merkle && merkle.checked) {
+      formData.append('dataset_digest', 'merkle_sha256');
+    }
 
     var imagesInput = document.getElementById('images-file');
     if (imagesInput && imagesInput.files && imagesInput.files.length > 0) {
@@ -507,7 +600,7 @@
       }
     }
 
-    fetch('/api/evaluate', {
+    fetch('/api/evaluate?async=1', {
       method: 'POST',
       body: formData,
       credentials: 'same-origin'
@@ -516,6 +609,10 @@
         if (!res.ok) return res.json().then(function(j) { throw new Error(j.error || res.statusText); });
         return res.json();
       })
+      .then(function(job) {
+        showStage(job.stage);
+        return followJob(job.job_id);
+      })
       .then(function(data) {
         var runId = data.run_id;
         var storageKey = 'noema_run_' + runId;